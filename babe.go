@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/mrnavastar/babe/babe"
 	"github.com/urfave/cli/v2"
@@ -10,19 +13,346 @@ import (
 func main() {
 	app := cli.App{
 		Name: "babe",
+		Flags: []cli.Flag{
+			&cli.IntFlag{Name: "workers", Usage: "maximum number of jar members processed at once", Value: babe.DefaultJarOptions.Workers},
+			&cli.BoolFlag{Name: "nested", Usage: "also process the jars nested in the jar"},
+			&cli.BoolFlag{Name: "strip-signatures", Usage: "remove the signatures of modified jars"},
+			&cli.StringFlag{Name: "keystore", Usage: "PKCS#12 keystore to sign modified jars with"},
+			&cli.StringFlag{Name: "keystore-password", Usage: "password of the keystore"},
+			&cli.StringFlag{Name: "sign-key", Usage: "PEM private key to sign modified jars with"},
+			&cli.StringFlag{Name: "sign-cert", Usage: "PEM certificate chain of the signing key"},
+		},
+		Before: func(c *cli.Context) (err error) {
+			babe.DefaultJarOptions.Workers = c.Int("workers")
+			babe.DefaultJarOptions.Nested = c.Bool("nested")
+			babe.DefaultJarOptions.StripSignatures = c.Bool("strip-signatures")
+			switch {
+			case c.String("keystore") != "":
+				babe.DefaultJarOptions.Signer, err = babe.LoadSignerPKCS12(c.String("keystore"), c.String("keystore-password"))
+			case c.String("sign-key") != "":
+				babe.DefaultJarOptions.Signer, err = babe.LoadSignerPEM(c.String("sign-key"), c.String("sign-cert"))
+			}
+			return err
+		},
 		Commands: []*cli.Command{
 			{
-				Name:  "relocate",
-				Args:  true,
+				Name: "relocate",
+				Args: true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "module-name", Usage: "new module name, so the jar no longer collides with the original"},
+					&cli.BoolFlag{Name: "keep-serial-version-uid", Usage: "declare the default serialVersionUID of serializable classes lacking one before changing them"},
+				},
+				Before: warnSigned,
+				Action: func(c *cli.Context) error {
+					relocator := &babe.Relocator{Relocations: babe.ParseRelocations(c.Args().Slice()[1:]), ModuleName: c.String("module-name")}
+					return serialVersionPipeline(c).Add(relocator).Run(c.Args().First())
+				},
+			},
+			{
+				Name: "minimize",
+				Args: true,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{Name: "keep-annotation", Usage: "keep the classes carrying an annotation, or with members carrying it"},
+					&cli.BoolFlag{Name: "keep-serial-version-uid", Usage: "declare the default serialVersionUID of serializable classes lacking one before changing them"},
+				},
+				Before: warnSigned,
+				Action: func(c *cli.Context) error {
+					minimizer := &babe.Minimizer{Keep: c.Args().Slice()[1:], KeepAnnotations: c.StringSlice("keep-annotation")}
+					return serialVersionPipeline(c).Add(minimizer).Run(c.Args().First())
+				},
+			},
+			{
+				Name:      "rename",
+				Usage:     "rename a class and update every reference to it",
+				ArgsUsage: "<jar> <from> <to>",
+				Args:      true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "strings", Usage: "also rename string constants equal to the class name, as passed to Class.forName"},
+				},
+				Before: warnSigned,
+				Action: func(c *cli.Context) error {
+					from := strings.ReplaceAll(c.Args().Get(1), ".", "/")
+					to := strings.ReplaceAll(c.Args().Get(2), ".", "/")
+					renamer := &babe.ClassRenamer{Classes: map[string]string{from: to}, Strings: c.Bool("strings")}
+					return babe.NewPipeline(renamer).Run(c.Args().First())
+				},
+			},
+			{
+				Name:      "remap",
+				Usage:     "remap a jar between the namespaces of a mapping file",
+				ArgsUsage: "<jar>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "mappings", Usage: "Tiny, SRG, TSRG, ProGuard or Enigma mappings", Required: true},
+					&cli.StringFlag{Name: "from", Usage: "namespace of the jar, defaults to the first namespace"},
+					&cli.StringFlag{Name: "to", Usage: "namespace to remap to, defaults to the second namespace"},
+					&cli.StringSliceFlag{Name: "lib", Usage: "library jar in the namespace of the jar, used to resolve inherited methods"},
+					&cli.BoolFlag{Name: "keep-serial-version-uid", Usage: "declare the default serialVersionUID of serializable classes lacking one before changing them"},
+				},
+				Before: warnSigned,
+				Action: func(c *cli.Context) error {
+					mappings, err := babe.LoadMappings(c.String("mappings"))
+					if err != nil {
+						return err
+					}
+					from, to := c.String("from"), c.String("to")
+					if from == "" {
+						from = mappings.Namespaces[0]
+					}
+					if to == "" && len(mappings.Namespaces) > 1 {
+						to = mappings.Namespaces[1]
+					}
+					remapper, err := mappings.Remapper(from, to)
+					if err != nil {
+						return err
+					}
+					hierarchy := babe.NewClassHierarchy()
+					for _, library := range c.StringSlice("lib") {
+						if err := hierarchy.AddJar(library); err != nil {
+							return err
+						}
+					}
+					jarRemapper := &babe.JarRemapper{Remapper: babe.NewHierarchyRemapper(remapper, hierarchy)}
+					return serialVersionPipeline(c).Add(hierarchy, jarRemapper).Run(c.Args().First())
+				},
+			},
+			{
+				Name:      "access",
+				Usage:     "apply Fabric access wideners and Forge access transformers",
+				ArgsUsage: "<jar> <file>...",
+				Args:      true,
+				Before:    warnSigned,
+				Action: func(c *cli.Context) error {
+					return babe.TransformAccessInJar(c.Args().First(), c.Args().Slice()[1:]...)
+				},
+			},
+			{
+				Name:      "extract-nested",
+				Usage:     "copy the jars nested in a jar into a directory",
+				ArgsUsage: "<jar> [dir]",
+				Args:      true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "remove", Usage: "remove the extracted jars from the jar"},
+				},
+				Action: func(c *cli.Context) error {
+					dir := c.Args().Get(1)
+					if dir == "" {
+						dir = "."
+					}
+					extracted, err := babe.ExtractNestedJars(c.Args().First(), dir, c.Bool("remove"))
+					for _, name := range extracted {
+						fmt.Println(name)
+					}
+					return err
+				},
+			},
+			{
+				Name:      "embed",
+				Usage:     "nest jars in a jar",
+				ArgsUsage: "<jar> <nested jar>...",
+				Args:      true,
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "path", Usage: "directory of the nested jars", Value: "META-INF/jars"},
+				},
+				Before: warnSigned,
+				Action: func(c *cli.Context) error {
+					return babe.EmbedJars(c.Args().First(), c.String("path"), c.Args().Slice()[1:]...)
+				},
+			},
+			{
+				Name:      "manifest",
+				Usage:     "print or edit the manifest of a jar",
+				ArgsUsage: "<jar> [attribute]",
+				Args:      true,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{Name: "set", Usage: "set an attribute, as name=value"},
+					&cli.StringSliceFlag{Name: "remove", Usage: "remove an attribute"},
+					&cli.StringFlag{Name: "section", Usage: "edit the section of an entry instead of the main attributes"},
+				},
+				Action: func(c *cli.Context) error {
+					if !c.IsSet("set") && !c.IsSet("remove") {
+						manifest, err := babe.ReadJarManifest(c.Args().First())
+						if err != nil {
+							return err
+						}
+						attributes := manifest.Main
+						if c.IsSet("section") {
+							section := manifest.Section(c.String("section"))
+							if section == nil {
+								return fmt.Errorf("manifest has no section %q", c.String("section"))
+							}
+							attributes = section.Attributes
+						}
+						if name := c.Args().Get(1); name != "" {
+							fmt.Println(attributes.Get(name))
+						} else if c.IsSet("section") {
+							for _, attribute := range attributes {
+								fmt.Printf("%s: %s\n", attribute.Name, attribute.Value)
+							}
+						} else {
+							os.Stdout.Write(manifest.Bytes())
+						}
+						return nil
+					}
+
+					if err := warnSigned(c); err != nil {
+						return err
+					}
+					return babe.EditJarManifest(c.Args().First(), func(manifest *babe.Manifest) error {
+						attributes := &manifest.Main
+						if c.IsSet("section") {
+							attributes = &manifest.AddSection(c.String("section")).Attributes
+						}
+						for _, attribute := range c.StringSlice("set") {
+							name, value, ok := strings.Cut(attribute, "=")
+							if !ok {
+								return fmt.Errorf("expected name=value, got %q", attribute)
+							}
+							attributes.Set(name, value)
+						}
+						for _, name := range c.StringSlice("remove") {
+							attributes.Remove(name)
+						}
+						return nil
+					})
+				},
+			},
+			{
+				Name: "polyfill",
+				Args: true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "multi-release", Usage: "keep the original classes as versioned entries of a multi-release jar"},
+				},
+				Before: warnSigned,
+				Action: func(c *cli.Context) error {
+					version, err := strconv.Atoi(c.Args().Get(1))
+					if err != nil {
+						return err
+					}
+					if c.Bool("multi-release") {
+						return babe.PolyfillJarMultiRelease(c.Args().First(), babe.JAVA_1+version-1)
+					}
+					return babe.PolyfillJar(c.Args().First(), babe.JAVA_1+version-1)
+				},
+			},
+			{
+				Name:      "modularize",
+				Usage:     "add a module descriptor to a jar, requiring the modules it references",
+				ArgsUsage: "<jar>",
+				Args:      true,
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{Name: "module-path", Aliases: []string{"p"}, Usage: "jars the module may require"},
+					&cli.StringFlag{Name: "name", Usage: "name of the module"},
+					&cli.StringFlag{Name: "version", Usage: "version of the module"},
+					&cli.StringFlag{Name: "override", Usage: "module-info.java merged into the generated descriptor"},
+				},
+				Before: warnSigned,
+				Action: func(c *cli.Context) error {
+					modularizer := &babe.Modularizer{Name: c.String("name"), Version: c.String("version")}
+					for _, jar := range c.StringSlice("module-path") {
+						module, err := babe.ReadJarModule(jar)
+						if err != nil {
+							return err
+						}
+						modularizer.ModulePath = append(modularizer.ModulePath, module)
+					}
+					if c.IsSet("override") {
+						override, err := babe.LoadModuleOverride(c.String("override"))
+						if err != nil {
+							return err
+						}
+						modularizer.Override = override
+					}
+					if err := babe.ModularizeJar(c.Args().First(), modularizer); err != nil {
+						return err
+					}
+					if len(modularizer.Unresolved) > 0 {
+						fmt.Fprintf(os.Stderr, "warning: no module found for %s\n", strings.Join(modularizer.Unresolved, ", "))
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "strip-annotations",
+				Usage:     "remove annotations, then the annotation classes no longer referenced",
+				ArgsUsage: "<jar> <pattern>...",
+				Args:      true,
+				Before:    warnSigned,
+				Action: func(c *cli.Context) error {
+					return babe.StripAnnotations(c.Args().First(), c.Args().Slice()[1:]...)
+				},
+			},
+			{
+				Name:      "strip",
+				Usage:     "remove debug information and compact the constant pools of a jar's classes",
+				ArgsUsage: "<jar>",
+				Args:      true,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "line-numbers", Usage: "remove line numbers"},
+					&cli.BoolFlag{Name: "local-variables", Usage: "remove local variable names and types"},
+					&cli.BoolFlag{Name: "source-file", Usage: "remove source file names and debug extensions"},
+					&cli.BoolFlag{Name: "parameters", Usage: "remove method parameter names"},
+					&cli.BoolFlag{Name: "generic-signatures", Usage: "remove generic signatures, which only reflection and compilers use"},
+					&cli.BoolFlag{Name: "inner-classes", Usage: "remove inner class and enclosing method metadata, which only reflection and compilers use"},
+				},
+				Before: warnSigned,
+				Action: func(c *cli.Context) error {
+					flags := 0
+					for name, flag := range map[string]int{
+						"line-numbers":       babe.StripLineNumbers,
+						"local-variables":    babe.StripLocalVariables,
+						"source-file":        babe.StripSourceFile,
+						"parameters":         babe.StripMethodParameters,
+						"generic-signatures": babe.StripGenericSignatures,
+						"inner-classes":      babe.StripInnerClasses,
+					} {
+						if c.Bool(name) {
+							flags |= flag
+						}
+					}
+					if flags == 0 {
+						flags = babe.StripDebug
+					}
+					return babe.StripJar(c.Args().First(), flags)
+				},
+			},
+			{
+				Name:      "sign",
+				Usage:     "sign a jar with the key given by --keystore or --sign-key",
+				ArgsUsage: "<jar>",
+				Args:      true,
+				Action: func(c *cli.Context) error {
+					if babe.DefaultJarOptions.Signer == nil {
+						return fmt.Errorf("no signing key, use --keystore or --sign-key and --sign-cert")
+					}
+					return babe.SignJar(c.Args().First(), babe.DefaultJarOptions.Signer)
+				},
+			},
+			{
+				Name:      "strip-signature",
+				Usage:     "remove the signature files and entry digests of a jar",
+				ArgsUsage: "<jar>",
+				Args:      true,
 				Action: func(c *cli.Context) error {
-					return babe.RelocateJar(c.Args().First(), babe.ParseRelocations(c.Args().Slice()[1:]))
+					return babe.StripJarSignature(c.Args().First())
 				},
 			},
 			{
-				Name:  "minimize",
-				Args:  true,
+				Name:      "verify-signature",
+				Usage:     "check the digests and signatures of a signed jar, without checking trust",
+				ArgsUsage: "<jar>",
+				Args:      true,
 				Action: func(c *cli.Context) error {
-					return babe.MinimizeJar(c.Args().First())
+					signatures, err := babe.VerifyJarSignature(c.Args().First())
+					for _, signature := range signatures {
+						for _, certificate := range signature.Certificates {
+							fmt.Printf("%s: %s\n", signature.Name, certificate.Subject)
+						}
+					}
+					if err != nil {
+						return err
+					}
+					fmt.Println("jar verified")
+					return nil
 				},
 			},
 		},
@@ -31,3 +361,23 @@ func main() {
 		panic(err)
 	}
 }
+
+// serialVersionPipeline starts the pipeline of a command changing classes, declaring the serialVersionUIDs they had
+// if asked to.
+func serialVersionPipeline(c *cli.Context) *babe.Pipeline {
+	if c.Bool("keep-serial-version-uid") {
+		return babe.NewPipeline(&babe.SerialVersionUIDAdder{Libraries: c.StringSlice("lib")})
+	}
+	return babe.NewPipeline()
+}
+
+// warnSigned warns that modifying a signed jar breaks its signature, unless it is stripped or the jar re-signed.
+func warnSigned(c *cli.Context) error {
+	if babe.DefaultJarOptions.StripSignatures || babe.DefaultJarOptions.Signer != nil {
+		return nil
+	}
+	if signed, _ := babe.IsSignedJar(c.Args().First()); signed {
+		fmt.Fprintf(os.Stderr, "warning: %s is signed and its signature will no longer match, use --strip-signatures or sign it again\n", c.Args().First())
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package babe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidAccessTransform = errors.New("jarhax: invalid access transform")
+
+// Access levels, from narrowest to widest. AccessKeep leaves the access level unchanged.
+const (
+	AccessKeep = iota
+	AccessPackage
+	AccessProtected
+	AccessPublic
+)
+
+// AccessChange widens the access of a class or member and changes whether it is final. Access levels are
+// only ever widened.
+type AccessChange struct {
+	Level       int
+	RemoveFinal bool
+	AddFinal    bool
+	// Access wideners make private methods final when making them accessible, so they can't be overridden by accident
+	FinalIfPrivate bool
+}
+
+func (change AccessChange) Merge(other AccessChange) AccessChange {
+	return AccessChange{
+		Level:          max(change.Level, other.Level),
+		RemoveFinal:    change.RemoveFinal || other.RemoveFinal,
+		AddFinal:       change.AddFinal || other.AddFinal,
+		FinalIfPrivate: change.FinalIfPrivate || other.FinalIfPrivate,
+	}
+}
+
+// Apply returns the changed access flags.
+func (change AccessChange) Apply(access int) int {
+	private := access&ACC_PRIVATE != 0
+	switch {
+	case change.Level == AccessPublic:
+		access = access&^(ACC_PRIVATE|ACC_PROTECTED) | ACC_PUBLIC
+	case change.Level == AccessProtected && access&ACC_PUBLIC == 0:
+		access = access&^ACC_PRIVATE | ACC_PROTECTED
+	case change.Level == AccessPackage:
+		access &^= ACC_PRIVATE
+	}
+	if change.AddFinal || change.FinalIfPrivate && private {
+		access |= ACC_FINAL
+	}
+	if change.RemoveFinal {
+		access &^= ACC_FINAL
+	}
+	return access
+}
+
+// applyClass changes the flags of a top level class, which is either public or package-private.
+func (change AccessChange) applyClass(access int) int {
+	if change.Level == AccessProtected {
+		change.Level = AccessPublic
+	}
+	return change.Apply(access)
+}
+
+// AccessTransforms holds the changes of Fabric access wideners and Forge access transformers. Classes are keyed by
+// internal name, fields by "owner.name" and methods by "owner.name" followed by the descriptor. "owner.*" matches
+// every field and "owner.*()" every method of a class. It is a class transformer applying the changes to a jar.
+type AccessTransforms struct {
+	// Namespace of the access wideners read, empty for access transformers
+	Namespace string
+	Classes   map[string]AccessChange
+	Fields    map[string]AccessChange
+	Methods   map[string]AccessChange
+}
+
+func NewAccessTransforms() *AccessTransforms {
+	return &AccessTransforms{Classes: map[string]AccessChange{}, Fields: map[string]AccessChange{}, Methods: map[string]AccessChange{}}
+}
+
+func addAccessChange(changes map[string]AccessChange, key string, change AccessChange) {
+	changes[key] = changes[key].Merge(change)
+}
+
+// LoadAccessTransforms reads and merges access widener and access transformer files.
+func LoadAccessTransforms(paths ...string) (*AccessTransforms, error) {
+	transforms := NewAccessTransforms()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		err = transforms.Read(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return transforms, nil
+}
+
+// Read adds the changes of a Fabric access widener or a Forge access transformer, detecting the format from the first line.
+func (transforms *AccessTransforms) Read(r io.Reader) error {
+	reader := bufio.NewReader(r)
+	first, err := reader.Peek(len("accessWidener"))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if string(first) == "accessWidener" {
+		return transforms.readAccessWidener(reader)
+	}
+	return transforms.readAccessTransformer(reader)
+}
+
+// accessLines calls iter with the whitespace separated words of every line, leaving out comments.
+func accessLines(reader io.Reader, iter func(number int, words []string) error) error {
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if words := strings.Fields(line); len(words) > 0 {
+			if err := iter(number, words); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func invalidAccessTransform(number int, words []string) error {
+	return fmt.Errorf("%w: line %d: %q", ErrInvalidAccessTransform, number, strings.Join(words, " "))
+}
+
+func (transforms *AccessTransforms) readAccessWidener(reader io.Reader) error {
+	return accessLines(reader, func(number int, words []string) error {
+		if words[0] == "accessWidener" {
+			if len(words) != 3 || words[1] != "v1" && words[1] != "v2" {
+				return invalidAccessTransform(number, words)
+			}
+			transforms.Namespace = words[2]
+			return nil
+		}
+
+		access := strings.TrimPrefix(words[0], "transitive-")
+		switch {
+		case len(words) == 3 && words[1] == "class":
+			switch access {
+			case "accessible":
+				addAccessChange(transforms.Classes, words[2], AccessChange{Level: AccessPublic})
+			case "extendable":
+				addAccessChange(transforms.Classes, words[2], AccessChange{Level: AccessPublic, RemoveFinal: true})
+			default:
+				return invalidAccessTransform(number, words)
+			}
+		case len(words) == 5 && words[1] == "method":
+			key := words[2] + "." + words[3] + words[4]
+			switch access {
+			case "accessible":
+				addAccessChange(transforms.Methods, key, AccessChange{Level: AccessPublic, FinalIfPrivate: words[3] != "<init>"})
+				addAccessChange(transforms.Classes, words[2], AccessChange{Level: AccessPublic})
+			case "extendable":
+				addAccessChange(transforms.Methods, key, AccessChange{Level: AccessProtected, RemoveFinal: true})
+				addAccessChange(transforms.Classes, words[2], AccessChange{Level: AccessPublic, RemoveFinal: true})
+			default:
+				return invalidAccessTransform(number, words)
+			}
+		case len(words) == 5 && words[1] == "field":
+			key := words[2] + "." + words[3]
+			switch access {
+			case "accessible":
+				addAccessChange(transforms.Fields, key, AccessChange{Level: AccessPublic})
+				addAccessChange(transforms.Classes, words[2], AccessChange{Level: AccessPublic})
+			case "mutable":
+				addAccessChange(transforms.Fields, key, AccessChange{RemoveFinal: true})
+			default:
+				return invalidAccessTransform(number, words)
+			}
+		default:
+			return invalidAccessTransform(number, words)
+		}
+		return nil
+	})
+}
+
+var accessTransformerLevels = map[string]int{"public": AccessPublic, "protected": AccessProtected, "default": AccessPackage, "private": AccessKeep}
+
+func (transforms *AccessTransforms) readAccessTransformer(reader io.Reader) error {
+	return accessLines(reader, func(number int, words []string) error {
+		if len(words) != 2 && len(words) != 3 {
+			return invalidAccessTransform(number, words)
+		}
+		var change AccessChange
+		modifier, final := words[0], ""
+		if i := strings.IndexAny(modifier, "-+"); i >= 0 {
+			modifier, final = modifier[:i], modifier[i:]
+		}
+		level, ok := accessTransformerLevels[modifier]
+		if !ok || final != "" && final != "-f" && final != "+f" {
+			return invalidAccessTransform(number, words)
+		}
+		change.Level, change.RemoveFinal, change.AddFinal = level, final == "-f", final == "+f"
+
+		owner := strings.ReplaceAll(words[1], ".", "/")
+		switch {
+		case len(words) == 2:
+			addAccessChange(transforms.Classes, owner, change)
+		case strings.Contains(words[2], "("):
+			addAccessChange(transforms.Methods, owner+"."+words[2], change)
+		default:
+			addAccessChange(transforms.Fields, owner+"."+words[2], change)
+		}
+		return nil
+	})
+}
+
+// member returns the change of a field or method, merged with the wildcard change of its class.
+func (transforms *AccessTransforms) member(changes map[string]AccessChange, owner string, key string, wildcard string) (AccessChange, bool) {
+	change, ok := changes[owner+"."+key]
+	all, allOk := changes[owner+"."+wildcard]
+	return change.Merge(all), ok || allOk
+}
+
+func (transforms *AccessTransforms) TransformClass(member *JarMember, class *Class) (bool, error) {
+	name := class.GetClassName()
+	changed := false
+	set := func(flags *uint16, access int) {
+		if uint16(access) != *flags {
+			*flags = uint16(access)
+			changed = true
+		}
+	}
+
+	if change, ok := transforms.Classes[name]; ok {
+		set(&class.AccessFlags, change.applyClass(int(class.AccessFlags)))
+	}
+	if transforms.innerClasses(class) {
+		changed = true
+	}
+	for i := range class.Fields {
+		field := &class.Fields[i]
+		if change, ok := transforms.member(transforms.Fields, name, field.GetName(), "*"); ok {
+			set(&field.AccessFlags, change.Apply(int(field.AccessFlags)))
+		}
+	}
+
+	// Calls to private methods that are no longer private have to be dispatched virtually
+	widened := map[string]bool{}
+	for i := range class.Methods {
+		method := &class.Methods[i]
+		key := method.GetName() + method.GetDescriptor()
+		if change, ok := transforms.member(transforms.Methods, name, key, "*()"); ok && key != "<clinit>()V" {
+			private := method.HasModifier(ACC_PRIVATE)
+			set(&method.AccessFlags, change.Apply(int(method.AccessFlags)))
+			if private && !method.HasModifier(ACC_PRIVATE) && !method.HasModifier(ACC_STATIC) && key[0] != '<' {
+				widened[key] = true
+			}
+		}
+	}
+	if len(widened) > 0 && !class.HasModifier(ACC_INTERFACE) {
+		invokeVirtual(class, widened)
+	}
+	return changed, nil
+}
+
+// innerClasses applies the class changes to the entries of the InnerClasses attribute.
+func (transforms *AccessTransforms) innerClasses(class *Class) bool {
+	attribute := class.FindAttribute(class.Attributes, "InnerClasses")
+	if attribute == nil || len(transforms.Classes) == 0 {
+		return false
+	}
+	data := slices.Clone(attribute.Data)
+	changed := false
+	for i, count := 2, u16(data, 0); count > 0; i, count = i+8, count-1 {
+		if change, ok := transforms.Classes[class.GetClassInfoName(uint16(u16(data, i)))]; ok {
+			access := uint16(change.Apply(u16(data, i+6)))
+			if access != uint16(u16(data, i+6)) {
+				binary.BigEndian.PutUint16(data[i+6:], access)
+				changed = true
+			}
+		}
+	}
+	attribute.Data = data
+	return changed
+}
+
+// invokeVirtual replaces the invokespecial instructions calling the given methods of the class itself.
+func invokeVirtual(class *Class, methods map[string]bool) {
+	owner := class.GetClassName()
+	for i := range class.Methods {
+		code := class.Methods[i].GetCode()
+		if code == nil {
+			continue
+		}
+		code.Code = slices.Clone(code.Code)
+		changed := false
+		ForInstruction(code.Code, func(offset int, opcode byte) error {
+			if opcode == INVOKESPECIAL {
+				refOwner, name, descriptor := class.GetRef(binary.BigEndian.Uint16(code.Code[offset+1:]))
+				if refOwner == owner && methods[name+descriptor] {
+					code.Code[offset] = INVOKEVIRTUAL
+					changed = true
+				}
+			}
+			return nil
+		})
+		if changed {
+			class.Methods[i].SetCode(code)
+		}
+	}
+}
+
+// TransformAccessInJar applies access widener and access transformer files to a jar.
+func TransformAccessInJar(filename string, paths ...string) error {
+	transforms, err := LoadAccessTransforms(paths...)
+	if err != nil {
+		return err
+	}
+	return NewPipeline(transforms).Run(filename)
+}
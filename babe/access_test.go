@@ -0,0 +1,299 @@
+package babe
+
+import (
+	"encoding/binary"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestAccessChangeApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		change AccessChange
+		access int
+		want   int
+	}{
+		{"public from private", AccessChange{Level: AccessPublic}, ACC_PRIVATE | ACC_STATIC, ACC_PUBLIC | ACC_STATIC},
+		{"public from protected", AccessChange{Level: AccessPublic}, ACC_PROTECTED, ACC_PUBLIC},
+		{"protected from private", AccessChange{Level: AccessProtected}, ACC_PRIVATE, ACC_PROTECTED},
+		{"protected from package", AccessChange{Level: AccessProtected}, 0, ACC_PROTECTED},
+		{"protected keeps public", AccessChange{Level: AccessProtected}, ACC_PUBLIC, ACC_PUBLIC},
+		{"package from private", AccessChange{Level: AccessPackage}, ACC_PRIVATE | ACC_FINAL, ACC_FINAL},
+		{"package keeps protected", AccessChange{Level: AccessPackage}, ACC_PROTECTED, ACC_PROTECTED},
+		{"keep", AccessChange{}, ACC_PRIVATE, ACC_PRIVATE},
+		{"remove final", AccessChange{RemoveFinal: true}, ACC_PUBLIC | ACC_FINAL, ACC_PUBLIC},
+		{"add final", AccessChange{AddFinal: true}, ACC_PUBLIC, ACC_PUBLIC | ACC_FINAL},
+		{"final if private", AccessChange{Level: AccessPublic, FinalIfPrivate: true}, ACC_PRIVATE, ACC_PUBLIC | ACC_FINAL},
+		{"not final if not private", AccessChange{Level: AccessPublic, FinalIfPrivate: true}, ACC_PROTECTED, ACC_PUBLIC},
+		{"removing final wins", AccessChange{AddFinal: true, RemoveFinal: true}, ACC_FINAL, 0},
+	}
+	for _, test := range tests {
+		if access := test.change.Apply(test.access); access != test.want {
+			t.Errorf("%s: Apply(%#x) = %#x, want %#x", test.name, test.access, access, test.want)
+		}
+	}
+	if access := (AccessChange{Level: AccessProtected}).applyClass(0); access != ACC_PUBLIC {
+		t.Errorf("protected top level class access = %#x, want public", access)
+	}
+}
+
+func TestAccessChangeMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b AccessChange
+		want AccessChange
+	}{
+		{"widest level", AccessChange{Level: AccessPackage}, AccessChange{Level: AccessProtected}, AccessChange{Level: AccessProtected}},
+		{"keep", AccessChange{}, AccessChange{Level: AccessPublic}, AccessChange{Level: AccessPublic}},
+		{"final flags", AccessChange{RemoveFinal: true}, AccessChange{AddFinal: true, FinalIfPrivate: true}, AccessChange{RemoveFinal: true, AddFinal: true, FinalIfPrivate: true}},
+	}
+	for _, test := range tests {
+		if merged := test.a.Merge(test.b); merged != test.want {
+			t.Errorf("%s: Merge = %+v, want %+v", test.name, merged, test.want)
+		}
+		if merged := test.b.Merge(test.a); merged != test.want {
+			t.Errorf("%s: reversed Merge = %+v, want %+v", test.name, merged, test.want)
+		}
+	}
+}
+
+func TestReadAccessTransforms(t *testing.T) {
+	public, extendable := AccessChange{Level: AccessPublic}, AccessChange{Level: AccessPublic, RemoveFinal: true}
+	tests := []struct {
+		name      string
+		file      string
+		namespace string
+		classes   map[string]AccessChange
+		fields    map[string]AccessChange
+		methods   map[string]AccessChange
+	}{
+		{
+			"access widener",
+			"accessWidener v2 named\n# comment\n\naccessible class a/A\nextendable class a/B # trailing\n" +
+				"accessible field a/A f I\nmutable field a/A g Ljava/lang/String;\n" +
+				"accessible method a/A m (I)V\naccessible method a/A <init> ()V\nextendable method a/C n ()V\n" +
+				"transitive-accessible class a/D\n",
+			"named",
+			map[string]AccessChange{"a/A": public, "a/B": extendable, "a/C": extendable, "a/D": public},
+			map[string]AccessChange{"a/A.f": public, "a/A.g": {RemoveFinal: true}},
+			map[string]AccessChange{"a/A.m(I)V": {Level: AccessPublic, FinalIfPrivate: true}, "a/A.<init>()V": public, "a/C.n()V": {Level: AccessProtected, RemoveFinal: true}},
+		},
+		{
+			"access widener v1",
+			"accessWidener\tv1\tintermediary\naccessible\tclass\ta/A\n",
+			"intermediary",
+			map[string]AccessChange{"a/A": public},
+			map[string]AccessChange{},
+			map[string]AccessChange{},
+		},
+		{
+			"access transformer",
+			"# comment\npublic a.A\npublic-f a.B\nprotected a.A f # field\ndefault a.A$Inner g\n" +
+				"public a.A m(I)V\nprivate-f a.A h\nprotected+f a.A n()V\npublic a.C *\npublic-f a.C *()\n",
+			"",
+			map[string]AccessChange{"a/A": public, "a/B": extendable},
+			map[string]AccessChange{"a/A.f": {Level: AccessProtected}, "a/A$Inner.g": {Level: AccessPackage}, "a/A.h": {RemoveFinal: true}, "a/C.*": public},
+			map[string]AccessChange{"a/A.m(I)V": public, "a/A.n()V": {Level: AccessProtected, AddFinal: true}, "a/C.*()": extendable},
+		},
+		{
+			"merged lines",
+			"protected a.A f\npublic-f a.A f\nprivate+f a.A f\n",
+			"",
+			map[string]AccessChange{},
+			map[string]AccessChange{"a/A.f": {Level: AccessPublic, RemoveFinal: true, AddFinal: true}},
+			map[string]AccessChange{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transforms := NewAccessTransforms()
+			if err := transforms.Read(strings.NewReader(test.file)); err != nil {
+				t.Fatal(err)
+			}
+			if transforms.Namespace != test.namespace {
+				t.Errorf("namespace = %q, want %q", transforms.Namespace, test.namespace)
+			}
+			if !maps.Equal(transforms.Classes, test.classes) {
+				t.Errorf("classes = %v, want %v", transforms.Classes, test.classes)
+			}
+			if !maps.Equal(transforms.Fields, test.fields) {
+				t.Errorf("fields = %v, want %v", transforms.Fields, test.fields)
+			}
+			if !maps.Equal(transforms.Methods, test.methods) {
+				t.Errorf("methods = %v, want %v", transforms.Methods, test.methods)
+			}
+		})
+	}
+}
+
+func TestReadAccessTransformsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"widener version":          "accessWidener v3 named\n",
+		"widener header":           "accessWidener v2\n",
+		"widener access":           "accessWidener v2 named\nvisible class a/A\n",
+		"mutable class":            "accessWidener v2 named\nmutable class a/A\n",
+		"mutable method":           "accessWidener v2 named\nmutable method a/A m ()V\n",
+		"extendable field":         "accessWidener v2 named\nextendable field a/A f I\n",
+		"field without descriptor": "accessWidener v2 named\naccessible field a/A f\n",
+		"unknown kind":             "accessWidener v2 named\naccessible package a\n",
+		"transitive of nothing":    "accessWidener v2 named\ntransitive-class a/A\n",
+		"transformer level":        "publik a.A\n",
+		"transformer final":        "public-x a.A\n",
+		"transformer finals":       "public-f+f a.A\n",
+		"transformer words":        "public a.A f g\n",
+		"transformer alone":        "public\n",
+	}
+	for name, file := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := NewAccessTransforms().Read(strings.NewReader(file))
+			if !errors.Is(err, ErrInvalidAccessTransform) {
+				t.Fatalf("Read error = %v, want ErrInvalidAccessTransform", err)
+			}
+			if !strings.Contains(err.Error(), "line ") {
+				t.Errorf("error %q doesn't name the line", err)
+			}
+		})
+	}
+}
+
+// invokeOpcodes returns the opcode of the invoke instruction calling each method of a class from the given method.
+func invokeOpcodes(t *testing.T, class *Class, method string) map[string]byte {
+	t.Helper()
+	opcodes := map[string]byte{}
+	code := class.FindMethod(method, "()V").GetCode().Code
+	ForInstruction(code, func(offset int, opcode byte) error {
+		if opcode == INVOKESPECIAL || opcode == INVOKEVIRTUAL || opcode == INVOKEINTERFACE {
+			owner, name, descriptor := class.GetRef(binary.BigEndian.Uint16(code[offset+1:]))
+			opcodes[owner+"."+name+descriptor] = opcode
+		}
+		return nil
+	})
+	return opcodes
+}
+
+func TestAccessTransformsClass(t *testing.T) {
+	transforms := NewAccessTransforms()
+	err := transforms.Read(strings.NewReader("accessWidener v2 named\n" +
+		"accessible method a/A helper ()V\naccessible method a/A <init> ()V\naccessible method a/A util ()V\n" +
+		"extendable method a/A other ()V\naccessible method a/I helper ()V\n" +
+		"mutable field a/A value I\naccessible class a/A$Inner\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	class, err := NewClassBuilder("a/A").Extends("a/Base").
+		InnerClass("a/A$Inner", "a/A", "Inner", ACC_PRIVATE|ACC_STATIC).
+		Field(ACC_PRIVATE|ACC_FINAL, "value", "I", nil).
+		Method(ACC_PRIVATE, "<init>", "()V", func(code *CodeBuilder) {
+			code.VisitVarInsn(ALOAD, 0)
+			code.InvokeSpecial("a/Base", "<init>", "()V")
+			code.Return()
+		}).
+		Method(ACC_PRIVATE, "helper", "()V", emptyBody).
+		Method(ACC_PRIVATE|ACC_STATIC, "util", "()V", emptyBody).
+		Method(ACC_PRIVATE, "other", "()V", emptyBody).
+		Method(ACC_PUBLIC, "run", "()V", func(code *CodeBuilder) {
+			code.VisitVarInsn(ALOAD, 0)
+			code.InvokeSpecial("a/A", "helper", "()V")
+			code.VisitVarInsn(ALOAD, 0)
+			code.InvokeSpecial("a/A", "other", "()V")
+			code.VisitVarInsn(ALOAD, 0)
+			code.InvokeSpecial("a/Base", "helper", "()V")
+			code.InvokeStatic("a/A", "util", "()V")
+			code.Return()
+		}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := transforms.TransformClass(nil, class)
+	if err != nil || !changed {
+		t.Fatalf("TransformClass = %v, %v", changed, err)
+	}
+	read := &Class{}
+	if err := read.Read(classBytes(class)); err != nil {
+		t.Fatal(err)
+	}
+
+	access := map[string]int{
+		"<init>": ACC_PUBLIC,
+		"helper": ACC_PUBLIC | ACC_FINAL,
+		"util":   ACC_PUBLIC | ACC_STATIC | ACC_FINAL,
+		"other":  ACC_PROTECTED,
+		"run":    ACC_PUBLIC,
+	}
+	for _, method := range read.Methods {
+		if int(method.AccessFlags) != access[method.GetName()] {
+			t.Errorf("%s access = %#x, want %#x", method.GetName(), method.AccessFlags, access[method.GetName()])
+		}
+	}
+	if field := read.FindField("value", "I"); field.AccessFlags != ACC_PRIVATE {
+		t.Errorf("value access = %#x, want private", field.AccessFlags)
+	}
+	if inner := innerClasses(read); len(inner) != 1 || u16(read.FindAttribute(read.Attributes, "InnerClasses").Data, 8) != ACC_PUBLIC|ACC_STATIC {
+		t.Errorf("inner class access not widened: %v", inner)
+	}
+
+	opcodes := invokeOpcodes(t, read, "run")
+	want := map[string]byte{"a/A.helper()V": INVOKEVIRTUAL, "a/A.other()V": INVOKEVIRTUAL, "a/Base.helper()V": INVOKESPECIAL}
+	if !maps.Equal(opcodes, want) {
+		t.Errorf("invokes = %v, want %v", opcodes, want)
+	}
+	if opcodes := invokeOpcodes(t, read, "<init>"); opcodes["a/Base.<init>()V"] != INVOKESPECIAL {
+		t.Errorf("constructor invokes = %v", opcodes)
+	}
+}
+
+func TestAccessTransformsInterface(t *testing.T) {
+	transforms := NewAccessTransforms()
+	if err := transforms.Read(strings.NewReader("public a.I helper()V\n")); err != nil {
+		t.Fatal(err)
+	}
+	class, err := NewClassBuilder("a/I").Version(JAVA_11).Access(ACC_PUBLIC|ACC_INTERFACE|ACC_ABSTRACT).
+		Method(ACC_PRIVATE, "helper", "()V", emptyBody).
+		Method(ACC_PUBLIC, "run", "()V", func(code *CodeBuilder) {
+			code.VisitVarInsn(ALOAD, 0)
+			code.VisitMethodInsn(INVOKESPECIAL, "a/I", "helper", "()V", true)
+			code.Return()
+		}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transforms.TransformClass(nil, class); err != nil {
+		t.Fatal(err)
+	}
+	if method := class.FindMethod("helper", "()V"); method.AccessFlags != ACC_PUBLIC {
+		t.Errorf("helper access = %#x, want public", method.AccessFlags)
+	}
+	if opcodes := invokeOpcodes(t, class, "run"); opcodes["a/I.helper()V"] != INVOKESPECIAL {
+		t.Errorf("invokes of the interface = %v, want invokespecial", opcodes)
+	}
+}
+
+func TestAccessTransformsWildcards(t *testing.T) {
+	transforms := NewAccessTransforms()
+	if err := transforms.Read(strings.NewReader("public-f a.A *\nprotected a.A *()\npublic a.A m()V\n")); err != nil {
+		t.Fatal(err)
+	}
+	class, err := NewClassBuilder("a/A").
+		Field(ACC_PRIVATE|ACC_FINAL, "f", "I", nil).
+		Field(ACC_FINAL, "g", "J", nil).
+		Method(ACC_PRIVATE, "m", "()V", emptyBody).
+		Method(ACC_PRIVATE, "n", "(I)V", emptyBody).
+		Method(ACC_STATIC, "<clinit>", "()V", emptyBody).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transforms.TransformClass(nil, class)
+	for _, field := range class.Fields {
+		if field.AccessFlags != ACC_PUBLIC {
+			t.Errorf("field %s access = %#x, want public", field.GetName(), field.AccessFlags)
+		}
+	}
+	access := map[string]uint16{"m": ACC_PUBLIC, "n": ACC_PROTECTED, "<clinit>": ACC_STATIC}
+	for _, method := range class.Methods {
+		if method.AccessFlags != access[method.GetName()] {
+			t.Errorf("method %s access = %#x, want %#x", method.GetName(), method.AccessFlags, access[method.GetName()])
+		}
+	}
+}
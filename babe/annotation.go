@@ -0,0 +1,484 @@
+package babe
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mrnavastar/assist/bytes"
+)
+
+// Annotation is a decoded annotation. Element values follow the conventions of AnnotationVisitor, with EnumValue for
+// enum constants, *Annotation for nested annotations and []any for arrays.
+type Annotation struct {
+	Descriptor string
+	// Visible is set for annotations retained at runtime, and unused for nested annotations
+	Visible  bool
+	Elements []AnnotationElement
+}
+
+type AnnotationElement struct {
+	Name  string
+	Value any
+}
+
+// EnumValue is an enum constant given to an annotation element.
+type EnumValue struct {
+	Descriptor string
+	Name       string
+}
+
+// TypeAnnotation is an annotation on a use of a type. Target holds the target_info of TargetType, which refers to
+// code offsets and local variables rather than constants.
+type TypeAnnotation struct {
+	TargetType byte
+	Target     []byte
+	Path       []TypePathStep
+	Annotation
+}
+
+type TypePathStep struct {
+	Kind     byte
+	Argument byte
+}
+
+// Get returns the value of an element, or nil if it isn't set.
+func (annotation *Annotation) Get(name string) any {
+	for _, element := range annotation.Elements {
+		if element.Name == name {
+			return element.Value
+		}
+	}
+	return nil
+}
+
+// Set replaces the value of an element, adding it if it isn't set.
+func (annotation *Annotation) Set(name string, value any) {
+	for i := range annotation.Elements {
+		if annotation.Elements[i].Name == name {
+			annotation.Elements[i].Value = value
+			return
+		}
+	}
+	annotation.Elements = append(annotation.Elements, AnnotationElement{name, value})
+}
+
+// Accept makes the visitor visit the elements of the annotation.
+func (annotation *Annotation) Accept(visitor AnnotationVisitor) {
+	for _, element := range annotation.Elements {
+		acceptElementValue(visitor, element.Name, element.Value)
+	}
+	visitor.VisitEnd()
+}
+
+func acceptElementValue(visitor AnnotationVisitor, name string, value any) {
+	switch v := value.(type) {
+	case EnumValue:
+		visitor.VisitEnum(name, v.Descriptor, v.Name)
+	case *Annotation:
+		v.Accept(visitor.VisitAnnotation(name, v.Descriptor))
+	case []any:
+		array := visitor.VisitArray(name)
+		for _, value := range v {
+			acceptElementValue(array, "", value)
+		}
+		array.VisitEnd()
+	default:
+		visitor.Visit(name, value)
+	}
+}
+
+// annotationBuilder collects the elements of an annotation, or the values of an array, visited by a ClassReader.
+type annotationBuilder struct {
+	annotation *Annotation
+	values     []any
+	// end adds a finished array to its parent
+	end func(values []any)
+}
+
+func (builder *annotationBuilder) Visit(name string, value any) {
+	if builder.annotation == nil {
+		builder.values = append(builder.values, value)
+	} else {
+		builder.annotation.Elements = append(builder.annotation.Elements, AnnotationElement{name, value})
+	}
+}
+
+func (builder *annotationBuilder) VisitEnum(name string, descriptor string, value string) {
+	builder.Visit(name, EnumValue{descriptor, value})
+}
+
+func (builder *annotationBuilder) VisitAnnotation(name string, descriptor string) AnnotationVisitor {
+	nested := &Annotation{Descriptor: descriptor}
+	builder.Visit(name, nested)
+	return &annotationBuilder{annotation: nested}
+}
+
+func (builder *annotationBuilder) VisitArray(name string) AnnotationVisitor {
+	return &annotationBuilder{values: []any{}, end: func(values []any) { builder.Visit(name, values) }}
+}
+
+func (builder *annotationBuilder) VisitEnd() {
+	if builder.end != nil {
+		builder.end(builder.values)
+	}
+}
+
+// annotationDescriptor returns the descriptor of an annotation type given as a descriptor, or as an internal or
+// binary name.
+func annotationDescriptor(name string) string {
+	if strings.HasPrefix(name, "L") && strings.HasSuffix(name, ";") {
+		return name
+	}
+	return "L" + strings.ReplaceAll(name, ".", "/") + ";"
+}
+
+// FindAnnotation returns the annotation of a type, given as a descriptor or a class name, or nil.
+func FindAnnotation(annotations []*Annotation, name string) *Annotation {
+	descriptor := annotationDescriptor(name)
+	for _, annotation := range annotations {
+		if annotation.Descriptor == descriptor {
+			return annotation
+		}
+	}
+	return nil
+}
+
+// AddAnnotation adds an annotation, replacing any of the same type.
+func AddAnnotation(annotations []*Annotation, annotation *Annotation) []*Annotation {
+	for i := range annotations {
+		if annotations[i].Descriptor == annotation.Descriptor {
+			annotations[i] = annotation
+			return annotations
+		}
+	}
+	return append(annotations, annotation)
+}
+
+// RemoveAnnotations removes the annotations of the given types and reports whether any were found.
+func RemoveAnnotations(annotations []*Annotation, names ...string) ([]*Annotation, bool) {
+	descriptors := make([]string, len(names))
+	for i, name := range names {
+		descriptors[i] = annotationDescriptor(name)
+	}
+	count := len(annotations)
+	annotations = slices.DeleteFunc(annotations, func(annotation *Annotation) bool {
+		return slices.Contains(descriptors, annotation.Descriptor)
+	})
+	return annotations, len(annotations) != count
+}
+
+func annotationAttributeName(kind string, visible bool) string {
+	if visible {
+		return "RuntimeVisible" + kind
+	}
+	return "RuntimeInvisible" + kind
+}
+
+// readAnnotationList decodes a num_annotations followed by its annotations.
+func (class *Class) readAnnotationList(buf *bytes.Buffer, visible bool) []*Annotation {
+	reader := &ClassReader{Class: class}
+	annotations := make([]*Annotation, buf.ReadU16())
+	for i := range annotations {
+		annotations[i] = &Annotation{Descriptor: class.GetUtf8(buf.ReadU16()), Visible: visible}
+		reader.readAnnotation(buf, &annotationBuilder{annotation: annotations[i]})
+	}
+	return annotations
+}
+
+func (class *Class) writeAnnotation(buf *bytes.Buffer, annotation *Annotation) {
+	buf.WriteU16(class.AddUtf8(annotation.Descriptor))
+	writer := newAnnotationWriter(class, buf, true)
+	writer.reserveCount()
+	annotation.Accept(writer)
+}
+
+func (class *Class) writeAnnotationList(buf *bytes.Buffer, annotations []*Annotation) {
+	buf.WriteU16(uint16(len(annotations)))
+	for _, annotation := range annotations {
+		class.writeAnnotation(buf, annotation)
+	}
+}
+
+func (class *Class) readAnnotations(attributes []AttributeInfo) []*Annotation {
+	var annotations []*Annotation
+	for _, visible := range []bool{true, false} {
+		if attribute := class.FindAttribute(attributes, annotationAttributeName("Annotations", visible)); attribute != nil {
+			annotations = append(annotations, class.readAnnotationList(&bytes.Buffer{Data: &attribute.Data, Index: 0}, visible)...)
+		}
+	}
+	return annotations
+}
+
+func (class *Class) writeAnnotations(attributes []AttributeInfo, annotations []*Annotation) []AttributeInfo {
+	for _, visible := range []bool{true, false} {
+		name := annotationAttributeName("Annotations", visible)
+		var retained []*Annotation
+		for _, annotation := range annotations {
+			if annotation.Visible == visible {
+				retained = append(retained, annotation)
+			}
+		}
+		if len(retained) == 0 {
+			attributes = class.RemoveAttribute(attributes, name)
+			continue
+		}
+		data := []byte{}
+		class.writeAnnotationList(&bytes.Buffer{Data: &data, Index: 0}, retained)
+		attributes = class.SetAttribute(attributes, name, data)
+	}
+	return attributes
+}
+
+// typeAnnotationPath returns the offset of the type_path of a type_annotation starting at data[i:].
+func typeAnnotationPath(data []byte, i int) int {
+	switch target := data[i]; {
+	case target == 0x00 || target == 0x01 || target == 0x16:
+		return i + 2
+	case target >= 0x13 && target <= 0x15:
+		return i + 1
+	case target == 0x40 || target == 0x41:
+		return i + 3 + 6*u16(data, i+1)
+	case target >= 0x47 && target <= 0x4b:
+		return i + 4
+	}
+	return i + 3
+}
+
+func (class *Class) readTypeAnnotations(attributes []AttributeInfo) []*TypeAnnotation {
+	var annotations []*TypeAnnotation
+	for _, visible := range []bool{true, false} {
+		attribute := class.FindAttribute(attributes, annotationAttributeName("TypeAnnotations", visible))
+		if attribute == nil {
+			continue
+		}
+		reader := &ClassReader{Class: class}
+		data := attribute.Data
+		buf := &bytes.Buffer{Data: &data, Index: 0}
+		for count := buf.ReadU16(); count > 0; count-- {
+			path := typeAnnotationPath(data, buf.Index)
+			annotation := &TypeAnnotation{TargetType: data[buf.Index], Target: slices.Clone(data[buf.Index+1 : path])}
+			for step := 0; step < int(data[path]); step++ {
+				annotation.Path = append(annotation.Path, TypePathStep{data[path+1+2*step], data[path+2+2*step]})
+			}
+			buf.Index = path + 1 + 2*len(annotation.Path)
+			annotation.Descriptor, annotation.Visible = class.GetUtf8(buf.ReadU16()), visible
+			reader.readAnnotation(buf, &annotationBuilder{annotation: &annotation.Annotation})
+			annotations = append(annotations, annotation)
+		}
+	}
+	return annotations
+}
+
+func (class *Class) writeTypeAnnotations(attributes []AttributeInfo, annotations []*TypeAnnotation) []AttributeInfo {
+	for _, visible := range []bool{true, false} {
+		name := annotationAttributeName("TypeAnnotations", visible)
+		data := []byte{0, 0}
+		buf := &bytes.Buffer{Data: &data, Index: 0}
+		count := 0
+		for _, annotation := range annotations {
+			if annotation.Visible != visible {
+				continue
+			}
+			buf.WriteByte(annotation.TargetType)
+			buf.Write(annotation.Target)
+			buf.WriteByte(byte(len(annotation.Path)))
+			for _, step := range annotation.Path {
+				buf.WriteByte(step.Kind)
+				buf.WriteByte(step.Argument)
+			}
+			class.writeAnnotation(buf, &annotation.Annotation)
+			count++
+		}
+		if count == 0 {
+			attributes = class.RemoveAttribute(attributes, name)
+			continue
+		}
+		data[0], data[1] = byte(count>>8), byte(count)
+		attributes = class.SetAttribute(attributes, name, data)
+	}
+	return attributes
+}
+
+// GetAnnotations decodes the annotations of the class, visible ones first.
+func (class *Class) GetAnnotations() []*Annotation {
+	return class.readAnnotations(class.Attributes)
+}
+
+// SetAnnotations replaces the annotations of the class.
+func (class *Class) SetAnnotations(annotations []*Annotation) {
+	class.Attributes = class.writeAnnotations(class.Attributes, annotations)
+	class.AttributesCount = uint16(len(class.Attributes))
+}
+
+// HasAnnotation reports whether the class is annotated with a type, given as a descriptor or a class name.
+func (class *Class) HasAnnotation(name string) bool {
+	return FindAnnotation(class.GetAnnotations(), name) != nil
+}
+
+// GetTypeAnnotations decodes the type annotations on the declaration of the class. Those in code are left to the Code
+// attribute.
+func (class *Class) GetTypeAnnotations() []*TypeAnnotation {
+	return class.readTypeAnnotations(class.Attributes)
+}
+
+func (class *Class) SetTypeAnnotations(annotations []*TypeAnnotation) {
+	class.Attributes = class.writeTypeAnnotations(class.Attributes, annotations)
+	class.AttributesCount = uint16(len(class.Attributes))
+}
+
+// GetAnnotations decodes the annotations of the field or method, visible ones first.
+func (info *FieldInfo) GetAnnotations() []*Annotation {
+	return info.class.readAnnotations(info.Attributes)
+}
+
+// SetAnnotations replaces the annotations of the field or method.
+func (info *FieldInfo) SetAnnotations(annotations []*Annotation) {
+	info.Attributes = info.class.writeAnnotations(info.Attributes, annotations)
+	info.AttributesCount = uint16(len(info.Attributes))
+}
+
+// HasAnnotation reports whether the field or method is annotated with a type, given as a descriptor or a class name.
+func (info *FieldInfo) HasAnnotation(name string) bool {
+	return FindAnnotation(info.GetAnnotations(), name) != nil
+}
+
+func (info *FieldInfo) GetTypeAnnotations() []*TypeAnnotation {
+	return info.class.readTypeAnnotations(info.Attributes)
+}
+
+func (info *FieldInfo) SetTypeAnnotations(annotations []*TypeAnnotation) {
+	info.Attributes = info.class.writeTypeAnnotations(info.Attributes, annotations)
+	info.AttributesCount = uint16(len(info.Attributes))
+}
+
+// GetParameterAnnotations decodes the annotations of each parameter of the method. Compilers may leave out synthetic
+// parameters, so the list can be shorter than the parameters of the descriptor.
+func (info *MethodInfo) GetParameterAnnotations() [][]*Annotation {
+	class := info.class
+	var parameters [][]*Annotation
+	for _, visible := range []bool{true, false} {
+		attribute := class.FindAttribute(info.Attributes, annotationAttributeName("ParameterAnnotations", visible))
+		if attribute == nil {
+			continue
+		}
+		buf := &bytes.Buffer{Data: &attribute.Data, Index: 0}
+		for parameter, count := 0, int(buf.ReadByte()); parameter < count; parameter++ {
+			if parameter == len(parameters) {
+				parameters = append(parameters, nil)
+			}
+			parameters[parameter] = append(parameters[parameter], class.readAnnotationList(buf, visible)...)
+		}
+	}
+	return parameters
+}
+
+// SetParameterAnnotations replaces the annotations of the parameters of the method.
+func (info *MethodInfo) SetParameterAnnotations(parameters [][]*Annotation) {
+	class := info.class
+	for _, visible := range []bool{true, false} {
+		name := annotationAttributeName("ParameterAnnotations", visible)
+		data := []byte{byte(len(parameters))}
+		buf := &bytes.Buffer{Data: &data, Index: 0}
+		found := false
+		for _, annotations := range parameters {
+			var retained []*Annotation
+			for _, annotation := range annotations {
+				if annotation.Visible == visible {
+					retained = append(retained, annotation)
+				}
+			}
+			found = found || len(retained) > 0
+			class.writeAnnotationList(buf, retained)
+		}
+		if found {
+			info.Attributes = class.SetAttribute(info.Attributes, name, data)
+		} else {
+			info.Attributes = class.RemoveAttribute(info.Attributes, name)
+		}
+	}
+	info.AttributesCount = uint16(len(info.Attributes))
+}
+
+// GetAnnotationDefault decodes the default value of an annotation element, or returns nil if the method has none.
+func (info *MethodInfo) GetAnnotationDefault() any {
+	attribute := info.class.FindAttribute(info.Attributes, "AnnotationDefault")
+	if attribute == nil {
+		return nil
+	}
+	builder := &annotationBuilder{}
+	(&ClassReader{Class: info.class}).readElementValue(&bytes.Buffer{Data: &attribute.Data, Index: 0}, builder, "")
+	if len(builder.values) == 0 {
+		return nil
+	}
+	return builder.values[0]
+}
+
+// SetAnnotationDefault replaces the default value of an annotation element, removing it for nil.
+func (info *MethodInfo) SetAnnotationDefault(value any) {
+	if value == nil {
+		info.Attributes = info.class.RemoveAttribute(info.Attributes, "AnnotationDefault")
+	} else {
+		writer := newAnnotationWriter(info.class, bytes.NewBuffer(), false)
+		acceptElementValue(writer, "", value)
+		info.Attributes = info.class.SetAttribute(info.Attributes, "AnnotationDefault", *writer.buf.Data)
+	}
+	info.AttributesCount = uint16(len(info.Attributes))
+}
+
+// RecordComponent is a component declared by the Record attribute of a record class.
+type RecordComponent struct {
+	class      *Class
+	Name       string
+	Descriptor string
+	Attributes []AttributeInfo
+}
+
+// GetRecordComponents decodes the components of a record class, returning nil for other classes.
+func (class *Class) GetRecordComponents() []*RecordComponent {
+	attribute := class.FindAttribute(class.Attributes, "Record")
+	if attribute == nil {
+		return nil
+	}
+	buf := &bytes.Buffer{Data: &attribute.Data, Index: 0}
+	components := make([]*RecordComponent, buf.ReadU16())
+	for i := range components {
+		components[i] = &RecordComponent{class: class, Name: class.GetUtf8(buf.ReadU16()), Descriptor: class.GetUtf8(buf.ReadU16())}
+		components[i].Attributes = ReadAttributes(buf, int(buf.ReadU16()))
+	}
+	return components
+}
+
+// SetRecordComponents replaces the Record attribute of the class.
+func (class *Class) SetRecordComponents(components []*RecordComponent) {
+	data := []byte{}
+	buf := &bytes.Buffer{Data: &data, Index: 0}
+	buf.WriteU16(uint16(len(components)))
+	for _, component := range components {
+		buf.WriteU16(class.AddUtf8(component.Name))
+		buf.WriteU16(class.AddUtf8(component.Descriptor))
+		buf.WriteU16(uint16(len(component.Attributes)))
+		WriteAttributes(buf, component.Attributes)
+	}
+	class.setAttribute("Record", data)
+}
+
+func (component *RecordComponent) GetAnnotations() []*Annotation {
+	return component.class.readAnnotations(component.Attributes)
+}
+
+// SetAnnotations replaces the annotations of the component, which is written back by SetRecordComponents.
+func (component *RecordComponent) SetAnnotations(annotations []*Annotation) {
+	component.Attributes = component.class.writeAnnotations(component.Attributes, annotations)
+}
+
+func (component *RecordComponent) HasAnnotation(name string) bool {
+	return FindAnnotation(component.GetAnnotations(), name) != nil
+}
+
+func (component *RecordComponent) GetTypeAnnotations() []*TypeAnnotation {
+	return component.class.readTypeAnnotations(component.Attributes)
+}
+
+func (component *RecordComponent) SetTypeAnnotations(annotations []*TypeAnnotation) {
+	component.Attributes = component.class.writeTypeAnnotations(component.Attributes, annotations)
+}
@@ -0,0 +1,348 @@
+package babe
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rereadClass writes a class out and reads it back.
+func rereadClass(t *testing.T, class *Class) *Class {
+	t.Helper()
+	read := &Class{}
+	if err := read.Read(classBytes(class)); err != nil {
+		t.Fatal(err)
+	}
+	return read
+}
+
+func buildTestClass(t *testing.T, builder *ClassBuilder) *Class {
+	t.Helper()
+	class, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return class
+}
+
+func TestAnnotationElementValues(t *testing.T) {
+	tests := []struct {
+		tag   byte
+		value any
+	}{
+		{'B', int8(-12)},
+		{'C', uint16('x')},
+		{'D', 1.5},
+		{'F', float32(2.5)},
+		{'I', int32(-42)},
+		{'J', int64(1) << 40},
+		{'S', int16(-300)},
+		{'Z', true},
+		{'Z', false},
+		{'s', "text"},
+		{'e', EnumValue{"La/Kind;", "ONE"}},
+		{'c', ClassConstant{"La/Foo;"}},
+		{'c', ClassConstant{"V"}},
+		{'@', &Annotation{Descriptor: "La/Nested;", Elements: []AnnotationElement{
+			{"value", &Annotation{Descriptor: "La/Deep;", Elements: []AnnotationElement{{"name", "deep"}}}},
+			{"empty", &Annotation{Descriptor: "La/Empty;"}},
+		}}},
+		{'[', []any{int32(1), "two", EnumValue{"La/Kind;", "THREE"}, []any{ClassConstant{"I"}}}},
+		{'[', []any{}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%c %v", test.tag, test.value), func(t *testing.T) {
+			class := buildTestClass(t, NewClassBuilder("a/Values").Access(ACC_PUBLIC|ACC_INTERFACE|ACC_ABSTRACT|ACC_ANNOTATION).
+				Method(ACC_PUBLIC|ACC_ABSTRACT, "value", "()V", nil))
+			class.SetAnnotations([]*Annotation{{Descriptor: "La/Values;", Visible: true, Elements: []AnnotationElement{{"value", test.value}}}})
+			class.Methods[0].SetAnnotationDefault(test.value)
+
+			data := class.FindAttribute(class.Attributes, "RuntimeVisibleAnnotations").Data
+			// num_annotations, type_index, num_element_value_pairs and element_name_index precede the tag
+			if tag := data[8]; tag != test.tag {
+				t.Errorf("element_value tag = %c, want %c", tag, test.tag)
+			}
+			read := rereadClass(t, class)
+			if value := read.GetAnnotations()[0].Get("value"); !reflect.DeepEqual(value, test.value) {
+				t.Errorf("element value = %#v, want %#v", value, test.value)
+			}
+			if value := read.Methods[0].GetAnnotationDefault(); !reflect.DeepEqual(value, test.value) {
+				t.Errorf("AnnotationDefault = %#v, want %#v", value, test.value)
+			}
+		})
+	}
+}
+
+func TestAnnotationHolders(t *testing.T) {
+	visible := &Annotation{Descriptor: "La/Visible;", Visible: true, Elements: []AnnotationElement{
+		{"count", int32(3)},
+		{"nested", &Annotation{Descriptor: "La/Nested;", Elements: []AnnotationElement{{"kind", EnumValue{"La/Kind;", "ONE"}}}}},
+		{"types", []any{ClassConstant{"La/Foo;"}, ClassConstant{"[I"}}},
+	}}
+	invisible := &Annotation{Descriptor: "La/Invisible;"}
+	typeAnnotation := &TypeAnnotation{TargetType: 0x13, Target: []byte{}, Path: []TypePathStep{{0, 0}, {3, 1}},
+		Annotation: Annotation{Descriptor: "La/NonNull;", Visible: true}}
+
+	tests := []struct {
+		name string
+		set  func(class *Class)
+		get  func(class *Class) any
+		want any
+	}{
+		{"class", func(class *Class) {
+			class.SetAnnotations([]*Annotation{visible, invisible})
+		}, func(class *Class) any {
+			return class.GetAnnotations()
+		}, []*Annotation{visible, invisible}},
+		{"field", func(class *Class) {
+			class.Fields[0].SetAnnotations([]*Annotation{invisible})
+		}, func(class *Class) any {
+			return class.Fields[0].GetAnnotations()
+		}, []*Annotation{invisible}},
+		{"field type", func(class *Class) {
+			class.Fields[0].SetTypeAnnotations([]*TypeAnnotation{typeAnnotation})
+		}, func(class *Class) any {
+			return class.Fields[0].GetTypeAnnotations()
+		}, []*TypeAnnotation{typeAnnotation}},
+		{"method", func(class *Class) {
+			class.Methods[0].SetAnnotations([]*Annotation{visible})
+		}, func(class *Class) any {
+			return class.Methods[0].GetAnnotations()
+		}, []*Annotation{visible}},
+		{"parameters", func(class *Class) {
+			class.Methods[0].SetParameterAnnotations([][]*Annotation{{visible, invisible}, nil, {invisible}})
+		}, func(class *Class) any {
+			return class.Methods[0].GetParameterAnnotations()
+		}, [][]*Annotation{{visible, invisible}, nil, {invisible}}},
+		{"record component", func(class *Class) {
+			component := &RecordComponent{class: class, Name: "value", Descriptor: "I"}
+			component.SetAnnotations([]*Annotation{visible, invisible})
+			component.SetTypeAnnotations([]*TypeAnnotation{typeAnnotation})
+			class.SetRecordComponents([]*RecordComponent{component, {class: class, Name: "plain", Descriptor: "J"}})
+		}, func(class *Class) any {
+			var annotations []any
+			for _, component := range class.GetRecordComponents() {
+				annotations = append(annotations, component.Name, component.GetAnnotations(), component.GetTypeAnnotations())
+			}
+			return annotations
+		}, []any{"value", []*Annotation{visible, invisible}, []*TypeAnnotation{typeAnnotation}, "plain", []*Annotation(nil), []*TypeAnnotation(nil)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class := buildTestClass(t, NewClassBuilder("a/Holder").
+				Field(ACC_PRIVATE, "value", "I", nil).
+				Method(ACC_PUBLIC, "run", "(IJLjava/lang/String;)V", emptyBody))
+			test.set(class)
+			if got := test.get(rereadClass(t, class)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("read back %#v, want %#v", got, test.want)
+			}
+
+			// Clearing the annotations removes their attributes
+			test.set(class)
+			class.SetAnnotations(nil)
+			class.Fields[0].SetAnnotations(nil)
+			class.Fields[0].SetTypeAnnotations(nil)
+			class.Methods[0].SetAnnotations(nil)
+			class.Methods[0].SetParameterAnnotations(nil)
+			class.Attributes = class.RemoveAttribute(class.Attributes, "Record")
+			class.AttributesCount = uint16(len(class.Attributes))
+			for _, attributes := range [][]AttributeInfo{class.Attributes, class.Fields[0].Attributes, class.Methods[0].Attributes} {
+				for i := range attributes {
+					if name := class.GetAttributeName(&attributes[i]); strings.HasPrefix(name, "Runtime") {
+						t.Errorf("attribute %s left after clearing the annotations", name)
+					}
+				}
+			}
+		})
+	}
+}
+
+// annotationRecorder records the calls of an AnnotationVisitor.
+type annotationRecorder struct {
+	calls  *[]string
+	prefix string
+}
+
+func (recorder annotationRecorder) Visit(name string, value any) {
+	*recorder.calls = append(*recorder.calls, fmt.Sprintf("%s%s=%v", recorder.prefix, name, value))
+}
+
+func (recorder annotationRecorder) VisitEnum(name string, descriptor string, value string) {
+	*recorder.calls = append(*recorder.calls, fmt.Sprintf("%s%s=%s.%s", recorder.prefix, name, descriptor, value))
+}
+
+func (recorder annotationRecorder) VisitAnnotation(name string, descriptor string) AnnotationVisitor {
+	*recorder.calls = append(*recorder.calls, fmt.Sprintf("%s%s=@%s", recorder.prefix, name, descriptor))
+	return annotationRecorder{recorder.calls, recorder.prefix + "  "}
+}
+
+func (recorder annotationRecorder) VisitArray(name string) AnnotationVisitor {
+	*recorder.calls = append(*recorder.calls, fmt.Sprintf("%s%s=[", recorder.prefix, name))
+	return annotationRecorder{recorder.calls, recorder.prefix + "  "}
+}
+
+func (recorder annotationRecorder) VisitEnd() {
+	*recorder.calls = append(*recorder.calls, recorder.prefix+"end")
+}
+
+func TestAnnotationAccept(t *testing.T) {
+	annotation := &Annotation{Descriptor: "La/Outer;", Elements: []AnnotationElement{
+		{"count", int32(1)},
+		{"kind", EnumValue{"La/Kind;", "ONE"}},
+		{"nested", &Annotation{Descriptor: "La/Nested;", Elements: []AnnotationElement{{"type", ClassConstant{"La/Foo;"}}}}},
+		{"values", []any{"a", &Annotation{Descriptor: "La/Empty;"}}},
+	}}
+	var calls []string
+	annotation.Accept(annotationRecorder{calls: &calls})
+	want := []string{
+		"count=1",
+		"kind=La/Kind;.ONE",
+		"nested=@La/Nested;",
+		"  type={La/Foo;}",
+		"  end",
+		"values=[",
+		"  =a",
+		"  =@La/Empty;",
+		"    end",
+		"  end",
+		"end",
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls =\n%s\nwant\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Accepting into an annotationBuilder copies the annotation
+	copied := &Annotation{Descriptor: annotation.Descriptor}
+	annotation.Accept(&annotationBuilder{annotation: copied})
+	if !reflect.DeepEqual(copied, annotation) {
+		t.Errorf("copy = %#v, want %#v", copied, annotation)
+	}
+}
+
+func TestAnnotationLists(t *testing.T) {
+	foo := &Annotation{Descriptor: "La/Foo;"}
+	bar := &Annotation{Descriptor: "La/b/Bar;"}
+	tests := []struct {
+		name string
+		// find is the type looked up and removed, as a descriptor, an internal name or a binary name
+		find    string
+		found   *Annotation
+		removed []*Annotation
+	}{
+		{"descriptor", "La/Foo;", foo, []*Annotation{bar}},
+		{"internal name", "a/b/Bar", bar, []*Annotation{foo}},
+		{"binary name", "a.b.Bar", bar, []*Annotation{foo}},
+		{"missing", "a.Baz", nil, []*Annotation{foo, bar}},
+		{"prefix of a type", "a/F", nil, []*Annotation{foo, bar}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			annotations := []*Annotation{foo, bar}
+			if found := FindAnnotation(annotations, test.find); found != test.found {
+				t.Errorf("FindAnnotation = %v, want %v", found, test.found)
+			}
+			removed, ok := RemoveAnnotations(annotations, test.find)
+			if !slices.Equal(removed, test.removed) || ok != (test.found != nil) {
+				t.Errorf("RemoveAnnotations = %v, %t, want %v", removed, ok, test.removed)
+			}
+		})
+	}
+
+	replacement := &Annotation{Descriptor: "La/Foo;", Visible: true}
+	annotations := AddAnnotation([]*Annotation{foo, bar}, replacement)
+	if !slices.Equal(annotations, []*Annotation{replacement, bar}) {
+		t.Errorf("AddAnnotation of an existing type = %v", annotations)
+	}
+	added := &Annotation{Descriptor: "La/Baz;"}
+	if annotations := AddAnnotation(annotations, added); !slices.Equal(annotations, []*Annotation{replacement, bar, added}) {
+		t.Errorf("AddAnnotation of a new type = %v", annotations)
+	}
+	if annotations, ok := RemoveAnnotations([]*Annotation{foo, bar}, "a.Foo", "a/b/Bar"); len(annotations) != 0 || !ok {
+		t.Errorf("RemoveAnnotations of every type = %v, %t", annotations, ok)
+	}
+}
+
+func TestStripAnnotations(t *testing.T) {
+	annotationAccess := ACC_PUBLIC | ACC_INTERFACE | ACC_ABSTRACT | ACC_ANNOTATION
+	stripped := &Annotation{Descriptor: "La/strip/Gone;", Visible: true}
+	kept := &Annotation{Descriptor: "La/Keep;", Visible: true, Elements: []AnnotationElement{
+		{"type", ClassConstant{"La/strip/Used;"}},
+		// Nested annotations are kept even when they match
+		{"nested", &Annotation{Descriptor: "La/strip/Nested;"}},
+	}}
+
+	user := buildTestClass(t, NewClassBuilder("a/User").
+		Field(ACC_PRIVATE, "value", "Ljava/lang/Object;", nil).
+		Method(ACC_PUBLIC, "run", "(Ljava/lang/Object;I)Ljava/lang/String;", func(code *CodeBuilder) {
+			code.VisitVarInsn(ALOAD, 1)
+			code.VisitTypeInsn(CHECKCAST, "java/lang/String")
+			code.VisitInsn(ARETURN)
+		}))
+	user.SetAnnotations([]*Annotation{stripped, kept})
+	user.Fields[0].SetAnnotations([]*Annotation{stripped})
+	user.Fields[0].SetTypeAnnotations([]*TypeAnnotation{{TargetType: 0x13, Target: []byte{}, Annotation: *stripped}})
+	method := &user.Methods[0]
+	method.SetAnnotations([]*Annotation{kept, stripped})
+	method.SetParameterAnnotations([][]*Annotation{{stripped}, {kept}})
+	code := method.GetCode()
+	// A cast at offset 1 of the code
+	code.Attributes = user.writeTypeAnnotations(code.Attributes, []*TypeAnnotation{{TargetType: 0x47, Target: []byte{0, 1, 0}, Annotation: *stripped}})
+	method.SetCode(code)
+	component := &RecordComponent{class: user, Name: "value", Descriptor: "Ljava/lang/Object;"}
+	component.SetAnnotations([]*Annotation{stripped})
+	user.SetRecordComponents([]*RecordComponent{component})
+
+	filename := filepath.Join(t.TempDir(), "test.jar")
+	writeTestZip(t, filename, []zipEntry{
+		{"a/User.class", string(classBytes(user))},
+		testClassEntry(t, NewClassBuilder("a/Keep").Access(annotationAccess)),
+		testClassEntry(t, NewClassBuilder("a/strip/Gone").Access(annotationAccess)),
+		testClassEntry(t, NewClassBuilder("a/strip/Used").Access(annotationAccess)),
+		testClassEntry(t, NewClassBuilder("a/strip/Nested").Access(annotationAccess)),
+		// Only annotation classes are dropped
+		testClassEntry(t, NewClassBuilder("a/strip/Helper")),
+	})
+	if err := StripAnnotations(filename, "a.strip.*"); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range readTestZip(t, filename) {
+		names = append(names, entry.name)
+		if entry.name != "a/User.class" {
+			continue
+		}
+		read := &Class{}
+		if err := read.Read([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+		if annotations := read.GetAnnotations(); !reflect.DeepEqual(annotations, []*Annotation{kept}) {
+			t.Errorf("class annotations = %v", annotations)
+		}
+		field := &read.Fields[0]
+		if annotations, types := field.GetAnnotations(), field.GetTypeAnnotations(); annotations != nil || types != nil {
+			t.Errorf("field annotations = %v, %v", annotations, types)
+		}
+		method := &read.Methods[0]
+		if annotations := method.GetAnnotations(); !reflect.DeepEqual(annotations, []*Annotation{kept}) {
+			t.Errorf("method annotations = %v", annotations)
+		}
+		if parameters := method.GetParameterAnnotations(); !reflect.DeepEqual(parameters, [][]*Annotation{nil, {kept}}) {
+			t.Errorf("parameter annotations = %v", parameters)
+		}
+		if types := read.readTypeAnnotations(method.GetCode().Attributes); types != nil {
+			t.Errorf("code type annotations = %v", types)
+		}
+		if components := read.GetRecordComponents(); len(components) != 1 || components[0].GetAnnotations() != nil {
+			t.Errorf("record components = %v", components)
+		}
+	}
+	slices.Sort(names)
+	want := []string{"a/Keep.class", "a/User.class", "a/strip/Helper.class", "a/strip/Nested.class", "a/strip/Used.class"}
+	if !slices.Equal(names, want) {
+		t.Errorf("entries = %v, want %v", names, want)
+	}
+}
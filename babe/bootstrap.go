@@ -0,0 +1,81 @@
+package babe
+
+import (
+	"fmt"
+
+	"github.com/mrnavastar/assist/bytes"
+)
+
+// BootstrapMethod is an entry of the BootstrapMethods attribute, which invokedynamic instructions and dynamic
+// constants refer to by index. MethodRef is the index of a MethodHandle constant, and Arguments those of loadable
+// constants.
+type BootstrapMethod struct {
+	MethodRef uint16
+	Arguments []uint16
+}
+
+func (class *Class) GetBootstrapMethods() []BootstrapMethod {
+	attribute := class.FindAttribute(class.Attributes, "BootstrapMethods")
+	if attribute == nil {
+		return nil
+	}
+
+	buf := bytes.Buffer{Data: &attribute.Data, Index: 0}
+	methods := make([]BootstrapMethod, buf.ReadU16())
+	for i := range methods {
+		methods[i].MethodRef = buf.ReadU16()
+		methods[i].Arguments = make([]uint16, buf.ReadU16())
+		for j := range methods[i].Arguments {
+			methods[i].Arguments[j] = buf.ReadU16()
+		}
+	}
+	return methods
+}
+
+// SetBootstrapMethods replaces the BootstrapMethods attribute, which the indexes held by InvokeDynamicInfo and
+// DynamicInfo constants point into.
+func (class *Class) SetBootstrapMethods(methods []BootstrapMethod) {
+	if len(methods) == 0 {
+		class.Attributes = class.RemoveAttribute(class.Attributes, "BootstrapMethods")
+		class.AttributesCount = uint16(len(class.Attributes))
+		return
+	}
+	data := []byte{}
+	buf := &bytes.Buffer{Data: &data, Index: 0}
+	buf.WriteU16(uint16(len(methods)))
+	for _, method := range methods {
+		buf.WriteU16(method.MethodRef)
+		buf.WriteU16(uint16(len(method.Arguments)))
+		for _, argument := range method.Arguments {
+			buf.WriteU16(argument)
+		}
+	}
+	class.setAttribute("BootstrapMethods", data)
+}
+
+// ResolveBootstrapMethod returns the method handle and the arguments of a bootstrap method, with arguments resolved
+// as ClassReader passes them to visitors.
+func (class *Class) ResolveBootstrapMethod(index uint16) (Handle, []any, error) {
+	reader := NewClassReader(class)
+	if int(index) >= len(reader.bootstrapMethods) {
+		return Handle{}, nil, fmt.Errorf("%w: no bootstrap method %d", ErrInvalidClass, index)
+	}
+	if class.bootstrapOwner(reader.bootstrapMethods[index]) == "" {
+		return Handle{}, nil, fmt.Errorf("%w: bootstrap method %d is not a method handle", ErrInvalidClass, index)
+	}
+	handle, arguments := reader.readBootstrapMethod(index)
+	return handle, arguments, nil
+}
+
+// bootstrapOwner returns the class declaring a bootstrap method, or "" if it isn't a method handle.
+func (class *Class) bootstrapOwner(method BootstrapMethod) string {
+	if method.MethodRef == 0 || int(method.MethodRef) > len(class.ConstantPool) {
+		return ""
+	}
+	handle, ok := class.GetConstant(method.MethodRef).(*MethodHandleInfo)
+	if !ok {
+		return ""
+	}
+	owner, _, _ := class.GetRef(handle.ReferenceIndex)
+	return owner
+}
@@ -0,0 +1,169 @@
+package babe
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const metafactoryDescriptor = "(Ljava/lang/invoke/MethodHandles$Lookup;Ljava/lang/String;Ljava/lang/invoke/MethodType;Ljava/lang/invoke/MethodType;Ljava/lang/invoke/MethodHandle;Ljava/lang/invoke/MethodType;)Ljava/lang/invoke/CallSite;"
+
+var metafactory = Handle{REF_invokeStatic, "java/lang/invoke/LambdaMetafactory", "metafactory", metafactoryDescriptor, false}
+
+// callSite is an invokedynamic instruction with its bootstrap method resolved.
+type callSite struct {
+	name, descriptor string
+	bootstrap        Handle
+	arguments        []any
+}
+
+func bootstrapTestClass(t *testing.T) *Class {
+	t.Helper()
+	return buildTestClass(t, NewClassBuilder("a/User").
+		Method(ACC_PUBLIC|ACC_STATIC, "run", "(La/Foo;)V", func(code *CodeBuilder) {
+			code.VisitVarInsn(ALOAD, 0)
+			code.VisitInvokeDynamicInsn("apply", "(La/Foo;)La/Fn;", metafactory,
+				MethodTypeConstant{"(Ljava/lang/Object;)Ljava/lang/Object;"},
+				Handle{REF_invokeStatic, "a/User", "lambda$run$0", "(La/Foo;Ljava/lang/Object;)Ljava/lang/Object;", false},
+				MethodTypeConstant{"(La/Foo;)La/Foo;"})
+			code.VisitInsn(POP)
+			code.VisitVarInsn(ALOAD, 0)
+			code.VisitInvokeDynamicInsn("describe", "(La/Foo;)Ljava/lang/String;",
+				Handle{REF_invokeStatic, "a/Bootstraps", "bootstrap", "(Ljava/lang/invoke/MethodHandles$Lookup;Ljava/lang/String;Ljava/lang/invoke/MethodType;[Ljava/lang/Object;)Ljava/lang/invoke/CallSite;", false},
+				"a/Foo \u0001", "a/Foo", "a.Foo", "unrelated", ClassConstantOf("a/Foo"), ClassConstant{"[La/Foo;"}, int32(1))
+			code.VisitInsn(POP)
+			code.Return()
+		}).
+		Method(ACC_PRIVATE|ACC_STATIC|ACC_SYNTHETIC, "lambda$run$0", "(La/Foo;Ljava/lang/Object;)Ljava/lang/Object;", func(code *CodeBuilder) {
+			code.VisitVarInsn(ALOAD, 0)
+			code.VisitInsn(ARETURN)
+		}))
+}
+
+// callSites returns the invokedynamic call sites of a class in the order of its constant pool.
+func callSites(t *testing.T, class *Class) []callSite {
+	t.Helper()
+	var sites []callSite
+	for _, constant := range class.ConstantPool {
+		info, ok := constant.(*InvokeDynamicInfo)
+		if !ok {
+			continue
+		}
+		site := callSite{}
+		site.name, site.descriptor = class.GetNameAndType(info.NameAndTypeIndex)
+		var err error
+		if site.bootstrap, site.arguments, err = class.ResolveBootstrapMethod(info.BootstrapMethodAttrIndex); err != nil {
+			t.Fatal(err)
+		}
+		sites = append(sites, site)
+	}
+	return sites
+}
+
+func TestRemapInvokeDynamic(t *testing.T) {
+	classes := map[string]string{"a/Foo": "b/Bar", "a/Fn": "b/Fn"}
+	methods := map[string]string{
+		"a/Fn.apply(Ljava/lang/Object;)Ljava/lang/Object;":                 "call",
+		"a/User.lambda$run$0(La/Foo;Ljava/lang/Object;)Ljava/lang/Object;": "lambda$mapped",
+	}
+	describe := metafactory
+	describe.Owner, describe.Name = "a/Bootstraps", "bootstrap"
+	describe.Descriptor = "(Ljava/lang/invoke/MethodHandles$Lookup;Ljava/lang/String;Ljava/lang/invoke/MethodType;[Ljava/lang/Object;)Ljava/lang/invoke/CallSite;"
+	relocated := describe
+	relocated.Owner = "shaded/a/Bootstraps"
+
+	tests := []struct {
+		name     string
+		remapper Remapper
+		want     []callSite
+	}{
+		{"relocation", relocationRemapper{{"a", "shaded/a"}}, []callSite{
+			{"apply", "(Lshaded/a/Foo;)Lshaded/a/Fn;", metafactory, []any{
+				MethodTypeConstant{"(Ljava/lang/Object;)Ljava/lang/Object;"},
+				Handle{REF_invokeStatic, "shaded/a/User", "lambda$run$0", "(Lshaded/a/Foo;Ljava/lang/Object;)Ljava/lang/Object;", false},
+				MethodTypeConstant{"(Lshaded/a/Foo;)Lshaded/a/Foo;"},
+			}},
+			{"describe", "(Lshaded/a/Foo;)Ljava/lang/String;", relocated, []any{
+				"a/Foo \u0001", "a/Foo", "a.Foo", "unrelated", ClassConstant{"Lshaded/a/Foo;"}, ClassConstant{"[Lshaded/a/Foo;"}, int32(1),
+			}},
+		}},
+		{"mappings", &SimpleRemapper{Classes: classes, Methods: methods}, []callSite{
+			{"call", "(Lb/Bar;)Lb/Fn;", metafactory, []any{
+				MethodTypeConstant{"(Ljava/lang/Object;)Ljava/lang/Object;"},
+				Handle{REF_invokeStatic, "a/User", "lambda$mapped", "(Lb/Bar;Ljava/lang/Object;)Ljava/lang/Object;", false},
+				MethodTypeConstant{"(Lb/Bar;)Lb/Bar;"},
+			}},
+			{"describe", "(Lb/Bar;)Ljava/lang/String;", describe, []any{
+				"a/Foo \u0001", "a/Foo", "a.Foo", "unrelated", ClassConstant{"Lb/Bar;"}, ClassConstant{"[Lb/Bar;"}, int32(1),
+			}},
+		}},
+		// Strings holding exactly a class name are renamed, other strings are left alone
+		{"renamed strings", &classRenameRemapper{SimpleRemapper{Classes: classes}}, []callSite{
+			{"apply", "(Lb/Bar;)Lb/Fn;", metafactory, []any{
+				MethodTypeConstant{"(Ljava/lang/Object;)Ljava/lang/Object;"},
+				Handle{REF_invokeStatic, "a/User", "lambda$run$0", "(Lb/Bar;Ljava/lang/Object;)Ljava/lang/Object;", false},
+				MethodTypeConstant{"(Lb/Bar;)Lb/Bar;"},
+			}},
+			{"describe", "(Lb/Bar;)Ljava/lang/String;", describe, []any{
+				"a/Foo \u0001", "b/Bar", "b.Bar", "unrelated", ClassConstant{"Lb/Bar;"}, ClassConstant{"[Lb/Bar;"}, int32(1),
+			}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class := bootstrapTestClass(t)
+			if !RemapClass(class, test.remapper) {
+				t.Fatal("RemapClass changed nothing")
+			}
+			read := rereadClass(t, class)
+			if sites := callSites(t, read); !reflect.DeepEqual(sites, test.want) {
+				t.Errorf("call sites =\n%+v\nwant\n%+v", sites, test.want)
+			}
+			// The handle of the lambda names the method as it is declared
+			lambda := test.want[0].arguments[1].(Handle)
+			if read.FindMethod(lambda.Name, lambda.Descriptor) == nil {
+				t.Errorf("method %s%s not found", lambda.Name, lambda.Descriptor)
+			}
+		})
+	}
+}
+
+func TestBootstrapMethods(t *testing.T) {
+	class := bootstrapTestClass(t)
+	methods := class.GetBootstrapMethods()
+	if len(methods) != 2 || len(methods[0].Arguments) != 3 || len(methods[1].Arguments) != 7 {
+		t.Fatalf("bootstrap methods = %+v", methods)
+	}
+	if owner := class.bootstrapOwner(methods[0]); owner != "java/lang/invoke/LambdaMetafactory" {
+		t.Errorf("owner of the first bootstrap method = %q", owner)
+	}
+
+	// Swapping the methods swaps the call sites they bootstrap
+	sites := callSites(t, class)
+	class.SetBootstrapMethods([]BootstrapMethod{methods[1], methods[0]})
+	read := rereadClass(t, class)
+	if swapped := callSites(t, read); !reflect.DeepEqual(swapped, []callSite{
+		{sites[0].name, sites[0].descriptor, sites[1].bootstrap, sites[1].arguments},
+		{sites[1].name, sites[1].descriptor, sites[0].bootstrap, sites[0].arguments},
+	}) {
+		t.Errorf("call sites after swapping = %+v", swapped)
+	}
+
+	tests := []struct {
+		name  string
+		index uint16
+	}{
+		{"missing", 2},
+		{"not a method handle", 0},
+	}
+	read.SetBootstrapMethods([]BootstrapMethod{{MethodRef: read.AddUtf8("bootstrap")}})
+	for _, test := range tests {
+		if _, _, err := read.ResolveBootstrapMethod(test.index); !errors.Is(err, ErrInvalidClass) {
+			t.Errorf("%s: ResolveBootstrapMethod error = %v, want %v", test.name, err, ErrInvalidClass)
+		}
+	}
+	read.SetBootstrapMethods(nil)
+	if read.FindAttribute(read.Attributes, "BootstrapMethods") != nil || read.GetBootstrapMethods() != nil {
+		t.Error("BootstrapMethods attribute left after clearing it")
+	}
+}
@@ -66,6 +66,17 @@ const (
 	ACC_ANNOTATION = 0x2000
 	ACC_ENUM       = 0x4000
 	ACC_MODULE     = 0x8000
+
+	// Method flags sharing bits with ACC_SUPER, ACC_VOLATILE and ACC_TRANSIENT
+	ACC_SYNCHRONIZED = 0x0020
+	ACC_BRIDGE       = 0x0040
+	ACC_VARARGS      = 0x0080
+
+	// Flags of modules and their requires, exports and opens directives
+	ACC_OPEN         = 0x0020
+	ACC_TRANSITIVE   = 0x0020
+	ACC_STATIC_PHASE = 0x0040
+	ACC_MANDATED     = 0x8000
 )
 
 type InfoConstructor func() Info
@@ -365,6 +376,41 @@ func WriteAttributes(buf *bytes.Buffer, attributes []AttributeInfo) {
 	}
 }
 
+func (class *Class) GetAttributeName(attribute *AttributeInfo) string {
+	return class.GetUtf8(attribute.AttributeNameIndex)
+}
+
+// FindAttribute returns the first attribute with the given name, or nil.
+func (class *Class) FindAttribute(attributes []AttributeInfo, name string) *AttributeInfo {
+	for i := range attributes {
+		if class.GetAttributeName(&attributes[i]) == name {
+			return &attributes[i]
+		}
+	}
+	return nil
+}
+
+// SetAttribute replaces the data of the named attribute, appending it if it is missing.
+func (class *Class) SetAttribute(attributes []AttributeInfo, name string, data []byte) []AttributeInfo {
+	if attribute := class.FindAttribute(attributes, name); attribute != nil {
+		attribute.AttributeLength = uint32(len(data))
+		attribute.Data = data
+		return attributes
+	}
+	return append(attributes, AttributeInfo{class.AddUtf8(name), uint32(len(data)), data})
+}
+
+// RemoveAttribute removes every attribute with the given name.
+func (class *Class) RemoveAttribute(attributes []AttributeInfo, name string) []AttributeInfo {
+	kept := attributes[:0]
+	for _, attribute := range attributes {
+		if class.GetAttributeName(&attribute) != name {
+			kept = append(kept, attribute)
+		}
+	}
+	return kept
+}
+
 type FieldInfo struct {
 	class           *Class
 	AccessFlags     uint16
@@ -424,6 +470,7 @@ type Class struct {
 	Methods           []MethodInfo
 	AttributesCount   uint16
 	Attributes        []AttributeInfo
+	pool              *poolIndex
 }
 
 func (class *Class) Read(b []byte) error {
@@ -450,6 +497,7 @@ func (class *Class) Read(b []byte) error {
 
 		if tag == CONSTANT_Long || tag == CONSTANT_Double {
 			i++ // Java specification: long and double take up two entries
+			class.ConstantPool = append(class.ConstantPool, nil)
 		}
 	}
 
@@ -488,7 +536,9 @@ func (class *Class) Write(b *[]byte) {
 
 	buf.WriteU16(class.ConstantPoolCount)
 	for _, constant := range class.ConstantPool {
-		constant.(Info).Write(&buf)
+		if constant != nil {
+			constant.Write(&buf)
+		}
 	}
 
 	buf.WriteU16(class.AccessFlags)
@@ -528,24 +578,32 @@ func (class *Class) GetClassName() string {
 	return class.GetConstant(class.GetConstant(class.ThisClass).(*ClassInfo).NameIndex).(*Utf8Info).String()
 }
 
+// SetClassName renames the class constant of this class, so references to it from within the class follow.
 func (class *Class) SetClassName(name string) {
-	info := class.GetConstant(class.GetConstant(class.ThisClass).(ClassInfo).NameIndex).(Utf8Info)
-	info.Set(name)
+	class.GetConstant(class.ThisClass).(*ClassInfo).NameIndex = class.AddUtf8(name)
+	class.pool = nil
 }
 
+// GetSuperClassName returns the name of the super class, or "" for java/lang/Object and module-info.
 func (class *Class) GetSuperClassName() string {
-	return class.GetConstant(class.GetConstant(class.SuperClass).(ClassInfo).NameIndex).(Utf8Info).String()
+	return class.GetClassInfoName(class.SuperClass)
 }
 
+// SetSuperClassName changes the super class. References to the old super class from within the class, such as
+// super constructor calls, follow the change.
 func (class *Class) SetSuperClassName(name string) {
-	info := class.GetConstant(class.GetConstant(class.SuperClass).(ClassInfo).NameIndex).(Utf8Info)
-	info.Set(name)
+	if class.SuperClass == 0 {
+		class.SuperClass = class.AddClass(name)
+		return
+	}
+	class.GetConstant(class.SuperClass).(*ClassInfo).NameIndex = class.AddUtf8(name)
+	class.pool = nil
 }
 
 func (class *Class) GetInterfaceNames() []string {
 	var interfaces []string
 	for _, i := range class.Interfaces {
-		interfaces = append(interfaces, class.GetConstant(class.GetConstant(i).(ClassInfo).NameIndex).(Utf8Info).String())
+		interfaces = append(interfaces, class.GetClassInfoName(i))
 	}
 	return interfaces
 }
@@ -553,11 +611,26 @@ func (class *Class) GetInterfaceNames() []string {
 func (class *Class) HasModifier(mod int) bool {
 	return (class.AccessFlags & uint16(mod)) != 0
 }
- 
+
+// HasMainMethod reports whether the class has a method the launcher can start, which is a void main taking either a
+// String[] or, since Java 25, nothing.
 func (class *Class) HasMainMethod() bool {
-	for _, method := range class.Methods {
-		if method.GetDescriptor() == "([Ljava/lang/String;)V" {
+	for i := range class.Methods {
+		method := &class.Methods[i]
+		if method.GetName() != "main" || method.HasModifier(ACC_PRIVATE) {
+			continue
+		}
+		descriptor, err := method.GetMethodDescriptor()
+		if err != nil || !descriptor.Return.IsVoid() {
+			continue
+		}
+		switch parameters := descriptor.Parameters; len(parameters) {
+		case 0:
 			return true
+		case 1:
+			if parameters[0] == ClassType("java/lang/String").ArrayOf() {
+				return true
+			}
 		}
 	}
 	return false
@@ -0,0 +1,270 @@
+package babe
+
+import (
+	"math"
+	"strings"
+)
+
+// ClassBuilder declares a new class and writes it with a ClassWriter, so the constant pool, max stack and
+// max locals are built automatically. Classes default to public, extending java/lang/Object, targeting
+// Java 6. Stack map frames are not computed: code with branches in classes targeting Java 7 or later
+// must visit its own frames.
+type ClassBuilder struct {
+	version    int
+	access     int
+	name       string
+	superName  string
+	signature  string
+	interfaces []string
+	source     string
+	members    []func(visitor ClassVisitor)
+}
+
+func NewClassBuilder(name string) *ClassBuilder {
+	return &ClassBuilder{version: JAVA_6, access: ACC_PUBLIC | ACC_SUPER, name: name, superName: "java/lang/Object"}
+}
+
+func (builder *ClassBuilder) Version(version int) *ClassBuilder {
+	builder.version = version
+	return builder
+}
+
+func (builder *ClassBuilder) Access(access int) *ClassBuilder {
+	builder.access = access
+	return builder
+}
+
+func (builder *ClassBuilder) Extends(superName string) *ClassBuilder {
+	builder.superName = superName
+	return builder
+}
+
+func (builder *ClassBuilder) Implements(interfaces ...string) *ClassBuilder {
+	builder.interfaces = append(builder.interfaces, interfaces...)
+	return builder
+}
+
+func (builder *ClassBuilder) Signature(signature string) *ClassBuilder {
+	builder.signature = signature
+	return builder
+}
+
+func (builder *ClassBuilder) Source(source string) *ClassBuilder {
+	builder.source = source
+	return builder
+}
+
+// InnerClass declares a class nested in this one, or the class nesting it, in the InnerClasses attribute.
+func (builder *ClassBuilder) InnerClass(name string, outerName string, innerName string, access int) *ClassBuilder {
+	builder.members = append(builder.members, func(visitor ClassVisitor) {
+		visitor.VisitInnerClass(name, outerName, innerName, access)
+	})
+	return builder
+}
+
+// Field declares a field. value is the ConstantValue of a static field, or nil.
+func (builder *ClassBuilder) Field(access int, name string, descriptor string, value any) *ClassBuilder {
+	builder.members = append(builder.members, func(visitor ClassVisitor) {
+		visitor.VisitField(access, name, descriptor, "", value).VisitEnd()
+	})
+	return builder
+}
+
+// Method declares a method whose code is emitted by body. body is nil for abstract and native methods.
+func (builder *ClassBuilder) Method(access int, name string, descriptor string, body func(code *CodeBuilder)) *ClassBuilder {
+	builder.members = append(builder.members, func(visitor ClassVisitor) {
+		method := visitor.VisitMethod(access, name, descriptor, "", nil)
+		if body != nil {
+			method.VisitCode()
+			body(&CodeBuilder{MethodVisitor: method, descriptor: descriptor})
+			method.VisitMaxs(0, 0)
+		}
+		method.VisitEnd()
+	})
+	return builder
+}
+
+// DefaultConstructor declares a public no-argument constructor that calls the super constructor.
+func (builder *ClassBuilder) DefaultConstructor() *ClassBuilder {
+	return builder.Method(ACC_PUBLIC, "<init>", "()V", func(code *CodeBuilder) {
+		code.VisitVarInsn(ALOAD, 0)
+		code.VisitMethodInsn(INVOKESPECIAL, builder.superName, "<init>", "()V", false)
+		code.VisitInsn(RETURN)
+	})
+}
+
+// Accept visits the declared class.
+func (builder *ClassBuilder) Accept(visitor ClassVisitor) {
+	visitor.Visit(builder.version, builder.access, builder.name, builder.signature, builder.superName, builder.interfaces)
+	if builder.source != "" {
+		visitor.VisitSource(builder.source, "")
+	}
+	for _, member := range builder.members {
+		member(visitor)
+	}
+	visitor.VisitEnd()
+}
+
+func (builder *ClassBuilder) Build() (*Class, error) {
+	writer := NewClassWriter(nil, ComputeMaxs)
+	builder.Accept(writer)
+	return writer.Class()
+}
+
+func (builder *ClassBuilder) Bytes() ([]byte, error) {
+	writer := NewClassWriter(nil, ComputeMaxs)
+	builder.Accept(writer)
+	return writer.Bytes()
+}
+
+// CodeBuilder emits the code of a method. Besides the MethodVisitor calls it has shortcuts that pick
+// the right instruction for a value or type.
+type CodeBuilder struct {
+	MethodVisitor
+	descriptor string
+}
+
+// Push loads a constant, using the shortest instruction for it.
+func (code *CodeBuilder) Push(value any) {
+	switch v := value.(type) {
+	case nil:
+		code.VisitInsn(ACONST_NULL)
+	case bool:
+		if v {
+			code.VisitInsn(ICONST_1)
+		} else {
+			code.VisitInsn(ICONST_0)
+		}
+	case int:
+		code.pushInt(v)
+	case int32:
+		code.pushInt(int(v))
+	case int64:
+		if v == 0 || v == 1 {
+			code.VisitInsn(LCONST_0 + int(v))
+		} else {
+			code.VisitLdcInsn(v)
+		}
+	case float32:
+		// Compared by bits, so -0.0 isn't taken for 0
+		if bits := math.Float32bits(v); bits == math.Float32bits(0) || bits == math.Float32bits(1) || bits == math.Float32bits(2) {
+			code.VisitInsn(FCONST_0 + int(v))
+		} else {
+			code.VisitLdcInsn(v)
+		}
+	case float64:
+		if bits := math.Float64bits(v); bits == math.Float64bits(0) || bits == math.Float64bits(1) {
+			code.VisitInsn(DCONST_0 + int(v))
+		} else {
+			code.VisitLdcInsn(v)
+		}
+	default:
+		code.VisitLdcInsn(value)
+	}
+}
+
+func (code *CodeBuilder) pushInt(value int) {
+	switch {
+	case value >= -1 && value <= 5:
+		code.VisitInsn(ICONST_0 + value)
+	case value >= -128 && value <= 127:
+		code.VisitIntInsn(BIPUSH, value)
+	case value >= -32768 && value <= 32767:
+		code.VisitIntInsn(SIPUSH, value)
+	default:
+		code.VisitLdcInsn(int32(value))
+	}
+}
+
+// typeOffset returns the distance of the instruction for descriptor from the int form of ILOAD, ISTORE,
+// IRETURN or IALOAD.
+func typeOffset(descriptor string) int {
+	switch descriptor[0] {
+	case 'J':
+		return 1
+	case 'F':
+		return 2
+	case 'D':
+		return 3
+	case 'L', '[':
+		return 4
+	}
+	return 0
+}
+
+// Load loads the local variable at index holding a value of the given field descriptor.
+func (code *CodeBuilder) Load(descriptor string, index int) {
+	code.VisitVarInsn(ILOAD+typeOffset(descriptor), index)
+}
+
+// Store stores into the local variable at index a value of the given field descriptor.
+func (code *CodeBuilder) Store(descriptor string, index int) {
+	code.VisitVarInsn(ISTORE+typeOffset(descriptor), index)
+}
+
+// LoadArguments loads every argument of the method, starting at local index first.
+func (code *CodeBuilder) LoadArguments(first int) {
+	for _, argument := range methodArguments(code.descriptor) {
+		code.Load(argument, first)
+		first++
+		if argument == "J" || argument == "D" {
+			first++
+		}
+	}
+}
+
+// Return returns from the method with the value on the stack, if the method returns one.
+func (code *CodeBuilder) Return() {
+	returned := code.descriptor[strings.IndexByte(code.descriptor, ')')+1:]
+	if returned == "V" {
+		code.VisitInsn(RETURN)
+	} else {
+		code.VisitInsn(IRETURN + typeOffset(returned))
+	}
+}
+
+func (code *CodeBuilder) New(typ string) {
+	code.VisitTypeInsn(NEW, typ)
+}
+
+func (code *CodeBuilder) GetStatic(owner string, name string, descriptor string) {
+	code.VisitFieldInsn(GETSTATIC, owner, name, descriptor)
+}
+
+func (code *CodeBuilder) PutStatic(owner string, name string, descriptor string) {
+	code.VisitFieldInsn(PUTSTATIC, owner, name, descriptor)
+}
+
+func (code *CodeBuilder) GetField(owner string, name string, descriptor string) {
+	code.VisitFieldInsn(GETFIELD, owner, name, descriptor)
+}
+
+func (code *CodeBuilder) PutField(owner string, name string, descriptor string) {
+	code.VisitFieldInsn(PUTFIELD, owner, name, descriptor)
+}
+
+func (code *CodeBuilder) InvokeStatic(owner string, name string, descriptor string) {
+	code.VisitMethodInsn(INVOKESTATIC, owner, name, descriptor, false)
+}
+
+func (code *CodeBuilder) InvokeVirtual(owner string, name string, descriptor string) {
+	code.VisitMethodInsn(INVOKEVIRTUAL, owner, name, descriptor, false)
+}
+
+func (code *CodeBuilder) InvokeSpecial(owner string, name string, descriptor string) {
+	code.VisitMethodInsn(INVOKESPECIAL, owner, name, descriptor, false)
+}
+
+func (code *CodeBuilder) InvokeInterface(owner string, name string, descriptor string) {
+	code.VisitMethodInsn(INVOKEINTERFACE, owner, name, descriptor, true)
+}
+
+// Jump branches to label, which must be marked before the method ends.
+func (code *CodeBuilder) Jump(opcode int, label *Label) {
+	code.VisitJumpInsn(opcode, label)
+}
+
+// Mark places label at the current position.
+func (code *CodeBuilder) Mark(label *Label) {
+	code.VisitLabel(label)
+}
@@ -0,0 +1,677 @@
+package babe
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+
+	"github.com/mrnavastar/assist/bytes"
+)
+
+const (
+	SkipCode   = 1 << iota // Don't visit method code
+	SkipDebug              // Don't visit source files, line numbers, local variables and method parameters
+	SkipFrames             // Don't visit stack map frames
+)
+
+// ClassReader drives visitors with the content of a parsed class.
+type ClassReader struct {
+	Class            *Class
+	bootstrapMethods []BootstrapMethod
+}
+
+func NewClassReader(class *Class) *ClassReader {
+	return &ClassReader{Class: class, bootstrapMethods: class.GetBootstrapMethods()}
+}
+
+func ReadClass(b []byte) (*ClassReader, error) {
+	class := &Class{}
+	if err := class.Read(b); err != nil {
+		return nil, err
+	}
+	return NewClassReader(class), nil
+}
+
+func (reader *ClassReader) readConstant(index uint16) any {
+	class := reader.Class
+	switch info := class.GetConstant(index).(type) {
+	case *IntegerInfo:
+		return info.GetInt()
+	case *FloatInfo:
+		return math.Float32frombits(info.Bytes)
+	case *LongInfo:
+		return info.GetLong()
+	case *DoubleInfo:
+		return math.Float64frombits(uint64(info.HighBytes)<<32 | uint64(info.LowBytes))
+	case *StringInfo:
+		return class.GetUtf8(info.StringIndex)
+	case *ClassInfo:
+		return ClassConstantOf(class.GetUtf8(info.NameIndex))
+	case *MethodTypeInfo:
+		return MethodTypeConstant{class.GetUtf8(info.DescriptorIndex)}
+	case *MethodHandleInfo:
+		return reader.readHandle(info)
+	case *DynamicInfo:
+		name, descriptor := class.GetNameAndType(info.NameAndTypeIndex)
+		bootstrap, arguments := reader.readBootstrapMethod(info.BootstrapMethodAttrIndex)
+		return ConstantDynamic{name, descriptor, bootstrap, arguments}
+	}
+	return nil
+}
+
+func (reader *ClassReader) readHandle(info *MethodHandleInfo) Handle {
+	owner, name, descriptor := reader.Class.GetRef(info.ReferenceIndex)
+	_, isInterface := reader.Class.GetConstant(info.ReferenceIndex).(*InterfaceMethodRefInfo)
+	return Handle{int(info.ReferenceKind), owner, name, descriptor, isInterface}
+}
+
+func (reader *ClassReader) readBootstrapMethod(index uint16) (Handle, []any) {
+	method := reader.bootstrapMethods[index]
+	arguments := make([]any, len(method.Arguments))
+	for i, argument := range method.Arguments {
+		arguments[i] = reader.readConstant(argument)
+	}
+	return reader.readHandle(reader.Class.GetConstant(method.MethodRef).(*MethodHandleInfo)), arguments
+}
+
+func (reader *ClassReader) readAnnotations(data []byte, visible bool, visit func(descriptor string, visible bool) AnnotationVisitor) {
+	buf := bytes.Buffer{Data: &data, Index: 0}
+	for count := buf.ReadU16(); count > 0; count-- {
+		reader.readAnnotation(&buf, visit(reader.Class.GetUtf8(buf.ReadU16()), visible))
+	}
+}
+
+// readAnnotation reads the element value pairs of an annotation whose type index was already read.
+func (reader *ClassReader) readAnnotation(buf *bytes.Buffer, visitor AnnotationVisitor) {
+	for count := buf.ReadU16(); count > 0; count-- {
+		reader.readElementValue(buf, visitor, reader.Class.GetUtf8(buf.ReadU16()))
+	}
+	if visitor != nil {
+		visitor.VisitEnd()
+	}
+}
+
+func (reader *ClassReader) readElementValue(buf *bytes.Buffer, visitor AnnotationVisitor, name string) {
+	class := reader.Class
+	tag := buf.ReadByte()
+	switch tag {
+	case 'e':
+		descriptor, value := class.GetUtf8(buf.ReadU16()), class.GetUtf8(buf.ReadU16())
+		if visitor != nil {
+			visitor.VisitEnum(name, descriptor, value)
+		}
+	case '@':
+		descriptor := class.GetUtf8(buf.ReadU16())
+		var child AnnotationVisitor
+		if visitor != nil {
+			child = visitor.VisitAnnotation(name, descriptor)
+		}
+		reader.readAnnotation(buf, child)
+	case '[':
+		var child AnnotationVisitor
+		if visitor != nil {
+			child = visitor.VisitArray(name)
+		}
+		for count := buf.ReadU16(); count > 0; count-- {
+			reader.readElementValue(buf, child, "")
+		}
+		if child != nil {
+			child.VisitEnd()
+		}
+	default:
+		index := buf.ReadU16()
+		if visitor == nil {
+			return
+		}
+
+		var value any
+		switch tag {
+		case 'B':
+			value = int8(reader.readConstant(index).(int32))
+		case 'C':
+			value = uint16(reader.readConstant(index).(int32))
+		case 'S':
+			value = int16(reader.readConstant(index).(int32))
+		case 'Z':
+			value = reader.readConstant(index).(int32) != 0
+		case 's':
+			value = class.GetUtf8(index)
+		case 'c':
+			value = ClassConstant{class.GetUtf8(index)}
+		default:
+			value = reader.readConstant(index)
+		}
+		visitor.Visit(name, value)
+	}
+}
+
+// Accept makes the visitor visit the class.
+func (reader *ClassReader) Accept(visitor ClassVisitor, flags int) error {
+	class := reader.Class
+
+	var signature, source, debug string
+	var nestHost, enclosing, nestMembers, permittedSubclasses, innerClasses *AttributeInfo
+	var annotations []*AttributeInfo
+	var attributes []Attribute
+
+	for i := range class.Attributes {
+		attribute := &class.Attributes[i]
+		switch name := class.GetAttributeName(attribute); name {
+		case "Signature":
+			signature = class.GetUtf8(binary.BigEndian.Uint16(attribute.Data))
+		case "SourceFile":
+			source = class.GetUtf8(binary.BigEndian.Uint16(attribute.Data))
+		case "SourceDebugExtension":
+			debug = string(attribute.Data)
+		case "NestHost":
+			nestHost = attribute
+		case "EnclosingMethod":
+			enclosing = attribute
+		case "NestMembers":
+			nestMembers = attribute
+		case "PermittedSubclasses":
+			permittedSubclasses = attribute
+		case "InnerClasses":
+			innerClasses = attribute
+		case "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations":
+			annotations = append(annotations, attribute)
+		case "BootstrapMethods":
+		default:
+			attributes = append(attributes, Attribute{name, attribute.Data})
+		}
+	}
+
+	var interfaces []string
+	for _, index := range class.Interfaces {
+		interfaces = append(interfaces, class.GetClassInfoName(index))
+	}
+	visitor.Visit(int(class.MajorVersion)|int(class.MinorVersion)<<16, int(class.AccessFlags), class.GetClassName(), signature, class.GetClassInfoName(class.SuperClass), interfaces)
+
+	if flags&SkipDebug == 0 && (source != "" || debug != "") {
+		visitor.VisitSource(source, debug)
+	}
+	if nestHost != nil {
+		visitor.VisitNestHost(class.GetClassInfoName(binary.BigEndian.Uint16(nestHost.Data)))
+	}
+	if enclosing != nil {
+		owner := class.GetClassInfoName(binary.BigEndian.Uint16(enclosing.Data))
+		var name, descriptor string
+		if method := binary.BigEndian.Uint16(enclosing.Data[2:]); method != 0 {
+			name, descriptor = class.GetNameAndType(method)
+		}
+		visitor.VisitOuterClass(owner, name, descriptor)
+	}
+	for _, attribute := range annotations {
+		reader.readAnnotations(attribute.Data, class.GetAttributeName(attribute) == "RuntimeVisibleAnnotations", visitor.VisitAnnotation)
+	}
+	for _, attribute := range attributes {
+		visitor.VisitAttribute(attribute)
+	}
+	if nestMembers != nil {
+		for _, name := range reader.readClassList(nestMembers.Data) {
+			visitor.VisitNestMember(name)
+		}
+	}
+	if permittedSubclasses != nil {
+		for _, name := range reader.readClassList(permittedSubclasses.Data) {
+			visitor.VisitPermittedSubclass(name)
+		}
+	}
+	if innerClasses != nil {
+		buf := bytes.Buffer{Data: &innerClasses.Data, Index: 0}
+		for count := buf.ReadU16(); count > 0; count-- {
+			inner, outer, name := buf.ReadU16(), buf.ReadU16(), buf.ReadU16()
+			visitor.VisitInnerClass(class.GetClassInfoName(inner), class.GetClassInfoName(outer), class.GetUtf8(name), int(buf.ReadU16()))
+		}
+	}
+
+	for i := range class.Fields {
+		reader.readField(visitor, &class.Fields[i])
+	}
+	for i := range class.Methods {
+		if err := reader.readMethod(visitor, &class.Methods[i], flags); err != nil {
+			return err
+		}
+	}
+
+	visitor.VisitEnd()
+	return nil
+}
+
+func (reader *ClassReader) readClassList(data []byte) []string {
+	buf := bytes.Buffer{Data: &data, Index: 0}
+	names := make([]string, buf.ReadU16())
+	for i := range names {
+		names[i] = reader.Class.GetClassInfoName(buf.ReadU16())
+	}
+	return names
+}
+
+func (reader *ClassReader) readField(classVisitor ClassVisitor, field *FieldInfo) {
+	class := reader.Class
+
+	var signature string
+	var value any
+	var annotations []*AttributeInfo
+	var attributes []Attribute
+
+	for i := range field.Attributes {
+		attribute := &field.Attributes[i]
+		switch name := class.GetAttributeName(attribute); name {
+		case "Signature":
+			signature = class.GetUtf8(binary.BigEndian.Uint16(attribute.Data))
+		case "ConstantValue":
+			value = reader.readConstant(binary.BigEndian.Uint16(attribute.Data))
+		case "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations":
+			annotations = append(annotations, attribute)
+		default:
+			attributes = append(attributes, Attribute{name, attribute.Data})
+		}
+	}
+
+	visitor := classVisitor.VisitField(int(field.AccessFlags), field.GetName(), field.GetDescriptor(), signature, value)
+	if visitor == nil {
+		return
+	}
+	for _, attribute := range annotations {
+		reader.readAnnotations(attribute.Data, class.GetAttributeName(attribute) == "RuntimeVisibleAnnotations", visitor.VisitAnnotation)
+	}
+	for _, attribute := range attributes {
+		visitor.VisitAttribute(attribute)
+	}
+	visitor.VisitEnd()
+}
+
+func (reader *ClassReader) readMethod(classVisitor ClassVisitor, method *MethodInfo, flags int) error {
+	class := reader.Class
+
+	var signature string
+	var exceptions []string
+	var code, parameters, annotationDefault *AttributeInfo
+	var annotations, parameterAnnotations []*AttributeInfo
+	var attributes []Attribute
+
+	for i := range method.Attributes {
+		attribute := &method.Attributes[i]
+		switch name := class.GetAttributeName(attribute); name {
+		case "Signature":
+			signature = class.GetUtf8(binary.BigEndian.Uint16(attribute.Data))
+		case "Exceptions":
+			exceptions = reader.readClassList(attribute.Data)
+		case "Code":
+			code = attribute
+		case "MethodParameters":
+			parameters = attribute
+		case "AnnotationDefault":
+			annotationDefault = attribute
+		case "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations":
+			annotations = append(annotations, attribute)
+		case "RuntimeVisibleParameterAnnotations", "RuntimeInvisibleParameterAnnotations":
+			parameterAnnotations = append(parameterAnnotations, attribute)
+		default:
+			attributes = append(attributes, Attribute{name, attribute.Data})
+		}
+	}
+
+	visitor := classVisitor.VisitMethod(int(method.AccessFlags), method.GetName(), method.GetDescriptor(), signature, exceptions)
+	if visitor == nil {
+		return nil
+	}
+
+	if parameters != nil && flags&SkipDebug == 0 {
+		buf := bytes.Buffer{Data: &parameters.Data, Index: 0}
+		for count := buf.ReadByte(); count > 0; count-- {
+			name := class.GetUtf8(buf.ReadU16())
+			visitor.VisitParameter(name, int(buf.ReadU16()))
+		}
+	}
+	if annotationDefault != nil {
+		buf := bytes.Buffer{Data: &annotationDefault.Data, Index: 0}
+		annotation := visitor.VisitAnnotationDefault()
+		reader.readElementValue(&buf, annotation, "")
+		if annotation != nil {
+			annotation.VisitEnd()
+		}
+	}
+	for _, attribute := range annotations {
+		reader.readAnnotations(attribute.Data, class.GetAttributeName(attribute) == "RuntimeVisibleAnnotations", visitor.VisitAnnotation)
+	}
+	for _, attribute := range parameterAnnotations {
+		visible := class.GetAttributeName(attribute) == "RuntimeVisibleParameterAnnotations"
+		buf := bytes.Buffer{Data: &attribute.Data, Index: 0}
+		count := int(buf.ReadByte())
+		for parameter := 0; parameter < count; parameter++ {
+			for annotations := buf.ReadU16(); annotations > 0; annotations-- {
+				reader.readAnnotation(&buf, visitor.VisitParameterAnnotation(parameter, class.GetUtf8(buf.ReadU16()), visible))
+			}
+		}
+	}
+	for _, attribute := range attributes {
+		visitor.VisitAttribute(attribute)
+	}
+
+	if code != nil && flags&SkipCode == 0 {
+		var attribute CodeAttribute
+		attribute.Read(&bytes.Buffer{Data: &code.Data, Index: 0})
+		if err := reader.readCode(visitor, method, &attribute, flags); err != nil {
+			return err
+		}
+	}
+	visitor.VisitEnd()
+	return nil
+}
+
+type frame struct {
+	locals []any
+	stack  []any
+}
+
+type localVariable struct {
+	start, length, index uint16
+	name, descriptor     string
+	signature            string
+}
+
+func (reader *ClassReader) readCode(visitor MethodVisitor, method *MethodInfo, code *CodeAttribute, flags int) error {
+	class := reader.Class
+	b := code.Code
+
+	labels := map[int]*Label{}
+	label := func(offset int) *Label {
+		if l, ok := labels[offset]; ok {
+			return l
+		}
+		l := &Label{offset}
+		labels[offset] = l
+		return l
+	}
+	u16 := func(offset int) int { return int(binary.BigEndian.Uint16(b[offset:])) }
+	s32 := func(offset int) int { return int(int32(binary.BigEndian.Uint32(b[offset:]))) }
+
+	err := ForInstruction(b, func(offset int, opcode byte) error {
+		switch operands[opcode] {
+		case operandJump:
+			label(offset + int(int16(u16(offset+1))))
+		case operandJumpWide:
+			label(offset + s32(offset+1))
+		case operandTableSwitch:
+			base := offset + 4 - offset%4
+			label(offset + s32(base))
+			for i := s32(base+8) - s32(base+4); i >= 0; i-- {
+				label(offset + s32(base+12+i*4))
+			}
+		case operandLookupSwitch:
+			base := offset + 4 - offset%4
+			label(offset + s32(base))
+			for i := s32(base+4) - 1; i >= 0; i-- {
+				label(offset + s32(base+12+i*8))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range code.ExceptionTable {
+		label(int(entry.StartPc))
+		label(int(entry.EndPc))
+		label(int(entry.HandlerPc))
+	}
+
+	lines := map[int][]int{}
+	var variables []*localVariable
+	signatures := map[[3]uint16]string{}
+	frames := map[int]frame{}
+	var attributes []Attribute
+
+	for i := range code.Attributes {
+		attribute := &code.Attributes[i]
+		buf := bytes.Buffer{Data: &attribute.Data, Index: 0}
+		switch name := class.GetAttributeName(attribute); name {
+		case "LineNumberTable":
+			if flags&SkipDebug != 0 {
+				continue
+			}
+			for count := buf.ReadU16(); count > 0; count-- {
+				start := int(buf.ReadU16())
+				label(start)
+				lines[start] = append(lines[start], int(buf.ReadU16()))
+			}
+		case "LocalVariableTable", "LocalVariableTypeTable":
+			if flags&SkipDebug != 0 {
+				continue
+			}
+			typed := class.GetAttributeName(attribute) == "LocalVariableTypeTable"
+			for count := buf.ReadU16(); count > 0; count-- {
+				variable := &localVariable{start: buf.ReadU16(), length: buf.ReadU16()}
+				variable.name = class.GetUtf8(buf.ReadU16())
+				variable.descriptor = class.GetUtf8(buf.ReadU16())
+				variable.index = buf.ReadU16()
+				label(int(variable.start))
+				label(int(variable.start + variable.length))
+				if typed {
+					signatures[[3]uint16{variable.start, variable.length, variable.index}] = variable.descriptor
+				} else {
+					variables = append(variables, variable)
+				}
+			}
+		case "StackMapTable":
+			if flags&SkipFrames != 0 {
+				continue
+			}
+			reader.readFrames(&buf, method, label, frames)
+		default:
+			attributes = append(attributes, Attribute{name, attribute.Data})
+		}
+	}
+
+	visitor.VisitCode()
+	for _, entry := range code.ExceptionTable {
+		visitor.VisitTryCatchBlock(labels[int(entry.StartPc)], labels[int(entry.EndPc)], labels[int(entry.HandlerPc)], class.GetClassInfoName(entry.CatchType))
+	}
+
+	err = ForInstruction(b, func(offset int, opcode byte) error {
+		if l, ok := labels[offset]; ok {
+			visitor.VisitLabel(l)
+			for _, line := range lines[offset] {
+				visitor.VisitLineNumber(line, l)
+			}
+		}
+		if f, ok := frames[offset]; ok {
+			visitor.VisitFrame(f.locals, f.stack)
+		}
+
+		op := int(opcode)
+		switch operands[opcode] {
+		case operandNone:
+			switch {
+			case op >= ILOAD_0 && op < ALOAD_0+4:
+				visitor.VisitVarInsn(ILOAD+(op-ILOAD_0)/4, (op-ILOAD_0)%4)
+			case op >= ISTORE_0 && op < ASTORE_0+4:
+				visitor.VisitVarInsn(ISTORE+(op-ISTORE_0)/4, (op-ISTORE_0)%4)
+			default:
+				visitor.VisitInsn(op)
+			}
+		case operandByte:
+			if op == BIPUSH {
+				visitor.VisitIntInsn(op, int(int8(b[offset+1])))
+			} else {
+				visitor.VisitIntInsn(op, int(b[offset+1]))
+			}
+		case operandShort:
+			visitor.VisitIntInsn(op, int(int16(u16(offset+1))))
+		case operandVar:
+			visitor.VisitVarInsn(op, int(b[offset+1]))
+		case operandLdc:
+			visitor.VisitLdcInsn(reader.readConstant(uint16(b[offset+1])))
+		case operandLdcWide:
+			visitor.VisitLdcInsn(reader.readConstant(uint16(u16(offset + 1))))
+		case operandField:
+			owner, name, descriptor := class.GetRef(uint16(u16(offset + 1)))
+			visitor.VisitFieldInsn(op, owner, name, descriptor)
+		case operandMethod, operandInterfaceMethod:
+			index := uint16(u16(offset + 1))
+			owner, name, descriptor := class.GetRef(index)
+			_, isInterface := class.GetConstant(index).(*InterfaceMethodRefInfo)
+			visitor.VisitMethodInsn(op, owner, name, descriptor, isInterface)
+		case operandInvokeDynamic:
+			info := class.GetConstant(uint16(u16(offset + 1))).(*InvokeDynamicInfo)
+			name, descriptor := class.GetNameAndType(info.NameAndTypeIndex)
+			bootstrap, arguments := reader.readBootstrapMethod(info.BootstrapMethodAttrIndex)
+			visitor.VisitInvokeDynamicInsn(name, descriptor, bootstrap, arguments...)
+		case operandType:
+			visitor.VisitTypeInsn(op, class.GetClassInfoName(uint16(u16(offset+1))))
+		case operandJump:
+			visitor.VisitJumpInsn(op, labels[offset+int(int16(u16(offset+1)))])
+		case operandJumpWide:
+			visitor.VisitJumpInsn(op-GOTO_W+GOTO, labels[offset+s32(offset+1)])
+		case operandIinc:
+			visitor.VisitIincInsn(int(b[offset+1]), int(int8(b[offset+2])))
+		case operandWide:
+			if b[offset+1] == IINC {
+				visitor.VisitIincInsn(u16(offset+2), int(int16(u16(offset+4))))
+			} else {
+				visitor.VisitVarInsn(int(b[offset+1]), u16(offset+2))
+			}
+		case operandTableSwitch:
+			base := offset + 4 - offset%4
+			low, high := s32(base+4), s32(base+8)
+			targets := make([]*Label, high-low+1)
+			for i := range targets {
+				targets[i] = labels[offset+s32(base+12+i*4)]
+			}
+			visitor.VisitTableSwitchInsn(low, high, labels[offset+s32(base)], targets...)
+		case operandLookupSwitch:
+			base := offset + 4 - offset%4
+			keys := make([]int, s32(base+4))
+			targets := make([]*Label, len(keys))
+			for i := range keys {
+				keys[i] = s32(base + 8 + i*8)
+				targets[i] = labels[offset+s32(base+12+i*8)]
+			}
+			visitor.VisitLookupSwitchInsn(labels[offset+s32(base)], keys, targets)
+		case operandMultiANewArray:
+			visitor.VisitMultiANewArrayInsn(class.GetClassInfoName(uint16(u16(offset+1))), int(b[offset+3]))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if l, ok := labels[len(b)]; ok {
+		visitor.VisitLabel(l)
+	}
+	for _, variable := range variables {
+		signature := signatures[[3]uint16{variable.start, variable.length, variable.index}]
+		visitor.VisitLocalVariable(variable.name, variable.descriptor, signature, labels[int(variable.start)], labels[int(variable.start+variable.length)], int(variable.index))
+	}
+	for _, attribute := range attributes {
+		visitor.VisitAttribute(attribute)
+	}
+	visitor.VisitMaxs(int(code.MaxStack), int(code.MaxLocals))
+	return nil
+}
+
+// frameType returns the verification type of a value of the given field descriptor.
+func frameType(descriptor string) any {
+	switch descriptor[0] {
+	case 'Z', 'B', 'C', 'S', 'I':
+		return ITEM_Integer
+	case 'F':
+		return ITEM_Float
+	case 'J':
+		return ITEM_Long
+	case 'D':
+		return ITEM_Double
+	case 'L':
+		return descriptor[1 : len(descriptor)-1]
+	}
+	return descriptor
+}
+
+// methodArguments splits a method descriptor into its argument descriptors.
+func methodArguments(descriptor string) []string {
+	var arguments []string
+	end := strings.IndexByte(descriptor, ')')
+	for i := 1; i < end; {
+		start := i
+		for descriptor[i] == '[' {
+			i++
+		}
+		if descriptor[i] == 'L' {
+			i += strings.IndexByte(descriptor[i:], ';')
+		}
+		i++
+		arguments = append(arguments, descriptor[start:i])
+	}
+	return arguments
+}
+
+func (reader *ClassReader) readFrames(buf *bytes.Buffer, method *MethodInfo, label func(int) *Label, frames map[int]frame) {
+	class := reader.Class
+
+	var locals []any
+	if method.AccessFlags&ACC_STATIC == 0 {
+		if method.GetName() == "<init>" && class.GetClassName() != "java/lang/Object" {
+			locals = append(locals, ITEM_UninitializedThis)
+		} else {
+			locals = append(locals, class.GetClassName())
+		}
+	}
+	for _, argument := range methodArguments(method.GetDescriptor()) {
+		locals = append(locals, frameType(argument))
+	}
+
+	readType := func() any {
+		switch tag := buf.ReadByte(); tag {
+		case ITEM_Object:
+			return class.GetClassInfoName(buf.ReadU16())
+		case ITEM_Uninitialized:
+			return label(int(buf.ReadU16()))
+		default:
+			return int(tag)
+		}
+	}
+	readTypes := func(count int) []any {
+		types := make([]any, count)
+		for i := range types {
+			types[i] = readType()
+		}
+		return types
+	}
+
+	offset := -1
+	for count := buf.ReadU16(); count > 0; count-- {
+		var stack []any
+		frameType := int(buf.ReadByte())
+		delta := frameType
+
+		switch {
+		case frameType < 64:
+		case frameType < 128:
+			delta = frameType - 64
+			stack = readTypes(1)
+		case frameType == 247:
+			delta = int(buf.ReadU16())
+			stack = readTypes(1)
+		case frameType >= 248 && frameType <= 250:
+			delta = int(buf.ReadU16())
+			locals = locals[:len(locals)-(251-frameType)]
+		case frameType == 251:
+			delta = int(buf.ReadU16())
+		case frameType >= 252 && frameType <= 254:
+			delta = int(buf.ReadU16())
+			locals = append(locals[:len(locals):len(locals)], readTypes(frameType-251)...)
+		case frameType == 255:
+			delta = int(buf.ReadU16())
+			locals = readTypes(int(buf.ReadU16()))
+			stack = readTypes(int(buf.ReadU16()))
+		}
+
+		offset += delta + 1
+		label(offset)
+		frames[offset] = frame{append([]any{}, locals...), stack}
+	}
+}
@@ -0,0 +1,1122 @@
+package babe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mrnavastar/assist/bytes"
+)
+
+var ErrUnvisitedLabel = errors.New("jarhax: label used but never visited")
+var ErrMissingFrame = errors.New("jarhax: widened jump needs a stack map frame after it")
+
+const (
+	ComputeMaxs = 1 << iota // Compute max stack and max locals, ignoring VisitMaxs
+)
+
+// ClassWriter is a ClassVisitor that builds a Class from the calls it receives. A writer created from a
+// ClassReader starts with a copy of the reader's constant pool and bootstrap methods, so attributes the
+// visitors pass through unmodelled stay valid.
+type ClassWriter struct {
+	class            *Class
+	flags            int
+	bootstrapMethods []BootstrapMethod
+	bootstrapIndex   map[string]uint16
+	attributes       []AttributeInfo
+	annotations      annotationSet
+	nestMembers      []uint16
+	permitted        []uint16
+	innerClasses     *bytes.Buffer
+	innerCount       int
+	fields           []*fieldWriter
+	methods          []*methodWriter
+	err              error
+}
+
+func NewClassWriter(reader *ClassReader, flags int) *ClassWriter {
+	writer := &ClassWriter{class: &Class{Magic: 0xCAFEBABE, ConstantPoolCount: 1}, flags: flags, bootstrapIndex: map[string]uint16{}}
+	if reader == nil {
+		return writer
+	}
+
+	for _, constant := range reader.Class.ConstantPool {
+		writer.class.ConstantPool = append(writer.class.ConstantPool, copyConstant(constant))
+	}
+	writer.class.ConstantPoolCount = uint16(len(writer.class.ConstantPool) + 1)
+	for _, method := range reader.bootstrapMethods {
+		writer.addBootstrapMethod(method.MethodRef, slices.Clone(method.Arguments))
+	}
+	return writer
+}
+
+func copyConstant(constant Info) Info {
+	if constant == nil {
+		return nil
+	}
+	buf := bytes.NewBuffer()
+	constant.Write(buf)
+	copied := infoConstructors[(*buf.Data)[0]]()
+	copied.Read(&bytes.Buffer{Data: buf.Data, Index: 1})
+	return copied
+}
+
+// Class returns the written class. It is only complete once VisitEnd has been called.
+func (writer *ClassWriter) Class() (*Class, error) {
+	return writer.class, writer.err
+}
+
+func (writer *ClassWriter) Bytes() ([]byte, error) {
+	if writer.err != nil {
+		return nil, writer.err
+	}
+	data := []byte{}
+	writer.class.Write(&data)
+	return data, nil
+}
+
+func (writer *ClassWriter) attribute(name string, data []byte) AttributeInfo {
+	return AttributeInfo{writer.class.AddUtf8(name), uint32(len(data)), data}
+}
+
+func (writer *ClassWriter) u16Attribute(name string, value uint16) AttributeInfo {
+	return writer.attribute(name, []byte{byte(value >> 8), byte(value)})
+}
+
+func (writer *ClassWriter) classListAttribute(name string, indexes []uint16) AttributeInfo {
+	buf := bytes.NewBuffer()
+	buf.WriteU16(uint16(len(indexes)))
+	for _, index := range indexes {
+		buf.WriteU16(index)
+	}
+	return writer.attribute(name, *buf.Data)
+}
+
+func (writer *ClassWriter) addBootstrapMethod(methodRef uint16, arguments []uint16) uint16 {
+	key := fmt.Sprint(methodRef, arguments)
+	if index, ok := writer.bootstrapIndex[key]; ok {
+		return index
+	}
+	index := uint16(len(writer.bootstrapMethods))
+	writer.bootstrapMethods = append(writer.bootstrapMethods, BootstrapMethod{methodRef, arguments})
+	writer.bootstrapIndex[key] = index
+	return index
+}
+
+func (writer *ClassWriter) addHandle(handle Handle) uint16 {
+	var ref uint16
+	if handle.Kind <= REF_putStatic {
+		ref = writer.class.AddFieldRef(handle.Owner, handle.Name, handle.Descriptor)
+	} else {
+		ref = writer.class.AddMethodRef(handle.Owner, handle.Name, handle.Descriptor, handle.IsInterface)
+	}
+	return writer.class.AddConstant(&MethodHandleInfo{byte(handle.Kind), ref})
+}
+
+func (writer *ClassWriter) addBootstrap(bootstrap Handle, arguments []any) uint16 {
+	indexes := make([]uint16, len(arguments))
+	for i, argument := range arguments {
+		indexes[i] = writer.addConstant(argument)
+	}
+	return writer.addBootstrapMethod(writer.addHandle(bootstrap), indexes)
+}
+
+// addConstant adds a loadable constant as passed to VisitLdcInsn.
+func (writer *ClassWriter) addConstant(value any) uint16 {
+	class := writer.class
+	switch v := value.(type) {
+	case int32:
+		return class.AddInteger(v)
+	case int:
+		return class.AddInteger(int32(v))
+	case float32:
+		return class.AddFloat(v)
+	case int64:
+		return class.AddLong(v)
+	case float64:
+		return class.AddDouble(v)
+	case string:
+		return class.AddString(v)
+	case ClassConstant:
+		return class.AddClass(v.InternalName())
+	case MethodTypeConstant:
+		return class.AddMethodType(v.Descriptor)
+	case Handle:
+		return writer.addHandle(v)
+	case ConstantDynamic:
+		bootstrap := writer.addBootstrap(v.Bootstrap, v.Arguments)
+		return class.AddConstant(&DynamicInfo{bootstrap, class.AddNameAndType(v.Name, v.Descriptor)})
+	}
+	writer.fail(fmt.Errorf("jarhax: unsupported constant %T", value))
+	return 0
+}
+
+func (writer *ClassWriter) fail(err error) {
+	if writer.err == nil {
+		writer.err = err
+	}
+}
+
+func (writer *ClassWriter) Visit(version int, access int, name string, signature string, superName string, interfaces []string) {
+	class := writer.class
+	class.MajorVersion = uint16(version)
+	class.MinorVersion = uint16(version >> 16)
+	class.AccessFlags = uint16(access)
+	class.ThisClass = class.AddClass(name)
+	if superName != "" {
+		class.SuperClass = class.AddClass(superName)
+	}
+	for _, i := range interfaces {
+		class.Interfaces = append(class.Interfaces, class.AddClass(i))
+	}
+	class.InterfacesCount = uint16(len(class.Interfaces))
+	if signature != "" {
+		writer.attributes = append(writer.attributes, writer.u16Attribute("Signature", class.AddUtf8(signature)))
+	}
+}
+
+func (writer *ClassWriter) VisitSource(source string, debug string) {
+	if source != "" {
+		writer.attributes = append(writer.attributes, writer.u16Attribute("SourceFile", writer.class.AddUtf8(source)))
+	}
+	if debug != "" {
+		writer.attributes = append(writer.attributes, writer.attribute("SourceDebugExtension", []byte(debug)))
+	}
+}
+
+func (writer *ClassWriter) VisitNestHost(nestHost string) {
+	writer.attributes = append(writer.attributes, writer.u16Attribute("NestHost", writer.class.AddClass(nestHost)))
+}
+
+func (writer *ClassWriter) VisitOuterClass(owner string, name string, descriptor string) {
+	buf := bytes.NewBuffer()
+	buf.WriteU16(writer.class.AddClass(owner))
+	if name != "" {
+		buf.WriteU16(writer.class.AddNameAndType(name, descriptor))
+	} else {
+		buf.WriteU16(0)
+	}
+	writer.attributes = append(writer.attributes, writer.attribute("EnclosingMethod", *buf.Data))
+}
+
+func (writer *ClassWriter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	return writer.annotations.add(writer.class, descriptor, visible)
+}
+
+func (writer *ClassWriter) VisitAttribute(attribute Attribute) {
+	writer.attributes = append(writer.attributes, writer.attribute(attribute.Name, attribute.Data))
+}
+
+func (writer *ClassWriter) VisitNestMember(nestMember string) {
+	writer.nestMembers = append(writer.nestMembers, writer.class.AddClass(nestMember))
+}
+
+func (writer *ClassWriter) VisitPermittedSubclass(permittedSubclass string) {
+	writer.permitted = append(writer.permitted, writer.class.AddClass(permittedSubclass))
+}
+
+func (writer *ClassWriter) VisitInnerClass(name string, outerName string, innerName string, access int) {
+	if writer.innerClasses == nil {
+		writer.innerClasses = bytes.NewBuffer()
+	}
+	class := writer.class
+	writer.innerClasses.WriteU16(class.AddClass(name))
+	if outerName != "" {
+		writer.innerClasses.WriteU16(class.AddClass(outerName))
+	} else {
+		writer.innerClasses.WriteU16(0)
+	}
+	if innerName != "" {
+		writer.innerClasses.WriteU16(class.AddUtf8(innerName))
+	} else {
+		writer.innerClasses.WriteU16(0)
+	}
+	writer.innerClasses.WriteU16(uint16(access))
+	writer.innerCount++
+}
+
+func (writer *ClassWriter) VisitField(access int, name string, descriptor string, signature string, value any) FieldVisitor {
+	class := writer.class
+	field := &fieldWriter{writer: writer}
+	field.info = FieldInfo{class: class, AccessFlags: uint16(access), NameIndex: class.AddUtf8(name), DescriptorIndex: class.AddUtf8(descriptor)}
+	if signature != "" {
+		field.attributes = append(field.attributes, writer.u16Attribute("Signature", class.AddUtf8(signature)))
+	}
+	if value != nil {
+		switch v := value.(type) {
+		case bool:
+			value = int32(0)
+			if v {
+				value = int32(1)
+			}
+		case int8:
+			value = int32(v)
+		case int16:
+			value = int32(v)
+		case uint16:
+			value = int32(v)
+		}
+		field.attributes = append(field.attributes, writer.u16Attribute("ConstantValue", writer.addConstant(value)))
+	}
+	writer.fields = append(writer.fields, field)
+	return field
+}
+
+func (writer *ClassWriter) VisitMethod(access int, name string, descriptor string, signature string, exceptions []string) MethodVisitor {
+	class := writer.class
+	method := &methodWriter{writer: writer, descriptor: descriptor, labels: map[*Label]bool{}}
+	method.info = MethodInfo{FieldInfo{class: class, AccessFlags: uint16(access), NameIndex: class.AddUtf8(name), DescriptorIndex: class.AddUtf8(descriptor)}}
+	if signature != "" {
+		method.attributes = append(method.attributes, writer.u16Attribute("Signature", class.AddUtf8(signature)))
+	}
+	if len(exceptions) > 0 {
+		indexes := make([]uint16, len(exceptions))
+		for i, exception := range exceptions {
+			indexes[i] = class.AddClass(exception)
+		}
+		method.attributes = append(method.attributes, writer.classListAttribute("Exceptions", indexes))
+	}
+	writer.methods = append(writer.methods, method)
+	return method
+}
+
+func (writer *ClassWriter) VisitEnd() {
+	class := writer.class
+
+	for _, field := range writer.fields {
+		field.info.Attributes = append(field.attributes, field.annotations.attributes(writer)...)
+		field.info.AttributesCount = uint16(len(field.info.Attributes))
+		class.Fields = append(class.Fields, field.info)
+	}
+	class.FieldsCount = uint16(len(class.Fields))
+
+	for _, method := range writer.methods {
+		if err := method.finish(); err != nil {
+			writer.fail(err)
+		}
+		class.Methods = append(class.Methods, method.info)
+	}
+	class.MethodCount = uint16(len(class.Methods))
+
+	attributes := append(writer.attributes, writer.annotations.attributes(writer)...)
+	if len(writer.nestMembers) > 0 {
+		attributes = append(attributes, writer.classListAttribute("NestMembers", writer.nestMembers))
+	}
+	if len(writer.permitted) > 0 {
+		attributes = append(attributes, writer.classListAttribute("PermittedSubclasses", writer.permitted))
+	}
+	if writer.innerClasses != nil {
+		data := binary.BigEndian.AppendUint16(nil, uint16(writer.innerCount))
+		attributes = append(attributes, writer.attribute("InnerClasses", append(data, *writer.innerClasses.Data...)))
+	}
+	if len(writer.bootstrapMethods) > 0 {
+		buf := bytes.NewBuffer()
+		buf.WriteU16(uint16(len(writer.bootstrapMethods)))
+		for _, method := range writer.bootstrapMethods {
+			buf.WriteU16(method.MethodRef)
+			buf.WriteU16(uint16(len(method.Arguments)))
+			for _, argument := range method.Arguments {
+				buf.WriteU16(argument)
+			}
+		}
+		attributes = append(attributes, writer.attribute("BootstrapMethods", *buf.Data))
+	}
+	class.Attributes = attributes
+	class.AttributesCount = uint16(len(attributes))
+}
+
+type fieldWriter struct {
+	writer      *ClassWriter
+	info        FieldInfo
+	attributes  []AttributeInfo
+	annotations annotationSet
+}
+
+func (field *fieldWriter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	return field.annotations.add(field.writer.class, descriptor, visible)
+}
+
+func (field *fieldWriter) VisitAttribute(attribute Attribute) {
+	field.attributes = append(field.attributes, field.writer.attribute(attribute.Name, attribute.Data))
+}
+
+func (field *fieldWriter) VisitEnd() {}
+
+type annotationSet struct {
+	visible   []*annotationWriter
+	invisible []*annotationWriter
+}
+
+func (set *annotationSet) add(class *Class, descriptor string, visible bool) AnnotationVisitor {
+	annotation := newAnnotationWriter(class, bytes.NewBuffer(), true)
+	annotation.buf.WriteU16(class.AddUtf8(descriptor))
+	annotation.reserveCount()
+	if visible {
+		set.visible = append(set.visible, annotation)
+	} else {
+		set.invisible = append(set.invisible, annotation)
+	}
+	return annotation
+}
+
+func annotationsData(annotations []*annotationWriter) []byte {
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(annotations)))
+	for _, annotation := range annotations {
+		data = append(data, *annotation.buf.Data...)
+	}
+	return data
+}
+
+func (set *annotationSet) attributes(writer *ClassWriter) []AttributeInfo {
+	var attributes []AttributeInfo
+	if len(set.visible) > 0 {
+		attributes = append(attributes, writer.attribute("RuntimeVisibleAnnotations", annotationsData(set.visible)))
+	}
+	if len(set.invisible) > 0 {
+		attributes = append(attributes, writer.attribute("RuntimeInvisibleAnnotations", annotationsData(set.invisible)))
+	}
+	return attributes
+}
+
+// annotationWriter appends element values to buf. Nested annotations and arrays share the buffer
+// of their parent, which works because visits are strictly nested.
+type annotationWriter struct {
+	class       *Class
+	buf         *bytes.Buffer
+	named       bool
+	count       int
+	countOffset int
+}
+
+func newAnnotationWriter(class *Class, buf *bytes.Buffer, named bool) *annotationWriter {
+	return &annotationWriter{class: class, buf: buf, named: named, countOffset: -1}
+}
+
+func (annotation *annotationWriter) reserveCount() {
+	annotation.countOffset = annotation.buf.Len()
+	annotation.buf.WriteU16(0)
+}
+
+func (annotation *annotationWriter) element(name string, tag byte) {
+	annotation.count++
+	if annotation.named {
+		annotation.buf.WriteU16(annotation.class.AddUtf8(name))
+	}
+	annotation.buf.WriteByte(tag)
+}
+
+func (annotation *annotationWriter) Visit(name string, value any) {
+	class := annotation.class
+	switch v := value.(type) {
+	case bool:
+		annotation.element(name, 'Z')
+		if v {
+			annotation.buf.WriteU16(class.AddInteger(1))
+		} else {
+			annotation.buf.WriteU16(class.AddInteger(0))
+		}
+	case int8:
+		annotation.element(name, 'B')
+		annotation.buf.WriteU16(class.AddInteger(int32(v)))
+	case uint16:
+		annotation.element(name, 'C')
+		annotation.buf.WriteU16(class.AddInteger(int32(v)))
+	case int16:
+		annotation.element(name, 'S')
+		annotation.buf.WriteU16(class.AddInteger(int32(v)))
+	case int32:
+		annotation.element(name, 'I')
+		annotation.buf.WriteU16(class.AddInteger(v))
+	case int:
+		annotation.element(name, 'I')
+		annotation.buf.WriteU16(class.AddInteger(int32(v)))
+	case int64:
+		annotation.element(name, 'J')
+		annotation.buf.WriteU16(class.AddLong(v))
+	case float32:
+		annotation.element(name, 'F')
+		annotation.buf.WriteU16(class.AddFloat(v))
+	case float64:
+		annotation.element(name, 'D')
+		annotation.buf.WriteU16(class.AddDouble(v))
+	case string:
+		annotation.element(name, 's')
+		annotation.buf.WriteU16(class.AddUtf8(v))
+	case ClassConstant:
+		annotation.element(name, 'c')
+		annotation.buf.WriteU16(class.AddUtf8(v.Descriptor))
+	}
+}
+
+func (annotation *annotationWriter) VisitEnum(name string, descriptor string, value string) {
+	annotation.element(name, 'e')
+	annotation.buf.WriteU16(annotation.class.AddUtf8(descriptor))
+	annotation.buf.WriteU16(annotation.class.AddUtf8(value))
+}
+
+func (annotation *annotationWriter) VisitAnnotation(name string, descriptor string) AnnotationVisitor {
+	annotation.element(name, '@')
+	annotation.buf.WriteU16(annotation.class.AddUtf8(descriptor))
+	child := newAnnotationWriter(annotation.class, annotation.buf, true)
+	child.reserveCount()
+	return child
+}
+
+func (annotation *annotationWriter) VisitArray(name string) AnnotationVisitor {
+	annotation.element(name, '[')
+	child := newAnnotationWriter(annotation.class, annotation.buf, false)
+	child.reserveCount()
+	return child
+}
+
+func (annotation *annotationWriter) VisitEnd() {
+	if annotation.countOffset >= 0 {
+		binary.BigEndian.PutUint16((*annotation.buf.Data)[annotation.countOffset:], uint16(annotation.count))
+	}
+}
+
+const (
+	opInsn = iota
+	opLabel
+	opJump
+	opTableSwitch
+	opLookupSwitch
+	opFrame
+)
+
+type codeOp struct {
+	kind   int
+	bytes  []byte
+	stack  int
+	opcode byte
+	label  *Label
+	dflt   *Label
+	labels []*Label
+	keys   []int
+	min    int
+	wide   bool
+	frame  frame
+	offset int
+}
+
+func (op *codeOp) size(offset int) int {
+	switch op.kind {
+	case opInsn:
+		return len(op.bytes)
+	case opJump:
+		if !op.wide {
+			return 3
+		}
+		if op.opcode == GOTO || op.opcode == JSR {
+			return 5
+		}
+		return 8
+	case opTableSwitch:
+		return 1 + 3 - offset%4 + 12 + 4*len(op.labels)
+	case opLookupSwitch:
+		return 1 + 3 - offset%4 + 8 + 8*len(op.labels)
+	}
+	return 0
+}
+
+type tryCatchBlock struct {
+	start, end, handler *Label
+	catchType           uint16
+}
+
+type lineNumber struct {
+	line  int
+	start *Label
+}
+
+type localVariableEntry struct {
+	name, descriptor, signature string
+	start, end                  *Label
+	index                       int
+}
+
+type methodWriter struct {
+	writer               *ClassWriter
+	info                 MethodInfo
+	descriptor           string
+	attributes           []AttributeInfo
+	annotations          annotationSet
+	parameterAnnotations map[int]*annotationSet
+	annotationDefault    *annotationWriter
+	parameters           *bytes.Buffer
+	parameterCount       int
+
+	hasCode   bool
+	ops       []*codeOp
+	labels    map[*Label]bool
+	tryCatch  []tryCatchBlock
+	lines     []lineNumber
+	variables []localVariableEntry
+	// codeAttributes are the attributes visited after VisitCode
+	codeAttributes []AttributeInfo
+	maxStack       int
+	maxLocals      int
+	locals         int
+}
+
+func (method *methodWriter) class() *Class {
+	return method.writer.class
+}
+
+func (method *methodWriter) VisitParameter(name string, access int) {
+	if method.parameters == nil {
+		method.parameters = bytes.NewBuffer()
+	}
+	if name != "" {
+		method.parameters.WriteU16(method.class().AddUtf8(name))
+	} else {
+		method.parameters.WriteU16(0)
+	}
+	method.parameters.WriteU16(uint16(access))
+	method.parameterCount++
+}
+
+func (method *methodWriter) VisitAnnotationDefault() AnnotationVisitor {
+	method.annotationDefault = newAnnotationWriter(method.class(), bytes.NewBuffer(), false)
+	return method.annotationDefault
+}
+
+func (method *methodWriter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	return method.annotations.add(method.class(), descriptor, visible)
+}
+
+func (method *methodWriter) VisitParameterAnnotation(parameter int, descriptor string, visible bool) AnnotationVisitor {
+	if method.parameterAnnotations == nil {
+		method.parameterAnnotations = map[int]*annotationSet{}
+	}
+	set, ok := method.parameterAnnotations[parameter]
+	if !ok {
+		set = &annotationSet{}
+		method.parameterAnnotations[parameter] = set
+	}
+	return set.add(method.class(), descriptor, visible)
+}
+
+func (method *methodWriter) VisitAttribute(attribute Attribute) {
+	if method.hasCode {
+		method.codeAttributes = append(method.codeAttributes, method.writer.attribute(attribute.Name, attribute.Data))
+	} else {
+		method.attributes = append(method.attributes, method.writer.attribute(attribute.Name, attribute.Data))
+	}
+}
+
+func (method *methodWriter) VisitCode() {
+	method.hasCode = true
+}
+
+func (method *methodWriter) insn(b ...byte) *codeOp {
+	op := &codeOp{kind: opInsn, bytes: b, stack: stackEffect(b[0])}
+	if b[0] == WIDE {
+		op.stack = stackEffect(b[1])
+	}
+	method.ops = append(method.ops, op)
+	return op
+}
+
+// local records that the instruction uses the local variable at index.
+func (method *methodWriter) local(index int, opcode int) {
+	size := 1
+	switch opcode {
+	case LLOAD, DLOAD, LSTORE, DSTORE:
+		size = 2
+	}
+	method.locals = max(method.locals, index+size)
+}
+
+func (method *methodWriter) VisitFrame(locals []any, stack []any) {
+	method.ops = append(method.ops, &codeOp{kind: opFrame, frame: frame{slices.Clone(locals), slices.Clone(stack)}})
+}
+
+func (method *methodWriter) VisitInsn(opcode int) {
+	method.insn(byte(opcode))
+}
+
+func (method *methodWriter) VisitIntInsn(opcode int, operand int) {
+	if opcode == SIPUSH {
+		method.insn(byte(opcode), byte(operand>>8), byte(operand))
+	} else {
+		method.insn(byte(opcode), byte(operand))
+	}
+}
+
+func (method *methodWriter) VisitVarInsn(opcode int, index int) {
+	method.local(index, opcode)
+	switch {
+	case index < 4 && opcode != RET && opcode < ISTORE:
+		method.insn(byte(ILOAD_0 + (opcode-ILOAD)*4 + index))
+	case index < 4 && opcode != RET:
+		method.insn(byte(ISTORE_0 + (opcode-ISTORE)*4 + index))
+	case index < 256:
+		method.insn(byte(opcode), byte(index))
+	default:
+		method.insn(WIDE, byte(opcode), byte(index>>8), byte(index))
+	}
+}
+
+func (method *methodWriter) VisitTypeInsn(opcode int, typ string) {
+	index := method.class().AddClass(typ)
+	method.insn(byte(opcode), byte(index>>8), byte(index))
+}
+
+func (method *methodWriter) VisitFieldInsn(opcode int, owner string, name string, descriptor string) {
+	index := method.class().AddFieldRef(owner, name, descriptor)
+	size := 1
+	if descriptor == "J" || descriptor == "D" {
+		size = 2
+	}
+	op := method.insn(byte(opcode), byte(index>>8), byte(index))
+	switch opcode {
+	case GETSTATIC:
+		op.stack = size
+	case PUTSTATIC:
+		op.stack = -size
+	case GETFIELD:
+		op.stack = size - 1
+	case PUTFIELD:
+		op.stack = -size - 1
+	}
+}
+
+func (method *methodWriter) VisitMethodInsn(opcode int, owner string, name string, descriptor string, isInterface bool) {
+	index := method.class().AddMethodRef(owner, name, descriptor, isInterface)
+	var op *codeOp
+	if opcode == INVOKEINTERFACE {
+		op = method.insn(byte(opcode), byte(index>>8), byte(index), byte(method.argumentSlots(descriptor)+1), 0)
+	} else {
+		op = method.insn(byte(opcode), byte(index>>8), byte(index))
+	}
+	op.stack = method.returnSlots(descriptor) - method.argumentSlots(descriptor)
+	if opcode != INVOKESTATIC {
+		op.stack--
+	}
+}
+
+// argumentSlots returns the number of local variable slots taken by the arguments of a method descriptor. A malformed
+// descriptor fails the class.
+func (method *methodWriter) argumentSlots(descriptor string) int {
+	parsed, err := ParseMethodDescriptor(descriptor)
+	if err != nil {
+		method.writer.fail(err)
+	}
+	return parsed.ParameterSlots()
+}
+
+// returnSlots returns the number of stack slots taken by the return value of a method descriptor.
+func (method *methodWriter) returnSlots(descriptor string) int {
+	parsed, err := ParseMethodDescriptor(descriptor)
+	if err != nil {
+		method.writer.fail(err)
+	}
+	return parsed.Return.Slots()
+}
+
+func (method *methodWriter) VisitInvokeDynamicInsn(name string, descriptor string, bootstrap Handle, arguments ...any) {
+	class := method.class()
+	index := class.AddConstant(&InvokeDynamicInfo{DynamicInfo{method.writer.addBootstrap(bootstrap, arguments), class.AddNameAndType(name, descriptor)}})
+	method.insn(INVOKEDYNAMIC, byte(index>>8), byte(index), 0, 0).stack = method.returnSlots(descriptor) - method.argumentSlots(descriptor)
+}
+
+func (method *methodWriter) VisitJumpInsn(opcode int, label *Label) {
+	method.ops = append(method.ops, &codeOp{kind: opJump, opcode: byte(opcode), label: label, stack: stackEffect(byte(opcode))})
+}
+
+func (method *methodWriter) VisitLabel(label *Label) {
+	method.labels[label] = true
+	method.ops = append(method.ops, &codeOp{kind: opLabel, label: label})
+}
+
+func (method *methodWriter) VisitLdcInsn(value any) {
+	index := method.writer.addConstant(value)
+	switch value.(type) {
+	case int64, float64:
+		method.insn(LDC2_W, byte(index>>8), byte(index))
+	default:
+		if dynamic, ok := value.(ConstantDynamic); ok && (dynamic.Descriptor == "J" || dynamic.Descriptor == "D") {
+			method.insn(LDC2_W, byte(index>>8), byte(index))
+		} else if index < 256 {
+			method.insn(LDC, byte(index))
+		} else {
+			method.insn(LDC_W, byte(index>>8), byte(index))
+		}
+	}
+}
+
+func (method *methodWriter) VisitIincInsn(index int, increment int) {
+	method.local(index, IINC)
+	if index < 256 && increment >= -128 && increment <= 127 {
+		method.insn(IINC, byte(index), byte(increment))
+	} else {
+		method.insn(WIDE, IINC, byte(index>>8), byte(index), byte(increment>>8), byte(increment))
+	}
+}
+
+func (method *methodWriter) VisitTableSwitchInsn(min int, max int, dflt *Label, labels ...*Label) {
+	method.ops = append(method.ops, &codeOp{kind: opTableSwitch, opcode: TABLESWITCH, min: min, dflt: dflt, labels: labels, stack: -1})
+}
+
+func (method *methodWriter) VisitLookupSwitchInsn(dflt *Label, keys []int, labels []*Label) {
+	method.ops = append(method.ops, &codeOp{kind: opLookupSwitch, opcode: LOOKUPSWITCH, dflt: dflt, keys: keys, labels: labels, stack: -1})
+}
+
+func (method *methodWriter) VisitMultiANewArrayInsn(descriptor string, dimensions int) {
+	index := method.class().AddClass(descriptor)
+	method.insn(MULTIANEWARRAY, byte(index>>8), byte(index), byte(dimensions)).stack = 1 - dimensions
+}
+
+func (method *methodWriter) VisitTryCatchBlock(start *Label, end *Label, handler *Label, typ string) {
+	var catchType uint16
+	if typ != "" {
+		catchType = method.class().AddClass(typ)
+	}
+	method.tryCatch = append(method.tryCatch, tryCatchBlock{start, end, handler, catchType})
+}
+
+func (method *methodWriter) VisitLocalVariable(name string, descriptor string, signature string, start *Label, end *Label, index int) {
+	method.variables = append(method.variables, localVariableEntry{name, descriptor, signature, start, end, index})
+}
+
+func (method *methodWriter) VisitLineNumber(line int, start *Label) {
+	method.lines = append(method.lines, lineNumber{line, start})
+}
+
+func (method *methodWriter) VisitMaxs(maxStack int, maxLocals int) {
+	method.maxStack = maxStack
+	method.maxLocals = maxLocals
+}
+
+func (method *methodWriter) VisitEnd() {}
+
+func (method *methodWriter) finish() error {
+	writer := method.writer
+	attributes := method.attributes
+
+	if method.hasCode {
+		code, err := method.assemble()
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", method.info.GetName(), method.descriptor, err)
+		}
+		data := []byte{}
+		code.Write(&bytes.Buffer{Data: &data, Index: 0})
+		attributes = append(attributes, writer.attribute("Code", data))
+	}
+	if method.parameters != nil {
+		data := append([]byte{byte(method.parameterCount)}, *method.parameters.Data...)
+		attributes = append(attributes, writer.attribute("MethodParameters", data))
+	}
+	if method.annotationDefault != nil {
+		attributes = append(attributes, writer.attribute("AnnotationDefault", *method.annotationDefault.buf.Data))
+	}
+	attributes = append(attributes, method.annotations.attributes(writer)...)
+	if method.parameterAnnotations != nil {
+		count := len(methodArguments(method.descriptor))
+		for parameter := range method.parameterAnnotations {
+			count = max(count, parameter+1)
+		}
+		for _, visible := range []bool{true, false} {
+			data := []byte{byte(count)}
+			found := false
+			for parameter := 0; parameter < count; parameter++ {
+				var annotations []*annotationWriter
+				if set, ok := method.parameterAnnotations[parameter]; ok {
+					annotations = set.invisible
+					if visible {
+						annotations = set.visible
+					}
+				}
+				found = found || len(annotations) > 0
+				data = append(data, annotationsData(annotations)...)
+			}
+			if !found {
+				continue
+			}
+			if visible {
+				attributes = append(attributes, writer.attribute("RuntimeVisibleParameterAnnotations", data))
+			} else {
+				attributes = append(attributes, writer.attribute("RuntimeInvisibleParameterAnnotations", data))
+			}
+		}
+	}
+
+	method.info.Attributes = attributes
+	method.info.AttributesCount = uint16(len(attributes))
+	return nil
+}
+
+// layout assigns an offset to every op, widening jumps that don't fit in 16 bits until the layout is stable.
+func (method *methodWriter) layout() (int, error) {
+	for {
+		offset := 0
+		for _, op := range method.ops {
+			op.offset = offset
+			if op.kind == opLabel {
+				op.label.offset = offset
+			}
+			offset += op.size(offset)
+		}
+
+		stable := true
+		for _, op := range method.ops {
+			if op.kind == opJump && !op.wide {
+				if !method.labels[op.label] {
+					return 0, ErrUnvisitedLabel
+				}
+				if delta := op.label.offset - op.offset; delta < -32768 || delta > 32767 {
+					op.wide = true
+					stable = false
+				}
+			}
+		}
+		if stable {
+			return offset, nil
+		}
+	}
+}
+
+func (method *methodWriter) assemble() (*CodeAttribute, error) {
+	class := method.class()
+	size, err := method.layout()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range method.ops {
+		for _, label := range append([]*Label{op.label, op.dflt}, op.labels...) {
+			if label != nil && !method.labels[label] {
+				return nil, ErrUnvisitedLabel
+			}
+		}
+	}
+
+	if err := method.checkWideJumps(); err != nil {
+		return nil, err
+	}
+
+	code := make([]byte, 0, size)
+	for _, op := range method.ops {
+		switch op.kind {
+		case opInsn:
+			code = append(code, op.bytes...)
+		case opJump:
+			delta := op.label.offset - op.offset
+			switch {
+			case !op.wide:
+				code = append(code, op.opcode, byte(delta>>8), byte(delta))
+			case op.opcode == GOTO || op.opcode == JSR:
+				code = binary.BigEndian.AppendUint32(append(code, op.opcode+GOTO_W-GOTO), uint32(delta))
+			default:
+				opposite := op.opcode ^ 1
+				if op.opcode <= IF_ACMPNE {
+					opposite = ((op.opcode + 1) ^ 1) - 1
+				}
+				code = append(code, opposite, 0, 8, GOTO_W)
+				code = binary.BigEndian.AppendUint32(code, uint32(delta-3))
+			}
+		case opTableSwitch, opLookupSwitch:
+			code = append(code, op.opcode)
+			for len(code)%4 != 0 {
+				code = append(code, 0)
+			}
+			code = binary.BigEndian.AppendUint32(code, uint32(op.dflt.offset-op.offset))
+			if op.kind == opTableSwitch {
+				code = binary.BigEndian.AppendUint32(code, uint32(op.min))
+				code = binary.BigEndian.AppendUint32(code, uint32(op.min+len(op.labels)-1))
+				for _, label := range op.labels {
+					code = binary.BigEndian.AppendUint32(code, uint32(label.offset-op.offset))
+				}
+			} else {
+				code = binary.BigEndian.AppendUint32(code, uint32(len(op.labels)))
+				for i, label := range op.labels {
+					code = binary.BigEndian.AppendUint32(code, uint32(op.keys[i]))
+					code = binary.BigEndian.AppendUint32(code, uint32(label.offset-op.offset))
+				}
+			}
+		}
+	}
+
+	if method.writer.flags&ComputeMaxs != 0 {
+		method.computeMaxs()
+	}
+	attribute := &CodeAttribute{MaxStack: uint16(method.maxStack), MaxLocals: uint16(method.maxLocals), Code: code}
+	for _, block := range method.tryCatch {
+		if !method.labels[block.start] || !method.labels[block.end] || !method.labels[block.handler] {
+			return nil, ErrUnvisitedLabel
+		}
+		attribute.ExceptionTable = append(attribute.ExceptionTable, ExceptionTableEntry{uint16(block.start.offset), uint16(block.end.offset), uint16(block.handler.offset), block.catchType})
+	}
+
+	if frames := method.frames(); frames != nil {
+		attribute.Attributes = append(attribute.Attributes, method.writer.attribute("StackMapTable", frames))
+	}
+	if len(method.lines) > 0 {
+		buf := bytes.NewBuffer()
+		buf.WriteU16(uint16(len(method.lines)))
+		for _, line := range method.lines {
+			buf.WriteU16(uint16(line.start.offset))
+			buf.WriteU16(uint16(line.line))
+		}
+		attribute.Attributes = append(attribute.Attributes, method.writer.attribute("LineNumberTable", *buf.Data))
+	}
+	if len(method.variables) > 0 {
+		variables, types := bytes.NewBuffer(), bytes.NewBuffer()
+		typeCount := 0
+		variables.WriteU16(uint16(len(method.variables)))
+		types.WriteU16(0)
+		for _, variable := range method.variables {
+			start, length := uint16(variable.start.offset), uint16(variable.end.offset-variable.start.offset)
+			variables.WriteU16(start)
+			variables.WriteU16(length)
+			variables.WriteU16(class.AddUtf8(variable.name))
+			variables.WriteU16(class.AddUtf8(variable.descriptor))
+			variables.WriteU16(uint16(variable.index))
+			if variable.signature != "" {
+				types.WriteU16(start)
+				types.WriteU16(length)
+				types.WriteU16(class.AddUtf8(variable.name))
+				types.WriteU16(class.AddUtf8(variable.signature))
+				types.WriteU16(uint16(variable.index))
+				typeCount++
+			}
+		}
+		attribute.Attributes = append(attribute.Attributes, method.writer.attribute("LocalVariableTable", *variables.Data))
+		if typeCount > 0 {
+			binary.BigEndian.PutUint16(*types.Data, uint16(typeCount))
+			attribute.Attributes = append(attribute.Attributes, method.writer.attribute("LocalVariableTypeTable", *types.Data))
+		}
+	}
+	attribute.Attributes = append(attribute.Attributes, method.codeAttributes...)
+	return attribute, nil
+}
+
+// checkWideJumps makes sure widened conditional jumps stay verifiable. A widened jump becomes an inverted jump over a
+// GOTO_W, which makes the instruction after it a branch target, so from version 50 on it needs a frame. Frames are
+// only visited, not computed, so one must already be at that offset.
+func (method *methodWriter) checkWideJumps() error {
+	if method.class().MajorVersion < 50 {
+		return nil
+	}
+	frames := map[int]bool{}
+	for _, op := range method.ops {
+		if op.kind == opFrame {
+			frames[op.offset] = true
+		}
+	}
+	for _, op := range method.ops {
+		if op.kind == opJump && op.wide && op.opcode != GOTO && op.opcode != JSR && !frames[op.offset+op.size(op.offset)] {
+			return fmt.Errorf("%w: at %d", ErrMissingFrame, op.offset)
+		}
+	}
+	return nil
+}
+
+// frames encodes every visited frame as a full_frame, keeping the last frame visited at each offset.
+func (method *methodWriter) frames() []byte {
+	var ops []*codeOp
+	for _, op := range method.ops {
+		if op.kind != opFrame {
+			continue
+		}
+		if len(ops) > 0 && ops[len(ops)-1].offset == op.offset {
+			ops[len(ops)-1] = op
+		} else {
+			ops = append(ops, op)
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	class := method.class()
+	buf := bytes.NewBuffer()
+	writeTypes := func(types []any) {
+		buf.WriteU16(uint16(len(types)))
+		for _, t := range types {
+			switch v := t.(type) {
+			case string:
+				buf.WriteByte(ITEM_Object)
+				buf.WriteU16(class.AddClass(v))
+			case *Label:
+				buf.WriteByte(ITEM_Uninitialized)
+				buf.WriteU16(uint16(v.offset))
+			case int:
+				buf.WriteByte(byte(v))
+			}
+		}
+	}
+
+	buf.WriteU16(uint16(len(ops)))
+	previous := -1
+	for _, op := range ops {
+		buf.WriteByte(255)
+		buf.WriteU16(uint16(op.offset - previous - 1))
+		writeTypes(op.frame.locals)
+		writeTypes(op.frame.stack)
+		previous = op.offset
+	}
+	return *buf.Data
+}
+
+// computeMaxs follows every path through the code to find the deepest operand stack, and sizes the
+// locals to fit the arguments and every variable instruction.
+func (method *methodWriter) computeMaxs() {
+	arguments := method.argumentSlots(method.descriptor)
+	if method.info.AccessFlags&ACC_STATIC == 0 {
+		arguments++
+	}
+	method.maxLocals = max(method.locals, arguments)
+
+	targets := map[*Label]int{}
+	for i, op := range method.ops {
+		if op.kind == opLabel {
+			targets[op.label] = i
+		}
+	}
+	heights := make([]int, len(method.ops))
+	for i := range heights {
+		heights[i] = -1
+	}
+
+	type entry struct{ index, height int }
+	queue := []entry{{0, 0}}
+	for _, block := range method.tryCatch {
+		queue = append(queue, entry{targets[block.handler], 1})
+	}
+	method.maxStack = 0
+	for len(queue) > 0 {
+		next := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		for i, height := next.index, next.height; i < len(method.ops) && heights[i] < 0; i++ {
+			heights[i] = height
+			op := method.ops[i]
+			height += op.stack
+			method.maxStack = max(method.maxStack, height)
+
+			switch op.kind {
+			case opJump:
+				if op.opcode == JSR {
+					queue = append(queue, entry{targets[op.label], height})
+					height--
+					continue
+				}
+				queue = append(queue, entry{targets[op.label], height})
+				if op.opcode == GOTO {
+					i = len(method.ops)
+				}
+			case opTableSwitch, opLookupSwitch:
+				for _, label := range append([]*Label{op.dflt}, op.labels...) {
+					queue = append(queue, entry{targets[label], height})
+				}
+				i = len(method.ops)
+			case opInsn:
+				switch op.bytes[0] {
+				case IRETURN, LRETURN, FRETURN, DRETURN, ARETURN, RETURN, ATHROW, RET:
+					i = len(method.ops)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package babe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"reflect"
+	"testing"
+)
+
+// jumpTarget decodes the branch at code[offset:], returning its opcode and target.
+func jumpTarget(code []byte, offset int) (byte, int) {
+	if opcode := code[offset]; opcode == GOTO_W || opcode == JSR_W {
+		return opcode, offset + int(int32(binary.BigEndian.Uint32(code[offset+1:])))
+	}
+	return code[offset], offset + int(int16(binary.BigEndian.Uint16(code[offset+1:])))
+}
+
+func TestJumpWidening(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode int
+		// operands pushes what the jump compares
+		operands func(code *CodeBuilder)
+		nops     int
+		// opposite is the inverted jump over the GOTO_W of a widened conditional jump, 0 when it isn't widened
+		opposite byte
+	}{
+		{"short ifeq", IFEQ, func(code *CodeBuilder) { code.VisitVarInsn(ILOAD, 0) }, 10, 0},
+		{"longest ifeq", IFEQ, func(code *CodeBuilder) { code.VisitVarInsn(ILOAD, 0) }, 32767 - 3, 0},
+		{"widened ifeq", IFEQ, func(code *CodeBuilder) { code.VisitVarInsn(ILOAD, 0) }, 32767 - 2, IFNE},
+		{"widened ifne", IFNE, func(code *CodeBuilder) { code.VisitVarInsn(ILOAD, 0) }, 40000, IFEQ},
+		{"widened if_icmplt", IF_ICMPLT, func(code *CodeBuilder) {
+			code.VisitVarInsn(ILOAD, 0)
+			code.VisitVarInsn(ILOAD, 0)
+		}, 40000, IF_ICMPGE},
+		{"widened if_acmpeq", IF_ACMPEQ, func(code *CodeBuilder) {
+			code.Push(nil)
+			code.Push(nil)
+		}, 40000, IF_ACMPNE},
+		{"widened ifnull", IFNULL, func(code *CodeBuilder) { code.Push(nil) }, 40000, IFNONNULL},
+		{"widened goto", GOTO, func(code *CodeBuilder) {}, 40000, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class, err := NewClassBuilder("a/Jump").Version(JAVA_5).Method(ACC_STATIC, "jump", "(I)V", func(code *CodeBuilder) {
+				end := &Label{}
+				test.operands(code)
+				code.Jump(test.opcode, end)
+				for i := 0; i < test.nops; i++ {
+					code.VisitInsn(NOP)
+				}
+				code.Mark(end)
+				code.Return()
+			}).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := class.Methods[0].GetCode().Code
+			end := len(code) - 1
+			if code[end] != RETURN {
+				t.Fatalf("code doesn't end with the return: %x", code[end])
+			}
+
+			offset := 0
+			for code[offset] != byte(test.opcode) && code[offset] != test.opposite && code[offset] != GOTO_W {
+				offset++
+			}
+			opcode, target := jumpTarget(code, offset)
+			switch {
+			case test.opposite != 0:
+				if opcode != test.opposite || target != offset+8 {
+					t.Errorf("inverted jump = %x to %d, want %x to %d", opcode, target, test.opposite, offset+8)
+				}
+				if opcode, target := jumpTarget(code, offset+3); opcode != GOTO_W || target != end {
+					t.Errorf("wide jump = %x to %d, want goto_w to %d", opcode, target, end)
+				}
+			case test.opcode == GOTO && test.nops > 32767:
+				if opcode != GOTO_W || target != end {
+					t.Errorf("jump = %x to %d, want goto_w to %d", opcode, target, end)
+				}
+			default:
+				if opcode != byte(test.opcode) || target != end {
+					t.Errorf("jump = %x to %d, want %x to %d", opcode, target, test.opcode, end)
+				}
+			}
+		})
+	}
+}
+
+func TestWideJumpFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		frame   bool
+		err     error
+	}{
+		{"no frames before version 50", JAVA_5, false, nil},
+		{"missing frame", JAVA_8, false, ErrMissingFrame},
+		{"frame after the jump", JAVA_8, true, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewClassBuilder("a/Jump").Version(test.version).Method(ACC_STATIC, "jump", "(I)V", func(code *CodeBuilder) {
+				end := &Label{}
+				code.VisitVarInsn(ILOAD, 0)
+				code.Jump(IFEQ, end)
+				if test.frame {
+					code.VisitFrame([]any{ITEM_Integer}, nil)
+				}
+				for i := 0; i < 40000; i++ {
+					code.VisitInsn(NOP)
+				}
+				code.Mark(end)
+				code.VisitFrame([]any{ITEM_Integer}, nil)
+				code.Return()
+			}).Build()
+			if !errors.Is(err, test.err) {
+				t.Errorf("Build error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+// attributeData maps the names of attributes to their data.
+func attributeData(class *Class, attributes []AttributeInfo) map[string]string {
+	data := map[string]string{}
+	for i := range attributes {
+		data[class.GetAttributeName(&attributes[i])] = string(attributes[i].Data)
+	}
+	return data
+}
+
+func TestClassReaderWriterRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags int
+		// dropped are the code attributes the reader doesn't visit with the flags
+		dropped []string
+	}{
+		{"all attributes", 0, nil},
+		{"without debug information", SkipDebug, []string{"LineNumberTable", "LocalVariableTable"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class, err := NewClassBuilder("a/Round").Method(ACC_PUBLIC|ACC_STATIC, "run", "(Ljava/lang/Object;)Ljava/lang/String;", func(code *CodeBuilder) {
+				start, end := &Label{}, &Label{}
+				code.Mark(start)
+				code.VisitLineNumber(7, start)
+				code.VisitVarInsn(ALOAD, 0)
+				code.VisitTypeInsn(CHECKCAST, "java/lang/String")
+				code.VisitInsn(ARETURN)
+				code.Mark(end)
+				code.VisitLocalVariable("value", "Ljava/lang/Object;", "", start, end, 0)
+			}).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			class.setAttribute("Unknown", []byte{1, 2, 3})
+			method := &class.Methods[0]
+			method.Attributes = class.SetAttribute(method.Attributes, "UnknownMethod", []byte{4})
+			method.AttributesCount = uint16(len(method.Attributes))
+			code := method.GetCode()
+			// Type annotations on the cast at offset 1, and one on the local variable
+			code.Attributes = class.writeTypeAnnotations(code.Attributes, []*TypeAnnotation{
+				{TargetType: 0x47, Target: []byte{0, 1, 0}, Annotation: Annotation{Descriptor: "La/NonNull;", Visible: true}},
+				{TargetType: 0x40, Target: []byte{0, 1, 0, 0, 0, 3, 0, 0}, Annotation: Annotation{Descriptor: "La/Local;"}},
+			})
+			code.Attributes = class.SetAttribute(code.Attributes, "UnknownCode", []byte{5, 6})
+			method.SetCode(code)
+
+			writer := NewClassWriter(NewClassReader(class), 0)
+			if err := NewClassReader(class).Accept(writer, test.flags); err != nil {
+				t.Fatal(err)
+			}
+			written, err := writer.Class()
+			if err != nil {
+				t.Fatal(err)
+			}
+			read := rereadClass(t, written)
+
+			if data := attributeData(read, read.Attributes)["Unknown"]; data != "\x01\x02\x03" {
+				t.Errorf("class attribute = %x", data)
+			}
+			if data := attributeData(read, read.Methods[0].Attributes)["UnknownMethod"]; data != "\x04" {
+				t.Errorf("method attribute = %x", data)
+			}
+			readCode := read.Methods[0].GetCode()
+			if !bytes.Equal(readCode.Code, code.Code) {
+				t.Errorf("code = %x, want %x", readCode.Code, code.Code)
+			}
+			want := attributeData(class, code.Attributes)
+			for _, name := range test.dropped {
+				delete(want, name)
+			}
+			if got := attributeData(read, readCode.Attributes); !maps.Equal(got, want) {
+				t.Errorf("code attributes = %q, want %q", got, want)
+			}
+			if annotations, want := read.readTypeAnnotations(readCode.Attributes), class.readTypeAnnotations(code.Attributes); !reflect.DeepEqual(annotations, want) {
+				t.Errorf("type annotations = %v, want %v", annotations, want)
+			}
+		})
+	}
+}
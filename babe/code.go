@@ -0,0 +1,144 @@
+package babe
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/mrnavastar/assist/bytes"
+)
+
+var ErrInvalidCode = errors.New("jarhax: invalid bytecode")
+
+type ExceptionTableEntry struct {
+	StartPc   uint16
+	EndPc     uint16
+	HandlerPc uint16
+	CatchType uint16
+}
+
+type CodeAttribute struct {
+	MaxStack       uint16
+	MaxLocals      uint16
+	Code           []byte
+	ExceptionTable []ExceptionTableEntry
+	Attributes     []AttributeInfo
+}
+
+func (code *CodeAttribute) Read(buf *bytes.Buffer) {
+	code.MaxStack = buf.ReadU16()
+	code.MaxLocals = buf.ReadU16()
+	code.Code = buf.ReadBytes(int(buf.ReadU32()))
+	count := buf.ReadU16()
+	code.ExceptionTable = make([]ExceptionTableEntry, count)
+	for i := range code.ExceptionTable {
+		code.ExceptionTable[i] = ExceptionTableEntry{buf.ReadU16(), buf.ReadU16(), buf.ReadU16(), buf.ReadU16()}
+	}
+	code.Attributes = ReadAttributes(buf, int(buf.ReadU16()))
+}
+
+func (code *CodeAttribute) Write(buf *bytes.Buffer) {
+	buf.WriteU16(code.MaxStack)
+	buf.WriteU16(code.MaxLocals)
+	buf.WriteU32(uint32(len(code.Code)))
+	buf.Write(code.Code)
+	buf.WriteU16(uint16(len(code.ExceptionTable)))
+	for _, entry := range code.ExceptionTable {
+		buf.WriteU16(entry.StartPc)
+		buf.WriteU16(entry.EndPc)
+		buf.WriteU16(entry.HandlerPc)
+		buf.WriteU16(entry.CatchType)
+	}
+	buf.WriteU16(uint16(len(code.Attributes)))
+	WriteAttributes(buf, code.Attributes)
+}
+
+// GetCode decodes the Code attribute of the method, returning nil for abstract and native methods.
+func (info *MethodInfo) GetCode() *CodeAttribute {
+	attribute := info.class.FindAttribute(info.Attributes, "Code")
+	if attribute == nil {
+		return nil
+	}
+	var code CodeAttribute
+	code.Read(&bytes.Buffer{Data: &attribute.Data, Index: 0})
+	return &code
+}
+
+// SetCode replaces the Code attribute of the method, adding one if it has none.
+func (info *MethodInfo) SetCode(code *CodeAttribute) {
+	data := []byte{}
+	code.Write(&bytes.Buffer{Data: &data, Index: 0})
+	info.Attributes = info.class.SetAttribute(info.Attributes, "Code", data)
+	info.AttributesCount = uint16(len(info.Attributes))
+}
+
+// InstructionLength returns the length of the instruction at offset, including its operands and padding.
+func InstructionLength(code []byte, offset int) (int, error) {
+	if offset >= len(code) {
+		return 0, ErrInvalidCode
+	}
+
+	length := 0
+	switch operands[code[offset]] {
+	case operandNone:
+		length = 1
+	case operandByte, operandVar, operandLdc:
+		length = 2
+	case operandShort, operandLdcWide, operandField, operandMethod, operandType, operandJump, operandIinc:
+		length = 3
+	case operandMultiANewArray:
+		length = 4
+	case operandInterfaceMethod, operandInvokeDynamic, operandJumpWide:
+		length = 5
+	case operandWide:
+		if offset+1 >= len(code) {
+			return 0, ErrInvalidCode
+		}
+		length = 4
+		if code[offset+1] == IINC {
+			length = 6
+		}
+	case operandTableSwitch:
+		pad := 3 - offset%4
+		if offset+pad+13 > len(code) {
+			return 0, ErrInvalidCode
+		}
+		low := int32(binary.BigEndian.Uint32(code[offset+pad+5:]))
+		high := int32(binary.BigEndian.Uint32(code[offset+pad+9:]))
+		if high < low {
+			return 0, ErrInvalidCode
+		}
+		length = 1 + pad + 12 + int(high-low+1)*4
+	case operandLookupSwitch:
+		pad := 3 - offset%4
+		if offset+pad+9 > len(code) {
+			return 0, ErrInvalidCode
+		}
+		pairs := int32(binary.BigEndian.Uint32(code[offset+pad+5:]))
+		if pairs < 0 {
+			return 0, ErrInvalidCode
+		}
+		length = 1 + pad + 8 + int(pairs)*8
+	default:
+		return 0, ErrInvalidCode
+	}
+
+	if offset+length > len(code) {
+		return 0, ErrInvalidCode
+	}
+	return length, nil
+}
+
+// ForInstruction calls iter with the offset and opcode of every instruction in code.
+func ForInstruction(code []byte, iter func(offset int, opcode byte) error) error {
+	for offset := 0; offset < len(code); {
+		length, err := InstructionLength(code, offset)
+		if err != nil {
+			return err
+		}
+		if err = iter(offset, code[offset]); err != nil {
+			return err
+		}
+		offset += length
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package babe
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+// constantReferences returns the fields of a constant holding indexes of other constants.
+func constantReferences(constant Info) []*uint16 {
+	switch c := constant.(type) {
+	case *ClassInfo:
+		return []*uint16{&c.NameIndex}
+	case *ModuleInfo:
+		return []*uint16{&c.NameIndex}
+	case *PackageInfo:
+		return []*uint16{&c.NameIndex}
+	case *StringInfo:
+		return []*uint16{&c.StringIndex}
+	case *FieldRefInfo:
+		return []*uint16{&c.ClassIndex, &c.NameAndTypeIndex}
+	case *MethodRefInfo:
+		return []*uint16{&c.ClassIndex, &c.NameAndTypeIndex}
+	case *InterfaceMethodRefInfo:
+		return []*uint16{&c.ClassIndex, &c.NameAndTypeIndex}
+	case *NameAndTypeInfo:
+		return []*uint16{&c.NameIndex, &c.DescriptorIndex}
+	case *MethodHandleInfo:
+		return []*uint16{&c.ReferenceIndex}
+	case *MethodTypeInfo:
+		return []*uint16{&c.DescriptorIndex}
+	case *DynamicInfo:
+		return []*uint16{&c.NameAndTypeIndex}
+	case *InvokeDynamicInfo:
+		return []*uint16{&c.NameAndTypeIndex}
+	}
+	return nil
+}
+
+// constantWalker passes every constant pool index the class holds outside of the pool through visit. Indexes in
+// attribute data are only written back when rewrite is set, as the data may alias the bytes the class was read from.
+type constantWalker struct {
+	class   *Class
+	visit   func(index uint16) uint16
+	rewrite bool
+}
+
+func (w *constantWalker) index(index *uint16) {
+	if *index != 0 {
+		*index = w.visit(*index)
+	}
+}
+
+func (w *constantWalker) at(data []byte, i int) {
+	if index := binary.BigEndian.Uint16(data[i:]); index != 0 {
+		if index = w.visit(index); w.rewrite {
+			binary.BigEndian.PutUint16(data[i:], index)
+		}
+	}
+}
+
+func (w *constantWalker) list(data []byte, i int) int {
+	count := u16(data, i)
+	for i += 2; count > 0; i, count = i+2, count-1 {
+		w.at(data, i)
+	}
+	return i
+}
+
+// walk reports false, without visiting everything, if the class has an attribute it doesn't know.
+func (w *constantWalker) walk() bool {
+	class := w.class
+	w.index(&class.ThisClass)
+	w.index(&class.SuperClass)
+	for i := range class.Interfaces {
+		w.index(&class.Interfaces[i])
+	}
+	members := make([]*FieldInfo, 0, len(class.Fields)+len(class.Methods))
+	for i := range class.Fields {
+		members = append(members, &class.Fields[i])
+	}
+	for i := range class.Methods {
+		members = append(members, &class.Methods[i].FieldInfo)
+	}
+	for _, member := range members {
+		w.index(&member.NameIndex)
+		w.index(&member.DescriptorIndex)
+		if !w.attributes(member.Attributes) {
+			return false
+		}
+	}
+	return w.attributes(class.Attributes)
+}
+
+func (w *constantWalker) attributes(attributes []AttributeInfo) bool {
+	for i := range attributes {
+		attribute := &attributes[i]
+		name := w.class.GetAttributeName(attribute)
+		w.index(&attribute.AttributeNameIndex)
+		if w.rewrite {
+			attribute.Data = slices.Clone(attribute.Data)
+		}
+		if !w.attribute(name, attribute.Data) {
+			return false
+		}
+	}
+	return true
+}
+
+// nestedAttributes walks the attribute count and attributes starting at data[i:], returning the offset after them.
+func (w *constantWalker) nestedAttributes(data []byte, i int) (int, bool) {
+	count := u16(data, i)
+	for i += 2; count > 0; count-- {
+		name := w.class.GetUtf8(uint16(u16(data, i)))
+		w.at(data, i)
+		length := int(binary.BigEndian.Uint32(data[i+2:]))
+		if !w.attribute(name, data[i+6:i+6+length]) {
+			return i, false
+		}
+		i += 6 + length
+	}
+	return i, true
+}
+
+func (w *constantWalker) attribute(name string, data []byte) bool {
+	switch name {
+	case "Deprecated", "Synthetic", "SourceDebugExtension", "LineNumberTable":
+	case "ConstantValue", "Signature", "SourceFile", "NestHost", "ModuleMainClass":
+		w.at(data, 0)
+	case "Exceptions", "NestMembers", "PermittedSubclasses", "ModulePackages":
+		w.list(data, 0)
+	case "EnclosingMethod":
+		w.at(data, 0)
+		w.at(data, 2)
+	case "InnerClasses":
+		for i, count := 2, u16(data, 0); count > 0; i, count = i+8, count-1 {
+			w.at(data, i)
+			w.at(data, i+2)
+			w.at(data, i+4)
+		}
+	case "LocalVariableTable", "LocalVariableTypeTable":
+		for i, count := 2, u16(data, 0); count > 0; i, count = i+10, count-1 {
+			w.at(data, i+4)
+			w.at(data, i+6)
+		}
+	case "MethodParameters":
+		for i, count := 1, int(data[0]); count > 0; i, count = i+4, count-1 {
+			w.at(data, i)
+		}
+	case "BootstrapMethods":
+		for i, count := 2, u16(data, 0); count > 0; count-- {
+			w.at(data, i)
+			i = w.list(data, i+2)
+		}
+	case "Module":
+		w.at(data, 0)
+		w.at(data, 4)
+		i := 6
+		count := u16(data, i)
+		for i += 2; count > 0; i, count = i+6, count-1 {
+			w.at(data, i)
+			w.at(data, i+4)
+		}
+		for directives := 0; directives < 2; directives++ {
+			count := u16(data, i)
+			for i += 2; count > 0; count-- {
+				w.at(data, i)
+				i = w.list(data, i+4)
+			}
+		}
+		i = w.list(data, i)
+		count = u16(data, i)
+		for i += 2; count > 0; count-- {
+			w.at(data, i)
+			i = w.list(data, i+2)
+		}
+	case "Record":
+		for i, count := 2, u16(data, 0); count > 0; count-- {
+			w.at(data, i)
+			w.at(data, i+2)
+			var ok bool
+			if i, ok = w.nestedAttributes(data, i+4); !ok {
+				return false
+			}
+		}
+	case "Code":
+		return w.code(data)
+	case "StackMapTable":
+		return w.stackMapTable(data)
+	case "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations":
+		for i, count := 2, u16(data, 0); count > 0; count-- {
+			i = w.annotation(data, i)
+		}
+	case "RuntimeVisibleParameterAnnotations", "RuntimeInvisibleParameterAnnotations":
+		i := 1
+		for parameters := int(data[0]); parameters > 0; parameters-- {
+			count := u16(data, i)
+			for i += 2; count > 0; count-- {
+				i = w.annotation(data, i)
+			}
+		}
+	case "RuntimeVisibleTypeAnnotations", "RuntimeInvisibleTypeAnnotations":
+		for i, count := 2, u16(data, 0); count > 0; count-- {
+			i = w.annotation(data, typeAnnotationTarget(data, i))
+		}
+	case "AnnotationDefault":
+		w.elementValue(data, 0)
+	default:
+		return false
+	}
+	return true
+}
+
+func (w *constantWalker) annotation(data []byte, i int) int {
+	w.at(data, i)
+	count := u16(data, i+2)
+	for i += 4; count > 0; count-- {
+		w.at(data, i)
+		i = w.elementValue(data, i+2)
+	}
+	return i
+}
+
+func (w *constantWalker) elementValue(data []byte, i int) int {
+	switch data[i] {
+	case 'e':
+		w.at(data, i+1)
+		w.at(data, i+3)
+		return i + 5
+	case '@':
+		return w.annotation(data, i+1)
+	case '[':
+		count := u16(data, i+1)
+		for i += 3; count > 0; count-- {
+			i = w.elementValue(data, i)
+		}
+		return i
+	}
+	w.at(data, i+1)
+	return i + 3
+}
+
+func (w *constantWalker) code(data []byte) bool {
+	length := int(binary.BigEndian.Uint32(data[4:]))
+	code := data[8 : 8+length]
+	err := ForInstruction(code, func(offset int, opcode byte) error {
+		switch operands[opcode] {
+		case operandLdc:
+			if index := w.visit(uint16(code[offset+1])); w.rewrite {
+				code[offset+1] = byte(index)
+			}
+		case operandLdcWide, operandField, operandMethod, operandInterfaceMethod, operandInvokeDynamic, operandType,
+			operandMultiANewArray:
+			w.at(code, offset+1)
+		}
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+	i := 8 + length
+	count := u16(data, i)
+	for i += 2; count > 0; i, count = i+8, count-1 {
+		w.at(data, i+6)
+	}
+	_, ok := w.nestedAttributes(data, i)
+	return ok
+}
+
+func (w *constantWalker) stackMapTable(data []byte) bool {
+	verificationType := func(i int) int {
+		switch data[i] {
+		case 7:
+			w.at(data, i+1)
+			return i + 3
+		case 8:
+			return i + 3
+		}
+		return i + 1
+	}
+	i := 2
+	for count := u16(data, 0); count > 0; count-- {
+		frame := data[i]
+		i++
+		switch {
+		case frame < 64:
+		case frame < 128:
+			i = verificationType(i)
+		case frame == 247:
+			i = verificationType(i + 2)
+		case frame >= 248 && frame <= 251:
+			i += 2
+		case frame >= 252 && frame <= 254:
+			i += 2
+			for locals := int(frame) - 251; locals > 0; locals-- {
+				i = verificationType(i)
+			}
+		case frame == 255:
+			i += 2
+			for lists := 0; lists < 2; lists++ {
+				types := u16(data, i)
+				for i += 2; types > 0; types-- {
+					i = verificationType(i)
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CompactConstantPool removes the constants nothing in the class refers to anymore, such as those left behind by
+// removed attributes or renamed members, and reports whether any were removed. Classes with attributes it doesn't
+// know are left as they are, as they may refer to constants in ways it can't see.
+func (class *Class) CompactConstantPool() bool {
+	used := make([]bool, len(class.ConstantPool)+1)
+	var mark func(index uint16) uint16
+	mark = func(index uint16) uint16 {
+		if int(index) < len(used) && !used[index] {
+			used[index] = true
+			for _, reference := range constantReferences(class.ConstantPool[index-1]) {
+				mark(*reference)
+			}
+		}
+		return index
+	}
+	if !(&constantWalker{class: class, visit: mark}).walk() {
+		return false
+	}
+
+	remap := make([]uint16, len(used))
+	var pool []Info
+	for i, constant := range class.ConstantPool {
+		if constant == nil || !used[i+1] {
+			continue
+		}
+		pool = append(pool, constant)
+		remap[i+1] = uint16(len(pool))
+		switch constant.(type) {
+		case *LongInfo, *DoubleInfo:
+			pool = append(pool, nil)
+		}
+	}
+	if len(pool) == len(class.ConstantPool) {
+		return false
+	}
+
+	// Attribute names are looked up while walking, so the pool is only replaced afterwards
+	(&constantWalker{class: class, visit: func(index uint16) uint16 { return remap[index] }, rewrite: true}).walk()
+	for _, constant := range pool {
+		for _, reference := range constantReferences(constant) {
+			*reference = remap[*reference]
+		}
+	}
+	class.ConstantPool = pool
+	class.ConstantPoolCount = uint16(len(pool) + 1)
+	class.pool = nil
+	return true
+}
@@ -0,0 +1,120 @@
+package babe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func compactTestClass(t *testing.T) *Class {
+	t.Helper()
+	class, err := NewClassBuilder("a/Compact").Source("Compact.java").
+		Field(ACC_PRIVATE, "removed", "Ljava/lang/Thread;", nil).
+		Field(ACC_STATIC, "kept", "I", nil).
+		Method(ACC_STATIC, "run", "()V", func(code *CodeBuilder) {
+			code.Push(int64(1234567890123))
+			code.VisitInsn(POP2)
+			code.Push("text")
+			code.VisitInsn(POP)
+			code.GetStatic("a/Compact", "kept", "I")
+			code.VisitInsn(POP)
+			code.Return()
+		}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return class
+}
+
+func classBytes(class *Class) []byte {
+	var out []byte
+	class.Write(&out)
+	return out
+}
+
+func TestCompactConstantPool(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(class *Class)
+	}{
+		{"unused constants", func(class *Class) {
+			class.AddUtf8("unused")
+			class.AddLong(42)
+			class.AddClass("a/Unused")
+			class.AddString("unused string")
+		}},
+		{"removed field", func(class *Class) {
+			class.Fields = class.Fields[1:]
+			class.FieldsCount--
+		}},
+		{"removed attribute", func(class *Class) {
+			class.Attributes = class.RemoveAttribute(class.Attributes, "SourceFile")
+			class.AttributesCount = uint16(len(class.Attributes))
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class := compactTestClass(t)
+			test.edit(class)
+			count := len(class.ConstantPool)
+			if !class.CompactConstantPool() {
+				t.Fatal("CompactConstantPool removed nothing")
+			}
+			if len(class.ConstantPool) >= count {
+				t.Errorf("pool has %d constants, had %d", len(class.ConstantPool), count)
+			}
+			if class.CompactConstantPool() {
+				t.Error("compacting twice removed more")
+			}
+
+			read := &Class{}
+			if err := read.Read(classBytes(class)); err != nil {
+				t.Fatal(err)
+			}
+			if read.GetClassName() != "a/Compact" || read.GetSuperClassName() != "java/lang/Object" {
+				t.Errorf("class = %s extends %s", read.GetClassName(), read.GetSuperClassName())
+			}
+			if field := read.FindField("kept", "I"); field == nil {
+				t.Error("field kept is gone")
+			}
+			method := read.Methods[len(read.Methods)-1]
+			if method.GetName() != "run" || method.GetDescriptor() != "()V" {
+				t.Fatalf("method = %s%s", method.GetName(), method.GetDescriptor())
+			}
+			code := method.GetCode().Code
+			if long, ok := read.GetConstant(binary.BigEndian.Uint16(code[1:])).(*LongInfo); !ok || long.GetLong() != 1234567890123 {
+				t.Errorf("ldc2_w loads %v", read.GetConstant(binary.BigEndian.Uint16(code[1:])))
+			}
+			if text, ok := read.GetConstant(uint16(code[5])).(*StringInfo); !ok || read.GetUtf8(text.StringIndex) != "text" {
+				t.Errorf("ldc loads %v", read.GetConstant(uint16(code[5])))
+			}
+			if owner, name, descriptor := read.GetRef(binary.BigEndian.Uint16(code[8:])); owner != "a/Compact" || name != "kept" || descriptor != "I" {
+				t.Errorf("getstatic reads %s.%s:%s", owner, name, descriptor)
+			}
+		})
+	}
+}
+
+func TestCompactConstantPoolUnchanged(t *testing.T) {
+	class := compactTestClass(t)
+	original := classBytes(class)
+	if class.CompactConstantPool() {
+		t.Error("CompactConstantPool removed constants of a fresh class")
+	}
+	class.AddUtf8("unused")
+	class.AddDouble(1.5)
+	class.CompactConstantPool()
+	if !bytes.Equal(classBytes(class), original) {
+		t.Error("compacting appended constants changed the class")
+	}
+}
+
+func TestCompactConstantPoolUnknownAttribute(t *testing.T) {
+	class := compactTestClass(t)
+	class.Attributes = class.SetAttribute(class.Attributes, "Unknown", []byte{0, 1})
+	class.AttributesCount = uint16(len(class.Attributes))
+	class.AddUtf8("unused")
+	if class.CompactConstantPool() {
+		t.Error("CompactConstantPool compacted a class with an unknown attribute")
+	}
+}
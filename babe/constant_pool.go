@@ -0,0 +1,203 @@
+package babe
+
+import (
+	"fmt"
+	"math"
+)
+
+// poolIndex maps the content of every constant to its index so lookups don't scan the pool.
+type poolIndex struct {
+	size  int
+	index map[string]uint16
+}
+
+func constantKey(info Info) string {
+	switch c := info.(type) {
+	case *Utf8Info:
+		return "\x01" + string(c.Bytes)
+	case *IntegerInfo:
+		return fmt.Sprintf("\x03%d", c.Bytes)
+	case *FloatInfo:
+		return fmt.Sprintf("\x04%d", c.Bytes)
+	case *LongInfo:
+		return fmt.Sprintf("\x05%d:%d", c.HighBytes, c.LowBytes)
+	case *DoubleInfo:
+		return fmt.Sprintf("\x06%d:%d", c.HighBytes, c.LowBytes)
+	case *ClassInfo:
+		return fmt.Sprintf("\x07%d", c.NameIndex)
+	case *StringInfo:
+		return fmt.Sprintf("\x08%d", c.StringIndex)
+	case *FieldRefInfo:
+		return fmt.Sprintf("\x09%d:%d", c.ClassIndex, c.NameAndTypeIndex)
+	case *MethodRefInfo:
+		return fmt.Sprintf("\x0a%d:%d", c.ClassIndex, c.NameAndTypeIndex)
+	case *InterfaceMethodRefInfo:
+		return fmt.Sprintf("\x0b%d:%d", c.ClassIndex, c.NameAndTypeIndex)
+	case *NameAndTypeInfo:
+		return fmt.Sprintf("\x0c%d:%d", c.NameIndex, c.DescriptorIndex)
+	case *MethodHandleInfo:
+		return fmt.Sprintf("\x0f%d:%d", c.ReferenceKind, c.ReferenceIndex)
+	case *MethodTypeInfo:
+		return fmt.Sprintf("\x10%d", c.DescriptorIndex)
+	case *DynamicInfo:
+		return fmt.Sprintf("\x11%d:%d", c.BootstrapMethodAttrIndex, c.NameAndTypeIndex)
+	case *InvokeDynamicInfo:
+		return fmt.Sprintf("\x12%d:%d", c.BootstrapMethodAttrIndex, c.NameAndTypeIndex)
+	case *ModuleInfo:
+		return fmt.Sprintf("\x13%d", c.NameIndex)
+	case *PackageInfo:
+		return fmt.Sprintf("\x14%d", c.NameIndex)
+	}
+	return ""
+}
+
+func (class *Class) indexPool() {
+	class.pool = &poolIndex{size: len(class.ConstantPool), index: map[string]uint16{}}
+	for i, constant := range class.ConstantPool {
+		if constant == nil {
+			continue
+		}
+		key := constantKey(constant)
+		if _, ok := class.pool.index[key]; !ok {
+			class.pool.index[key] = uint16(i + 1)
+		}
+	}
+}
+
+func (class *Class) findConstant(key string) (uint16, bool) {
+	if class.pool == nil || class.pool.size != len(class.ConstantPool) {
+		class.indexPool()
+	}
+	index, ok := class.pool.index[key]
+	if ok && constantKey(class.ConstantPool[index-1]) != key {
+		// The constant was modified in place since the pool was indexed
+		class.indexPool()
+		index, ok = class.pool.index[key]
+	}
+	return index, ok
+}
+
+// AddConstant returns the index of an equal constant already in the pool, or appends the constant.
+func (class *Class) AddConstant(constant Info) uint16 {
+	key := constantKey(constant)
+	if index, ok := class.findConstant(key); ok {
+		return index
+	}
+
+	class.ConstantPool = append(class.ConstantPool, constant)
+	index := uint16(len(class.ConstantPool))
+	switch constant.(type) {
+	case *LongInfo, *DoubleInfo:
+		class.ConstantPool = append(class.ConstantPool, nil)
+	}
+	class.ConstantPoolCount = uint16(len(class.ConstantPool) + 1)
+
+	class.pool.index[key] = index
+	class.pool.size = len(class.ConstantPool)
+	return index
+}
+
+func (class *Class) AddUtf8(s string) uint16 {
+	var info Utf8Info
+	info.Set(s)
+	return class.AddConstant(&info)
+}
+
+func (class *Class) AddClass(name string) uint16 {
+	return class.AddConstant(&ClassInfo{class.AddUtf8(name)})
+}
+
+func (class *Class) AddString(s string) uint16 {
+	return class.AddConstant(&StringInfo{class.AddUtf8(s)})
+}
+
+func (class *Class) AddInteger(value int32) uint16 {
+	return class.AddConstant(&IntegerInfo{uint32(value)})
+}
+
+func (class *Class) AddFloat(value float32) uint16 {
+	return class.AddConstant(&FloatInfo{IntegerInfo{math.Float32bits(value)}})
+}
+
+func (class *Class) AddLong(value int64) uint16 {
+	return class.AddConstant(&LongInfo{uint32(uint64(value) >> 32), uint32(value)})
+}
+
+func (class *Class) AddDouble(value float64) uint16 {
+	bits := math.Float64bits(value)
+	return class.AddConstant(&DoubleInfo{LongInfo{uint32(bits >> 32), uint32(bits)}})
+}
+
+func (class *Class) AddNameAndType(name string, descriptor string) uint16 {
+	return class.AddConstant(&NameAndTypeInfo{class.AddUtf8(name), class.AddUtf8(descriptor)})
+}
+
+func (class *Class) AddFieldRef(owner string, name string, descriptor string) uint16 {
+	return class.AddConstant(&FieldRefInfo{class.AddClass(owner), class.AddNameAndType(name, descriptor)})
+}
+
+func (class *Class) AddMethodRef(owner string, name string, descriptor string, isInterface bool) uint16 {
+	ref := FieldRefInfo{class.AddClass(owner), class.AddNameAndType(name, descriptor)}
+	if isInterface {
+		return class.AddConstant(&InterfaceMethodRefInfo{ref})
+	}
+	return class.AddConstant(&MethodRefInfo{ref})
+}
+
+func (class *Class) AddMethodType(descriptor string) uint16 {
+	return class.AddConstant(&MethodTypeInfo{class.AddUtf8(descriptor)})
+}
+
+func (class *Class) AddModule(name string) uint16 {
+	return class.AddConstant(&ModuleInfo{ClassInfo{class.AddUtf8(name)}})
+}
+
+func (class *Class) AddPackage(name string) uint16 {
+	return class.AddConstant(&PackageInfo{ClassInfo{class.AddUtf8(name)}})
+}
+
+// GetUtf8 returns the string at index, or "" for index 0.
+func (class *Class) GetUtf8(index uint16) string {
+	if index == 0 {
+		return ""
+	}
+	return class.GetConstant(index).(*Utf8Info).String()
+}
+
+// GetClassInfoName returns the name of the class, module or package constant at index, or "" for index 0.
+func (class *Class) GetClassInfoName(index uint16) string {
+	if index == 0 {
+		return ""
+	}
+	switch info := class.GetConstant(index).(type) {
+	case *ClassInfo:
+		return class.GetUtf8(info.NameIndex)
+	case *ModuleInfo:
+		return class.GetUtf8(info.NameIndex)
+	case *PackageInfo:
+		return class.GetUtf8(info.NameIndex)
+	}
+	return ""
+}
+
+func (class *Class) GetNameAndType(index uint16) (name string, descriptor string) {
+	info := class.GetConstant(index).(*NameAndTypeInfo)
+	return class.GetUtf8(info.NameIndex), class.GetUtf8(info.DescriptorIndex)
+}
+
+// GetRef resolves a field, method or interface method reference.
+func (class *Class) GetRef(index uint16) (owner string, name string, descriptor string) {
+	var ref *FieldRefInfo
+	switch info := class.GetConstant(index).(type) {
+	case *FieldRefInfo:
+		ref = info
+	case *MethodRefInfo:
+		ref = &info.FieldRefInfo
+	case *InterfaceMethodRefInfo:
+		ref = &info.FieldRefInfo
+	default:
+		return "", "", ""
+	}
+	name, descriptor = class.GetNameAndType(ref.NameAndTypeIndex)
+	return class.GetClassInfoName(ref.ClassIndex), name, descriptor
+}
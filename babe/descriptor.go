@@ -0,0 +1,245 @@
+package babe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidDescriptor = errors.New("jarhax: invalid descriptor")
+
+var primitiveNames = map[byte]string{
+	'V': "void", 'Z': "boolean", 'B': "byte", 'C': "char", 'S': "short", 'I': "int", 'J': "long", 'F': "float", 'D': "double",
+}
+
+// FieldType is a type of a descriptor: a primitive type, void or a class, and the number of array dimensions around it.
+type FieldType struct {
+	// Base is the descriptor of a primitive type or void, such as 'I' or 'V', or 'L' for classes
+	Base byte
+	// ClassName is the internal name of the class of 'L' types
+	ClassName  string
+	Dimensions int
+}
+
+// MethodDescriptor is the parameter and return types of a method.
+type MethodDescriptor struct {
+	Parameters []FieldType
+	Return     FieldType
+}
+
+// ClassType returns the type of a class given its internal name.
+func ClassType(name string) FieldType {
+	return FieldType{Base: 'L', ClassName: name}
+}
+
+// JavaType returns the type of a Java source type such as "int" or "java.lang.String[]".
+func JavaType(name string) FieldType {
+	dimensions := strings.Count(name, "[]")
+	name = strings.TrimSuffix(name, strings.Repeat("[]", dimensions))
+	for base, primitive := range primitiveNames {
+		if primitive == name {
+			return FieldType{Base: base, Dimensions: dimensions}
+		}
+	}
+	return FieldType{Base: 'L', ClassName: strings.ReplaceAll(name, ".", "/"), Dimensions: dimensions}
+}
+
+// readFieldType reads the type at the start of a descriptor, returning the length it takes.
+func readFieldType(descriptor string) (FieldType, int, bool) {
+	var typ FieldType
+	i := 0
+	for i < len(descriptor) && descriptor[i] == '[' {
+		i++
+	}
+	if i == len(descriptor) || i > 255 {
+		return typ, i, false
+	}
+	typ.Dimensions, typ.Base = i, descriptor[i]
+	if typ.Base == 'L' {
+		end := strings.IndexByte(descriptor[i:], ';')
+		if end <= 1 {
+			return typ, i, false
+		}
+		typ.ClassName = descriptor[i+1 : i+end]
+		if strings.ContainsAny(typ.ClassName, ".[") || strings.Contains("/"+typ.ClassName+"/", "//") {
+			return typ, i, false
+		}
+		return typ, i + end + 1, true
+	}
+	_, ok := primitiveNames[typ.Base]
+	return typ, i + 1, ok && !(typ.Base == 'V' && typ.Dimensions > 0)
+}
+
+// ParseFieldType parses a field descriptor such as "[Ljava/lang/String;".
+func ParseFieldType(descriptor string) (FieldType, error) {
+	typ, length, ok := readFieldType(descriptor)
+	if !ok || length != len(descriptor) || typ.IsVoid() {
+		return typ, fmt.Errorf("%w: %q", ErrInvalidDescriptor, descriptor)
+	}
+	return typ, nil
+}
+
+// ParseMethodDescriptor parses a method descriptor such as "([Ljava/lang/String;)V".
+func ParseMethodDescriptor(descriptor string) (MethodDescriptor, error) {
+	var method MethodDescriptor
+	invalid := fmt.Errorf("%w: %q", ErrInvalidDescriptor, descriptor)
+	if !strings.HasPrefix(descriptor, "(") {
+		return method, invalid
+	}
+	i := 1
+	for i < len(descriptor) && descriptor[i] != ')' {
+		typ, length, ok := readFieldType(descriptor[i:])
+		if !ok || typ.IsVoid() {
+			return method, invalid
+		}
+		method.Parameters = append(method.Parameters, typ)
+		i += length
+	}
+	if i == len(descriptor) {
+		return method, invalid
+	}
+	typ, length, ok := readFieldType(descriptor[i+1:])
+	if !ok || i+1+length != len(descriptor) {
+		return method, invalid
+	}
+	method.Return = typ
+	return method, nil
+}
+
+func (typ FieldType) IsVoid() bool {
+	return typ.Base == 'V' && typ.Dimensions == 0
+}
+
+func (typ FieldType) IsPrimitive() bool {
+	return typ.Base != 'L' && typ.Dimensions == 0 && !typ.IsVoid()
+}
+
+func (typ FieldType) IsArray() bool {
+	return typ.Dimensions > 0
+}
+
+// ElementType returns the type of the elements of an array, or the type itself otherwise.
+func (typ FieldType) ElementType() FieldType {
+	typ.Dimensions = max(typ.Dimensions-1, 0)
+	return typ
+}
+
+// ArrayOf returns an array type with the type as its elements.
+func (typ FieldType) ArrayOf() FieldType {
+	typ.Dimensions++
+	return typ
+}
+
+// Slots returns the number of local variable or operand stack slots a value of the type takes.
+func (typ FieldType) Slots() int {
+	switch {
+	case typ.IsVoid():
+		return 0
+	case typ.Dimensions == 0 && (typ.Base == 'J' || typ.Base == 'D'):
+		return 2
+	}
+	return 1
+}
+
+// InternalName returns the name of the type as a CONSTANT_Class names it: the internal name of classes, and the
+// descriptor of arrays.
+func (typ FieldType) InternalName() string {
+	if typ.Dimensions == 0 && typ.Base == 'L' {
+		return typ.ClassName
+	}
+	return typ.String()
+}
+
+func (typ FieldType) String() string {
+	if typ.Base == 'L' {
+		return strings.Repeat("[", typ.Dimensions) + "L" + typ.ClassName + ";"
+	}
+	return strings.Repeat("[", typ.Dimensions) + string(typ.Base)
+}
+
+// JavaName returns the type as written in Java source, such as "java.lang.String[]". Nested classes keep their $.
+func (typ FieldType) JavaName() string {
+	name := primitiveNames[typ.Base]
+	if typ.Base == 'L' {
+		name = strings.ReplaceAll(typ.ClassName, "/", ".")
+	}
+	return name + strings.Repeat("[]", typ.Dimensions)
+}
+
+// SimpleName returns the type as written in Java source without its package, such as "String[]".
+func (typ FieldType) SimpleName() string {
+	name := typ.JavaName()
+	if typ.Base == 'L' {
+		name = name[strings.LastIndexByte(name, '.')+1:]
+	}
+	return name
+}
+
+// MapClass returns the type with its class renamed by mapClass.
+func (typ FieldType) MapClass(mapClass func(name string) string) FieldType {
+	if typ.Base == 'L' {
+		typ.ClassName = mapClass(typ.ClassName)
+	}
+	return typ
+}
+
+func (method MethodDescriptor) String() string {
+	var out strings.Builder
+	out.WriteByte('(')
+	for _, parameter := range method.Parameters {
+		out.WriteString(parameter.String())
+	}
+	out.WriteString(")" + method.Return.String())
+	return out.String()
+}
+
+// JavaString returns the method as declared in Java source, named name and with simple names as in "void main(String[])".
+func (method MethodDescriptor) JavaString(name string) string {
+	parameters := make([]string, len(method.Parameters))
+	for i, parameter := range method.Parameters {
+		parameters[i] = parameter.SimpleName()
+	}
+	return method.Return.SimpleName() + " " + name + "(" + strings.Join(parameters, ", ") + ")"
+}
+
+// ParameterSlots returns the number of local variable slots taken by the parameters, not counting this.
+func (method MethodDescriptor) ParameterSlots() int {
+	slots := 0
+	for _, parameter := range method.Parameters {
+		slots += parameter.Slots()
+	}
+	return slots
+}
+
+// ClassNames returns the internal names of the classes of the parameter and return types, in order.
+func (method MethodDescriptor) ClassNames() []string {
+	var names []string
+	for _, typ := range method.Parameters {
+		if typ.Base == 'L' {
+			names = append(names, typ.ClassName)
+		}
+	}
+	if method.Return.Base == 'L' {
+		names = append(names, method.Return.ClassName)
+	}
+	return names
+}
+
+// MapClasses returns the descriptor with its classes renamed by mapClass.
+func (method MethodDescriptor) MapClasses(mapClass func(name string) string) MethodDescriptor {
+	mapped := MethodDescriptor{Parameters: make([]FieldType, len(method.Parameters)), Return: method.Return.MapClass(mapClass)}
+	for i, parameter := range method.Parameters {
+		mapped.Parameters[i] = parameter.MapClass(mapClass)
+	}
+	return mapped
+}
+
+// GetFieldType parses the descriptor of a field.
+func (info *FieldInfo) GetFieldType() (FieldType, error) {
+	return ParseFieldType(info.GetDescriptor())
+}
+
+// GetMethodDescriptor parses the descriptor of a method.
+func (info *MethodInfo) GetMethodDescriptor() (MethodDescriptor, error) {
+	return ParseMethodDescriptor(info.GetDescriptor())
+}
@@ -0,0 +1,91 @@
+package babe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseMethodDescriptor(t *testing.T) {
+	tests := []struct {
+		descriptor string
+		java       string
+		slots      int
+		ok         bool
+	}{
+		{"()V", "void m()", 0, true},
+		{"(IJ)D", "double m(int, long)", 3, true},
+		{"([Ljava/lang/String;)V", "void m(String[])", 1, true},
+		{"(Ljava/util/Map$Entry;[[D)Ljava/lang/Object;", "Object m(Map$Entry, double[][])", 2, true},
+		{"", "", 0, false},
+		{"V", "", 0, false},
+		{"(I", "", 0, false},
+		{"(V)V", "", 0, false},
+		{"(L;)V", "", 0, false},
+		{"(Ljava/lang/String)V", "", 0, false},
+		{"()", "", 0, false},
+		{"()VV", "", 0, false},
+		{"(Q)V", "", 0, false},
+	}
+	for _, test := range tests {
+		method, err := ParseMethodDescriptor(test.descriptor)
+		if !test.ok {
+			if !errors.Is(err, ErrInvalidDescriptor) {
+				t.Errorf("ParseMethodDescriptor(%q) error = %v, want ErrInvalidDescriptor", test.descriptor, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMethodDescriptor(%q): %v", test.descriptor, err)
+			continue
+		}
+		if s := method.String(); s != test.descriptor {
+			t.Errorf("ParseMethodDescriptor(%q).String() = %q", test.descriptor, s)
+		}
+		if java := method.JavaString("m"); java != test.java {
+			t.Errorf("ParseMethodDescriptor(%q).JavaString = %q, want %q", test.descriptor, java, test.java)
+		}
+		if slots := method.ParameterSlots(); slots != test.slots {
+			t.Errorf("ParseMethodDescriptor(%q).ParameterSlots = %d, want %d", test.descriptor, slots, test.slots)
+		}
+	}
+}
+
+func TestJavaType(t *testing.T) {
+	tests := map[string]string{
+		"int":                   "I",
+		"void":                  "V",
+		"java.lang.String":      "Ljava/lang/String;",
+		"long[][]":              "[[J",
+		"java.util.Map$Entry[]": "[Ljava/util/Map$Entry;",
+	}
+	for name, descriptor := range tests {
+		if typ := JavaType(name); typ.String() != descriptor {
+			t.Errorf("JavaType(%q) = %q, want %q", name, typ, descriptor)
+		}
+	}
+}
+
+func TestMapClasses(t *testing.T) {
+	method, err := ParseMethodDescriptor("(La/A;I[La/B;)La/A;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped := method.MapClasses(func(name string) string { return strings.Replace(name, "a/", "b/", 1) })
+	if s := mapped.String(); s != "(Lb/A;I[Lb/B;)Lb/A;" {
+		t.Errorf("MapClasses = %q", s)
+	}
+	if s := method.String(); s != "(La/A;I[La/B;)La/A;" {
+		t.Errorf("MapClasses changed the original to %q", s)
+	}
+}
+
+func TestInvalidInvokeDescriptor(t *testing.T) {
+	_, err := NewClassBuilder("a/Main").Method(ACC_PUBLIC|ACC_STATIC, "main", "()V", func(code *CodeBuilder) {
+		code.InvokeStatic("a/Other", "call", "(Ljava/lang/String)V")
+		code.Return()
+	}).Build()
+	if !errors.Is(err, ErrInvalidDescriptor) {
+		t.Errorf("Build error = %v, want ErrInvalidDescriptor", err)
+	}
+}
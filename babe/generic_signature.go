@@ -0,0 +1,450 @@
+package babe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidGenericSignature = errors.New("jarhax: invalid generic signature")
+
+// ClassSignature is the Signature attribute of a class, such as <T:Ljava/lang/Object;>Ljava/lang/Object;Ljava/lang/Comparable<TT;>;
+type ClassSignature struct {
+	TypeParameters []*TypeParameter
+	Super          *ClassTypeSignature
+	Interfaces     []*ClassTypeSignature
+}
+
+// MethodSignature is the Signature attribute of a method. Throws holds class types and type variables.
+type MethodSignature struct {
+	TypeParameters []*TypeParameter
+	Parameters     []*TypeSignature
+	Return         *TypeSignature
+	Throws         []*TypeSignature
+}
+
+// TypeParameter declares a type variable. ClassBound is nil when the variable is only bounded by interfaces.
+type TypeParameter struct {
+	Name            string
+	ClassBound      *TypeSignature
+	InterfaceBounds []*TypeSignature
+}
+
+// TypeSignature is a type in a signature, of which exactly one form is set: a primitive type or void, a type
+// variable, an array or a class type.
+type TypeSignature struct {
+	// Base is the descriptor of a primitive type or void, such as 'I' or 'V'
+	Base     byte
+	Variable string
+	Array    *TypeSignature
+	Class    *ClassTypeSignature
+}
+
+// ClassTypeSignature is a class type with its type arguments. Inner classes of parameterized types are written as
+// suffixes of their outer class, as in Ljava/util/Map<TK;TV;>.Entry<TK;TV;>;
+type ClassTypeSignature struct {
+	// Name is the internal name of the outermost class
+	Name      string
+	Arguments []*TypeArgument
+	Inner     []*InnerClassTypeSignature
+}
+
+// InnerClassTypeSignature is an inner class suffix of a ClassTypeSignature, named by its simple name.
+type InnerClassTypeSignature struct {
+	Name      string
+	Arguments []*TypeArgument
+}
+
+// TypeArgument is an argument of a class type. Wildcard is 0 for exact types, '+' for ? extends, '-' for ? super
+// and '*' for ?, which has no Type.
+type TypeArgument struct {
+	Wildcard byte
+	Type     *TypeSignature
+}
+
+// SignatureVisitor is called with every class type of a signature, before those in its type arguments, and may
+// change it in place.
+type SignatureVisitor func(class *ClassTypeSignature)
+
+// ClassName returns the internal name of the class, inner classes included.
+func (signature *ClassTypeSignature) ClassName() string {
+	name := signature.Name
+	for _, inner := range signature.Inner {
+		name += "$" + inner.Name
+	}
+	return name
+}
+
+func (signature *ClassSignature) Accept(visitor SignatureVisitor) {
+	acceptTypeParameters(signature.TypeParameters, visitor)
+	if signature.Super != nil {
+		signature.Super.Accept(visitor)
+	}
+	for _, class := range signature.Interfaces {
+		class.Accept(visitor)
+	}
+}
+
+func (signature *MethodSignature) Accept(visitor SignatureVisitor) {
+	acceptTypeParameters(signature.TypeParameters, visitor)
+	for _, parameter := range signature.Parameters {
+		parameter.Accept(visitor)
+	}
+	if signature.Return != nil {
+		signature.Return.Accept(visitor)
+	}
+	for _, throws := range signature.Throws {
+		throws.Accept(visitor)
+	}
+}
+
+func acceptTypeParameters(parameters []*TypeParameter, visitor SignatureVisitor) {
+	for _, parameter := range parameters {
+		if parameter.ClassBound != nil {
+			parameter.ClassBound.Accept(visitor)
+		}
+		for _, bound := range parameter.InterfaceBounds {
+			bound.Accept(visitor)
+		}
+	}
+}
+
+func (signature *TypeSignature) Accept(visitor SignatureVisitor) {
+	switch {
+	case signature.Array != nil:
+		signature.Array.Accept(visitor)
+	case signature.Class != nil:
+		signature.Class.Accept(visitor)
+	}
+}
+
+func (signature *ClassTypeSignature) Accept(visitor SignatureVisitor) {
+	visitor(signature)
+	acceptTypeArguments(signature.Arguments, visitor)
+	for _, inner := range signature.Inner {
+		acceptTypeArguments(inner.Arguments, visitor)
+	}
+}
+
+func acceptTypeArguments(arguments []*TypeArgument, visitor SignatureVisitor) {
+	for _, argument := range arguments {
+		if argument.Type != nil {
+			argument.Type.Accept(visitor)
+		}
+	}
+}
+
+func (signature *ClassSignature) String() string {
+	var out strings.Builder
+	writeTypeParameters(&out, signature.TypeParameters)
+	if signature.Super != nil {
+		signature.Super.write(&out)
+	}
+	for _, class := range signature.Interfaces {
+		class.write(&out)
+	}
+	return out.String()
+}
+
+func (signature *MethodSignature) String() string {
+	var out strings.Builder
+	writeTypeParameters(&out, signature.TypeParameters)
+	out.WriteByte('(')
+	for _, parameter := range signature.Parameters {
+		parameter.write(&out)
+	}
+	out.WriteByte(')')
+	if signature.Return != nil {
+		signature.Return.write(&out)
+	}
+	for _, throws := range signature.Throws {
+		out.WriteByte('^')
+		throws.write(&out)
+	}
+	return out.String()
+}
+
+func writeTypeParameters(out *strings.Builder, parameters []*TypeParameter) {
+	if len(parameters) == 0 {
+		return
+	}
+	out.WriteByte('<')
+	for _, parameter := range parameters {
+		out.WriteString(parameter.Name)
+		out.WriteByte(':')
+		if parameter.ClassBound != nil {
+			parameter.ClassBound.write(out)
+		}
+		for _, bound := range parameter.InterfaceBounds {
+			out.WriteByte(':')
+			bound.write(out)
+		}
+	}
+	out.WriteByte('>')
+}
+
+func (signature *TypeSignature) String() string {
+	var out strings.Builder
+	signature.write(&out)
+	return out.String()
+}
+
+func (signature *TypeSignature) write(out *strings.Builder) {
+	switch {
+	case signature.Array != nil:
+		out.WriteByte('[')
+		signature.Array.write(out)
+	case signature.Class != nil:
+		signature.Class.write(out)
+	case signature.Variable != "":
+		out.WriteString("T" + signature.Variable + ";")
+	default:
+		out.WriteByte(signature.Base)
+	}
+}
+
+func (signature *ClassTypeSignature) String() string {
+	var out strings.Builder
+	signature.write(&out)
+	return out.String()
+}
+
+func (signature *ClassTypeSignature) write(out *strings.Builder) {
+	out.WriteString("L" + signature.Name)
+	writeTypeArguments(out, signature.Arguments)
+	for _, inner := range signature.Inner {
+		out.WriteString("." + inner.Name)
+		writeTypeArguments(out, inner.Arguments)
+	}
+	out.WriteByte(';')
+}
+
+func writeTypeArguments(out *strings.Builder, arguments []*TypeArgument) {
+	if len(arguments) == 0 {
+		return
+	}
+	out.WriteByte('<')
+	for _, argument := range arguments {
+		if argument.Wildcard != 0 {
+			out.WriteByte(argument.Wildcard)
+		}
+		if argument.Type != nil {
+			argument.Type.write(out)
+		}
+	}
+	out.WriteByte('>')
+}
+
+// signatureParser reads signatures following the grammar of JVMS 4.7.9.1. The first error stops it, leaving the
+// parsed values incomplete.
+type signatureParser struct {
+	signature string
+	i         int
+	err       error
+}
+
+func (parser *signatureParser) peek() byte {
+	if parser.err != nil || parser.i >= len(parser.signature) {
+		return 0
+	}
+	return parser.signature[parser.i]
+}
+
+func (parser *signatureParser) fail() {
+	if parser.err == nil {
+		parser.err = fmt.Errorf("%w: %q at %d", ErrInvalidGenericSignature, parser.signature, parser.i)
+	}
+}
+
+func (parser *signatureParser) expect(c byte) {
+	if parser.peek() != c {
+		parser.fail()
+		return
+	}
+	parser.i++
+}
+
+// identifier reads up to any of the given characters, which must follow it.
+func (parser *signatureParser) identifier(stops string) string {
+	start := parser.i
+	for parser.i < len(parser.signature) && !strings.ContainsRune(stops, rune(parser.signature[parser.i])) {
+		parser.i++
+	}
+	if parser.i == start || parser.i == len(parser.signature) {
+		parser.fail()
+	}
+	return parser.signature[start:parser.i]
+}
+
+func (parser *signatureParser) end() error {
+	if parser.err == nil && parser.i != len(parser.signature) {
+		parser.fail()
+	}
+	return parser.err
+}
+
+func (parser *signatureParser) typeParameters() []*TypeParameter {
+	if parser.peek() != '<' {
+		return nil
+	}
+	parser.i++
+	var parameters []*TypeParameter
+	for parser.peek() != '>' && parser.err == nil {
+		parameter := &TypeParameter{Name: parser.identifier(":")}
+		parser.expect(':')
+		if c := parser.peek(); c != ':' && c != '>' {
+			parameter.ClassBound = parser.referenceType()
+		}
+		for parser.peek() == ':' {
+			parser.i++
+			parameter.InterfaceBounds = append(parameter.InterfaceBounds, parser.referenceType())
+		}
+		parameters = append(parameters, parameter)
+	}
+	if len(parameters) == 0 {
+		parser.fail()
+	}
+	parser.expect('>')
+	return parameters
+}
+
+func (parser *signatureParser) javaType() *TypeSignature {
+	switch c := parser.peek(); c {
+	case 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'Z', 'V':
+		parser.i++
+		return &TypeSignature{Base: c}
+	}
+	return parser.referenceType()
+}
+
+func (parser *signatureParser) referenceType() *TypeSignature {
+	switch parser.peek() {
+	case 'L':
+		return &TypeSignature{Class: parser.classType()}
+	case 'T':
+		parser.i++
+		variable := parser.identifier(";")
+		parser.expect(';')
+		return &TypeSignature{Variable: variable}
+	case '[':
+		parser.i++
+		element := parser.javaType()
+		if element.Base == 'V' {
+			parser.fail()
+		}
+		return &TypeSignature{Array: element}
+	}
+	parser.fail()
+	return &TypeSignature{}
+}
+
+func (parser *signatureParser) classType() *ClassTypeSignature {
+	parser.expect('L')
+	class := &ClassTypeSignature{Name: parser.identifier("<.;")}
+	class.Arguments = parser.typeArguments()
+	for parser.peek() == '.' {
+		parser.i++
+		inner := &InnerClassTypeSignature{Name: parser.identifier("<.;")}
+		inner.Arguments = parser.typeArguments()
+		class.Inner = append(class.Inner, inner)
+	}
+	parser.expect(';')
+	return class
+}
+
+func (parser *signatureParser) typeArguments() []*TypeArgument {
+	if parser.peek() != '<' {
+		return nil
+	}
+	parser.i++
+	var arguments []*TypeArgument
+	for parser.peek() != '>' && parser.err == nil {
+		argument := &TypeArgument{}
+		switch c := parser.peek(); c {
+		case '*':
+			parser.i++
+			argument.Wildcard = c
+			arguments = append(arguments, argument)
+			continue
+		case '+', '-':
+			parser.i++
+			argument.Wildcard = c
+		}
+		argument.Type = parser.referenceType()
+		arguments = append(arguments, argument)
+	}
+	if len(arguments) == 0 {
+		parser.fail()
+	}
+	parser.expect('>')
+	return arguments
+}
+
+// ParseClassSignature parses the Signature attribute of a class.
+func ParseClassSignature(signature string) (*ClassSignature, error) {
+	parser := &signatureParser{signature: signature}
+	class := &ClassSignature{TypeParameters: parser.typeParameters(), Super: parser.classType()}
+	for parser.peek() == 'L' {
+		class.Interfaces = append(class.Interfaces, parser.classType())
+	}
+	return class, parser.end()
+}
+
+// ParseMethodSignature parses the Signature attribute of a method. Method descriptors are valid method signatures.
+func ParseMethodSignature(signature string) (*MethodSignature, error) {
+	parser := &signatureParser{signature: signature}
+	method := &MethodSignature{TypeParameters: parser.typeParameters()}
+	parser.expect('(')
+	for parser.peek() != ')' && parser.err == nil {
+		parameter := parser.javaType()
+		if parameter.Base == 'V' {
+			parser.fail()
+		}
+		method.Parameters = append(method.Parameters, parameter)
+	}
+	parser.expect(')')
+	method.Return = parser.javaType()
+	for parser.peek() == '^' {
+		parser.i++
+		throws := parser.referenceType()
+		if throws.Array != nil {
+			parser.fail()
+		}
+		method.Throws = append(method.Throws, throws)
+	}
+	return method, parser.end()
+}
+
+// ParseFieldSignature parses the Signature attribute of a field or record component, which is a class type, type
+// variable or array. Field descriptors of reference types are valid field signatures.
+func ParseFieldSignature(signature string) (*TypeSignature, error) {
+	parser := &signatureParser{signature: signature}
+	field := parser.referenceType()
+	return field, parser.end()
+}
+
+// VisitSignature parses a class, method or field signature, passes its class types to visitor and prints it again.
+func VisitSignature(signature string, visitor SignatureVisitor) (string, error) {
+	type acceptor interface {
+		Accept(SignatureVisitor)
+		String() string
+	}
+	var parsed acceptor
+	var err error
+	switch {
+	case strings.ContainsRune(signature, '('):
+		parsed, err = ParseMethodSignature(signature)
+	case strings.HasPrefix(signature, "<"):
+		parsed, err = ParseClassSignature(signature)
+	default:
+		// Class signatures without type parameters are field signatures followed by the interfaces
+		if parsed, err = ParseFieldSignature(signature); err != nil && strings.HasPrefix(signature, "L") {
+			parsed, err = ParseClassSignature(signature)
+		}
+	}
+	if err != nil {
+		return signature, err
+	}
+	parsed.Accept(visitor)
+	return parsed.String(), nil
+}
@@ -0,0 +1,67 @@
+package babe
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVisitSignature(t *testing.T) {
+	tests := []struct {
+		signature string
+		classes   []string
+	}{
+		{"<T:Ljava/lang/Object;>Ljava/lang/Object;Ljava/lang/Comparable<TT;>;", []string{"java/lang/Object", "java/lang/Object", "java/lang/Comparable"}},
+		{"<T::Ljava/lang/Runnable;>Ljava/lang/Object;", []string{"java/lang/Runnable", "java/lang/Object"}},
+		{"Ljava/util/AbstractList<Ljava/lang/String;>;Ljava/util/RandomAccess;", []string{"java/util/AbstractList", "java/lang/String", "java/util/RandomAccess"}},
+		{"Ljava/util/Map<TK;TV;>.Entry<TK;TV;>;", []string{"java/util/Map$Entry"}},
+		{"[Ljava/util/List<+Ljava/lang/Number;>;", []string{"java/util/List", "java/lang/Number"}},
+		{"Ljava/util/List<*>;", []string{"java/util/List"}},
+		{"TT;", nil},
+		{"<E:Ljava/lang/Exception;>(I[TE;Ljava/util/List<-TE;>;)V^TE;^Ljava/io/IOException;", []string{"java/lang/Exception", "java/util/List", "java/io/IOException"}},
+		{"(JLjava/lang/String;)[D", []string{"java/lang/String"}},
+	}
+	for _, test := range tests {
+		var classes []string
+		printed, err := VisitSignature(test.signature, func(class *ClassTypeSignature) {
+			classes = append(classes, class.ClassName())
+		})
+		if err != nil {
+			t.Errorf("VisitSignature(%q): %v", test.signature, err)
+			continue
+		}
+		if printed != test.signature {
+			t.Errorf("VisitSignature(%q) printed %q", test.signature, printed)
+		}
+		if !slices.Equal(classes, test.classes) {
+			t.Errorf("VisitSignature(%q) visited %v, want %v", test.signature, classes, test.classes)
+		}
+	}
+}
+
+func TestVisitSignatureInvalid(t *testing.T) {
+	for _, signature := range []string{"", "L", "Ljava/lang/String", "<T>V", "(V)V", "(I)", "()V^I", "Ljava/util/List<>;", "I"} {
+		if _, err := VisitSignature(signature, func(*ClassTypeSignature) {}); err == nil {
+			t.Errorf("VisitSignature(%q) succeeded", signature)
+		}
+	}
+}
+
+func TestMapSignature(t *testing.T) {
+	remapper := &SimpleRemapper{Classes: map[string]string{
+		"a/Outer":       "b/Renamed",
+		"a/Outer$Inner": "b/Renamed$Nested",
+		"a/Other":       "b/Other",
+	}}
+	tests := map[string]string{
+		"La/Outer<TT;>.Inner<La/Other;>;":       "Lb/Renamed<TT;>.Nested<Lb/Other;>;",
+		"(La/Outer$Inner;[La/Other;)La/Outer;":  "(Lb/Renamed$Nested;[Lb/Other;)Lb/Renamed;",
+		"<T:La/Other;>La/Outer;":                "<T:Lb/Other;>Lb/Renamed;",
+		"Ljava/util/List<-La/Outer$Inner;>;":    "Ljava/util/List<-Lb/Renamed$Nested;>;",
+		"La/Outer<TT;>.Inner<La/Other;>;broken": "La/Outer<TT;>.Inner<La/Other;>;broken",
+	}
+	for signature, want := range tests {
+		if mapped := MapSignature(remapper, signature); mapped != want {
+			t.Errorf("MapSignature(%q) = %q, want %q", signature, mapped, want)
+		}
+	}
+}
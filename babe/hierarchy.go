@@ -0,0 +1,355 @@
+package babe
+
+import (
+	"encoding/binary"
+	"errors"
+	"path"
+	"slices"
+	"sync"
+)
+
+// HierarchyClass is the part of a class the hierarchy needs. Fields and methods are keyed by name followed by
+// descriptor and hold their access flags.
+type HierarchyClass struct {
+	Name        string
+	Super       string
+	Interfaces  []string
+	AccessFlags int
+	Fields      map[string]int
+	Methods     map[string]int
+	// Methods called by bridge methods, keyed like Methods and holding the descriptor of the bridge
+	bridges map[string]string
+	// variant is set for classes only known from the versioned entries of a multi-release jar
+	variant bool
+}
+
+// ClassHierarchy resolves inherited members and overrides across the classes of a jar and its libraries.
+// It is an analyzer, so adding it to a pipeline adds every class of the jar being processed.
+type ClassHierarchy struct {
+	lock     sync.RWMutex
+	classes  map[string]*HierarchyClass
+	families map[string][]string
+}
+
+func NewClassHierarchy() *ClassHierarchy {
+	return &ClassHierarchy{classes: map[string]*HierarchyClass{}}
+}
+
+func (hierarchy *ClassHierarchy) AddClass(class *Class) {
+	hierarchy.add(class, false)
+}
+
+// addMember adds the class of a member. The versioned variants of multi-release jars only add classes missing from
+// the base entries, which are what the hierarchy describes.
+func (hierarchy *ClassHierarchy) addMember(member *JarMember) error {
+	class, err := member.GetAsClass()
+	if errors.Is(err, ErrNotClass) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	version, _ := SplitVersionedName(member.Name)
+	hierarchy.add(class, version > 0)
+	return nil
+}
+
+func (hierarchy *ClassHierarchy) add(class *Class, variant bool) {
+	entry := &HierarchyClass{
+		Name:        class.GetClassName(),
+		Super:       class.GetSuperClassName(),
+		Interfaces:  class.GetInterfaceNames(),
+		AccessFlags: int(class.AccessFlags),
+		Fields:      map[string]int{},
+		Methods:     map[string]int{},
+		bridges:     map[string]string{},
+		variant:     variant,
+	}
+	for _, field := range class.Fields {
+		entry.Fields[field.GetName()+field.GetDescriptor()] = int(field.AccessFlags)
+	}
+	for i := range class.Methods {
+		method := &class.Methods[i]
+		entry.Methods[method.GetName()+method.GetDescriptor()] = int(method.AccessFlags)
+		if method.HasModifier(ACC_BRIDGE) {
+			if target := bridgeTarget(class, method); target != "" {
+				entry.bridges[target] = method.GetDescriptor()
+			}
+		}
+	}
+
+	hierarchy.lock.Lock()
+	defer hierarchy.lock.Unlock()
+	if existing := hierarchy.classes[entry.Name]; variant && existing != nil && !existing.variant {
+		return
+	}
+	hierarchy.classes[entry.Name] = entry
+	hierarchy.families = nil
+}
+
+// bridgeTarget returns the name and descriptor of the method of the same class a bridge method calls.
+func bridgeTarget(class *Class, method *MethodInfo) string {
+	code := method.GetCode()
+	if code == nil {
+		return ""
+	}
+	owner, name := class.GetClassName(), method.GetName()
+	target := ""
+	ForInstruction(code.Code, func(offset int, opcode byte) error {
+		if opcode == INVOKEVIRTUAL || opcode == INVOKESPECIAL || opcode == INVOKEINTERFACE {
+			refOwner, refName, refDescriptor := class.GetRef(binary.BigEndian.Uint16(code.Code[offset+1:]))
+			if refOwner == owner && refName == name && refDescriptor != method.GetDescriptor() {
+				target = refName + refDescriptor
+			}
+		}
+		return nil
+	})
+	return target
+}
+
+// AddJar adds every class of a jar, typically a library the jar being processed is compiled against.
+func (hierarchy *ClassHierarchy) AddJar(filename string) error {
+	return ForJarMember(filename, hierarchy.addMember)
+}
+
+func (hierarchy *ClassHierarchy) Analyze(members []*JarMember) error {
+	for _, member := range members {
+		if err := hierarchy.addMember(member); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Class returns the class named name, or nil if it isn't part of the hierarchy.
+func (hierarchy *ClassHierarchy) Class(name string) *HierarchyClass {
+	hierarchy.lock.RLock()
+	defer hierarchy.lock.RUnlock()
+	return hierarchy.classes[name]
+}
+
+// Ancestors returns the superclasses and superinterfaces of a class known to the hierarchy, nearest first.
+func (hierarchy *ClassHierarchy) Ancestors(name string) []string {
+	hierarchy.lock.RLock()
+	defer hierarchy.lock.RUnlock()
+	return hierarchy.ancestors(name)[1:]
+}
+
+// ancestors returns the class itself followed by its known ancestors.
+func (hierarchy *ClassHierarchy) ancestors(name string) []string {
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	for i := 0; i < len(queue); i++ {
+		class := hierarchy.classes[queue[i]]
+		if class == nil {
+			continue
+		}
+		for _, parent := range append([]string{class.Super}, class.Interfaces...) {
+			if parent != "" && !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return queue
+}
+
+// ResolveField returns the class declaring the field a reference through owner resolves to, or an empty string.
+func (hierarchy *ClassHierarchy) ResolveField(owner string, name string, descriptor string) string {
+	hierarchy.lock.RLock()
+	defer hierarchy.lock.RUnlock()
+	for class := hierarchy.classes[owner]; class != nil; class = hierarchy.classes[class.Super] {
+		if _, ok := class.Fields[name+descriptor]; ok {
+			return class.Name
+		}
+		// Fields of superinterfaces are found before those of the superclass
+		for _, parent := range hierarchy.ancestors(class.Name)[1:] {
+			if interfaceClass := hierarchy.classes[parent]; interfaceClass != nil && interfaceClass.AccessFlags&ACC_INTERFACE != 0 {
+				if _, ok := interfaceClass.Fields[name+descriptor]; ok {
+					return parent
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// ResolveMethod returns the class declaring the method a reference through owner resolves to, searching the
+// superclasses before the superinterfaces, or an empty string.
+func (hierarchy *ClassHierarchy) ResolveMethod(owner string, name string, descriptor string) string {
+	hierarchy.lock.RLock()
+	defer hierarchy.lock.RUnlock()
+	return hierarchy.resolveMethod(owner, name+descriptor)
+}
+
+func (hierarchy *ClassHierarchy) resolveMethod(owner string, key string) string {
+	for class := hierarchy.classes[owner]; class != nil; class = hierarchy.classes[class.Super] {
+		if _, ok := class.Methods[key]; ok {
+			return class.Name
+		}
+	}
+	for _, parent := range hierarchy.ancestors(owner) {
+		if class := hierarchy.classes[parent]; class != nil {
+			if access, ok := class.Methods[key]; ok && access&(ACC_PRIVATE|ACC_STATIC) == 0 {
+				return parent
+			}
+		}
+	}
+	return ""
+}
+
+// MethodFamily returns the classes declaring a method that overrides, or is overridden by, the method declared
+// by owner, including owner itself. Classes inheriting an implementation of an interface method from a superclass
+// join the two into one family. Constructors, private and static methods have no family but themselves.
+func (hierarchy *ClassHierarchy) MethodFamily(owner string, name string, descriptor string) []string {
+	hierarchy.lock.RLock()
+	if hierarchy.families == nil {
+		hierarchy.lock.RUnlock()
+		hierarchy.lock.Lock()
+		if hierarchy.families == nil {
+			hierarchy.families = hierarchy.methodFamilies()
+		}
+		hierarchy.lock.Unlock()
+		hierarchy.lock.RLock()
+	}
+	defer hierarchy.lock.RUnlock()
+
+	if family, ok := hierarchy.families[owner+"."+name+descriptor]; ok {
+		return family
+	}
+	return []string{owner}
+}
+
+func overridable(key string, access int) bool {
+	return key[0] != '<' && access&(ACC_PRIVATE|ACC_STATIC) == 0
+}
+
+type declaration struct {
+	owner string
+	key   string
+}
+
+// methodFamilies groups every overridable method declaration with the declarations it shares a subclass with.
+// Families are keyed by each of their declarations and list the declaring classes in name order.
+func (hierarchy *ClassHierarchy) methodFamilies() map[string][]string {
+	parents := map[declaration]declaration{}
+	var find func(declaration) declaration
+	find = func(method declaration) declaration {
+		parent, ok := parents[method]
+		if !ok || parent == method {
+			parents[method] = method
+			return method
+		}
+		root := find(parent)
+		parents[method] = root
+		return root
+	}
+
+	for name := range hierarchy.classes {
+		visible := map[string]declaration{}
+		for _, ancestor := range hierarchy.ancestors(name) {
+			class := hierarchy.classes[ancestor]
+			if class == nil {
+				continue
+			}
+			for key, access := range class.Methods {
+				// Package-private methods are only overridden from within their package
+				if !overridable(key, access) || access&(ACC_PUBLIC|ACC_PROTECTED) == 0 && path.Dir(ancestor) != path.Dir(name) {
+					continue
+				}
+				method := declaration{ancestor, key}
+				if first, ok := visible[key]; ok {
+					parents[find(method)] = find(first)
+				} else {
+					visible[key] = method
+					find(method)
+				}
+			}
+		}
+	}
+
+	groups := map[declaration][]declaration{}
+	for method := range parents {
+		root := find(method)
+		groups[root] = append(groups[root], method)
+	}
+	families := map[string][]string{}
+	for _, methods := range groups {
+		owners := make([]string, len(methods))
+		for i, method := range methods {
+			owners[i] = method.owner
+		}
+		slices.Sort(owners)
+		for _, method := range methods {
+			families[method.owner+"."+method.key] = owners
+		}
+	}
+	return families
+}
+
+// HierarchyRemapper applies the mappings of a Remapper through a class hierarchy. Members referenced through
+// a subclass are mapped with their declaring class, and overriding methods, the methods called by bridge methods
+// and the methods inherited from a superclass to implement an interface are renamed together, so remapped
+// classes keep overriding each other.
+type HierarchyRemapper struct {
+	Remapper  Remapper
+	Hierarchy *ClassHierarchy
+}
+
+func NewHierarchyRemapper(remapper Remapper, hierarchy *ClassHierarchy) *HierarchyRemapper {
+	return &HierarchyRemapper{remapper, hierarchy}
+}
+
+func (remapper *HierarchyRemapper) MapClass(name string) string {
+	return remapper.Remapper.MapClass(name)
+}
+
+func (remapper *HierarchyRemapper) MapField(owner string, name string, descriptor string) string {
+	if declaring := remapper.Hierarchy.ResolveField(owner, name, descriptor); declaring != "" {
+		owner = declaring
+	}
+	return remapper.Remapper.MapField(owner, name, descriptor)
+}
+
+func (remapper *HierarchyRemapper) MapMethod(owner string, name string, descriptor string) string {
+	if mapped := remapper.Remapper.MapMethod(owner, name, descriptor); mapped != name || name[0] == '<' {
+		return mapped
+	}
+	if declaring := remapper.Hierarchy.ResolveMethod(owner, name, descriptor); declaring != "" {
+		owner = declaring
+	}
+	for _, member := range remapper.Hierarchy.MethodFamily(owner, name, descriptor) {
+		if mapped := remapper.Remapper.MapMethod(member, name, descriptor); mapped != name {
+			return mapped
+		}
+	}
+	if bridge, ok := remapper.Hierarchy.bridge(owner, name+descriptor); ok {
+		return remapper.MapMethod(owner, name, bridge)
+	}
+	return name
+}
+
+// bridge returns the descriptor of the bridge method calling a method.
+func (hierarchy *ClassHierarchy) bridge(owner string, key string) (string, bool) {
+	hierarchy.lock.RLock()
+	defer hierarchy.lock.RUnlock()
+	if class := hierarchy.classes[owner]; class != nil {
+		descriptor, ok := class.bridges[key]
+		return descriptor, ok
+	}
+	return "", false
+}
+
+func (remapper *HierarchyRemapper) MapString(value string) string {
+	if strings, ok := remapper.Remapper.(StringRemapper); ok {
+		return strings.MapString(value)
+	}
+	return value
+}
+
+func (remapper *HierarchyRemapper) MapLocal(owner string, method string, descriptor string, index int, name string) string {
+	if locals, ok := remapper.Remapper.(LocalRemapper); ok {
+		return locals.MapLocal(owner, method, descriptor, index, name)
+	}
+	return name
+}
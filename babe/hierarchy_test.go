@@ -0,0 +1,173 @@
+package babe
+
+import (
+	"slices"
+	"testing"
+)
+
+func testHierarchy(t *testing.T) *ClassHierarchy {
+	t.Helper()
+	interfaceAccess := ACC_PUBLIC | ACC_INTERFACE | ACC_ABSTRACT
+	builders := []*ClassBuilder{
+		// a/C inherits the implementation of a/I.m from a/B
+		NewClassBuilder("a/I").Access(interfaceAccess).Method(ACC_PUBLIC|ACC_ABSTRACT, "m", "()V", nil),
+		NewClassBuilder("a/B").Method(ACC_PUBLIC, "m", "()V", emptyBody),
+		NewClassBuilder("a/C").Extends("a/B").Implements("a/I"),
+		NewClassBuilder("a/D").Extends("a/C").Method(ACC_PUBLIC, "m", "()V", emptyBody),
+
+		NewClassBuilder("a/P").
+			Method(ACC_PRIVATE, "p", "()V", emptyBody).
+			Method(ACC_STATIC, "s", "()V", emptyBody).
+			Method(0, "q", "()V", emptyBody).
+			Method(ACC_PUBLIC, "<init>", "()V", emptyBody),
+		NewClassBuilder("a/Q").Extends("a/P").
+			Method(ACC_PRIVATE, "p", "()V", emptyBody).
+			Method(ACC_STATIC, "s", "()V", emptyBody).
+			Method(0, "q", "()V", emptyBody).
+			Method(ACC_PUBLIC, "<init>", "()V", emptyBody),
+		NewClassBuilder("b/R").Extends("a/P").Method(ACC_PUBLIC, "q", "()V", emptyBody),
+
+		NewClassBuilder("a/Base").Method(ACC_PUBLIC, "get", "(Ljava/lang/Object;)V", emptyBody),
+		NewClassBuilder("a/Sub").Extends("a/Base").
+			Method(ACC_PUBLIC, "get", "(Ljava/lang/String;)V", emptyBody).
+			Method(ACC_PUBLIC|ACC_BRIDGE|ACC_SYNTHETIC, "get", "(Ljava/lang/Object;)V", func(code *CodeBuilder) {
+				code.VisitVarInsn(ALOAD, 0)
+				code.VisitVarInsn(ALOAD, 1)
+				code.VisitTypeInsn(CHECKCAST, "java/lang/String")
+				code.InvokeVirtual("a/Sub", "get", "(Ljava/lang/String;)V")
+				code.Return()
+			}),
+
+		NewClassBuilder("a/J").Access(interfaceAccess).Field(ACC_PUBLIC|ACC_STATIC|ACC_FINAL, "X", "I", 1),
+		NewClassBuilder("a/F").Field(ACC_PUBLIC, "value", "I", nil).Field(ACC_PUBLIC, "X", "I", nil),
+		NewClassBuilder("a/G").Extends("a/F").Implements("a/J"),
+	}
+	hierarchy := NewClassHierarchy()
+	for _, builder := range builders {
+		class, err := builder.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hierarchy.AddClass(class)
+	}
+	return hierarchy
+}
+
+func TestMethodFamily(t *testing.T) {
+	hierarchy := testHierarchy(t)
+	tests := []struct {
+		owner, name, descriptor string
+		family                  []string
+	}{
+		{"a/I", "m", "()V", []string{"a/B", "a/D", "a/I"}},
+		{"a/B", "m", "()V", []string{"a/B", "a/D", "a/I"}},
+		{"a/D", "m", "()V", []string{"a/B", "a/D", "a/I"}},
+		{"a/P", "p", "()V", []string{"a/P"}},
+		{"a/Q", "p", "()V", []string{"a/Q"}},
+		{"a/P", "s", "()V", []string{"a/P"}},
+		{"a/Q", "s", "()V", []string{"a/Q"}},
+		{"a/P", "<init>", "()V", []string{"a/P"}},
+		{"a/P", "q", "()V", []string{"a/P", "a/Q"}},
+		{"a/Q", "q", "()V", []string{"a/P", "a/Q"}},
+		{"b/R", "q", "()V", []string{"b/R"}},
+		{"a/Base", "get", "(Ljava/lang/Object;)V", []string{"a/Base", "a/Sub"}},
+		{"a/Sub", "get", "(Ljava/lang/String;)V", []string{"a/Sub"}},
+		{"a/Unknown", "m", "()V", []string{"a/Unknown"}},
+	}
+	for _, test := range tests {
+		if family := hierarchy.MethodFamily(test.owner, test.name, test.descriptor); !slices.Equal(family, test.family) {
+			t.Errorf("MethodFamily(%s.%s%s) = %v, want %v", test.owner, test.name, test.descriptor, family, test.family)
+		}
+	}
+}
+
+func TestResolveMembers(t *testing.T) {
+	hierarchy := testHierarchy(t)
+	methods := []struct {
+		owner, name, descriptor, declaring string
+	}{
+		{"a/C", "m", "()V", "a/B"},
+		{"a/D", "m", "()V", "a/D"},
+		{"a/Q", "q", "()V", "a/Q"},
+		{"b/R", "s", "()V", "a/P"},
+		{"a/C", "missing", "()V", ""},
+	}
+	for _, test := range methods {
+		if declaring := hierarchy.ResolveMethod(test.owner, test.name, test.descriptor); declaring != test.declaring {
+			t.Errorf("ResolveMethod(%s.%s%s) = %q, want %q", test.owner, test.name, test.descriptor, declaring, test.declaring)
+		}
+	}
+	fields := []struct {
+		owner, name, declaring string
+	}{
+		{"a/G", "value", "a/F"},
+		{"a/F", "X", "a/F"},
+		// Superinterfaces are searched before the superclass
+		{"a/G", "X", "a/J"},
+		{"a/J", "X", "a/J"},
+		{"a/G", "missing", ""},
+	}
+	for _, test := range fields {
+		if declaring := hierarchy.ResolveField(test.owner, test.name, "I"); declaring != test.declaring {
+			t.Errorf("ResolveField(%s.%s) = %q, want %q", test.owner, test.name, declaring, test.declaring)
+		}
+	}
+	if ancestors := hierarchy.Ancestors("a/D"); !slices.Equal(ancestors, []string{"a/C", "a/B", "a/I", "java/lang/Object"}) {
+		t.Errorf("Ancestors(a/D) = %v", ancestors)
+	}
+}
+
+func TestHierarchyRemapper(t *testing.T) {
+	remapper := NewHierarchyRemapper(&SimpleRemapper{
+		Fields: map[string]string{"a/F.value": "amount"},
+		Methods: map[string]string{
+			"a/I.m()V":                        "run",
+			"a/P.q()V":                        "query",
+			"a/P.p()V":                        "private",
+			"a/P.s()V":                        "static",
+			"a/P.<init>()V":                   "constructor",
+			"a/Base.get(Ljava/lang/Object;)V": "fetch",
+		},
+	}, testHierarchy(t))
+	tests := []struct {
+		owner, name, descriptor, mapped string
+	}{
+		{"a/I", "m", "()V", "run"},
+		{"a/B", "m", "()V", "run"},
+		{"a/C", "m", "()V", "run"},
+		{"a/D", "m", "()V", "run"},
+		{"a/P", "q", "()V", "query"},
+		{"a/Q", "q", "()V", "query"},
+		{"b/R", "q", "()V", "q"},
+		{"a/Q", "p", "()V", "p"},
+		{"a/Q", "s", "()V", "s"},
+		{"a/Q", "<init>", "()V", "<init>"},
+		{"a/Sub", "get", "(Ljava/lang/Object;)V", "fetch"},
+		{"a/Sub", "get", "(Ljava/lang/String;)V", "fetch"},
+	}
+	for _, test := range tests {
+		if mapped := remapper.MapMethod(test.owner, test.name, test.descriptor); mapped != test.mapped {
+			t.Errorf("MapMethod(%s.%s%s) = %q, want %q", test.owner, test.name, test.descriptor, mapped, test.mapped)
+		}
+	}
+	if mapped := remapper.MapField("a/G", "value", "I"); mapped != "amount" {
+		t.Errorf("MapField(a/G.value) = %q, want amount", mapped)
+	}
+
+	class, err := NewClassBuilder("a/E").Extends("a/D").Method(ACC_PUBLIC, "m", "()V", func(code *CodeBuilder) {
+		code.VisitVarInsn(ALOAD, 0)
+		code.InvokeSpecial("a/C", "m", "()V")
+		code.Return()
+	}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remapper.Hierarchy.AddClass(class)
+	RemapClass(class, remapper)
+	if class.FindMethod("run", "()V") == nil {
+		t.Error("overriding method not renamed")
+	}
+	if opcodes := invokeOpcodes(t, class, "run"); opcodes["a/C.run()V"] != INVOKESPECIAL {
+		t.Errorf("super call not renamed: %v", opcodes)
+	}
+}
@@ -2,11 +2,13 @@ package babe
 
 import (
 	"archive/zip"
+	stdbytes "bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"runtime"
 	"strings"
 
 	"github.com/mrnavastar/assist/bytes"
@@ -14,10 +16,45 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+type JarOptions struct {
+	// Workers is the maximum number of members processed at the same time.
+	Workers int
+	// StreamThreshold is the uncompressed size above which non-class members are
+	// passed through to the output without being loaded into memory.
+	StreamThreshold uint64
+	// Nested makes pipelines process the members of jars nested in the jar, such as Fabric's META-INF/jars,
+	// Forge's JarJar and Spring Boot's BOOT-INF/lib, along with the members of the jar itself.
+	Nested bool
+	// StripSignatures removes the signature files and entry digests of written jars, as any change to a signed
+	// jar invalidates its signature.
+	StripSignatures bool
+	// Signer signs written jars, replacing any signature they had.
+	Signer *JarSigner
+}
+
+var DefaultJarOptions = JarOptions{
+	Workers:         runtime.GOMAXPROCS(0),
+	StreamThreshold: 1 << 20,
+}
+
+func (options JarOptions) workers() int {
+	if options.Workers < 1 {
+		return 1
+	}
+	return options.Workers
+}
+
 type JarMember struct {
-	Name   string
-	Buffer *bytes.Buffer
-	delete bool
+	Name        string
+	Buffer      *bytes.Buffer
+	file        *zip.File
+	class       *Class
+	classBuffer *bytes.Buffer
+	delete      bool
+	// stored members are written without compression
+	stored bool
+	// nestedIn is the path of the nested jar holding the member, empty for members of the jar itself
+	nestedIn string
 }
 
 func JarMemberFromFile(filename string) (member JarMember, err error) {
@@ -37,26 +74,128 @@ func JarMemberFromString(name string, str string) (member JarMember) {
 	return member
 }
 
+// JarMemberFromClass creates a member for the class at the path matching its name.
+func JarMemberFromClass(class *Class) (member JarMember) {
+	member.Name = class.GetClassName() + ".class"
+	member.SetClass(class)
+	return member
+}
+
+// NestedIn returns the path of the nested jar holding the member, as "outer.jar!/inner.jar" for jars nested twice,
+// or "" for members of the jar itself. Analyzers see the members of every nested jar at once, and use it to tell
+// members of the same name apart.
+func (member *JarMember) NestedIn() string {
+	return member.nestedIn
+}
+
+// scopedName returns the name of the member prefixed with the nested jar holding it, as in "inner.jar!/a/B.class".
+func (member *JarMember) scopedName() string {
+	if member.nestedIn == "" {
+		return member.Name
+	}
+	return member.nestedIn + "!/" + member.Name
+}
+
+// splitScopedName splits a name returned by scopedName into the nested jar and the name of the member in it.
+func splitScopedName(name string) (string, string) {
+	if i := strings.LastIndex(name, "!/"); i >= 0 {
+		return name[:i], name[i+2:]
+	}
+	return "", name
+}
+
 func (member *JarMember) Delete() {
 	member.delete = true
 }
 
-func (member *JarMember) GetAsClass() (Class, error) {
+// IsStreamed reports whether the member content is still in the source jar
+// and has not been loaded into Buffer.
+func (member *JarMember) IsStreamed() bool {
+	return member.Buffer == nil && member.file != nil
+}
+
+// Open returns a reader over the member content without loading a streamed member into memory.
+func (member *JarMember) Open() (io.ReadCloser, error) {
+	if member.IsStreamed() {
+		return member.file.Open()
+	}
+	return io.NopCloser(stdbytes.NewReader(*member.Buffer.Data)), nil
+}
+
+// Load reads a streamed member into Buffer.
+func (member *JarMember) Load() error {
+	if !member.IsStreamed() {
+		return nil
+	}
+
+	f, err := member.file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buffer := bytes.NewBuffer()
+	if _, err = io.Copy(buffer, f); err != nil {
+		return err
+	}
+	member.Buffer = buffer
+	member.file = nil
+	return nil
+}
+
+// GetAsClass parses the member as a class. The result is cached until Buffer is replaced,
+// so every caller shares and may modify the same Class.
+func (member *JarMember) GetAsClass() (*Class, error) {
 	if !strings.HasSuffix(member.Name, ".class") {
-		return Class{}, ErrNotClass
+		return nil, ErrNotClass
+	}
+	if err := member.Load(); err != nil {
+		return nil, err
 	}
-	var class Class
+	if member.class != nil && member.classBuffer == member.Buffer {
+		return member.class, nil
+	}
+
+	class := &Class{}
 	if err := class.Read(*member.Buffer.Data); err != nil {
-		return class, err
+		return nil, err
 	}
+	member.class = class
+	member.classBuffer = member.Buffer
 	return class, nil
 }
 
+// SetClass replaces the member content with the serialized class.
+func (member *JarMember) SetClass(class *Class) {
+	member.Buffer = bytes.NewBuffer()
+	member.file = nil
+	class.Write(member.Buffer.Data)
+	member.class = class
+	member.classBuffer = member.Buffer
+}
+
+type queuedMember struct {
+	member *JarMember
+	done   chan struct{}
+}
+
 type Jar struct {
-	Name  string
-	c     chan *JarMember
-	tasks *errgroup.Group
-	group *errgroup.Group
+	Name    string
+	path    string
+	options JarOptions
+	c       chan queuedMember
+	ctx     context.Context
+	tasks   *errgroup.Group
+	group   *errgroup.Group
+}
+
+// Context is cancelled as soon as any task or the writer fails.
+func (jar *Jar) Context() context.Context {
+	return jar.ctx
+}
+
+func (jar *Jar) Options() JarOptions {
+	return jar.options
 }
 
 func (jar *Jar) Task(task func(jar *Jar) error) {
@@ -65,76 +204,120 @@ func (jar *Jar) Task(task func(jar *Jar) error) {
 	})
 }
 
-func (jar *Jar) Add(member JarMember) {
-	jar.c <- &member
+// Add queues a member for writing, blocking while the writer is busy. Streamed members
+// are copied straight from the source jar, so Add waits until they have been written.
+func (jar *Jar) Add(member JarMember) error {
+	queued := queuedMember{member: &member}
+	if member.IsStreamed() {
+		queued.done = make(chan struct{})
+	}
+
+	select {
+	case jar.c <- queued:
+	case <-jar.ctx.Done():
+		return jar.ctx.Err()
+	}
+
+	if queued.done != nil {
+		select {
+		case <-queued.done:
+		case <-jar.ctx.Done():
+			return jar.ctx.Err()
+		}
+	}
+	return nil
 }
 
 func (jar *Jar) Wait() error {
-	if err := jar.tasks.Wait(); err != nil {
-		return err
-	}
+	err := jar.tasks.Wait()
 	close(jar.c)
-	return jar.group.Wait()
+	if werr := jar.group.Wait(); err == nil {
+		err = werr
+	}
+	if err == nil && jar.options.Signer != nil {
+		err = SignJar(jar.path, jar.options.Signer)
+	}
+	return err
 }
 
 func ForJarMember(filename string, iter func(*JarMember) error) error {
+	return ForJarMemberWithOptions(context.Background(), filename, DefaultJarOptions, iter)
+}
+
+func ForJarMemberWithOptions(ctx context.Context, filename string, options JarOptions, iter func(*JarMember) error) error {
 	reader, err := zip.OpenReader(filename)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
+	return forZipMember(ctx, &reader.Reader, options, iter)
+}
+
+func forZipMember(ctx context.Context, reader *zip.Reader, options JarOptions, iter func(*JarMember) error) error {
+	errs, errCtx := errgroup.WithContext(ctx)
+	errs.SetLimit(options.workers())
 
-	errs, _ := errgroup.WithContext(context.Background())
 	for _, file := range reader.File {
+		if errCtx.Err() != nil {
+			break
+		}
+
 		errs.Go(func() error {
-			if file.FileInfo().IsDir() {
+			if file.FileInfo().IsDir() || errCtx.Err() != nil {
 				return nil
 			}
 
-			f, err := file.Open()
-			if err != nil {
-				return err
-			}
-
-			member := JarMember{file.Name, bytes.NewBuffer(), false}
-			if _, err = io.Copy(member.Buffer, f); err != nil {
-				return err
-			}
-			f.Close()
-
-			if err = iter(&member); err != nil {
-				return err
+			member := JarMember{Name: file.Name, file: file, stored: file.Method == zip.Store}
+			if strings.HasSuffix(file.Name, ".class") || file.UncompressedSize64 <= options.StreamThreshold {
+				if err := member.Load(); err != nil {
+					return err
+				}
 			}
-			return nil
+			return iter(&member)
 		})
 	}
-	return errs.Wait()
+
+	if err := errs.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
 }
 
 func CreateJar(filename string) (jar Jar) {
+	return CreateJarWithOptions(context.Background(), filename, DefaultJarOptions)
+}
+
+func CreateJarWithOptions(ctx context.Context, filename string, options JarOptions) (jar Jar) {
 	jar.Name = path.Base(filename)
-	jar.c = make(chan *JarMember)
-	jar.tasks, _ = errgroup.WithContext(context.Background())
-	jar.group, _ = errgroup.WithContext(context.Background())
+	jar.path = filename
+	jar.options = options
+	jar.c = make(chan queuedMember, options.workers())
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	jar.group = group
+	jar.tasks, jar.ctx = errgroup.WithContext(groupCtx)
 
 	jar.group.Go(func() error {
 		file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 		if err != nil {
 			return err
 		}
+		defer file.Close()
 		writer := zip.NewWriter(file)
 
-		for {
-			member, ok := <-jar.c
-			if !ok {
-				break
+		strip := options.StripSignatures || options.Signer != nil
+		for queued := range jar.c {
+			var skip bool
+			var err error
+			if strip {
+				skip, err = stripSignature(queued.member)
 			}
-
-			w, err := writer.CreateHeader(&zip.FileHeader{Name: member.Name, Method: zip.Deflate})
-			if err != nil {
-				return err
+			if !skip && err == nil {
+				err = writeMember(writer, queued.member)
+			}
+			if queued.done != nil {
+				close(queued.done)
 			}
-			_, err = w.Write(*member.Buffer.Data)
 			if err != nil {
 				return err
 			}
@@ -144,27 +327,62 @@ func CreateJar(filename string) (jar Jar) {
 	return jar
 }
 
+func writeMember(writer *zip.Writer, member *JarMember) error {
+	if member.IsStreamed() {
+		header := member.file.FileHeader
+		header.Name = member.Name
+
+		w, err := writer.CreateRaw(&header)
+		if err != nil {
+			return err
+		}
+		r, err := member.file.OpenRaw()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, r)
+		return err
+	}
+
+	method := zip.Deflate
+	if member.stored {
+		method = zip.Store
+	}
+	w, err := writer.CreateHeader(&zip.FileHeader{Name: member.Name, Method: method})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(*member.Buffer.Data)
+	return err
+}
+
 func ModifyJar(filename string, modifier func(*JarMember) error) error {
+	return ModifyJarWithOptions(context.Background(), filename, DefaultJarOptions, modifier)
+}
+
+func ModifyJarWithOptions(ctx context.Context, filename string, options JarOptions, modifier func(*JarMember) error) error {
 	if !fss.Exists(filename) {
 		return fmt.Errorf("%s does not exist", filename)
 	}
 
-	jar := CreateJar(filename + "-modified.zip")
+	output := filename + "-modified.zip"
+	jar := CreateJarWithOptions(ctx, output, options)
 	jar.Task(func(jar *Jar) error {
-		return ForJarMember(filename, func(member *JarMember) error {
+		return ForJarMemberWithOptions(jar.Context(), filename, jar.Options(), func(member *JarMember) error {
 			if err := modifier(member); err != nil {
 				return err
 			}
 
 			if !member.delete {
-				jar.Add(*member)
+				return jar.Add(*member)
 			}
 			return nil
 		})
 	})
 
-	if err := os.Rename(filename+"-modified.zip", filename); err != nil {
+	if err := jar.Wait(); err != nil {
+		os.Remove(output)
 		return err
 	}
-	return jar.Wait()
+	return os.Rename(output, filename)
 }
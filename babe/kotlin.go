@@ -0,0 +1,337 @@
+package babe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mrnavastar/assist/bytes"
+)
+
+var ErrInvalidKotlinMetadata = errors.New("jarhax: invalid kotlin metadata")
+
+const KotlinMetadataDescriptor = "Lkotlin/Metadata;"
+
+// Kinds of classes carrying Kotlin metadata, the k element of kotlin.Metadata
+const (
+	KotlinClass              = 1
+	KotlinFileFacade         = 2
+	KotlinSyntheticClass     = 3
+	KotlinMultiFileFacade    = 4
+	KotlinMultiFileClassPart = 5
+)
+
+// protoField is a field of an encoded protobuf message. Data is the payload of length delimited fields, and the
+// encoded value of the others.
+type protoField struct {
+	Number   uint64
+	WireType uint64
+	Data     []byte
+}
+
+func readProtoFields(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, ErrInvalidKotlinMetadata
+		}
+		data = data[n:]
+		field := protoField{Number: tag >> 3, WireType: tag & 7}
+		size := 0
+		switch field.WireType {
+		case 0:
+			if _, size = binary.Uvarint(data); size <= 0 {
+				return nil, ErrInvalidKotlinMetadata
+			}
+		case 1:
+			size = 8
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return nil, ErrInvalidKotlinMetadata
+			}
+			data, size = data[n:], int(length)
+		case 5:
+			size = 4
+		default:
+			return nil, fmt.Errorf("%w: wire type %d", ErrInvalidKotlinMetadata, field.WireType)
+		}
+		if size > len(data) {
+			return nil, ErrInvalidKotlinMetadata
+		}
+		field.Data, data = data[:size], data[size:]
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func appendProtoFields(data []byte, fields []protoField) []byte {
+	for _, field := range fields {
+		data = binary.AppendUvarint(data, field.Number<<3|field.WireType)
+		if field.WireType == 2 {
+			data = binary.AppendUvarint(data, uint64(len(field.Data)))
+		}
+		data = append(data, field.Data...)
+	}
+	return data
+}
+
+// mapProtoStrings maps the string fields with the given number.
+func mapProtoStrings(fields []protoField, number uint64, mapString func(string) string) bool {
+	changed := false
+	for i, field := range fields {
+		if field.Number == number && field.WireType == 2 {
+			if mapped := mapString(string(field.Data)); mapped != string(field.Data) {
+				fields[i].Data = []byte(mapped)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// mapNestedProtoStrings maps the string fields with the given number of the messages in the message fields, encoding
+// the messages again when their strings change.
+func mapNestedProtoStrings(fields []protoField, message uint64, number uint64, mapString func(string) string) (bool, error) {
+	changed := false
+	for i, field := range fields {
+		if field.Number != message || field.WireType != 2 {
+			continue
+		}
+		nested, err := readProtoFields(field.Data)
+		if err != nil {
+			return false, err
+		}
+		if mapProtoStrings(nested, number, mapString) {
+			fields[i].Data = appendProtoFields(nil, nested)
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// decodeKotlinData joins the d1 strings of Kotlin metadata into the protobuf messages they hold. The bytes are stored
+// as chars after a \u0000 marker, which class files encode in modified UTF-8. The 7 bit encoding of metadata
+// written by Kotlin before 1.1 isn't supported.
+func decodeKotlinData(strings []string) ([]byte, bool) {
+	var data []byte
+	for _, s := range strings {
+		for i := 0; i < len(s); i++ {
+			switch b := s[i]; {
+			case b < 0x80:
+				data = append(data, b)
+			case b&0xE0 == 0xC0 && i+1 < len(s) && s[i+1]&0xC0 == 0x80:
+				char := uint16(b&0x1F)<<6 | uint16(s[i+1]&0x3F)
+				if char > 0xFF {
+					return nil, false
+				}
+				data = append(data, byte(char))
+				i++
+			default:
+				return nil, false
+			}
+		}
+	}
+	if len(data) == 0 || data[0] != 0 {
+		return nil, false
+	}
+	return data[1:], true
+}
+
+// encodeKotlinData splits bytes into d1 strings the way decodeKotlinData reads them, each fitting a constant.
+func encodeKotlinData(data []byte) []any {
+	var strings []any
+	var s []byte
+	for _, b := range append([]byte{0}, data...) {
+		if len(s) > 65535-2 {
+			strings, s = append(strings, string(s)), nil
+		}
+		switch {
+		case b == 0:
+			s = append(s, 0xC0, 0x80)
+		case b < 0x80:
+			s = append(s, b)
+		default:
+			s = append(s, 0xC0|b>>6, 0x80|b&0x3F)
+		}
+	}
+	return append(strings, string(s))
+}
+
+// mapKotlinData maps the strings the string table of a class's metadata holds inline, which precedes the message
+// describing the class.
+func mapKotlinData(data []byte, mapName func(string) string) ([]byte, bool, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)-n) {
+		return nil, false, ErrInvalidKotlinMetadata
+	}
+	types, err := readProtoFields(data[n : n+int(length)])
+	if err != nil {
+		return nil, false, err
+	}
+	// StringTableTypes.record is field 1, and Record.string field 6
+	changed, err := mapNestedProtoStrings(types, 1, 6, mapName)
+	if err != nil || !changed {
+		return data, false, err
+	}
+	encoded := appendProtoFields(nil, types)
+	mapped := binary.AppendUvarint(nil, uint64(len(encoded)))
+	mapped = append(mapped, encoded...)
+	return append(mapped, data[n+int(length):]...), true, nil
+}
+
+// mapKotlinName maps a class name or descriptor held by Kotlin metadata. Class names are internal names, or class ids
+// naming nested classes with dots as in com/a/Outer.Inner, and descriptors are those of the JVM signatures of
+// members. Other strings, such as the names of members, are left alone unless a class has the same name.
+func mapKotlinName(remapper Remapper, name string) string {
+	if strings.HasPrefix(name, "(") || strings.HasPrefix(name, "[") || strings.HasPrefix(name, "L") && strings.HasSuffix(name, ";") {
+		return MapDescriptor(remapper, name)
+	}
+	// Class ids are written as the signatures of inner classes are
+	mapped := MapSignature(remapper, "L"+name+";")
+	return mapped[1 : len(mapped)-1]
+}
+
+// mapKotlinMetadata maps the class names and descriptors of a kotlin.Metadata annotation, see mapKotlinName, and the
+// package it names.
+func mapKotlinMetadata(metadata *Annotation, remapper Remapper) (bool, error) {
+	mapName := func(name string) string {
+		return mapKotlinName(remapper, name)
+	}
+	changed := false
+	mapStrings := func(element string, mapString func(string) string) {
+		values, _ := metadata.Get(element).([]any)
+		for i, value := range values {
+			if s, ok := value.(string); ok {
+				if mapped := mapString(s); mapped != s {
+					values[i] = mapped
+					changed = true
+				}
+			}
+		}
+	}
+	mapString := func(element string, mapString func(string) string) {
+		if s, ok := metadata.Get(element).(string); ok {
+			if mapped := mapString(s); mapped != s {
+				metadata.Set(element, mapped)
+				changed = true
+			}
+		}
+	}
+
+	mapStrings("d2", mapName)
+	mapString("xs", mapName)
+	mapString("pn", func(name string) string { return mapBinaryName(remapper, name) })
+	kind, ok := metadata.Get("k").(int32)
+	if !ok {
+		kind = KotlinClass
+	}
+	if kind == KotlinMultiFileFacade {
+		// The internal names of the parts
+		mapStrings("d1", mapName)
+		return changed, nil
+	}
+
+	values, _ := metadata.Get("d1").([]any)
+	strings := make([]string, len(values))
+	for i, value := range values {
+		strings[i], _ = value.(string)
+	}
+	data, ok := decodeKotlinData(strings)
+	if !ok {
+		return changed, nil
+	}
+	data, dataChanged, err := mapKotlinData(data, mapName)
+	if err != nil {
+		return changed, err
+	}
+	if dataChanged {
+		metadata.Set("d1", encodeKotlinData(data))
+		changed = true
+	}
+	return changed, nil
+}
+
+// mapKotlinClassMetadata maps the kotlin.Metadata annotation of a class, see mapKotlinMetadata. The annotation is
+// read from original, the class before it was relocated, so names are mapped only once.
+func mapKotlinClassMetadata(class *Class, original []*Annotation, remapper Remapper) (bool, error) {
+	annotations := class.GetAnnotations()
+	for i, annotation := range original {
+		if annotation.Descriptor != KotlinMetadataDescriptor || i >= len(annotations) {
+			continue
+		}
+		if _, err := mapKotlinMetadata(annotation, remapper); err != nil {
+			return false, fmt.Errorf("%w: %s", err, class.GetClassName())
+		}
+		annotation.Descriptor = annotations[i].Descriptor
+		if !equalAnnotations(annotation, annotations[i]) {
+			annotations[i] = annotation
+			class.SetAnnotations(annotations)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// equalAnnotations compares annotations by their encoding.
+func equalAnnotations(a *Annotation, b *Annotation) bool {
+	class := &Class{}
+	encode := func(annotation *Annotation) string {
+		data := []byte{}
+		class.writeAnnotation(&bytes.Buffer{Data: &data, Index: 0}, annotation)
+		return string(data)
+	}
+	return a.Visible == b.Visible && encode(a) == encode(b)
+}
+
+// IsKotlinModule reports whether a jar member is the module metadata of a Kotlin library, which lists the file
+// facades of its packages.
+func IsKotlinModule(name string) bool {
+	_, name = SplitVersionedName(name)
+	return strings.HasPrefix(name, "META-INF/") && strings.HasSuffix(name, ".kotlin_module")
+}
+
+// mapKotlinModule maps the packages a .kotlin_module file lists. It starts with the metadata version, as a count
+// followed by that many ints, then flags from Kotlin 1.4 on, then the Module message.
+func mapKotlinModule(data []byte, mapPackage func(string) string) ([]byte, bool, error) {
+	if len(data) < 4 {
+		return nil, false, ErrInvalidKotlinMetadata
+	}
+	count := int(binary.BigEndian.Uint32(data))
+	if count < 0 || count > (len(data)-4)/4 {
+		return nil, false, ErrInvalidKotlinMetadata
+	}
+	version := make([]int, count)
+	for i := range version {
+		version[i] = int(binary.BigEndian.Uint32(data[4+4*i:]))
+	}
+	header := 4 + 4*count
+	if len(version) >= 2 && (version[0] > 1 || version[0] == 1 && version[1] >= 4) {
+		header += 4
+	}
+	if header > len(data) {
+		return nil, false, ErrInvalidKotlinMetadata
+	}
+	module, err := readProtoFields(data[header:])
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := false
+	// package_parts and metadata_parts start with package_fq_name, and jvm_package_name lists the packages of
+	// classes moved with @JvmPackageName
+	for _, message := range []uint64{1, 2} {
+		partsChanged, err := mapNestedProtoStrings(module, message, 1, mapPackage)
+		if err != nil {
+			return nil, false, err
+		}
+		changed = partsChanged || changed
+	}
+	changed = mapProtoStrings(module, 3, mapPackage) || changed
+	if !changed {
+		return data, false, nil
+	}
+	return appendProtoFields(append([]byte{}, data[:header]...), module), true, nil
+}
@@ -0,0 +1,282 @@
+package babe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func protoString(number uint64, s string) protoField {
+	return protoField{Number: number, WireType: 2, Data: []byte(s)}
+}
+
+func protoMessage(number uint64, fields ...protoField) protoField {
+	return protoField{Number: number, WireType: 2, Data: appendProtoFields(nil, fields)}
+}
+
+func protoVarint(number uint64, value uint64) protoField {
+	return protoField{Number: number, WireType: 0, Data: binary.AppendUvarint(nil, value)}
+}
+
+func TestProtoFieldsRoundTrip(t *testing.T) {
+	tests := map[string][]protoField{
+		"empty":               nil,
+		"varints":             {protoVarint(1, 0), protoVarint(2, 300), protoVarint(3, 1<<63)},
+		"fixed":               {{Number: 1, WireType: 1, Data: []byte{1, 2, 3, 4, 5, 6, 7, 8}}, {Number: 2, WireType: 5, Data: []byte{1, 2, 3, 4}}},
+		"strings":             {protoString(1, ""), protoString(2, "kotlin/Unit"), protoString(1, strings.Repeat("x", 200))},
+		"nested":              {protoMessage(1, protoString(1, "com.a"), protoString(2, "FooKt")), protoMessage(20, protoVarint(1, 7))},
+		"large field numbers": {protoString(1000, "a"), protoVarint(536870911, 1)},
+	}
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := appendProtoFields(nil, fields)
+			read, err := readProtoFields(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(read) != len(fields) {
+				t.Fatalf("read %d fields, want %d", len(read), len(fields))
+			}
+			for i := range fields {
+				if read[i].Number != fields[i].Number || read[i].WireType != fields[i].WireType || !bytes.Equal(read[i].Data, fields[i].Data) {
+					t.Errorf("field %d = %+v, want %+v", i, read[i], fields[i])
+				}
+			}
+			if encoded := appendProtoFields(nil, read); !bytes.Equal(encoded, data) {
+				t.Errorf("encoded again as %x, want %x", encoded, data)
+			}
+		})
+	}
+}
+
+func TestReadProtoFieldsInvalid(t *testing.T) {
+	tests := map[string][]byte{
+		"truncated tag":     {0x80},
+		"truncated varint":  {0x08, 0x80},
+		"missing varint":    {0x08},
+		"truncated fixed64": {0x09, 1, 2, 3},
+		"truncated fixed32": {0x0D, 1},
+		"length past end":   {0x0A, 5, 'a'},
+		"group wire type":   {0x0B},
+	}
+	for name, data := range tests {
+		if _, err := readProtoFields(data); !errors.Is(err, ErrInvalidKotlinMetadata) {
+			t.Errorf("%s: readProtoFields error = %v, want ErrInvalidKotlinMetadata", name, err)
+		}
+	}
+}
+
+func kotlinStrings(values []any) []string {
+	strings := make([]string, len(values))
+	for i, value := range values {
+		strings[i] = value.(string)
+	}
+	return strings
+}
+
+func TestKotlinDataRoundTrip(t *testing.T) {
+	every := make([]byte, 256)
+	for i := range every {
+		every[i] = byte(i)
+	}
+	tests := map[string][]byte{
+		"empty":            {},
+		"ascii":            []byte("kotlin/Metadata"),
+		"zero bytes":       {0, 0, 1, 0},
+		"every byte":       every,
+		"several strings":  bytes.Repeat([]byte{0x7F, 0x80, 0}, 40000),
+		"ascii over limit": bytes.Repeat([]byte("a"), 70000),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			encoded := kotlinStrings(encodeKotlinData(data))
+			for _, s := range encoded {
+				if len(s) > 65535 {
+					t.Errorf("string of %d bytes doesn't fit a constant", len(s))
+				}
+			}
+			if !strings.HasPrefix(encoded[0], "\xC0\x80") {
+				t.Errorf("first string starts with %q, want the encoded zero marker", encoded[0][:2])
+			}
+			decoded, ok := decodeKotlinData(encoded)
+			if !ok {
+				t.Fatal("decodeKotlinData failed")
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Errorf("decoded %x, want %x", decoded, data)
+			}
+			if again := kotlinStrings(encodeKotlinData(decoded)); !slices.Equal(again, encoded) {
+				t.Error("encoding the decoded data gives other strings")
+			}
+		})
+	}
+}
+
+func TestDecodeKotlinDataInvalid(t *testing.T) {
+	tests := map[string][]string{
+		"no strings":         nil,
+		"no marker":          {"\x01\x02"},
+		"char over a byte":   {"\xC0\x80\xC4\x80"},
+		"three byte char":    {"\xC0\x80\xE0\x80\x80"},
+		"truncated char":     {"\xC0\x80\xC2"},
+		"continuation first": {"\xC0\x80\x80"},
+	}
+	for name, strings := range tests {
+		if _, ok := decodeKotlinData(strings); ok {
+			t.Errorf("%s: decodeKotlinData succeeded", name)
+		}
+	}
+}
+
+// kotlinModule encodes a .kotlin_module file of a metadata version, with the flags written from Kotlin 1.4 on.
+func kotlinModule(version []int, fields ...protoField) []byte {
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(version)))
+	for _, v := range version {
+		data = binary.BigEndian.AppendUint32(data, uint32(v))
+	}
+	if version[0] > 1 || version[1] >= 4 {
+		data = binary.BigEndian.AppendUint32(data, 0)
+	}
+	return appendProtoFields(data, fields)
+}
+
+func kotlinModuleParts(packages ...string) []protoField {
+	return []protoField{
+		protoMessage(1, protoString(1, packages[0]), protoString(2, "FooKt"), protoString(2, "BarKt")),
+		protoMessage(1, protoString(1, packages[1]), protoString(2, "BazKt")),
+		protoMessage(2, protoString(1, packages[2])),
+		protoString(3, packages[3]),
+		protoMessage(4, protoString(1, "com.a.Annotation")),
+	}
+}
+
+func TestMapKotlinModule(t *testing.T) {
+	relocator := &Relocator{Relocations: ParseRelocation("com.a:shaded.com.a")}
+	original := kotlinModuleParts("com.a", "com.abc", "com.a.b", "org.com.a")
+	relocated := kotlinModuleParts("shaded.com.a", "com.abc", "shaded.com.a.b", "org.com.a")
+	tests := []struct {
+		name    string
+		version []int
+	}{
+		{"1.9 with flags", []int{1, 9, 0}},
+		{"1.3 without flags", []int{1, 3, 0}},
+		{"2.0", []int{2, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := kotlinModule(test.version, original...)
+			mapped, changed, err := mapKotlinModule(data, func(name string) string {
+				return mapOSGiPackage(name, relocator.relocate)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := kotlinModule(test.version, relocated...); !changed || !bytes.Equal(mapped, want) {
+				t.Errorf("mapKotlinModule = %x, %v, want %x", mapped, changed, want)
+			}
+
+			unchanged, changed, err := mapKotlinModule(data, func(name string) string { return name })
+			if err != nil || changed || !bytes.Equal(unchanged, data) {
+				t.Errorf("mapKotlinModule without relocations = %x, %v, %v", unchanged, changed, err)
+			}
+		})
+	}
+}
+
+func TestMapKotlinModuleInvalid(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":            {},
+		"version too long": {0, 0, 0, 9, 0, 0, 0, 1},
+		"missing flags":    {0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 9},
+		"truncated module": append(kotlinModule([]int{1, 9, 0}), 0x0A, 9),
+	}
+	for name, data := range tests {
+		if _, _, err := mapKotlinModule(data, func(name string) string { return name }); !errors.Is(err, ErrInvalidKotlinMetadata) {
+			t.Errorf("%s: mapKotlinModule error = %v, want ErrInvalidKotlinMetadata", name, err)
+		}
+	}
+}
+
+func TestRelocateKotlinModule(t *testing.T) {
+	relocator := &Relocator{Relocations: ParseRelocation("com.a:shaded.com.a")}
+	member := JarMemberFromString("META-INF/main.kotlin_module", string(kotlinModule([]int{1, 9, 0}, kotlinModuleParts("com.a", "com.abc", "com.a.b", "org.com.a")...)))
+	if err := relocator.TransformResource(&member); err != nil {
+		t.Fatal(err)
+	}
+	if member.Name != "META-INF/main.kotlin_module" {
+		t.Errorf("module file moved to %s", member.Name)
+	}
+	if want := kotlinModule([]int{1, 9, 0}, kotlinModuleParts("shaded.com.a", "com.abc", "shaded.com.a.b", "org.com.a")...); !bytes.Equal(*member.Buffer.Data, want) {
+		t.Errorf("relocated module = %x, want %x", *member.Buffer.Data, want)
+	}
+}
+
+// kotlinClassData encodes the d1 data of a class: its string table, with strings inline, and the class message.
+func kotlinClassData(strings ...string) []byte {
+	var records []protoField
+	for _, s := range strings {
+		records = append(records, protoMessage(1, protoVarint(1, 1), protoString(6, s)))
+	}
+	table := appendProtoFields(nil, records)
+	data := binary.AppendUvarint(nil, uint64(len(table)))
+	data = append(data, table...)
+	return appendProtoFields(data, []protoField{protoVarint(1, 6), protoVarint(3, 1)})
+}
+
+func TestRelocateKotlinMetadata(t *testing.T) {
+	d2 := func(prefix string) []any {
+		return []any{prefix + "com/a/Foo", "(L" + prefix + "com/a/Foo;Lcom/abc/Bar;)V", "L" + prefix + "com/a/Foo$Inner;", prefix + "com/a/Foo.Inner", "com/abc/Bar", "getValue", "<init>", "I"}
+	}
+	tests := []struct {
+		name     string
+		elements func(prefix string) []AnnotationElement
+	}{
+		{"class", func(prefix string) []AnnotationElement {
+			return []AnnotationElement{
+				{"mv", []any{int32(1), int32(9), int32(0)}},
+				{"k", int32(KotlinClass)},
+				{"d1", encodeKotlinData(kotlinClassData(prefix+"com/a/Foo", "com/abc/Bar", "(L"+prefix+"com/a/Foo;)V"))},
+				{"d2", d2(prefix)},
+				{"pn", strings.ReplaceAll(prefix, "/", ".") + "com.a"},
+			}
+		}},
+		{"multi-file facade", func(prefix string) []AnnotationElement {
+			return []AnnotationElement{
+				{"k", int32(KotlinMultiFileFacade)},
+				{"d1", []any{prefix + "com/a/Foo__PartKt", "com/abc/Bar__PartKt"}},
+				{"d2", d2(prefix)},
+				{"xs", prefix + "com/a/FooKt"},
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class, err := NewClassBuilder("com/a/Foo").Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			class.SetAnnotations([]*Annotation{{Descriptor: KotlinMetadataDescriptor, Visible: true, Elements: test.elements("")}})
+			read := &Class{}
+			if err := read.Read(classBytes(class)); err != nil {
+				t.Fatal(err)
+			}
+
+			member := JarMember{Name: "com/a/Foo.class"}
+			relocator := &Relocator{Relocations: ParseRelocation("com.a:shaded.com.a")}
+			if _, err := relocator.TransformClass(&member, read); err != nil {
+				t.Fatal(err)
+			}
+			if member.Name != "shaded/com/a/Foo.class" {
+				t.Errorf("class file = %s", member.Name)
+			}
+			annotations := read.GetAnnotations()
+			want := &Annotation{Descriptor: KotlinMetadataDescriptor, Visible: true, Elements: test.elements("shaded/")}
+			if len(annotations) != 1 || !equalAnnotations(annotations[0], want) {
+				t.Errorf("relocated metadata = %+v, want %+v", annotations[0], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package babe
+
+import (
+	"archive/zip"
+	stdbytes "bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	fss "github.com/mrnavastar/assist/fs"
+)
+
+const ManifestName = "META-INF/MANIFEST.MF"
+
+var ErrInvalidManifest = errors.New("jarhax: invalid manifest")
+var ErrNoManifest = errors.New("jarhax: jar has no manifest")
+
+// Manifest attributes naming classes, which are relocated and remapped along with the classes.
+var ManifestClassAttributes = []string{
+	"Main-Class", "Premain-Class", "Agent-Class", "Launcher-Agent-Class", "Start-Class", "Bundle-Activator",
+}
+
+type ManifestAttribute struct {
+	Name  string
+	Value string
+}
+
+// ManifestAttributes is an ordered list of manifest attributes. Names are matched ignoring case.
+type ManifestAttributes []ManifestAttribute
+
+func (attributes ManifestAttributes) index(name string) int {
+	for i, attribute := range attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the value of an attribute, or an empty string.
+func (attributes ManifestAttributes) Get(name string) string {
+	if i := attributes.index(name); i >= 0 {
+		return attributes[i].Value
+	}
+	return ""
+}
+
+func (attributes ManifestAttributes) Has(name string) bool {
+	return attributes.index(name) >= 0
+}
+
+// Set replaces the value of an attribute, appending it if it is missing.
+func (attributes *ManifestAttributes) Set(name string, value string) {
+	if i := attributes.index(name); i >= 0 {
+		(*attributes)[i].Value = value
+		return
+	}
+	*attributes = append(*attributes, ManifestAttribute{name, value})
+}
+
+func (attributes *ManifestAttributes) Remove(name string) bool {
+	i := attributes.index(name)
+	if i >= 0 {
+		*attributes = append((*attributes)[:i], (*attributes)[i+1:]...)
+	}
+	return i >= 0
+}
+
+// ManifestSection holds the attributes of a single jar entry, named by its Name attribute.
+type ManifestSection struct {
+	Name       string
+	Attributes ManifestAttributes
+}
+
+type Manifest struct {
+	Main     ManifestAttributes
+	Sections []*ManifestSection
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{Main: ManifestAttributes{{"Manifest-Version", "1.0"}}}
+}
+
+// Section returns the section of an entry, or nil.
+func (manifest *Manifest) Section(name string) *ManifestSection {
+	for _, section := range manifest.Sections {
+		if section.Name == name {
+			return section
+		}
+	}
+	return nil
+}
+
+// AddSection returns the section of an entry, appending a new one if it is missing.
+func (manifest *Manifest) AddSection(name string) *ManifestSection {
+	if section := manifest.Section(name); section != nil {
+		return section
+	}
+	section := &ManifestSection{Name: name}
+	manifest.Sections = append(manifest.Sections, section)
+	return section
+}
+
+func (manifest *Manifest) RemoveSection(name string) bool {
+	for i, section := range manifest.Sections {
+		if section.Name == name {
+			manifest.Sections = append(manifest.Sections[:i], manifest.Sections[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ReadManifest parses a manifest, joining continuation lines. Lines may end in CRLF, LF or CR.
+func ReadManifest(data []byte) (*Manifest, error) {
+	manifest := &Manifest{}
+	var section *ManifestSection
+	attributes := &manifest.Main
+	lines := strings.Split(strings.ReplaceAll(strings.ReplaceAll(string(data), "\r\n", "\n"), "\r", "\n"), "\n")
+
+	for number := 0; number < len(lines); number++ {
+		line := lines[number]
+		if line == "" {
+			// Sections are separated by blank lines
+			section, attributes = nil, nil
+			continue
+		}
+		for number+1 < len(lines) && strings.HasPrefix(lines[number+1], " ") {
+			number++
+			line += lines[number][1:]
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.Contains(name, " ") {
+			return nil, fmt.Errorf("%w: line %d: %q", ErrInvalidManifest, number+1, line)
+		}
+		value = strings.TrimPrefix(value, " ")
+
+		if attributes == nil {
+			if !strings.EqualFold(name, "Name") {
+				return nil, fmt.Errorf("%w: line %d: section without a name", ErrInvalidManifest, number+1)
+			}
+			section = &ManifestSection{Name: value}
+			manifest.Sections = append(manifest.Sections, section)
+			attributes = &section.Attributes
+			continue
+		}
+		*attributes = append(*attributes, ManifestAttribute{name, value})
+	}
+	return manifest, nil
+}
+
+// Bytes serialises the manifest with CRLF line endings, wrapping lines at 72 bytes without splitting characters.
+func (manifest *Manifest) Bytes() []byte {
+	var out stdbytes.Buffer
+	for _, attribute := range manifest.Main {
+		writeManifestLine(&out, attribute.Name+": "+attribute.Value)
+	}
+	out.WriteString("\r\n")
+	for _, section := range manifest.Sections {
+		writeManifestLine(&out, "Name: "+section.Name)
+		for _, attribute := range section.Attributes {
+			writeManifestLine(&out, attribute.Name+": "+attribute.Value)
+		}
+		out.WriteString("\r\n")
+	}
+	return out.Bytes()
+}
+
+func writeManifestLine(out *stdbytes.Buffer, line string) {
+	// Continuation lines start with a space, leaving room for 71 bytes of the line
+	limit := 72
+	for len(line) > limit {
+		end := limit
+		for end > 0 && !utf8.RuneStart(line[end]) {
+			end--
+		}
+		out.WriteString(line[:end])
+		out.WriteString("\r\n ")
+		line, limit = line[end:], 71
+	}
+	out.WriteString(line)
+	out.WriteString("\r\n")
+}
+
+// ReadJarManifest reads the manifest of a jar, returning ErrNoManifest if it has none.
+func ReadJarManifest(filename string) (*Manifest, error) {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	file, err := reader.Open(ManifestName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoManifest
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return ReadManifest(data)
+}
+
+// EditJarManifest changes the manifest of a jar, creating one if it has none.
+func EditJarManifest(filename string, edit func(manifest *Manifest) error) error {
+	if !fss.Exists(filename) {
+		return fmt.Errorf("%s does not exist", filename)
+	}
+	manifest, err := ReadJarManifest(filename)
+	if errors.Is(err, ErrNoManifest) {
+		manifest, err = NewManifest(), nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := edit(manifest); err != nil {
+		return err
+	}
+
+	output := filename + "-modified.zip"
+	jar := CreateJar(output)
+	jar.Task(func(jar *Jar) error {
+		// The manifest is written first, where jar readers expect it
+		if err := jar.Add(JarMemberFromString(ManifestName, string(manifest.Bytes()))); err != nil {
+			return err
+		}
+		return ForJarMemberWithOptions(jar.Context(), filename, jar.Options(), func(member *JarMember) error {
+			if member.Name == ManifestName {
+				return nil
+			}
+			return jar.Add(*member)
+		})
+	})
+
+	if err := jar.Wait(); err != nil {
+		os.Remove(output)
+		return err
+	}
+	return os.Rename(output, filename)
+}
+
+// editManifestMember edits a member if it is the manifest, leaving it untouched when edit reports no change.
+func editManifestMember(member *JarMember, edit func(manifest *Manifest) bool) error {
+	if member.Name != ManifestName {
+		return nil
+	}
+	if err := member.Load(); err != nil {
+		return err
+	}
+	manifest, err := ReadManifest(*member.Buffer.Data)
+	if err != nil {
+		return err
+	}
+	if edit(manifest) {
+		*member.Buffer.Data = manifest.Bytes()
+	}
+	return nil
+}
+
+// mapManifestClasses maps the classes named by the attributes of a manifest.
+func mapManifestClasses(manifest *Manifest, mapClass func(name string) string) bool {
+	changed := false
+	for _, name := range ManifestClassAttributes {
+		if value := manifest.Main.Get(name); value != "" {
+			if mapped := strings.ReplaceAll(mapClass(strings.ReplaceAll(value, ".", "/")), "/", "."); mapped != value {
+				manifest.Main.Set(name, mapped)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// remapManifestClasses maps the classes named by the attributes of a manifest, leaving it untouched when none change.
+func remapManifestClasses(member *JarMember, mapClass func(name string) string) error {
+	return editManifestMember(member, func(manifest *Manifest) bool {
+		return mapManifestClasses(manifest, mapClass)
+	})
+}
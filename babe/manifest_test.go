@@ -0,0 +1,130 @@
+package babe
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestReadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		manifest *Manifest
+	}{
+		{"crlf", "Manifest-Version: 1.0\r\nMain-Class: a.Main\r\n\r\n", &Manifest{
+			Main: ManifestAttributes{{"Manifest-Version", "1.0"}, {"Main-Class", "a.Main"}},
+		}},
+		{"lf without trailing newline", "Manifest-Version: 1.0\nMain-Class: a.Main", &Manifest{
+			Main: ManifestAttributes{{"Manifest-Version", "1.0"}, {"Main-Class", "a.Main"}},
+		}},
+		{"cr", "Manifest-Version: 1.0\rMain-Class: a.Main\r", &Manifest{
+			Main: ManifestAttributes{{"Manifest-Version", "1.0"}, {"Main-Class", "a.Main"}},
+		}},
+		{"continuation", "Manifest-Version: 1.0\r\nClass-Path: a.jar \r\n b.jar\r\n  c.jar\r\n", &Manifest{
+			Main: ManifestAttributes{{"Manifest-Version", "1.0"}, {"Class-Path", "a.jar b.jar c.jar"}},
+		}},
+		{"empty value", "Manifest-Version: 1.0\r\nEmpty:\r\n", &Manifest{
+			Main: ManifestAttributes{{"Manifest-Version", "1.0"}, {"Empty", ""}},
+		}},
+		{"sections", "Manifest-Version: 1.0\r\n\r\nName: a/A.class\r\nSHA-256-Digest: x\r\n\r\n\r\nname: a/B.class\r\nSealed: true\r\n", &Manifest{
+			Main: ManifestAttributes{{"Manifest-Version", "1.0"}},
+			Sections: []*ManifestSection{
+				{"a/A.class", ManifestAttributes{{"SHA-256-Digest", "x"}}},
+				{"a/B.class", ManifestAttributes{{"Sealed", "true"}}},
+			},
+		}},
+		{"empty", "", &Manifest{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest, err := ReadManifest([]byte(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(manifest, test.manifest) {
+				t.Errorf("ReadManifest = %+v, want %+v", manifest, test.manifest)
+			}
+		})
+	}
+}
+
+func TestReadManifestErrors(t *testing.T) {
+	for _, data := range []string{
+		"Manifest-Version 1.0\r\n",
+		": value\r\n",
+		"Bad Name: value\r\n",
+		"Manifest-Version: 1.0\r\n\r\nSealed: true\r\n",
+	} {
+		if _, err := ReadManifest([]byte(data)); !errors.Is(err, ErrInvalidManifest) {
+			t.Errorf("ReadManifest(%q) error = %v, want ErrInvalidManifest", data, err)
+		}
+	}
+}
+
+func TestManifestBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"short", "a.Main"},
+		{"exactly one line", strings.Repeat("a", 72-len("Class-Path: "))},
+		{"one byte over", strings.Repeat("a", 73-len("Class-Path: "))},
+		{"long", strings.Repeat("lib/dependency.jar ", 20)},
+		{"multibyte", strings.Repeat("é", 40) + strings.Repeat("日本", 30)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest := NewManifest()
+			manifest.Main.Set("Class-Path", test.value)
+			manifest.AddSection("a/A.class").Attributes.Set("Value", test.value)
+			data := manifest.Bytes()
+
+			lines := strings.Split(strings.TrimSuffix(string(data), "\r\n"), "\r\n")
+			for _, line := range lines {
+				if len(line) > 72 {
+					t.Errorf("line of %d bytes: %q", len(line), line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line splits a character: %q", line)
+				}
+			}
+			if !strings.HasSuffix(string(data), "\r\n\r\n") {
+				t.Errorf("manifest doesn't end with a blank line: %q", data)
+			}
+
+			read, err := ReadManifest(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(read, manifest) {
+				t.Errorf("ReadManifest(Bytes()) = %+v, want %+v", read, manifest)
+			}
+		})
+	}
+}
+
+func TestManifestAttributes(t *testing.T) {
+	manifest := NewManifest()
+	manifest.Main.Set("Main-Class", "a.Main")
+	manifest.Main.Set("main-class", "b.Main")
+	if value := manifest.Main.Get("MAIN-CLASS"); value != "b.Main" {
+		t.Errorf("Get = %q, want b.Main", value)
+	}
+	if len(manifest.Main) != 2 {
+		t.Errorf("Set appended a duplicate: %v", manifest.Main)
+	}
+	if !manifest.Main.Remove("Main-Class") || manifest.Main.Has("Main-Class") || manifest.Main.Remove("Main-Class") {
+		t.Errorf("Remove left %v", manifest.Main)
+	}
+
+	manifest.AddSection("a")
+	if manifest.AddSection("a") != manifest.Section("a") || len(manifest.Sections) != 1 {
+		t.Errorf("AddSection added a duplicate")
+	}
+	if !manifest.RemoveSection("a") || manifest.Section("a") != nil || manifest.RemoveSection("a") {
+		t.Errorf("RemoveSection left %v", manifest.Sections)
+	}
+}
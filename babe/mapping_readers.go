@@ -0,0 +1,392 @@
+package babe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mappingLines calls iter with every line of a mapping file along with its indentation depth in tabs, skipping blank
+// lines and # comments.
+func mappingLines(reader io.Reader, iter func(number int, depth int, line string) error) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		trimmed := strings.TrimLeft(line, "\t")
+		if content := strings.TrimSpace(trimmed); content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if err := iter(number, len(line)-len(trimmed), trimmed); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func invalidMappings(number int, line string) error {
+	return fmt.Errorf("%w: line %d: %q", ErrInvalidMappings, number, line)
+}
+
+func readTinyV1(reader io.Reader) (*Mappings, error) {
+	var mappings *Mappings
+	err := mappingLines(reader, func(number int, depth int, line string) error {
+		parts := strings.Split(line, "\t")
+		if mappings == nil {
+			mappings = NewMappings(parts[1:]...)
+			return nil
+		}
+
+		switch {
+		case parts[0] == "CLASS" && len(parts) >= 2:
+			class := mappings.Class(parts[1])
+			mappings.setNames(&class.Names, parts[1:])
+		case (parts[0] == "FIELD" || parts[0] == "METHOD") && len(parts) >= 4:
+			class := mappings.Class(parts[1])
+			var member *MemberMapping
+			if parts[0] == "METHOD" {
+				member = class.Method(parts[3], parts[2])
+			} else {
+				member = class.Field(parts[3], parts[2])
+			}
+			mappings.setNames(&member.Names, parts[3:])
+		default:
+			return invalidMappings(number, line)
+		}
+		return nil
+	})
+	return mappings, err
+}
+
+var tinyUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r", `\t`, "\t", `\0`, "\x00")
+
+func readTinyV2(reader io.Reader) (*Mappings, error) {
+	var mappings *Mappings
+	var class *ClassMapping
+	var member *MemberMapping
+	escaped := false
+
+	err := mappingLines(reader, func(number int, depth int, line string) error {
+		parts := strings.Split(line, "\t")
+		if mappings == nil {
+			if len(parts) < 5 {
+				return invalidMappings(number, line)
+			}
+			mappings = NewMappings(parts[3:]...)
+			return nil
+		}
+		if escaped {
+			for i := range parts {
+				parts[i] = tinyUnescaper.Replace(parts[i])
+			}
+		}
+
+		switch {
+		case depth == 0 && parts[0] == "c" && len(parts) >= 2:
+			class = mappings.Class(parts[1])
+			mappings.setNames(&class.Names, parts[1:])
+			member = nil
+		case depth == 1 && class == nil:
+			// Header properties
+			escaped = escaped || parts[0] == "escaped-names"
+		case depth == 1 && (parts[0] == "f" || parts[0] == "m") && len(parts) >= 3:
+			if parts[0] == "m" {
+				member = class.Method(parts[2], parts[1])
+			} else {
+				member = class.Field(parts[2], parts[1])
+			}
+			mappings.setNames(&member.Names, parts[2:])
+		case depth == 2 && member != nil && (parts[0] == "p" && len(parts) >= 2 || parts[0] == "v" && len(parts) >= 4):
+			index, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return invalidMappings(number, line)
+			}
+			names := parts[2:]
+			if parts[0] == "v" {
+				names = parts[4:]
+			}
+			if member.Locals == nil {
+				member.Locals = map[int][]string{}
+			}
+			member.Locals[index] = names
+		case parts[0] == "c":
+			// Comment
+		case depth == 0:
+			return invalidMappings(number, line)
+		}
+		return nil
+	})
+	return mappings, err
+}
+
+// splitOwner splits an SRG member reference such as "net/minecraft/Foo/field_1" into the owner and member name.
+func splitOwner(reference string) (string, string) {
+	i := strings.LastIndexByte(reference, '/')
+	return reference[:max(i, 0)], reference[i+1:]
+}
+
+func readSrg(reader io.Reader) (*Mappings, error) {
+	mappings := NewMappings("obf", "srg")
+	err := mappingLines(reader, func(number int, depth int, line string) error {
+		parts := strings.Fields(line)
+		switch {
+		case parts[0] == "PK:":
+		case parts[0] == "CL:" && len(parts) == 3:
+			mappings.setNames(&mappings.Class(parts[1]).Names, parts[1:])
+		case parts[0] == "FD:" && len(parts) >= 3:
+			owner, name := splitOwner(parts[1])
+			_, mapped := splitOwner(parts[2])
+			if len(parts) == 5 {
+				// The extended form with descriptors
+				_, mapped = splitOwner(parts[3])
+				mappings.setNames(&mappings.Class(owner).Field(name, parts[2]).Names, []string{name, mapped})
+			} else {
+				mappings.setNames(&mappings.Class(owner).Field(name, "").Names, []string{name, mapped})
+			}
+		case parts[0] == "MD:" && len(parts) == 5:
+			owner, name := splitOwner(parts[1])
+			_, mapped := splitOwner(parts[3])
+			mappings.setNames(&mappings.Class(owner).Method(name, parts[2]).Names, []string{name, mapped})
+		default:
+			return invalidMappings(number, line)
+		}
+		return nil
+	})
+	return mappings, err
+}
+
+// readTsrg reads TSRG and TSRG2 mappings. TSRG has no header and two namespaces.
+func readTsrg(reader io.Reader) (*Mappings, error) {
+	var mappings *Mappings
+	var class *ClassMapping
+	var member *MemberMapping
+
+	err := mappingLines(reader, func(number int, depth int, line string) error {
+		parts := strings.Fields(line)
+		if mappings == nil {
+			if parts[0] == "tsrg2" {
+				mappings = NewMappings(parts[1:]...)
+				return nil
+			}
+			mappings = NewMappings("obf", "srg")
+		}
+		namespaces := len(mappings.Namespaces)
+
+		switch {
+		case depth == 0 && strings.HasSuffix(parts[0], "/"):
+			// A package, which like SRG's PK lines has nothing to map on its own
+			class, member = nil, nil
+		case depth == 0 && len(parts) == namespaces:
+			class = mappings.Class(parts[0])
+			mappings.setNames(&class.Names, parts)
+			member = nil
+		case depth == 1 && class != nil && len(parts) == namespaces:
+			member = class.Field(parts[0], "")
+			mappings.setNames(&member.Names, parts)
+		case depth == 1 && class != nil && len(parts) == namespaces+1:
+			if strings.HasPrefix(parts[1], "(") {
+				member = class.Method(parts[0], parts[1])
+			} else {
+				member = class.Field(parts[0], parts[1])
+			}
+			mappings.setNames(&member.Names, append([]string{parts[0]}, parts[2:]...))
+		case depth == 2 && member != nil && parts[0] == "static":
+		case depth == 2 && member != nil && len(parts) == namespaces+1:
+			index, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return invalidMappings(number, line)
+			}
+			if member.Locals == nil {
+				member.Locals = map[int][]string{}
+			}
+			member.Locals[index] = parts[1:]
+		default:
+			return invalidMappings(number, line)
+		}
+		return nil
+	})
+	return mappings, err
+}
+
+// javaTypeDescriptor converts a Java source type such as "java.lang.String[]" to a descriptor.
+func javaTypeDescriptor(typ string) string {
+	return JavaType(typ).String()
+}
+
+// readProguard reads a ProGuard or R8 mapping, whose first namespace holds the original names.
+func readProguard(reader io.Reader) (*Mappings, error) {
+	mappings := NewMappings("named", "obf")
+	var class *ClassMapping
+
+	err := mappingLines(reader, func(number int, depth int, line string) error {
+		trimmed := strings.TrimSpace(line)
+		source, target, ok := strings.Cut(trimmed, " -> ")
+		if !ok {
+			return invalidMappings(number, line)
+		}
+
+		if !strings.HasPrefix(line, " ") {
+			target, ok = strings.CutSuffix(target, ":")
+			if !ok {
+				return invalidMappings(number, line)
+			}
+			class = mappings.Class(strings.ReplaceAll(source, ".", "/"))
+			mappings.setNames(&class.Names, []string{class.Names[0], strings.ReplaceAll(target, ".", "/")})
+			return nil
+		}
+		if class == nil {
+			return invalidMappings(number, line)
+		}
+
+		// Strip the line number range of methods
+		for i := 0; i < 2; i++ {
+			if prefix, rest, ok := strings.Cut(source, ":"); ok && strings.Trim(prefix, "0123456789") == "" {
+				source = rest
+			}
+		}
+		typ, member, ok := strings.Cut(source, " ")
+		if !ok {
+			return invalidMappings(number, line)
+		}
+
+		open := strings.IndexByte(member, '(')
+		if open < 0 {
+			mappings.setNames(&class.Field(member, javaTypeDescriptor(typ)).Names, []string{member, target})
+			return nil
+		}
+		end := strings.IndexByte(member, ')')
+		if end < open {
+			return invalidMappings(number, line)
+		}
+		name := member[:open]
+		if strings.Contains(name, ".") {
+			// A method inlined from another class
+			return nil
+		}
+		descriptor := "("
+		if arguments := member[open+1 : end]; arguments != "" {
+			for _, argument := range strings.Split(arguments, ",") {
+				descriptor += javaTypeDescriptor(argument)
+			}
+		}
+		descriptor += ")" + javaTypeDescriptor(typ)
+
+		method := class.Method(name, descriptor)
+		if method.Names[0] == name && len(method.Names) == 1 {
+			// Inlined frames repeat a method, only the first line names it
+			mappings.setNames(&method.Names, []string{name, target})
+		}
+		return nil
+	})
+	return mappings, err
+}
+
+type enigmaClass struct {
+	mapping *ClassMapping
+	named   string
+}
+
+// readEnigma reads one Enigma mapping file into mappings, which has the namespaces obf and named.
+func readEnigma(reader io.Reader, mappings *Mappings) error {
+	var classes []enigmaClass
+	var member *MemberMapping
+
+	return mappingLines(reader, func(number int, depth int, line string) error {
+		var parts []string
+		for _, part := range strings.Fields(line) {
+			if !strings.HasPrefix(part, "ACC:") {
+				parts = append(parts, part)
+			}
+		}
+		if depth > len(classes) {
+			if parts[0] == "ARG" || parts[0] == "COMMENT" {
+				depth = len(classes)
+			} else {
+				return invalidMappings(number, line)
+			}
+		}
+
+		switch {
+		case parts[0] == "COMMENT":
+		case parts[0] == "CLASS" && len(parts) >= 2:
+			obf, named := parts[1], ""
+			if len(parts) >= 3 {
+				named = parts[2]
+			}
+			classes = classes[:depth]
+			if depth > 0 {
+				outer := classes[depth-1]
+				if !strings.ContainsAny(obf, "/$") {
+					obf = outer.mapping.Names[0] + "$" + obf
+				}
+				switch {
+				case named != "" && !strings.Contains(named, "/"):
+					named = outer.named + "$" + named
+				case named == "" && outer.named != outer.mapping.Names[0]:
+					named = outer.named + obf[strings.LastIndexByte(obf, '$'):]
+				}
+			}
+			class := mappings.Class(obf)
+			mappings.setNames(&class.Names, []string{obf, named})
+			if named == "" {
+				named = obf
+			}
+			classes = append(classes, enigmaClass{class, named})
+			member = nil
+		case (parts[0] == "FIELD" || parts[0] == "METHOD") && (len(parts) == 3 || len(parts) == 4) && depth > 0:
+			class := classes[depth-1].mapping
+			descriptor := parts[len(parts)-1]
+			if parts[0] == "METHOD" {
+				member = class.Method(parts[1], descriptor)
+			} else {
+				member = class.Field(parts[1], descriptor)
+			}
+			names := []string{parts[1]}
+			if len(parts) == 4 {
+				names = append(names, parts[2])
+			}
+			mappings.setNames(&member.Names, names)
+			classes = classes[:depth]
+		case parts[0] == "ARG" && len(parts) == 3 && member != nil:
+			index, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return invalidMappings(number, line)
+			}
+			if member.Locals == nil {
+				member.Locals = map[int][]string{}
+			}
+			member.Locals[index] = []string{"", parts[2]}
+		default:
+			return invalidMappings(number, line)
+		}
+		return nil
+	})
+}
+
+// readEnigmaDirectory reads every .mapping file below an Enigma mapping directory.
+func readEnigmaDirectory(directory string) (*Mappings, error) {
+	mappings := NewMappings("obf", "named")
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".mapping") {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := readEnigma(file, mappings); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
@@ -0,0 +1,223 @@
+package babe
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+var ErrUnknownMappingFormat = errors.New("jarhax: unknown mapping format")
+var ErrInvalidMappings = errors.New("jarhax: invalid mappings")
+var ErrUnknownNamespace = errors.New("jarhax: unknown mapping namespace")
+
+// Mappings holds the names of classes, fields and methods in every namespace of a mapping file.
+// Classes are keyed by their name in the first namespace, and member descriptors use the class
+// names of the first namespace. An empty name means the name is the same as in the first namespace.
+type Mappings struct {
+	Namespaces []string
+	Classes    map[string]*ClassMapping
+}
+
+type ClassMapping struct {
+	Names   []string
+	Fields  []*MemberMapping
+	Methods []*MemberMapping
+}
+
+// MemberMapping is a field or method. Descriptor is empty for fields of formats that don't record it.
+type MemberMapping struct {
+	Names      []string
+	Descriptor string
+	// Parameters and local variables keyed by local variable slot
+	Locals map[int][]string
+}
+
+func NewMappings(namespaces ...string) *Mappings {
+	return &Mappings{Namespaces: namespaces, Classes: map[string]*ClassMapping{}}
+}
+
+// Class returns the mapping of the class named name in the first namespace, creating it if needed.
+func (mappings *Mappings) Class(name string) *ClassMapping {
+	class, ok := mappings.Classes[name]
+	if !ok {
+		class = &ClassMapping{Names: mappings.names(name)}
+		mappings.Classes[name] = class
+	}
+	return class
+}
+
+// names returns a list of names for every namespace, starting with first.
+func (mappings *Mappings) names(first string) []string {
+	names := make([]string, len(mappings.Namespaces))
+	names[0] = first
+	return names
+}
+
+func (class *ClassMapping) Field(name string, descriptor string) *MemberMapping {
+	return findMember(&class.Fields, name, descriptor)
+}
+
+func (class *ClassMapping) Method(name string, descriptor string) *MemberMapping {
+	return findMember(&class.Methods, name, descriptor)
+}
+
+func findMember(members *[]*MemberMapping, name string, descriptor string) *MemberMapping {
+	for _, member := range *members {
+		if member.Names[0] == name && member.Descriptor == descriptor {
+			return member
+		}
+	}
+	member := &MemberMapping{Names: []string{name}, Descriptor: descriptor}
+	*members = append(*members, member)
+	return member
+}
+
+// setNames replaces the names of a mapping, keeping one name for every namespace.
+func (mappings *Mappings) setNames(target *[]string, names []string) {
+	*target = make([]string, len(mappings.Namespaces))
+	copy(*target, names)
+}
+
+// mappedName returns the name in a namespace, falling back to the name in the first namespace.
+func mappedName(names []string, namespace int) string {
+	if namespace < len(names) && names[namespace] != "" {
+		return names[namespace]
+	}
+	return names[0]
+}
+
+func (mappings *Mappings) namespace(namespace string) (int, error) {
+	index := slices.Index(mappings.Namespaces, namespace)
+	if index < 0 {
+		return 0, fmt.Errorf("%w: %s (have %s)", ErrUnknownNamespace, namespace, strings.Join(mappings.Namespaces, ", "))
+	}
+	return index, nil
+}
+
+// MappingRemapper maps names from one namespace of a set of mappings to another. Members are looked up by
+// the owner that declares them; references through subclasses need a hierarchy-aware remapper.
+type MappingRemapper struct {
+	SimpleRemapper
+	locals map[string]string
+}
+
+// Remapper returns a remapper from the from namespace to the to namespace.
+func (mappings *Mappings) Remapper(from string, to string) (*MappingRemapper, error) {
+	source, err := mappings.namespace(from)
+	if err != nil {
+		return nil, err
+	}
+	target, err := mappings.namespace(to)
+	if err != nil {
+		return nil, err
+	}
+
+	remapper := &MappingRemapper{SimpleRemapper{map[string]string{}, map[string]string{}, map[string]string{}}, map[string]string{}}
+	// Descriptors are written with the names of the first namespace, so they are mapped to the source namespace first
+	sourceNames := &SimpleRemapper{Classes: map[string]string{}}
+	for _, class := range mappings.Classes {
+		sourceNames.Classes[class.Names[0]] = mappedName(class.Names, source)
+		remapper.Classes[mappedName(class.Names, source)] = mappedName(class.Names, target)
+	}
+
+	for _, class := range mappings.Classes {
+		owner := mappedName(class.Names, source)
+		for _, field := range class.Fields {
+			key := owner + "." + mappedName(field.Names, source)
+			if field.Descriptor != "" {
+				// Obfuscated classes often declare fields of the same name with different types
+				key += ":" + MapDescriptor(sourceNames, field.Descriptor)
+			}
+			remapper.Fields[key] = mappedName(field.Names, target)
+		}
+		for _, method := range class.Methods {
+			key := owner + "." + mappedName(method.Names, source) + MapDescriptor(sourceNames, method.Descriptor)
+			remapper.Methods[key] = mappedName(method.Names, target)
+			for index, names := range method.Locals {
+				if mapped := mappedName(names, target); mapped != "" {
+					remapper.locals[fmt.Sprintf("%s:%d", key, index)] = mapped
+				}
+			}
+		}
+	}
+	return remapper, nil
+}
+
+func (remapper *MappingRemapper) MapLocal(owner string, method string, descriptor string, index int, name string) string {
+	if mapped, ok := remapper.locals[fmt.Sprintf("%s.%s%s:%d", owner, method, descriptor, index)]; ok {
+		return mapped
+	}
+	return name
+}
+
+// LoadMappings reads a mapping file, detecting its format. A directory is read as Enigma mappings.
+func LoadMappings(path string) (*Mappings, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return readEnigmaDirectory(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mappings, err := ReadMappings(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return mappings, nil
+}
+
+// ReadMappings reads Tiny v1, Tiny v2, SRG, TSRG, TSRG2, ProGuard or Enigma mappings, detecting the format
+// from the first line that isn't a comment.
+func ReadMappings(r io.Reader) (*Mappings, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	start, err := reader.Peek(64 * 1024)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	line, comments := "", false
+	for _, candidate := range strings.Split(string(start), "\n") {
+		candidate = strings.TrimSuffix(candidate, "\r")
+		if strings.HasPrefix(strings.TrimSpace(candidate), "#") {
+			comments = true
+		} else if strings.TrimSpace(candidate) != "" {
+			line = candidate
+			break
+		}
+	}
+	if line == "" && comments {
+		// R8 starts its mappings with a long header of comments
+		return readProguard(reader)
+	}
+
+	switch {
+	case strings.HasPrefix(line, "v1\t"):
+		return readTinyV1(reader)
+	case strings.HasPrefix(line, "tiny\t2\t"):
+		return readTinyV2(reader)
+	case strings.HasPrefix(line, "tsrg2 "):
+		return readTsrg(reader)
+	case strings.HasPrefix(line, "PK: "), strings.HasPrefix(line, "CL: "), strings.HasPrefix(line, "FD: "), strings.HasPrefix(line, "MD: "):
+		return readSrg(reader)
+	case strings.HasPrefix(line, "CLASS "), strings.HasPrefix(line, "CLASS\t"):
+		mappings := NewMappings("obf", "named")
+		if err := readEnigma(reader, mappings); err != nil {
+			return nil, err
+		}
+		return mappings, nil
+	case strings.Contains(line, " -> ") && strings.HasSuffix(line, ":"):
+		return readProguard(reader)
+	case len(strings.Fields(line)) == 2:
+		return readTsrg(reader)
+	}
+	return nil, ErrUnknownMappingFormat
+}
@@ -0,0 +1,122 @@
+package babe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadMappings(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings string
+		from, to string
+		// typed formats record field descriptors, so fields of another type keep their name
+		typed bool
+	}{
+		{"tiny v1", "v1\tofficial\tnamed\nCLASS\ta/A\tb/B\nFIELD\ta/A\tI\tf\tg\nMETHOD\ta/A\t(La/A;)V\tm\tn\n", "official", "named", true},
+		{"tiny v1 with comments", "# generated\n\n# by hand\nv1\tofficial\tnamed\nCLASS\ta/A\tb/B\n# a field\nFIELD\ta/A\tI\tf\tg\nMETHOD\ta/A\t(La/A;)V\tm\tn\n", "official", "named", true},
+		{"tiny v2", "tiny\t2\t0\tofficial\tnamed\nc\ta/A\tb/B\n\tf\tI\tf\tg\n\tm\t(La/A;)V\tm\tn\n\t\tp\t1\tx\ty\n", "official", "named", true},
+		{"tiny v2 reversed", "tiny\t2\t0\tnamed\tofficial\nc\tb/B\ta/A\n\tf\tI\tg\tf\n\tm\t(Lb/B;)V\tn\tm\n", "official", "named", true},
+		{"srg", "PK: a b\nCL: a/A b/B\nFD: a/A/f b/B/g\nMD: a/A/m (La/A;)V b/B/n (Lb/B;)V\n", "obf", "srg", false},
+		{"srg with field types", "CL: a/A b/B\nFD: a/A/f I b/B/g I\nMD: a/A/m (La/A;)V b/B/n (Lb/B;)V\n", "obf", "srg", true},
+		{"tsrg", "a/ b/\na/A b/B\n\tf g\n\tm (La/A;)V n\n", "obf", "srg", false},
+		{"tsrg with comments", "# tsrg\na/A b/B\n\tf g\n\tm (La/A;)V n\n", "obf", "srg", false},
+		{"tsrg2", "tsrg2 obf srg\na/A b/B\n\tf I g\n\tm (La/A;)V n\n\t\tstatic\n\t\t0 p q\n", "obf", "srg", true},
+		{"proguard", "a.A -> b.B:\n    int f -> g\n    1:2:void m(a.A):3:4 -> n\n    5:6:void m(a.A):7:8 -> n\n", "named", "obf", true},
+		{"r8", "# compiler: R8\n# {\"id\":\"com.android.tools.r8.mapping\",\"version\":\"2.0\"}\na.A -> b.B:\n    int f -> g\n    void m(a.A) -> n\n", "named", "obf", true},
+		{"enigma", "CLASS a/A b/B\n\tFIELD f g I\n\tMETHOD m n (La/A;)V\n\t\tARG 1 x\n", "obf", "named", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mappings, err := ReadMappings(strings.NewReader(test.mappings))
+			if err != nil {
+				t.Fatal(err)
+			}
+			remapper, err := mappings.Remapper(test.from, test.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name := remapper.MapClass("a/A"); name != "b/B" {
+				t.Errorf("MapClass = %q, want b/B", name)
+			}
+			if name := remapper.MapField("a/A", "f", "I"); name != "g" {
+				t.Errorf("MapField = %q, want g", name)
+			}
+			other := "g"
+			if test.typed {
+				other = "f"
+			}
+			if name := remapper.MapField("a/A", "f", "J"); name != other {
+				t.Errorf("MapField of another type = %q, want %q", name, other)
+			}
+			if name := remapper.MapMethod("a/A", "m", "(La/A;)V"); name != "n" {
+				t.Errorf("MapMethod = %q, want n", name)
+			}
+			if name := remapper.MapMethod("a/A", "m", "()V"); name != "m" {
+				t.Errorf("MapMethod of another descriptor = %q, want m", name)
+			}
+		})
+	}
+}
+
+func TestReadMappingsLocals(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings string
+		from, to string
+		index    int
+		local    string
+	}{
+		{"tiny v2", "tiny\t2\t0\tofficial\tnamed\nc\ta/A\tb/B\n\tm\t()V\tm\tn\n\t\tp\t1\t\tvalue\n", "official", "named", 1, "value"},
+		{"tsrg2", "tsrg2 obf srg\na/A b/B\n\tm ()V n\n\t\t0 o p\n", "obf", "srg", 0, "p"},
+		{"enigma", "CLASS a/A b/B\n\tMETHOD m n ()V\n\t\tARG 2 value\n", "obf", "named", 2, "value"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mappings, err := ReadMappings(strings.NewReader(test.mappings))
+			if err != nil {
+				t.Fatal(err)
+			}
+			remapper, err := mappings.Remapper(test.from, test.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name := remapper.MapLocal("a/A", "m", "()V", test.index, "x"); name != test.local {
+				t.Errorf("MapLocal = %q, want %q", name, test.local)
+			}
+		})
+	}
+}
+
+func TestReadMappingsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings string
+		err      error
+	}{
+		{"empty", "", ErrUnknownMappingFormat},
+		{"unknown", "a b c d\n", ErrUnknownMappingFormat},
+		{"tiny v1", "v1\tofficial\tnamed\nPACKAGE\ta\n", ErrInvalidMappings},
+		{"tiny v2 header", "tiny\t2\t0\tofficial\n", ErrInvalidMappings},
+		{"srg", "CL: a/A\n", ErrInvalidMappings},
+		{"tsrg member without class", "\tf g\n", ErrInvalidMappings},
+		{"tsrg", "a/A b/B\n\tf g h i\n", ErrInvalidMappings},
+		{"proguard", "a.A -> b.B:\n    int f\n", ErrInvalidMappings},
+		{"enigma", "CLASS a/A b/B\nMETHOD m n ()V\n", ErrInvalidMappings},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ReadMappings(strings.NewReader(test.mappings)); !errors.Is(err, test.err) {
+				t.Errorf("ReadMappings error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestRemapperUnknownNamespace(t *testing.T) {
+	mappings := NewMappings("official", "named")
+	if _, err := mappings.Remapper("official", "intermediary"); !errors.Is(err, ErrUnknownNamespace) {
+		t.Errorf("Remapper error = %v, want ErrUnknownNamespace", err)
+	}
+}
@@ -0,0 +1,156 @@
+package babe
+
+// SetName points the member at a new name. Other constants using the old name are left alone.
+func (info *FieldInfo) SetName(name string) {
+	info.NameIndex = info.class.AddUtf8(name)
+}
+
+func (info *FieldInfo) SetDescriptor(descriptor string) {
+	info.DescriptorIndex = info.class.AddUtf8(descriptor)
+}
+
+func (info *FieldInfo) SetAccessFlags(access int) {
+	info.AccessFlags = uint16(access)
+}
+
+// SetModifier sets or clears the given access flags.
+func (info *FieldInfo) SetModifier(mod int, enabled bool) {
+	if enabled {
+		info.AccessFlags |= uint16(mod)
+	} else {
+		info.AccessFlags &^= uint16(mod)
+	}
+}
+
+func (class *Class) SetModifier(mod int, enabled bool) {
+	if enabled {
+		class.AccessFlags |= uint16(mod)
+	} else {
+		class.AccessFlags &^= uint16(mod)
+	}
+}
+
+func (info *FieldInfo) matches(name string, descriptor string) bool {
+	return info.GetName() == name && (descriptor == "" || info.GetDescriptor() == descriptor)
+}
+
+// FindField returns the field with the given name and descriptor, or nil. An empty descriptor matches any field with the name.
+// Like the pointers returned by FindMethod, AddField and AddMethod, it points into the class and is invalidated by adding or
+// removing members.
+func (class *Class) FindField(name string, descriptor string) *FieldInfo {
+	for i := range class.Fields {
+		if class.Fields[i].matches(name, descriptor) {
+			return &class.Fields[i]
+		}
+	}
+	return nil
+}
+
+// FindMethod returns the method with the given name and descriptor, or nil. An empty descriptor matches the first overload.
+func (class *Class) FindMethod(name string, descriptor string) *MethodInfo {
+	for i := range class.Methods {
+		if class.Methods[i].matches(name, descriptor) {
+			return &class.Methods[i]
+		}
+	}
+	return nil
+}
+
+// AddField declares a new field without attributes.
+func (class *Class) AddField(access int, name string, descriptor string) *FieldInfo {
+	class.Fields = append(class.Fields, FieldInfo{class: class, AccessFlags: uint16(access), NameIndex: class.AddUtf8(name), DescriptorIndex: class.AddUtf8(descriptor)})
+	class.FieldsCount = uint16(len(class.Fields))
+	return &class.Fields[len(class.Fields)-1]
+}
+
+// AddMethod declares a new method without attributes. Methods that aren't abstract or native need code set with SetCode.
+func (class *Class) AddMethod(access int, name string, descriptor string) *MethodInfo {
+	class.Methods = append(class.Methods, MethodInfo{FieldInfo{class: class, AccessFlags: uint16(access), NameIndex: class.AddUtf8(name), DescriptorIndex: class.AddUtf8(descriptor)}})
+	class.MethodCount = uint16(len(class.Methods))
+	return &class.Methods[len(class.Methods)-1]
+}
+
+// RemoveField removes the matching fields and reports whether any were found.
+func (class *Class) RemoveField(name string, descriptor string) bool {
+	kept := class.Fields[:0]
+	for _, field := range class.Fields {
+		if !field.matches(name, descriptor) {
+			kept = append(kept, field)
+		}
+	}
+	removed := len(kept) != len(class.Fields)
+	class.Fields = kept
+	class.FieldsCount = uint16(len(kept))
+	return removed
+}
+
+// RemoveMethod removes the matching methods and reports whether any were found.
+func (class *Class) RemoveMethod(name string, descriptor string) bool {
+	kept := class.Methods[:0]
+	for _, method := range class.Methods {
+		if !method.matches(name, descriptor) {
+			kept = append(kept, method)
+		}
+	}
+	removed := len(kept) != len(class.Methods)
+	class.Methods = kept
+	class.MethodCount = uint16(len(kept))
+	return removed
+}
+
+// RenameField renames the matching fields along with the references to them from within the class.
+func (class *Class) RenameField(name string, descriptor string, newName string) bool {
+	found := false
+	for i := range class.Fields {
+		if class.Fields[i].matches(name, descriptor) {
+			class.renameReferences(name, class.Fields[i].GetDescriptor(), newName, false)
+			class.Fields[i].SetName(newName)
+			found = true
+		}
+	}
+	return found
+}
+
+// RenameMethod renames the matching methods along with the references to them from within the class.
+func (class *Class) RenameMethod(name string, descriptor string, newName string) bool {
+	found := false
+	for i := range class.Methods {
+		if class.Methods[i].matches(name, descriptor) {
+			class.renameReferences(name, class.Methods[i].GetDescriptor(), newName, true)
+			class.Methods[i].SetName(newName)
+			found = true
+		}
+	}
+	return found
+}
+
+// renameReferences repoints the field or method references owned by this class to a new name.
+func (class *Class) renameReferences(name string, descriptor string, newName string, method bool) {
+	self := class.GetClassName()
+	var refs []*FieldRefInfo
+	for _, constant := range class.ConstantPool {
+		switch info := constant.(type) {
+		case *FieldRefInfo:
+			if !method {
+				refs = append(refs, info)
+			}
+		case *MethodRefInfo:
+			if method {
+				refs = append(refs, &info.FieldRefInfo)
+			}
+		case *InterfaceMethodRefInfo:
+			if method {
+				refs = append(refs, &info.FieldRefInfo)
+			}
+		}
+	}
+
+	for _, ref := range refs {
+		refName, refDescriptor := class.GetNameAndType(ref.NameAndTypeIndex)
+		if class.GetClassInfoName(ref.ClassIndex) == self && refName == name && refDescriptor == descriptor {
+			ref.NameAndTypeIndex = class.AddNameAndType(newName, descriptor)
+		}
+	}
+	// The refs were changed in place, so their old content may still be indexed
+	class.pool = nil
+}
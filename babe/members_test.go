@@ -0,0 +1,212 @@
+package babe
+
+import (
+	"slices"
+	"testing"
+)
+
+func membersTestClass(t *testing.T) *Class {
+	t.Helper()
+	return buildTestClass(t, NewClassBuilder("a/Members").
+		Field(ACC_PUBLIC, "value", "I", nil).
+		Field(ACC_PUBLIC, "value", "J", nil).
+		Method(ACC_PUBLIC, "run", "(La/Other;)V", func(code *CodeBuilder) {
+			code.VisitVarInsn(ALOAD, 0)
+			code.GetField("a/Members", "value", "I")
+			code.VisitInsn(POP)
+			code.VisitVarInsn(ALOAD, 1)
+			code.GetField("a/Other", "value", "I")
+			code.VisitInsn(POP)
+			code.VisitVarInsn(ALOAD, 0)
+			code.InvokeVirtual("a/Members", "helper", "()V")
+			code.InvokeStatic("a/Other", "helper", "()V")
+			code.Return()
+		}).
+		Method(ACC_PRIVATE, "helper", "()V", emptyBody).
+		Method(ACC_PRIVATE, "helper", "(I)V", emptyBody))
+}
+
+// memberRefs returns the field and method references of a class as owner.name:descriptor, sorted.
+func memberRefs(class *Class) []string {
+	var refs []string
+	for i, constant := range class.ConstantPool {
+		switch constant.(type) {
+		case *FieldRefInfo, *MethodRefInfo, *InterfaceMethodRefInfo:
+			owner, name, descriptor := class.GetRef(uint16(i + 1))
+			refs = append(refs, owner+"."+name+":"+descriptor)
+		}
+	}
+	slices.Sort(refs)
+	return refs
+}
+
+// memberNames returns the fields or methods of a class as name:descriptor.
+func memberNames[T any, P interface {
+	*T
+	GetName() string
+	GetDescriptor() string
+}](members []T) []string {
+	var names []string
+	for i := range members {
+		member := P(&members[i])
+		names = append(names, member.GetName()+":"+member.GetDescriptor())
+	}
+	return names
+}
+
+func TestFindMembers(t *testing.T) {
+	class := membersTestClass(t)
+	fields := []struct {
+		name, descriptor, found string
+	}{
+		{"value", "I", "value:I"},
+		{"value", "J", "value:J"},
+		{"value", "", "value:I"},
+		{"value", "D", ""},
+		{"missing", "", ""},
+	}
+	for _, test := range fields {
+		found := ""
+		if field := class.FindField(test.name, test.descriptor); field != nil {
+			found = field.GetName() + ":" + field.GetDescriptor()
+		}
+		if found != test.found {
+			t.Errorf("FindField(%q, %q) = %q, want %q", test.name, test.descriptor, found, test.found)
+		}
+	}
+	methods := []struct {
+		name, descriptor, found string
+	}{
+		{"helper", "(I)V", "helper:(I)V"},
+		{"helper", "", "helper:()V"},
+		{"run", "()V", ""},
+		{"missing", "", ""},
+	}
+	for _, test := range methods {
+		found := ""
+		if method := class.FindMethod(test.name, test.descriptor); method != nil {
+			found = method.GetName() + ":" + method.GetDescriptor()
+		}
+		if found != test.found {
+			t.Errorf("FindMethod(%q, %q) = %q, want %q", test.name, test.descriptor, found, test.found)
+		}
+	}
+}
+
+func TestEditMembers(t *testing.T) {
+	refs := []string{"a/Members.helper:()V", "a/Members.value:I", "a/Other.helper:()V", "a/Other.value:I"}
+	fields := []string{"value:I", "value:J"}
+	methods := []string{"run:(La/Other;)V", "helper:()V", "helper:(I)V"}
+	tests := []struct {
+		name string
+		edit func(class *Class) bool
+		want bool
+		// added is the number of constants the edit adds to the pool
+		added   int
+		fields  []string
+		methods []string
+		refs    []string
+	}{
+		{"add field with a new name", func(class *Class) bool {
+			return class.AddField(ACC_PRIVATE, "count", "I") != nil
+		}, true, 1, append(slices.Clone(fields), "count:I"), methods, refs},
+		{"add field with known constants", func(class *Class) bool {
+			return class.AddField(ACC_PRIVATE, "helper", "J") != nil
+		}, true, 0, append(slices.Clone(fields), "helper:J"), methods, refs},
+		{"add method overload", func(class *Class) bool {
+			return class.AddMethod(ACC_PUBLIC|ACC_NATIVE, "helper", "(J)V") != nil
+		}, true, 1, fields, append(slices.Clone(methods), "helper:(J)V"), refs},
+		{"remove field by descriptor", func(class *Class) bool {
+			return class.RemoveField("value", "J")
+		}, true, 0, fields[:1], methods, refs},
+		{"remove every field of a name", func(class *Class) bool {
+			return class.RemoveField("value", "")
+		}, true, 0, nil, methods, refs},
+		{"remove every overload", func(class *Class) bool {
+			return class.RemoveMethod("helper", "")
+		}, true, 0, fields, methods[:1], refs},
+		{"remove missing method", func(class *Class) bool {
+			return class.RemoveMethod("helper", "(J)V")
+		}, false, 0, fields, methods, refs},
+		{"rename field", func(class *Class) bool {
+			return class.RenameField("value", "I", "amount")
+		}, true, 2, []string{"amount:I", "value:J"}, methods,
+			[]string{"a/Members.amount:I", "a/Members.helper:()V", "a/Other.helper:()V", "a/Other.value:I"}},
+		{"rename field without references", func(class *Class) bool {
+			return class.RenameField("value", "J", "wide")
+		}, true, 1, []string{"value:I", "wide:J"}, methods, refs},
+		{"rename every overload", func(class *Class) bool {
+			return class.RenameMethod("helper", "", "assist")
+		}, true, 2, fields, []string{"run:(La/Other;)V", "assist:()V", "assist:(I)V"},
+			[]string{"a/Members.assist:()V", "a/Members.value:I", "a/Other.helper:()V", "a/Other.value:I"}},
+		{"rename to a known name", func(class *Class) bool {
+			return class.RenameMethod("helper", "()V", "value")
+		}, true, 1, fields, []string{"run:(La/Other;)V", "value:()V", "helper:(I)V"},
+			[]string{"a/Members.value:()V", "a/Members.value:I", "a/Other.helper:()V", "a/Other.value:I"}},
+		{"rename missing field", func(class *Class) bool {
+			return class.RenameField("value", "D", "amount")
+		}, false, 0, fields, methods, refs},
+		{"set name", func(class *Class) bool {
+			class.FindMethod("helper", "(I)V").SetName("run")
+			return true
+		}, true, 0, fields, []string{"run:(La/Other;)V", "helper:()V", "run:(I)V"}, refs},
+		{"set descriptor", func(class *Class) bool {
+			class.FindField("value", "J").SetDescriptor("D")
+			return true
+		}, true, 1, []string{"value:I", "value:D"}, methods, refs},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class := membersTestClass(t)
+			count := len(class.ConstantPool)
+			if got := test.edit(class); got != test.want {
+				t.Errorf("edit = %t, want %t", got, test.want)
+			}
+			read := rereadClass(t, class)
+			if added := len(read.ConstantPool) - count; added != test.added {
+				t.Errorf("%d constants added, want %d", added, test.added)
+			}
+			if names := memberNames(read.Fields); !slices.Equal(names, test.fields) || int(read.FieldsCount) != len(names) {
+				t.Errorf("fields = %v (%d), want %v", names, read.FieldsCount, test.fields)
+			}
+			if names := memberNames(read.Methods); !slices.Equal(names, test.methods) || int(read.MethodCount) != len(names) {
+				t.Errorf("methods = %v (%d), want %v", names, read.MethodCount, test.methods)
+			}
+			if got := memberRefs(read); !slices.Equal(got, test.refs) {
+				t.Errorf("references = %v, want %v", got, test.refs)
+			}
+		})
+	}
+}
+
+func TestSetModifier(t *testing.T) {
+	class := membersTestClass(t)
+	field := class.FindField("value", "I")
+	field.SetModifier(ACC_FINAL, true)
+	field.SetModifier(ACC_PUBLIC, false)
+	field.SetModifier(ACC_PRIVATE|ACC_STATIC, true)
+	method := class.FindMethod("helper", "()V")
+	method.SetModifier(ACC_PRIVATE, false)
+	method.SetModifier(ACC_PROTECTED|ACC_SYNCHRONIZED, true)
+	class.FindField("value", "J").SetAccessFlags(ACC_VOLATILE)
+	class.SetModifier(ACC_FINAL, true)
+	class.SetModifier(ACC_SUPER, false)
+
+	read := rereadClass(t, class)
+	tests := []struct {
+		name   string
+		access uint16
+		want   int
+	}{
+		{"field value:I", read.FindField("value", "I").AccessFlags, ACC_PRIVATE | ACC_STATIC | ACC_FINAL},
+		{"field value:J", read.FindField("value", "J").AccessFlags, ACC_VOLATILE},
+		{"method helper()V", read.FindMethod("helper", "()V").AccessFlags, ACC_PROTECTED | ACC_SYNCHRONIZED},
+		{"method helper(I)V", read.FindMethod("helper", "(I)V").AccessFlags, ACC_PRIVATE},
+		{"class", read.AccessFlags, ACC_PUBLIC | ACC_FINAL},
+	}
+	for _, test := range tests {
+		if test.access != uint16(test.want) {
+			t.Errorf("%s access = %#x, want %#x", test.name, test.access, test.want)
+		}
+	}
+}
@@ -1,32 +1,193 @@
 package babe
 
-func MinimizeJar(filename string) error {
+import (
+	"bufio"
+	"errors"
+	"strings"
+)
 
-	//var members []string
+var ErrNoEntryPoints = errors.New("jarhax: no entry points to minimize from")
 
-	/*err := ForJarMember(filename, func(member *JarMember) error {
-		members = append(members, member.Name)
+// Minimizer removes every class that cannot be reached from a main method, a service
+// provider or a kept class. The versioned variants of a reachable class in a multi-release jar
+// are kept, along with every class they reach. A module descriptor is kept along with the services it uses and
+// provides, and left listing the packages that remain.
+type Minimizer struct {
+	// Keep lists class names, or package prefixes ending in "/", that are always kept.
+	Keep []string
+	// KeepAnnotations lists annotation types, such as "androidx.annotation.Keep", keeping the classes they annotate
+	// along with the classes declaring annotated members.
+	KeepAnnotations []string
+	reachable       map[string]bool
+	// packages left in every jar, by the nested jar holding them
+	packages map[string]map[string]bool
+}
+
+func (minimizer *Minimizer) keeps(name string) bool {
+	for _, keep := range minimizer.Keep {
+		keep = strings.ReplaceAll(keep, ".", "/")
+		if name == keep || (strings.HasSuffix(keep, "/") && strings.HasPrefix(name, keep)) {
+			return true
+		}
+	}
+	return false
+}
+
+// annotated reports whether the class or one of its members carries one of the KeepAnnotations.
+func (minimizer *Minimizer) annotated(class *Class) bool {
+	if len(minimizer.KeepAnnotations) == 0 {
+		return false
+	}
+	annotations := class.GetAnnotations()
+	for i := range class.Fields {
+		annotations = append(annotations, class.Fields[i].GetAnnotations()...)
+	}
+	for i := range class.Methods {
+		annotations = append(annotations, class.Methods[i].GetAnnotations()...)
+	}
+	for _, component := range class.GetRecordComponents() {
+		annotations = append(annotations, component.GetAnnotations()...)
+	}
+	for _, name := range minimizer.KeepAnnotations {
+		if FindAnnotation(annotations, name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (minimizer *Minimizer) Analyze(members []*JarMember) error {
+	// Every variant of a class, versioned ones included
+	classes := map[string][]*Class{}
+	var roots []string
+
+	for _, member := range members {
+		if strings.HasPrefix(member.Name, "META-INF/services/") {
+			services, err := readServices(member)
+			if err != nil {
+				return err
+			}
+			roots = append(roots, services...)
+			continue
+		}
 
 		class, err := member.GetAsClass()
 		if err != nil {
 			if errors.Is(err, ErrNotClass) {
-				return nil
+				continue
 			}
 			return err
 		}
 
-		for i, constant := range class.ConstantPool {
-			switch info := constant.(type) {
-			case ClassInfo:
+		name := class.GetClassName()
+		classes[name] = append(classes[name], class)
+		if class.HasMainMethod() || class.IsModuleInfo() || minimizer.keeps(name) || minimizer.annotated(class) {
+			roots = append(roots, name)
+		}
+	}
 
-			}
+	if len(roots) == 0 {
+		return ErrNoEntryPoints
+	}
+
+	minimizer.reachable = map[string]bool{}
+	for len(roots) > 0 {
+		name := roots[len(roots)-1]
+		roots = roots[:len(roots)-1]
+
+		variants, ok := classes[name]
+		if !ok || minimizer.reachable[name] {
+			continue
+		}
+		minimizer.reachable[name] = true
+		for _, class := range variants {
+			roots = append(roots, ClassReferences(class)...)
 		}
+	}
 
-		return nil
-	})
+	var names []string
+	for _, member := range members {
+		_, base := SplitVersionedName(member.Name)
+		if name, ok := strings.CutSuffix(base, ".class"); !ok || minimizer.reachable[name] {
+			names = append(names, member.scopedName())
+		}
+	}
+	minimizer.packages = scopedPackages(names, nil)
+	return nil
+}
+
+func (minimizer *Minimizer) TransformClass(member *JarMember, class *Class) (bool, error) {
+	if !minimizer.reachable[class.GetClassName()] {
+		member.Delete()
+		return false, nil
+	}
+	if class.IsModuleInfo() {
+		return syncModulePackages(class, minimizer.packages[member.NestedIn()]), nil
+	}
+	return false, nil
+}
+
+// readServices returns the provider class names listed in a META-INF/services file.
+func readServices(member *JarMember) ([]string, error) {
+	r, err := member.Open()
 	if err != nil {
-		return err
-	}*/
+		return nil, err
+	}
+	defer r.Close()
 
-	return nil
+	var services []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			services = append(services, strings.ReplaceAll(line, ".", "/"))
+		}
+	}
+	return services, scanner.Err()
+}
+
+// ClassReferences returns every class name the class may refer to. It over-approximates by also
+// treating descriptor-like and dotted strings as references, so reflective lookups stay reachable.
+func ClassReferences(class *Class) []string {
+	var references []string
+	for _, constant := range class.ConstantPool {
+		switch info := constant.(type) {
+		case *ClassInfo:
+			name := class.GetConstant(info.NameIndex).(*Utf8Info).String()
+			if strings.HasPrefix(name, "[") {
+				references = append(references, descriptorClassNames(name)...)
+			} else {
+				references = append(references, name)
+			}
+		case *Utf8Info:
+			s := info.String()
+			references = append(references, descriptorClassNames(s)...)
+			references = append(references, strings.ReplaceAll(s, ".", "/"))
+		}
+	}
+	return references
+}
+
+// descriptorClassNames extracts the names of every L<name>; or L<name>< type in a descriptor or signature.
+func descriptorClassNames(s string) []string {
+	var names []string
+	for i := 0; i < len(s); i++ {
+		if s[i] != 'L' {
+			continue
+		}
+		end := strings.IndexAny(s[i+1:], ";<")
+		if end <= 0 {
+			break
+		}
+		name := s[i+1 : i+1+end]
+		if !strings.ContainsAny(name, " ().[:>") {
+			names = append(names, name)
+			i += end
+		}
+	}
+	return names
+}
+
+func MinimizeJar(filename string, keep ...string) error {
+	return NewPipeline(&Minimizer{Keep: keep}).Run(filename)
 }
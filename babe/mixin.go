@@ -0,0 +1,259 @@
+package babe
+
+import (
+	stdbytes "bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	notMixin = iota
+	mixinConfig
+	mixinRefmap
+)
+
+// mixinResources are the Mixin configs and refmaps of a jar. Configs are declared by the MixinConfigs attribute of
+// the manifest and the mixins of fabric.mod.json, and each names its refmap.
+type mixinResources struct {
+	configs map[string]bool
+	refmaps map[string]bool
+}
+
+// isMixinMetadata reports whether a resource may declare Mixin configs or refmaps: the manifest, fabric.mod.json and
+// the configs themselves.
+func isMixinMetadata(name string) bool {
+	return name == ManifestName || strings.HasSuffix(name, ".json")
+}
+
+// isMixinConfigName reports whether a resource is named as Mixin configs usually are, as in modid.mixins.json or
+// mixins.modid.json.
+func isMixinConfigName(name string) bool {
+	name = path.Base(name)
+	return strings.HasSuffix(name, ".mixins.json") || strings.HasPrefix(name, "mixins.") && strings.HasSuffix(name, ".json")
+}
+
+// isRefmapName reports whether a resource is named as Mixin refmaps usually are, as in modid-refmap.json.
+func isRefmapName(name string) bool {
+	name = path.Base(name)
+	return strings.Contains(name, "refmap") && strings.HasSuffix(name, ".json")
+}
+
+// readMixinResources finds the Mixin configs and refmaps of a jar, and of each of its nested jars, by the nested jar
+// holding them. Besides the declared configs, resources named as configs are taken for configs when their content is.
+func readMixinResources(members []*JarMember) (map[string]*mixinResources, error) {
+	jars := map[string]*mixinResources{}
+	resources := func(member *JarMember) *mixinResources {
+		if jars[member.NestedIn()] == nil {
+			jars[member.NestedIn()] = &mixinResources{configs: map[string]bool{}, refmaps: map[string]bool{}}
+		}
+		return jars[member.NestedIn()]
+	}
+
+	for _, member := range members {
+		switch member.Name {
+		case ManifestName:
+			manifest, err := ReadManifest(*member.Buffer.Data)
+			if err != nil {
+				return nil, err
+			}
+			for _, config := range strings.Split(manifest.Main.Get("MixinConfigs"), ",") {
+				if config = strings.TrimSpace(config); config != "" {
+					resources(member).configs[config] = true
+				}
+			}
+		case "fabric.mod.json":
+			var mod struct{ Mixins []json.RawMessage }
+			if json.Unmarshal(*member.Buffer.Data, &mod) != nil {
+				continue
+			}
+			// Each config is named either by a string or by an object restricting it to an environment
+			for _, entry := range mod.Mixins {
+				var config struct{ Config string }
+				if json.Unmarshal(entry, &config.Config) != nil {
+					json.Unmarshal(entry, &config)
+				}
+				if config.Config != "" {
+					resources(member).configs[config.Config] = true
+				}
+			}
+		}
+	}
+
+	for _, member := range members {
+		configs := resources(member).configs
+		if !configs[member.Name] && !(isMixinConfigName(member.Name) && mixinKind(*member.Buffer.Data) == mixinConfig) {
+			continue
+		}
+		configs[member.Name] = true
+		var config struct{ Refmap string }
+		if json.Unmarshal(*member.Buffer.Data, &config) == nil && config.Refmap != "" {
+			resources(member).refmaps[config.Refmap] = true
+		}
+	}
+	return jars, nil
+}
+
+// mayBeMixin reports whether a resource is a declared Mixin config or refmap, or is named as one.
+func (resources *mixinResources) mayBeMixin(name string) bool {
+	if resources != nil && (resources.configs[name] || resources.refmaps[name]) {
+		return true
+	}
+	return isMixinConfigName(name) || isRefmapName(name)
+}
+
+// kind tells whether a resource is a Mixin config or refmap. Resources that are neither declared as such nor named as
+// such are never taken for one, and those named as such must have the content of one.
+func (resources *mixinResources) kind(name string, data []byte) int {
+	switch {
+	case resources != nil && resources.configs[name]:
+		return mixinConfig
+	case resources != nil && resources.refmaps[name]:
+		return mixinRefmap
+	case isMixinConfigName(name) || isRefmapName(name):
+		return mixinKind(data)
+	}
+	return notMixin
+}
+
+// mixinKind tells Mixin configs and refmaps apart by their content. Configs have a package and mixins to apply,
+// refmaps map mixin classes to their references.
+func mixinKind(data []byte) int {
+	var document struct {
+		Package  string
+		Mixins   json.RawMessage
+		Client   json.RawMessage
+		Server   json.RawMessage
+		Mappings map[string]map[string]string
+	}
+	if json.Unmarshal(data, &document) != nil {
+		return notMixin
+	}
+	switch {
+	case document.Package != "" && (document.Mixins != nil || document.Client != nil || document.Server != nil):
+		return mixinConfig
+	case document.Mappings != nil:
+		return mixinRefmap
+	}
+	return notMixin
+}
+
+func readMember(member *JarMember) ([]byte, error) {
+	r, err := member.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// rewriteJSONStrings replaces the strings of a JSON document, keeping its formatting. The rewrite function is given
+// the top level key the string is under, its depth and whether it is an object key.
+func rewriteJSONStrings(data []byte, rewrite func(field string, depth int, value string, key bool) string) ([]byte, error) {
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	var out stdbytes.Buffer
+	depth, field := 0, ""
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case '"':
+			end := i + 1
+			for ; data[end] != '"'; end++ {
+				if data[end] == '\\' {
+					end++
+				}
+			}
+			var value string
+			json.Unmarshal(data[i:end+1], &value)
+			next := end + 1
+			for next < len(data) && strings.IndexByte(" \t\r\n", data[next]) >= 0 {
+				next++
+			}
+			key := next < len(data) && data[next] == ':'
+
+			if key && depth == 1 {
+				field = value
+			}
+			if rewritten := rewrite(field, depth, value, key); rewritten != value {
+				encoded := &stdbytes.Buffer{}
+				encoder := json.NewEncoder(encoded)
+				encoder.SetEscapeHTML(false)
+				encoder.Encode(rewritten)
+				out.Write(stdbytes.TrimSuffix(encoded.Bytes(), []byte("\n")))
+			} else {
+				out.Write(data[i : end+1])
+			}
+			i = end
+			continue
+		}
+		out.WriteByte(data[i])
+	}
+	return out.Bytes(), nil
+}
+
+// relocateMixinConfig moves the package of a Mixin config, along with its plugin and the mixins listed relative to it.
+func relocateMixinConfig(data []byte, relocate func(string) string) ([]byte, error) {
+	var config struct{ Package string }
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	relocated := relocateBinaryName(relocate, config.Package)
+	return rewriteJSONStrings(data, func(field string, depth int, value string, key bool) string {
+		switch {
+		case key:
+			return value
+		case depth == 1 && field == "package":
+			return relocated
+		case depth == 1 && field == "plugin":
+			return relocateBinaryName(relocate, value)
+		case depth == 2 && (field == "mixins" || field == "client" || field == "server"):
+			// Mixins moved out of the package can't be listed relative to it, so they are left alone
+			if mixin, ok := strings.CutPrefix(relocateBinaryName(relocate, config.Package+"."+value), relocated+"."); ok {
+				return mixin
+			}
+		}
+		return value
+	})
+}
+
+// relocateRefmap relocates the mixin class names, target references and annotation values of a Mixin refmap, see
+// mapMixinReference. The mappings are listed once more by namespaces under data, whose keys are kept.
+func relocateRefmap(data []byte, remapper Remapper) ([]byte, error) {
+	return rewriteJSONStrings(data, func(field string, depth int, value string, key bool) string {
+		if key && (depth == 1 || depth == 2 && field == "data") {
+			return value
+		}
+		return mapMixinReference(remapper, value)
+	})
+}
+
+// mapMixinReference maps the classes of a reference of a refmap: a class name, or a member written as
+// Lowner;name(descriptor) or Lowner;name:descriptor, its owner and descriptor being optional. Member names are kept.
+func mapMixinReference(remapper Remapper, reference string) string {
+	owner, member := "", reference
+	if strings.HasPrefix(reference, "L") {
+		if end := strings.IndexByte(reference, ';'); end >= 0 {
+			owner, member = "L"+remapper.MapClass(reference[1:end])+";", reference[end+1:]
+		}
+	}
+	switch i := strings.IndexAny(member, "(:"); {
+	case i >= 0 && member[i] == '(':
+		return owner + member[:i] + MapDescriptor(remapper, member[i:])
+	case i >= 0:
+		return owner + member[:i+1] + MapDescriptor(remapper, member[i+1:])
+	case owner != "":
+		return owner + member
+	}
+	return remapper.MapClass(reference)
+}
+
+func relocateBinaryName(relocate func(string) string, name string) string {
+	return strings.ReplaceAll(relocate(strings.ReplaceAll(name, ".", "/")), "/", ".")
+}
@@ -0,0 +1,263 @@
+package babe
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMapMixinReference(t *testing.T) {
+	remapper := relocationRemapper(ParseRelocation("com.a:shaded.com.a"))
+	tests := map[string]string{
+		"com/a/X":                             "shaded/com/a/X",
+		"com/abc/Y":                           "com/abc/Y",
+		"Lcom/a/X;":                           "Lshaded/com/a/X;",
+		"Lcom/abc/Y;":                         "Lcom/abc/Y;",
+		"Lcom/a/X;run(Lcom/a/Y;Lcom/abc/Y;)V": "Lshaded/com/a/X;run(Lshaded/com/a/Y;Lcom/abc/Y;)V",
+		"Lcom/abc/Y;run(Lcom/a/Y;)Lcom/a/X;":  "Lcom/abc/Y;run(Lshaded/com/a/Y;)Lshaded/com/a/X;",
+		"Lcom/a/X;value:Lcom/a/Y;":            "Lshaded/com/a/X;value:Lshaded/com/a/Y;",
+		"Lcom/a/X;value":                      "Lshaded/com/a/X;value",
+		"run(Lcom/a/Y;)V":                     "run(Lshaded/com/a/Y;)V",
+		"value:[Lcom/a/Y;":                    "value:[Lshaded/com/a/Y;",
+		"run":                                 "run",
+		"Lcom/a/X;<init>()V":                  "Lshaded/com/a/X;<init>()V",
+	}
+	for reference, want := range tests {
+		if mapped := mapMixinReference(remapper, reference); mapped != want {
+			t.Errorf("mapMixinReference(%q) = %q, want %q", reference, mapped, want)
+		}
+	}
+}
+
+func TestRelocateRefmap(t *testing.T) {
+	refmap := `{
+  "mappings": {
+    "com/a/mixin/XMixin": {
+      "run": "Lcom/a/X;run(Lcom/abc/Y;)V",
+      "Lcom/a/X;value:I": "Lcom/a/X;field_1:I"
+    },
+    "com/abc/mixin/YMixin": {
+      "target": "Lcom/abc/Y;target()Lcom/a/X;"
+    }
+  },
+  "data": {
+    "named:intermediary": {
+      "com/a/mixin/XMixin": {
+        "run": "Lcom/a/X;method_1(Lcom/abc/Y;)V"
+      }
+    }
+  }
+}`
+	want := `{
+  "mappings": {
+    "shaded/com/a/mixin/XMixin": {
+      "run": "Lshaded/com/a/X;run(Lcom/abc/Y;)V",
+      "Lshaded/com/a/X;value:I": "Lshaded/com/a/X;field_1:I"
+    },
+    "com/abc/mixin/YMixin": {
+      "target": "Lcom/abc/Y;target()Lshaded/com/a/X;"
+    }
+  },
+  "data": {
+    "named:intermediary": {
+      "shaded/com/a/mixin/XMixin": {
+        "run": "Lshaded/com/a/X;method_1(Lcom/abc/Y;)V"
+      }
+    }
+  }
+}`
+	relocated, err := relocateRefmap([]byte(refmap), relocationRemapper(ParseRelocation("com.a:shaded.com.a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(relocated) != want {
+		t.Errorf("relocateRefmap = %s", relocated)
+	}
+}
+
+func TestRewriteJSONStrings(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"formatting", "{\n\t\"a\" :  \"x\",\r\n  \"b\":[ \"x\" ,\"y\"]\n}", "{\n\t\"a\" :  \"X\",\r\n  \"b\":[ \"X\" ,\"y\"]\n}"},
+		{"escapes", `{"a": "x", "b": "say \"x\"", "c": "x\\"}`, `{"a": "X", "b": "say \"x\"", "c": "x\\"}`},
+		{"unchanged escapes", `{"a": "é\/"}`, `{"a": "é\/"}`},
+		{"html", `{"a": "h"}`, `{"a": "<a & \"b\">"}`},
+		{"keys", `{"x": {"x": "x"}}`, `{"x": {"x": "X"}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rewritten, err := rewriteJSONStrings([]byte(test.data), func(field string, depth int, value string, key bool) string {
+				switch {
+				case key:
+					return value
+				case value == "x":
+					return "X"
+				case value == "h":
+					return `<a & "b">`
+				}
+				return value
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rewritten) != test.want {
+				t.Errorf("rewriteJSONStrings = %s, want %s", rewritten, test.want)
+			}
+		})
+	}
+	if _, err := rewriteJSONStrings([]byte(`{"a": `), func(string, int, string, bool) string { return "" }); err == nil {
+		t.Error("rewriteJSONStrings of invalid JSON succeeded")
+	}
+}
+
+func TestRewriteJSONStringsFields(t *testing.T) {
+	type visit struct {
+		field string
+		depth int
+		value string
+		key   bool
+	}
+	var visits []visit
+	rewriteJSONStrings([]byte(`{"a": ["b", {"c": "d"}], "e": "f"}`), func(field string, depth int, value string, key bool) string {
+		visits = append(visits, visit{field, depth, value, key})
+		return value
+	})
+	want := []visit{{"a", 1, "a", true}, {"a", 2, "b", false}, {"a", 3, "c", true}, {"a", 3, "d", false}, {"e", 1, "e", true}, {"e", 1, "f", false}}
+	if len(visits) != len(want) {
+		t.Fatalf("visits = %v, want %v", visits, want)
+	}
+	for i := range want {
+		if visits[i] != want[i] {
+			t.Errorf("visit %d = %v, want %v", i, visits[i], want[i])
+		}
+	}
+}
+
+func TestRelocateMixinConfig(t *testing.T) {
+	tests := []struct {
+		name, relocation, config, want string
+	}{
+		{
+			"package",
+			"com.a:shaded.com.a",
+			`{"required": true, "package": "com.a.mixin", "mixins": ["XMixin", "sub.YMixin"], "refmap": "a.refmap.json"}`,
+			`{"required": true, "package": "shaded.com.a.mixin", "mixins": ["XMixin", "sub.YMixin"], "refmap": "a.refmap.json"}`,
+		},
+		{
+			"plugin",
+			"com.a:shaded.com.a",
+			`{"package": "com.a.mixin", "plugin": "com.a.Plugin", "mixins": []}`,
+			`{"package": "shaded.com.a.mixin", "plugin": "shaded.com.a.Plugin", "mixins": []}`,
+		},
+		{
+			"plugin outside the package",
+			"com.a:shaded.com.a",
+			`{"package": "com.a.mixin", "plugin": "com.abc.Plugin", "mixins": []}`,
+			`{"package": "shaded.com.a.mixin", "plugin": "com.abc.Plugin", "mixins": []}`,
+		},
+		{
+			"client and server",
+			"com.a:shaded.com.a",
+			`{"package": "com.a.mixin", "client": ["ClientMixin"], "server": ["ServerMixin"]}`,
+			`{"package": "shaded.com.a.mixin", "client": ["ClientMixin"], "server": ["ServerMixin"]}`,
+		},
+		{
+			"mixins moved into another package",
+			"com.a.mixin.client:other.client",
+			`{"package": "com.a.mixin", "mixins": ["XMixin"], "client": ["client.ClientMixin"]}`,
+			`{"package": "com.a.mixin", "mixins": ["XMixin"], "client": ["client.ClientMixin"]}`,
+		},
+		{
+			"unrelated package",
+			"com.a:shaded.com.a",
+			`{"package": "com.abc.mixin", "mixins": ["XMixin"]}`,
+			`{"package": "com.abc.mixin", "mixins": ["XMixin"]}`,
+		},
+		{
+			"nested values",
+			"com.a:shaded.com.a",
+			`{"package": "com.a.mixin", "mixins": ["XMixin"], "injectors": {"defaultRequire": 1}, "overwrites": {"package": "com.a.x"}}`,
+			`{"package": "shaded.com.a.mixin", "mixins": ["XMixin"], "injectors": {"defaultRequire": 1}, "overwrites": {"package": "com.a.x"}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			relocator := &Relocator{Relocations: ParseRelocation(test.relocation)}
+			relocated, err := relocateMixinConfig([]byte(test.config), relocator.relocate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(relocated) != test.want {
+				t.Errorf("relocateMixinConfig = %s, want %s", relocated, test.want)
+			}
+		})
+	}
+}
+
+func TestReadMixinResources(t *testing.T) {
+	manifest := JarMemberFromString(ManifestName, "Manifest-Version: 1.0\r\nMixinConfigs: a.json, b.json\r\n\r\n")
+	fabric := JarMemberFromString("fabric.mod.json", `{"mixins": ["c.json", {"config": "d.json", "environment": "client"}]}`)
+	config := JarMemberFromString("a.json", `{"package": "com.a", "refmap": "a-map.json", "mixins": []}`)
+	named := JarMemberFromString("e.mixins.json", `{"package": "com.e", "refmap": "e-refmap.json", "mixins": []}`)
+	misnamed := JarMemberFromString("mixins.f.json", `{"mappings": {}}`)
+	nested := JarMemberFromString(ManifestName, "Manifest-Version: 1.0\r\nMixinConfigs: g.json\r\n\r\n")
+	nested.nestedIn = "META-INF/jars/inner.jar"
+
+	jars, err := readMixinResources([]*JarMember{&manifest, &fabric, &config, &named, &misnamed, &nested})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		jar, name, data string
+		kind            int
+	}{
+		{"", "a.json", `{}`, mixinConfig},
+		{"", "b.json", `{}`, mixinConfig},
+		{"", "c.json", `{}`, mixinConfig},
+		{"", "d.json", `{}`, mixinConfig},
+		{"", "e.mixins.json", `{}`, mixinConfig},
+		{"", "a-map.json", `{}`, mixinRefmap},
+		{"", "e-refmap.json", `{}`, mixinRefmap},
+		{"", "mixins.f.json", `{"mappings": {}}`, mixinRefmap},
+		{"", "g.json", `{"package": "com.g", "mixins": []}`, notMixin},
+		{"", "data/a/recipes/x.json", `{"package": "com.x", "mixins": []}`, notMixin},
+		{"", "assets/a/lang/en_us.json", `{"mappings": {}}`, notMixin},
+		{"", "other-refmap.json", `{"mappings": {}}`, mixinRefmap},
+		{"", "other-refmap.json", `{"other": {}}`, notMixin},
+		{"META-INF/jars/inner.jar", "g.json", `{}`, mixinConfig},
+		{"META-INF/jars/inner.jar", "a.json", `{}`, notMixin},
+	}
+	for _, test := range tests {
+		if kind := jars[test.jar].kind(test.name, []byte(test.data)); kind != test.kind {
+			t.Errorf("kind of %s in %q = %d, want %d", test.name, test.jar, kind, test.kind)
+		}
+	}
+}
+
+func TestRelocateJarMixins(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.jar")
+	writeTestZip(t, filename, []zipEntry{
+		{ManifestName, "Manifest-Version: 1.0\r\nMixinConfigs: a.json\r\n\r\n"},
+		{"a.json", `{"package": "com.a.mixin", "refmap": "a-map.json", "mixins": ["XMixin"]}`},
+		{"a-map.json", `{"mappings": {"com/a/mixin/XMixin": {"run": "Lcom/a/X;run()V"}}}`},
+		{"data/x.json", `{"package": "com.a", "mixins": [], "mappings": {"com/a/X": {}}}`},
+	})
+	if err := RelocateJar(filename, ParseRelocation("com.a:shaded.com.a")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		ManifestName:  "Manifest-Version: 1.0\r\nMixinConfigs: a.json\r\n\r\n",
+		"a.json":      `{"package": "shaded.com.a.mixin", "refmap": "a-map.json", "mixins": ["XMixin"]}`,
+		"a-map.json":  `{"mappings": {"shaded/com/a/mixin/XMixin": {"run": "Lshaded/com/a/X;run()V"}}}`,
+		"data/x.json": `{"package": "com.a", "mixins": [], "mappings": {"com/a/X": {}}}`,
+	}
+	entries := readTestZip(t, filename)
+	if len(entries) != len(want) {
+		t.Errorf("entries = %v", entries)
+	}
+	for _, entry := range entries {
+		if entry.data != want[entry.name] {
+			t.Errorf("%s = %s, want %s", entry.name, entry.data, want[entry.name])
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package babe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var ErrModuleExists = errors.New("jarhax: jar already has a module descriptor")
+
+// jdkModules lists the packages exported by the modules of the JDK. A name ending in ".*" stands for the package and
+// all of its subpackages, unless a subpackage is listed by itself.
+var jdkModules = map[string]string{
+	"java.base": "java.io java.lang java.lang.annotation java.lang.constant java.lang.foreign java.lang.invoke " +
+		"java.lang.module java.lang.ref java.lang.reflect java.lang.runtime java.math java.net java.net.spi java.nio.* " +
+		"java.security.* java.text java.text.spi java.time.* java.util java.util.concurrent.* java.util.function " +
+		"java.util.jar java.util.random java.util.regex java.util.spi java.util.stream java.util.zip javax.crypto.* " +
+		"javax.net.* javax.security.auth javax.security.auth.callback javax.security.auth.login javax.security.auth.spi " +
+		"javax.security.auth.x500 javax.security.cert",
+	"java.compiler":        "javax.annotation.processing javax.lang.model.* javax.tools",
+	"java.datatransfer":    "java.awt.datatransfer",
+	"java.desktop":         "java.applet java.awt.* java.beans.* javax.accessibility javax.imageio.* javax.print.* javax.sound.* javax.swing.*",
+	"java.instrument":      "java.lang.instrument",
+	"java.logging":         "java.util.logging",
+	"java.management":      "java.lang.management javax.management.*",
+	"java.management.rmi":  "javax.management.remote.rmi",
+	"java.naming":          "javax.naming.*",
+	"java.net.http":        "java.net.http",
+	"java.prefs":           "java.util.prefs",
+	"java.rmi":             "java.rmi.* javax.rmi.ssl",
+	"java.scripting":       "javax.script",
+	"java.security.jgss":   "javax.security.auth.kerberos org.ietf.jgss",
+	"java.security.sasl":   "javax.security.sasl",
+	"java.smartcardio":     "javax.smartcardio",
+	"java.sql":             "java.sql javax.sql",
+	"java.sql.rowset":      "javax.sql.rowset.*",
+	"java.transaction.xa":  "javax.transaction.xa",
+	"java.xml":             "javax.xml javax.xml.catalog javax.xml.datatype javax.xml.namespace javax.xml.parsers javax.xml.stream.* javax.xml.transform.* javax.xml.validation javax.xml.xpath org.w3c.dom org.w3c.dom.bootstrap org.w3c.dom.events org.w3c.dom.ls org.w3c.dom.ranges org.w3c.dom.traversal org.w3c.dom.views org.xml.sax.*",
+	"java.xml.crypto":      "javax.xml.crypto.*",
+	"jdk.httpserver":       "com.sun.net.httpserver.*",
+	"jdk.jfr":              "jdk.jfr.*",
+	"jdk.management":       "com.sun.management",
+	"jdk.net":              "jdk.net",
+	"jdk.unsupported":      "sun.misc sun.reflect",
+	"jdk.jdi":              "com.sun.jdi.*",
+	"jdk.attach":           "com.sun.tools.attach.*",
+	"jdk.compiler":         "com.sun.source.* com.sun.tools.javac",
+	"jdk.dynalink":         "jdk.dynalink.*",
+	"jdk.jsobject":         "netscape.javascript",
+	"jdk.security.auth":    "com.sun.security.auth.*",
+	"jdk.security.jgss":    "com.sun.security.jgss",
+	"jdk.accessibility":    "com.sun.java.accessibility.util",
+	"jdk.jshell":           "jdk.jshell.*",
+	"jdk.javadoc":          "jdk.javadoc.doclet",
+	"jdk.xml.dom":          "org.w3c.dom.css org.w3c.dom.html org.w3c.dom.stylesheets org.w3c.dom.xpath",
+	"jdk.sctp":             "com.sun.nio.sctp",
+	"jdk.nio.mapmode":      "jdk.nio.mapmode",
+	"jdk.incubator.vector": "jdk.incubator.vector",
+}
+
+// jdkPackages and jdkPackageTrees map the packages, and the roots of the package trees, of jdkModules to their module.
+var jdkPackages, jdkPackageTrees = func() (map[string]string, map[string]string) {
+	packages, trees := map[string]string{}, map[string]string{}
+	for module, list := range jdkModules {
+		for _, name := range strings.Fields(list) {
+			if root, ok := strings.CutSuffix(name, ".*"); ok {
+				trees[strings.ReplaceAll(root, ".", "/")] = module
+			} else {
+				packages[strings.ReplaceAll(name, ".", "/")] = module
+			}
+		}
+	}
+	return packages, trees
+}()
+
+// jdkModule returns the JDK module of a package, or "" if it isn't part of the JDK.
+func jdkModule(name string) string {
+	if module, ok := jdkPackages[name]; ok {
+		return module
+	}
+	for ; name != "."; name = path.Dir(name) {
+		if module, ok := jdkPackageTrees[name]; ok {
+			return module
+		}
+	}
+	return ""
+}
+
+var (
+	automaticVersion = regexp.MustCompile(`-\d+(\.|$).*`)
+	automaticInvalid = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// automaticModuleName derives the name of an automatic module from its jar file name, as the JDK does.
+func automaticModuleName(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), ".jar")
+	name = automaticVersion.ReplaceAllString(name, "")
+	return strings.Trim(automaticInvalid.ReplaceAllString(name, "."), ".")
+}
+
+// JarModule describes a jar as the JDK sees it on the module path.
+type JarModule struct {
+	Name string
+	// Automatic is set for jars without a module descriptor
+	Automatic bool
+	Packages  map[string]bool
+}
+
+// ReadJarModule reads the module name and packages of a jar: the name of its module descriptor, or for automatic
+// modules its Automatic-Module-Name, or a name derived from its file name.
+func ReadJarModule(filename string) (*JarModule, error) {
+	var lock sync.Mutex
+	var names []string
+	var descriptor, automatic string
+	err := ForJarMember(filename, func(member *JarMember) error {
+		lock.Lock()
+		names = append(names, member.Name)
+		lock.Unlock()
+
+		switch _, base := SplitVersionedName(member.Name); {
+		case base == ModuleInfoName+".class":
+			// Descriptors are often only found among the versioned entries, they all name the same module
+			class, err := member.GetAsClass()
+			if err != nil {
+				return err
+			}
+			if module := class.GetModule(); module != nil {
+				lock.Lock()
+				descriptor = module.Name
+				lock.Unlock()
+			}
+		case member.Name == ManifestName:
+			data, err := readMember(member)
+			if err != nil {
+				return err
+			}
+			manifest, err := ReadManifest(data)
+			if err != nil {
+				return err
+			}
+			automatic = manifest.Main.Get("Automatic-Module-Name")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	module := &JarModule{Name: descriptor, Packages: memberPackages(names)}
+	if descriptor == "" {
+		module.Name, module.Automatic = automatic, true
+	}
+	if module.Name == "" {
+		module.Name = automaticModuleName(filename)
+	}
+	return module, nil
+}
+
+// Modularizer generates a module descriptor for a jar without one. The module exports every package holding classes,
+// requires the JDK modules and modules of the module path it references, uses the services loaded through
+// ServiceLoader with a class literal, and provides the services listed in META-INF/services.
+type Modularizer struct {
+	// Name of the module, defaults to the Automatic-Module-Name of the jar or a name derived from its file name
+	Name       string
+	Version    string
+	ModulePath []*JarModule
+	// Override is merged into the generated module. Its requires, uses and provides are added, replacing those of
+	// the same module or service, while its exports and opens, if it has any, replace the generated ones.
+	Override *Module
+	// Unresolved lists the referenced packages found in neither the jar, the JDK nor the module path
+	Unresolved []string
+	module     *Module
+	packages   []string
+	main       string
+	// fallbackName is derived from the file name of the jar
+	fallbackName string
+}
+
+func (modularizer *Modularizer) Analyze(members []*JarMember) error {
+	module := &Module{Name: modularizer.Name, Version: modularizer.Version}
+	classPackages := map[string]bool{}
+	referenced := map[string]bool{}
+	uses := map[string]bool{}
+	classes := map[string]bool{}
+	var names []string
+
+	for _, member := range members {
+		names = append(names, member.Name)
+		_, base := SplitVersionedName(member.Name)
+		switch {
+		case base == ModuleInfoName+".class":
+			return ErrModuleExists
+		case member.Name == ManifestName:
+			data, err := readMember(member)
+			if err != nil {
+				return err
+			}
+			manifest, err := ReadManifest(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", member.Name, err)
+			}
+			if module.Name == "" {
+				module.Name = manifest.Main.Get("Automatic-Module-Name")
+			}
+			modularizer.main = strings.ReplaceAll(manifest.Main.Get("Main-Class"), ".", "/")
+		case strings.HasPrefix(member.Name, "META-INF/services/"):
+			service := strings.TrimPrefix(member.Name, "META-INF/services/")
+			if service == "" || strings.Contains(service, "/") {
+				continue
+			}
+			providers, err := readServices(member)
+			if err != nil {
+				return err
+			}
+			if len(providers) > 0 {
+				module.Provides = append(module.Provides, ModuleProvide{strings.ReplaceAll(service, ".", "/"), providers})
+			}
+		case strings.HasSuffix(base, ".class"):
+			class, err := member.GetAsClass()
+			if err != nil {
+				return fmt.Errorf("%s: %w", member.Name, err)
+			}
+			classes[class.GetClassName()] = true
+			classPackages[path.Dir(class.GetClassName())] = true
+			for _, reference := range typeReferences(class) {
+				referenced[path.Dir(reference)] = true
+			}
+			for _, service := range loadedServices(class) {
+				uses[service] = true
+			}
+		}
+	}
+	if module.Name == "" {
+		module.Name = modularizer.fallbackName
+	}
+	own := memberPackages(names)
+	modularizer.packages = sortedSet(own)
+
+	for _, name := range sortedSet(classPackages) {
+		if name != "." {
+			module.Exports = append(module.Exports, ModuleExport{Package: name})
+		}
+	}
+	module.Uses = sortedSet(uses)
+
+	requires := map[string]bool{"java.base": true}
+	for _, name := range sortedSet(referenced) {
+		if own[name] || name == "." {
+			continue
+		}
+		if required := modularizer.moduleOf(name); required != "" {
+			requires[required] = true
+		} else {
+			modularizer.Unresolved = append(modularizer.Unresolved, name)
+		}
+	}
+	delete(requires, module.Name)
+	module.Requires = append(module.Requires, ModuleRequire{Module: "java.base", Flags: ACC_MANDATED})
+	delete(requires, "java.base")
+	for _, name := range sortedSet(requires) {
+		module.Requires = append(module.Requires, ModuleRequire{Module: name})
+	}
+
+	if override := modularizer.Override; override != nil {
+		mergeModule(module, override, classes)
+	}
+	modularizer.module = module
+	return nil
+}
+
+// moduleOf returns the module of the module path or the JDK holding a package, or "". The module path comes first,
+// it may hold packages outside of the JDK's own, like javax/xml/bind.
+func (modularizer *Modularizer) moduleOf(name string) string {
+	for _, module := range modularizer.ModulePath {
+		if module.Packages[name] {
+			return module.Name
+		}
+	}
+	return jdkModule(name)
+}
+
+func sortedSet(set map[string]bool) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// mergeModule merges an override into a generated module. Class names from source are written with dots, so nested
+// classes are matched against the classes of the jar.
+func mergeModule(module *Module, override *Module, classes map[string]bool) {
+	className := func(name string) string {
+		for candidate := name; strings.Contains(candidate, "/"); {
+			if classes[candidate] {
+				return candidate
+			}
+			i := strings.LastIndexByte(candidate, '/')
+			candidate = candidate[:i] + "$" + candidate[i+1:]
+		}
+		return name
+	}
+
+	module.Name = override.Name
+	module.Flags |= override.Flags
+	if override.Version != "" {
+		module.Version = override.Version
+	}
+	for _, require := range override.Requires {
+		if i := slices.IndexFunc(module.Requires, func(r ModuleRequire) bool { return r.Module == require.Module }); i >= 0 {
+			module.Requires[i] = require
+		} else {
+			module.Requires = append(module.Requires, require)
+		}
+	}
+	if len(override.Exports) > 0 {
+		module.Exports = override.Exports
+	}
+	if len(override.Opens) > 0 {
+		module.Opens = override.Opens
+	}
+	for _, service := range override.Uses {
+		if service = className(service); !slices.Contains(module.Uses, service) {
+			module.Uses = append(module.Uses, service)
+		}
+	}
+	for _, provide := range override.Provides {
+		provide.Service = className(provide.Service)
+		for i, with := range provide.With {
+			provide.With[i] = className(with)
+		}
+		if i := slices.IndexFunc(module.Provides, func(p ModuleProvide) bool { return p.Service == provide.Service }); i >= 0 {
+			module.Provides[i] = provide
+		} else {
+			module.Provides = append(module.Provides, provide)
+		}
+	}
+}
+
+// typeReferences returns the classes a class refers to through its constant pool and the descriptors of its members.
+// Unlike ClassReferences, strings are not taken as references.
+func typeReferences(class *Class) []string {
+	var references []string
+	add := func(descriptor string) {
+		references = append(references, descriptorClassNames(descriptor)...)
+	}
+	for _, constant := range class.ConstantPool {
+		switch info := constant.(type) {
+		case *ClassInfo:
+			if name := class.GetUtf8(info.NameIndex); strings.HasPrefix(name, "[") {
+				add(name)
+			} else {
+				references = append(references, name)
+			}
+		case *NameAndTypeInfo:
+			add(class.GetUtf8(info.DescriptorIndex))
+		case *MethodTypeInfo:
+			add(class.GetUtf8(info.DescriptorIndex))
+		}
+	}
+	for _, field := range class.Fields {
+		add(field.GetDescriptor())
+	}
+	for i := range class.Methods {
+		add(class.Methods[i].GetDescriptor())
+	}
+	return references
+}
+
+// loadedServices returns the services a class loads by passing a class literal to ServiceLoader.
+func loadedServices(class *Class) []string {
+	var services []string
+	for i := range class.Methods {
+		code := class.Methods[i].GetCode()
+		if code == nil {
+			continue
+		}
+		literal := ""
+		ForInstruction(code.Code, func(offset int, opcode byte) error {
+			switch opcode {
+			case ALOAD, ALOAD_0, ALOAD_0 + 1, ALOAD_0 + 2, ALOAD_0 + 3, GETSTATIC, GETFIELD, CHECKCAST, INVOKEVIRTUAL,
+				INVOKEINTERFACE:
+				// The class loader argument may be loaded or computed between the literal and the call, these
+				// leave the literal below them on the stack
+				return nil
+			case LDC, LDC_W:
+				index := uint16(code.Code[offset+1])
+				if opcode == LDC_W {
+					index = binary.BigEndian.Uint16(code.Code[offset+1:])
+				}
+				literal = ""
+				if info, ok := class.GetConstant(index).(*ClassInfo); ok {
+					literal = class.GetUtf8(info.NameIndex)
+				}
+				return nil
+			case INVOKESTATIC:
+				owner, name, descriptor := class.GetRef(binary.BigEndian.Uint16(code.Code[offset+1:]))
+				if owner == "java/util/ServiceLoader" && strings.HasPrefix(name, "load") && literal != "" {
+					services = append(services, literal)
+				} else if strings.HasPrefix(descriptor, "()") {
+					// Calls without arguments, like Thread.currentThread(), don't consume the literal
+					return nil
+				}
+			}
+			literal = ""
+			return nil
+		})
+	}
+	return services
+}
+
+// Generate returns the module descriptor, which targets Java 9 so the jar still loads as a plain jar on Java 8.
+func (modularizer *Modularizer) Generate() ([]JarMember, error) {
+	class, err := NewClassBuilder(ModuleInfoName).Version(JAVA_9).Access(ACC_MODULE).Extends("").Build()
+	if err != nil {
+		return nil, err
+	}
+	class.SetModule(modularizer.module)
+	class.SetModulePackages(modularizer.packages)
+	if modularizer.main != "" {
+		class.SetModuleMainClass(modularizer.main)
+	}
+	return []JarMember{JarMemberFromClass(class)}, nil
+}
+
+// ModularizeJar adds a module descriptor generated by modularizer to a jar.
+func ModularizeJar(filename string, modularizer *Modularizer) error {
+	modularizer.fallbackName = automaticModuleName(filename)
+	return NewPipeline(modularizer).Run(filename)
+}
+
+// LoadModuleOverride reads an override for Modularizer from a module-info.java file.
+func LoadModuleOverride(filename string) (*Module, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	module, err := ParseModuleSource(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return module, nil
+}
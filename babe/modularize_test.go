@@ -0,0 +1,101 @@
+package babe
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestJdkModule(t *testing.T) {
+	tests := []struct {
+		name   string
+		module string
+	}{
+		{"java/lang", "java.base"},
+		{"java/util/concurrent/atomic", "java.base"},
+		{"java/awt/datatransfer", "java.datatransfer"},
+		{"java/awt/image", "java.desktop"},
+		{"javax/management/remote/rmi", "java.management.rmi"},
+		{"javax/management/openmbean", "java.management"},
+		{"javax/sql/rowset/serial", "java.sql.rowset"},
+		{"javax/xml/parsers", "java.xml"},
+		{"org/w3c/dom/css", "jdk.xml.dom"},
+		{"javax/xml/bind", ""},
+		{"javax/xml/ws", ""},
+		{"javax/xml/soap", ""},
+		{"javax/security/auth/message", ""},
+		{"javax/annotation", ""},
+		{"com/google/common", ""},
+	}
+	for _, test := range tests {
+		if module := jdkModule(test.name); module != test.module {
+			t.Errorf("jdkModule(%q) = %q, want %q", test.name, module, test.module)
+		}
+	}
+}
+
+func TestModuleOfPrefersModulePath(t *testing.T) {
+	modularizer := &Modularizer{ModulePath: []*JarModule{
+		{Name: "java.xml.bind", Packages: map[string]bool{"javax/xml/bind": true}},
+		{Name: "shadow.xml", Packages: map[string]bool{"javax/xml/parsers": true}},
+	}}
+	tests := map[string]string{
+		"javax/xml/bind":    "java.xml.bind",
+		"javax/xml/parsers": "shadow.xml",
+		"java/lang":         "java.base",
+		"javax/xml/ws":      "",
+	}
+	for name, want := range tests {
+		if module := modularizer.moduleOf(name); module != want {
+			t.Errorf("moduleOf(%q) = %q, want %q", name, module, want)
+		}
+	}
+}
+
+func TestLoadedServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     func(code *CodeBuilder)
+		services []string
+	}{
+		{"load", func(code *CodeBuilder) {
+			code.Push(ClassConstantOf("a/Service"))
+			code.InvokeStatic("java/util/ServiceLoader", "load", "(Ljava/lang/Class;)Ljava/util/ServiceLoader;")
+		}, []string{"a/Service"}},
+		{"context class loader", func(code *CodeBuilder) {
+			code.Push(ClassConstantOf("a/Service"))
+			code.InvokeStatic("java/lang/Thread", "currentThread", "()Ljava/lang/Thread;")
+			code.InvokeVirtual("java/lang/Thread", "getContextClassLoader", "()Ljava/lang/ClassLoader;")
+			code.InvokeStatic("java/util/ServiceLoader", "load", "(Ljava/lang/Class;Ljava/lang/ClassLoader;)Ljava/util/ServiceLoader;")
+		}, []string{"a/Service"}},
+		{"own class loader", func(code *CodeBuilder) {
+			code.Push(ClassConstantOf("a/Service"))
+			code.Push(ClassConstantOf("a/Service"))
+			code.InvokeVirtual("java/lang/Class", "getClassLoader", "()Ljava/lang/ClassLoader;")
+			code.InvokeStatic("java/util/ServiceLoader", "load", "(Ljava/lang/Class;Ljava/lang/ClassLoader;)Ljava/util/ServiceLoader;")
+		}, []string{"a/Service"}},
+		{"consumed literal", func(code *CodeBuilder) {
+			code.Push(ClassConstantOf("a/Service"))
+			code.InvokeStatic("a/Util", "wrap", "(Ljava/lang/Class;)Ljava/lang/Class;")
+			code.InvokeStatic("java/util/ServiceLoader", "load", "(Ljava/lang/Class;)Ljava/util/ServiceLoader;")
+		}, nil},
+		{"string", func(code *CodeBuilder) {
+			code.Push("a/Service")
+			code.InvokeStatic("java/util/ServiceLoader", "load", "(Ljava/lang/Class;)Ljava/util/ServiceLoader;")
+		}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class, err := NewClassBuilder("a/Main").Method(ACC_PUBLIC|ACC_STATIC, "main", "()V", func(code *CodeBuilder) {
+				test.body(code)
+				code.VisitInsn(POP)
+				code.Return()
+			}).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if services := loadedServices(class); !slices.Equal(services, test.services) {
+				t.Errorf("loadedServices = %v, want %v", services, test.services)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package babe
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/mrnavastar/assist/bytes"
+)
+
+// ModuleInfoName is the class name of module descriptors.
+const ModuleInfoName = "module-info"
+
+type ModuleRequire struct {
+	Module  string
+	Flags   uint16
+	Version string
+}
+
+// ModuleExport is an exports or opens directive. To lists the modules it is qualified to, and is empty for
+// unqualified directives.
+type ModuleExport struct {
+	Package string
+	Flags   uint16
+	To      []string
+}
+
+type ModuleProvide struct {
+	Service string
+	With    []string
+}
+
+// Module is the decoded Module attribute of a module descriptor. Packages and classes use internal names.
+type Module struct {
+	Name     string
+	Flags    uint16
+	Version  string
+	Requires []ModuleRequire
+	Exports  []ModuleExport
+	Opens    []ModuleExport
+	Uses     []string
+	Provides []ModuleProvide
+}
+
+// IsModuleInfo reports whether the class is a module descriptor.
+func (class *Class) IsModuleInfo() bool {
+	return class.HasModifier(ACC_MODULE)
+}
+
+func (class *Class) readClassList(buf *bytes.Buffer) []string {
+	names := make([]string, buf.ReadU16())
+	for i := range names {
+		names[i] = class.GetClassInfoName(buf.ReadU16())
+	}
+	return names
+}
+
+func (class *Class) readExports(buf *bytes.Buffer) []ModuleExport {
+	exports := make([]ModuleExport, buf.ReadU16())
+	for i := range exports {
+		exports[i] = ModuleExport{Package: class.GetClassInfoName(buf.ReadU16()), Flags: buf.ReadU16()}
+		exports[i].To = class.readClassList(buf)
+	}
+	return exports
+}
+
+// GetModule decodes the Module attribute of the class, returning nil if it has none.
+func (class *Class) GetModule() *Module {
+	attribute := class.FindAttribute(class.Attributes, "Module")
+	if attribute == nil {
+		return nil
+	}
+	buf := &bytes.Buffer{Data: &attribute.Data, Index: 0}
+	module := &Module{Name: class.GetClassInfoName(buf.ReadU16()), Flags: buf.ReadU16(), Version: class.GetUtf8(buf.ReadU16())}
+	module.Requires = make([]ModuleRequire, buf.ReadU16())
+	for i := range module.Requires {
+		module.Requires[i] = ModuleRequire{class.GetClassInfoName(buf.ReadU16()), buf.ReadU16(), class.GetUtf8(buf.ReadU16())}
+	}
+	module.Exports = class.readExports(buf)
+	module.Opens = class.readExports(buf)
+	module.Uses = class.readClassList(buf)
+	module.Provides = make([]ModuleProvide, buf.ReadU16())
+	for i := range module.Provides {
+		module.Provides[i] = ModuleProvide{Service: class.GetClassInfoName(buf.ReadU16())}
+		module.Provides[i].With = class.readClassList(buf)
+	}
+	return module
+}
+
+func (class *Class) addUtf8OrZero(value string) uint16 {
+	if value == "" {
+		return 0
+	}
+	return class.AddUtf8(value)
+}
+
+func writeIndexes(buf *bytes.Buffer, names []string, add func(string) uint16) {
+	buf.WriteU16(uint16(len(names)))
+	for _, name := range names {
+		buf.WriteU16(add(name))
+	}
+}
+
+func (class *Class) writeExports(buf *bytes.Buffer, exports []ModuleExport) {
+	buf.WriteU16(uint16(len(exports)))
+	for _, export := range exports {
+		buf.WriteU16(class.AddPackage(export.Package))
+		buf.WriteU16(export.Flags)
+		writeIndexes(buf, export.To, class.AddModule)
+	}
+}
+
+// SetModule replaces the Module attribute of the class, adding one if it has none.
+func (class *Class) SetModule(module *Module) {
+	data := []byte{}
+	buf := &bytes.Buffer{Data: &data, Index: 0}
+	buf.WriteU16(class.AddModule(module.Name))
+	buf.WriteU16(module.Flags)
+	buf.WriteU16(class.addUtf8OrZero(module.Version))
+	buf.WriteU16(uint16(len(module.Requires)))
+	for _, require := range module.Requires {
+		buf.WriteU16(class.AddModule(require.Module))
+		buf.WriteU16(require.Flags)
+		buf.WriteU16(class.addUtf8OrZero(require.Version))
+	}
+	class.writeExports(buf, module.Exports)
+	class.writeExports(buf, module.Opens)
+	writeIndexes(buf, module.Uses, class.AddClass)
+	buf.WriteU16(uint16(len(module.Provides)))
+	for _, provide := range module.Provides {
+		buf.WriteU16(class.AddClass(provide.Service))
+		writeIndexes(buf, provide.With, class.AddClass)
+	}
+	class.setAttribute("Module", data)
+}
+
+// GetModulePackages returns the packages listed by the ModulePackages attribute of the class.
+func (class *Class) GetModulePackages() []string {
+	attribute := class.FindAttribute(class.Attributes, "ModulePackages")
+	if attribute == nil {
+		return nil
+	}
+	return class.readClassList(&bytes.Buffer{Data: &attribute.Data, Index: 0})
+}
+
+// SetModulePackages replaces the ModulePackages attribute of the class, adding one if it has none.
+func (class *Class) SetModulePackages(packages []string) {
+	data := []byte{}
+	writeIndexes(&bytes.Buffer{Data: &data, Index: 0}, packages, class.AddPackage)
+	class.setAttribute("ModulePackages", data)
+}
+
+// GetModuleMainClass returns the class named by the ModuleMainClass attribute of the class, or "".
+func (class *Class) GetModuleMainClass() string {
+	attribute := class.FindAttribute(class.Attributes, "ModuleMainClass")
+	if attribute == nil || len(attribute.Data) < 2 {
+		return ""
+	}
+	return class.GetClassInfoName(uint16(u16(attribute.Data, 0)))
+}
+
+// SetModuleMainClass replaces the ModuleMainClass attribute of the class, removing it for "".
+func (class *Class) SetModuleMainClass(name string) {
+	if name == "" {
+		class.Attributes = class.RemoveAttribute(class.Attributes, "ModuleMainClass")
+		class.AttributesCount = uint16(len(class.Attributes))
+		return
+	}
+	data := []byte{}
+	(&bytes.Buffer{Data: &data, Index: 0}).WriteU16(class.AddClass(name))
+	class.setAttribute("ModuleMainClass", data)
+}
+
+func (class *Class) setAttribute(name string, data []byte) {
+	class.Attributes = class.SetAttribute(class.Attributes, name, data)
+	class.AttributesCount = uint16(len(class.Attributes))
+}
+
+// memberPackages returns the packages of a jar with the given member names, the way the jar tool computes
+// ModulePackages: every directory holding a class or resource, outside of META-INF, whose name is a legal package
+// name. Directory entries hold nothing themselves. Versioned entries count towards the package they override.
+func memberPackages(names []string) map[string]bool {
+	packages := map[string]bool{}
+	for _, name := range names {
+		_, name = SplitVersionedName(name)
+		if strings.HasPrefix(name, "META-INF/") || strings.HasSuffix(name, "/") || path.Base(name) == ModuleInfoName+".class" {
+			continue
+		}
+		if i := strings.LastIndexByte(name, '/'); i > 0 && isPackageName(name[:i]) {
+			packages[name[:i]] = true
+		}
+	}
+	return packages
+}
+
+var javaKeywords = map[string]bool{
+	"abstract": true, "assert": true, "boolean": true, "break": true, "byte": true, "case": true, "catch": true,
+	"char": true, "class": true, "const": true, "continue": true, "default": true, "do": true, "double": true,
+	"else": true, "enum": true, "extends": true, "final": true, "finally": true, "float": true, "for": true,
+	"goto": true, "if": true, "implements": true, "import": true, "instanceof": true, "int": true,
+	"interface": true, "long": true, "native": true, "new": true, "package": true, "private": true,
+	"protected": true, "public": true, "return": true, "short": true, "static": true, "strictfp": true,
+	"super": true, "switch": true, "synchronized": true, "this": true, "throw": true, "throws": true,
+	"transient": true, "try": true, "void": true, "volatile": true, "while": true, "true": true, "false": true,
+	"null": true, "_": true,
+}
+
+// isPackageName reports whether a directory is a legal package name, made of Java identifiers other than keywords.
+func isPackageName(dir string) bool {
+	for _, part := range strings.Split(dir, "/") {
+		if part == "" || javaKeywords[part] {
+			return false
+		}
+		for i, r := range part {
+			letter := r == '_' || r == '$' || unicode.IsLetter(r)
+			if !letter && (i == 0 || !unicode.IsDigit(r)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// scopedPackages returns the packages of every jar, keyed by the nested jar holding them as NestedIn names it, given
+// the member names as NameAnalyzer gets them. mapName, if not nil, maps the member names first.
+func scopedPackages(names []string, mapName func(string) string) map[string]map[string]bool {
+	scoped := map[string][]string{}
+	for _, name := range names {
+		jar, name := splitScopedName(name)
+		if mapName != nil {
+			name = mapName(name)
+		}
+		scoped[jar] = append(scoped[jar], name)
+	}
+	packages := map[string]map[string]bool{}
+	for jar, names := range scoped {
+		packages[jar] = memberPackages(names)
+	}
+	return packages
+}
+
+// mapModule maps the packages and classes named by a module descriptor. The main class and the classes used and
+// provided are mapped by mapClass, exported, opened and listed packages by mapPackage.
+func mapModule(class *Class, mapPackage func(string) string, mapClass func(string) string) bool {
+	mapNames := func(names []string, mapper func(string) string) bool {
+		changed := false
+		for i, name := range names {
+			if mapped := mapper(name); mapped != name {
+				names[i], changed = mapped, true
+			}
+		}
+		return changed
+	}
+
+	changed := false
+	if module := class.GetModule(); module != nil {
+		moduleChanged := mapNames(module.Uses, mapClass)
+		for _, exports := range [][]ModuleExport{module.Exports, module.Opens} {
+			for i := range exports {
+				if mapped := mapPackage(exports[i].Package); mapped != exports[i].Package {
+					exports[i].Package, moduleChanged = mapped, true
+				}
+			}
+		}
+		for i := range module.Provides {
+			provide := &module.Provides[i]
+			moduleChanged = mapNames(provide.With, mapClass) || moduleChanged
+			if mapped := mapClass(provide.Service); mapped != provide.Service {
+				provide.Service, moduleChanged = mapped, true
+			}
+		}
+		if moduleChanged {
+			class.SetModule(module)
+			changed = true
+		}
+	}
+
+	if packages := class.GetModulePackages(); mapNames(packages, mapPackage) {
+		class.SetModulePackages(packages)
+		changed = true
+	}
+	if main := class.GetModuleMainClass(); main != "" && mapClass(main) != main {
+		class.SetModuleMainClass(mapClass(main))
+		changed = true
+	}
+	return changed
+}
+
+// syncModulePackages makes a module descriptor list the packages of the jar, dropping the exports and opens of
+// packages the jar no longer has, which would fail to load.
+func syncModulePackages(class *Class, packages map[string]bool) bool {
+	changed := false
+	if module := class.GetModule(); module != nil {
+		missing := func(export ModuleExport) bool { return !packages[export.Package] }
+		exports, opens := len(module.Exports), len(module.Opens)
+		module.Exports = slices.DeleteFunc(module.Exports, missing)
+		module.Opens = slices.DeleteFunc(module.Opens, missing)
+		if len(module.Exports) != exports || len(module.Opens) != opens {
+			class.SetModule(module)
+			changed = true
+		}
+	}
+
+	listed := class.GetModulePackages()
+	if listed == nil {
+		return changed
+	}
+	sorted := make([]string, 0, len(packages))
+	for name := range packages {
+		sorted = append(sorted, name)
+	}
+	slices.Sort(sorted)
+	slices.Sort(listed)
+	if !slices.Equal(sorted, listed) {
+		class.SetModulePackages(sorted)
+		changed = true
+	}
+	return changed
+}
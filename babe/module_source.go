@@ -0,0 +1,187 @@
+package babe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidModuleSource = errors.New("jarhax: invalid module declaration")
+
+// moduleTokens splits a module declaration into identifiers, which may be qualified, and the symbols { } ; , @,
+// dropping comments.
+func moduleTokens(source string) []string {
+	var tokens []string
+	for i := 0; i < len(source); {
+		switch c := rune(source[i]); {
+		case strings.HasPrefix(source[i:], "//"):
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return append(tokens, source[i:])
+			}
+			i += end + 4
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("{};,@()", c):
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			start := i
+			for i < len(source) && !unicode.IsSpace(rune(source[i])) && !strings.ContainsRune("{};,@()/", rune(source[i])) {
+				i++
+			}
+			if i == start {
+				i++
+			}
+			tokens = append(tokens, source[start:i])
+		}
+	}
+	return tokens
+}
+
+// ParseModuleSource parses a module-info.java declaration. Imports and annotations are skipped, and packages and
+// classes are returned as internal names.
+func ParseModuleSource(source string) (*Module, error) {
+	tokens := moduleTokens(source)
+	position := 0
+	next := func() string {
+		if position >= len(tokens) {
+			return ""
+		}
+		position++
+		return tokens[position-1]
+	}
+	peek := func() string {
+		if position >= len(tokens) {
+			return ""
+		}
+		return tokens[position]
+	}
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidModuleSource, fmt.Sprintf(format, args...))
+	}
+	// names reads a comma separated list of names ending in a semicolon
+	names := func(internal bool) ([]string, error) {
+		var list []string
+		for {
+			name := next()
+			if name == "" || strings.ContainsAny(name, "{};,") {
+				return nil, invalid("expected a name, got %q", name)
+			}
+			if internal {
+				name = strings.ReplaceAll(name, ".", "/")
+			}
+			list = append(list, name)
+			if separator := next(); separator == ";" {
+				return list, nil
+			} else if separator != "," {
+				return nil, invalid("expected , or ;, got %q", separator)
+			}
+		}
+	}
+	skipAnnotation := func() {
+		next()
+		if peek() == "(" {
+			for depth := 0; position < len(tokens); {
+				switch next() {
+				case "(":
+					depth++
+				case ")":
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+		}
+	}
+
+	module := &Module{}
+	for token := next(); token != "module"; token = next() {
+		switch token {
+		case "import":
+			for next() != ";" && position < len(tokens) {
+			}
+		case "@":
+			skipAnnotation()
+		case "open":
+			module.Flags |= ACC_OPEN
+		case "":
+			return nil, invalid("no module declaration")
+		default:
+			return nil, invalid("unexpected %q", token)
+		}
+	}
+	if module.Name = next(); module.Name == "" || next() != "{" {
+		return nil, invalid("expected the module name and {")
+	}
+
+	for {
+		directive := next()
+		switch directive {
+		case "}":
+			return module, nil
+		case "requires":
+			require := ModuleRequire{}
+			for modifier := peek(); modifier == "transitive" || modifier == "static"; modifier = peek() {
+				// A module may be named transitive, which is only a modifier if a name follows
+				if position+1 < len(tokens) && tokens[position+1] == ";" {
+					break
+				}
+				if next() == "transitive" {
+					require.Flags |= ACC_TRANSITIVE
+				} else {
+					require.Flags |= ACC_STATIC_PHASE
+				}
+			}
+			list, err := names(false)
+			if err != nil || len(list) != 1 {
+				return nil, invalid("requires takes a single module")
+			}
+			require.Module = list[0]
+			module.Requires = append(module.Requires, require)
+		case "exports", "opens":
+			export := ModuleExport{Package: strings.ReplaceAll(next(), ".", "/")}
+			if separator := next(); separator == "to" {
+				to, err := names(false)
+				if err != nil {
+					return nil, err
+				}
+				export.To = to
+			} else if separator != ";" {
+				return nil, invalid("expected to or ;, got %q", separator)
+			}
+			if directive == "exports" {
+				module.Exports = append(module.Exports, export)
+			} else {
+				module.Opens = append(module.Opens, export)
+			}
+		case "uses":
+			list, err := names(true)
+			if err != nil || len(list) != 1 {
+				return nil, invalid("uses takes a single service")
+			}
+			module.Uses = append(module.Uses, list[0])
+		case "provides":
+			provide := ModuleProvide{Service: strings.ReplaceAll(next(), ".", "/")}
+			if with := next(); with != "with" {
+				return nil, invalid("expected with, got %q", with)
+			}
+			with, err := names(true)
+			if err != nil {
+				return nil, err
+			}
+			provide.With = with
+			module.Provides = append(module.Provides, provide)
+		case "@":
+			skipAnnotation()
+		default:
+			return nil, invalid("unexpected %q", directive)
+		}
+	}
+}
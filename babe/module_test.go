@@ -0,0 +1,28 @@
+package babe
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMemberPackages(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		packages []string
+	}{
+		{"classes and resources", []string{"a/A.class", "a/b/data.txt", "Main.class"}, []string{"a", "a/b"}},
+		{"directory entries", []string{"com/", "com/foo/", "com/foo/bar/", "com/foo/bar/A.class"}, []string{"com/foo/bar"}},
+		{"meta-inf and descriptors", []string{"META-INF/MANIFEST.MF", "META-INF/services/a.Service", "module-info.class", "META-INF/versions/9/module-info.class"}, nil},
+		{"versioned entries", []string{"META-INF/versions/11/a/v/A.class"}, []string{"a/v"}},
+		{"illegal package names", []string{"1a/A.class", "a-b/x.txt", "a/class/A.class", "a//A.class", "_/A.class"}, nil},
+		{"identifiers", []string{"$a/_b/c1/A.class", "ünï/A.class"}, []string{"$a/_b/c1", "ünï"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if packages := sortedSet(memberPackages(test.names)); !slices.Equal(packages, test.packages) {
+				t.Errorf("memberPackages = %v, want %v", packages, test.packages)
+			}
+		})
+	}
+}
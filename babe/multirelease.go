@@ -0,0 +1,90 @@
+package babe
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VersionsPrefix is the directory holding the versioned entries of a multi-release jar.
+const VersionsPrefix = "META-INF/versions/"
+
+// IsMultiRelease reports whether a manifest marks its jar as multi-release.
+func IsMultiRelease(manifest *Manifest) bool {
+	return strings.EqualFold(manifest.Main.Get("Multi-Release"), "true")
+}
+
+// SplitVersionedName splits the name of a versioned entry into its Java version and the name it overrides.
+// Other names are returned with version 0, including versions below 9, which the JVM ignores.
+func SplitVersionedName(name string) (int, string) {
+	rest, ok := strings.CutPrefix(name, VersionsPrefix)
+	if !ok {
+		return 0, name
+	}
+	number, base, ok := strings.Cut(rest, "/")
+	version, err := strconv.Atoi(number)
+	if !ok || err != nil || version < 9 || base == "" {
+		return 0, name
+	}
+	return version, base
+}
+
+// VersionedName returns the name of the entry overriding name for a Java version, or name for version 0.
+func VersionedName(version int, name string) string {
+	if version == 0 {
+		return name
+	}
+	return VersionsPrefix + strconv.Itoa(version) + "/" + name
+}
+
+// mapVersionedName maps the name of an entry, keeping the versioned prefix of multi-release entries.
+func mapVersionedName(name string, mapName func(string) string) string {
+	version, base := SplitVersionedName(name)
+	return VersionedName(version, mapName(base))
+}
+
+// ClassVariants is a class of a multi-release jar along with the variants overriding it on newer Java versions.
+type ClassVariants struct {
+	Name string
+	// Base is nil for classes that only exist for some versions
+	Base     *JarMember
+	Versions map[int]*JarMember
+}
+
+// Variant returns the member the JVM loads for a Java version, or nil if the class doesn't exist on it.
+func (variants *ClassVariants) Variant(version int) *JarMember {
+	best, member := 0, variants.Base
+	for candidate, variant := range variants.Versions {
+		if candidate <= version && candidate > best {
+			best, member = candidate, variant
+		}
+	}
+	return member
+}
+
+// MultiReleaseClasses groups the class members of a jar by class name, along with their versioned variants.
+func MultiReleaseClasses(members []*JarMember) map[string]*ClassVariants {
+	classes := map[string]*ClassVariants{}
+	for _, member := range members {
+		version, base := SplitVersionedName(member.Name)
+		name, ok := strings.CutSuffix(base, ".class")
+		if !ok {
+			continue
+		}
+		variants := classes[name]
+		if variants == nil {
+			variants = &ClassVariants{Name: name, Versions: map[int]*JarMember{}}
+			classes[name] = variants
+		}
+		if version == 0 {
+			variants.Base = member
+		} else {
+			variants.Versions[version] = member
+		}
+	}
+	return classes
+}
+
+// javaVersion returns the Java version of a class file major version.
+func javaVersion(major int) int {
+	return major - JAVA_1 + 1
+}
@@ -0,0 +1,383 @@
+package babe
+
+import (
+	"archive/zip"
+	stdbytes "bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mrnavastar/assist/bytes"
+	fss "github.com/mrnavastar/assist/fs"
+)
+
+var ErrUnsafeMemberName = errors.New("jarhax: member name escapes the output directory")
+
+// nestedJar is a jar stored as a member of another jar, with its members read for processing.
+type nestedJar struct {
+	member  *JarMember
+	members []*JarMember
+}
+
+func isNestedJar(name string) bool {
+	return strings.HasSuffix(name, ".jar")
+}
+
+// expandNestedJars reads the members of every jar nested in members, recursively. It returns the members along
+// with those of the nested jars, which know the jar they are nested in, and the nested jars innermost first, so they
+// can be written back in order.
+func expandNestedJars(ctx context.Context, members []*JarMember, options JarOptions) ([]*JarMember, []*nestedJar, error) {
+	all := slices.Clone(members)
+	var nested []*nestedJar
+	for _, member := range members {
+		if !isNestedJar(member.Name) {
+			continue
+		}
+		if err := member.Load(); err != nil {
+			return nil, nil, err
+		}
+		data := *member.Buffer.Data
+		reader, err := zip.NewReader(stdbytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", member.Name, err)
+		}
+		inner, err := readMembers(ctx, reader, options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", member.Name, err)
+		}
+		for _, innerMember := range inner {
+			innerMember.nestedIn = member.scopedName()
+		}
+		innerAll, innerNested, err := expandNestedJars(ctx, inner, options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", member.Name, err)
+		}
+		all = append(all, innerAll...)
+		nested = append(nested, innerNested...)
+		nested = append(nested, &nestedJar{member, inner})
+	}
+	return all, nested, nil
+}
+
+// write replaces the content of the nested jar member with its processed members. Spring Boot only loads nested jars
+// that are stored without compression.
+func (nested *nestedJar) write() error {
+	var buffer stdbytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, member := range nested.members {
+		if member.delete {
+			continue
+		}
+		if err := writeMember(writer, member); err != nil {
+			return fmt.Errorf("%s: %w", nested.member.Name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	data := buffer.Bytes()
+	nested.member.Buffer = &bytes.Buffer{Data: &data, Index: 0}
+	nested.member.stored = nested.member.stored || strings.HasPrefix(nested.member.Name, "BOOT-INF/lib/") || strings.HasPrefix(nested.member.Name, "WEB-INF/lib/")
+	return nil
+}
+
+// ExtractNestedJars copies the jars nested in a jar into dir, keeping their paths, and returns their names. When
+// remove is set they are also removed from the jar. Jars nested in the extracted jars are left inside them.
+func ExtractNestedJars(filename string, dir string, remove bool) ([]string, error) {
+	iterate := ForJarMember
+	if remove {
+		iterate = ModifyJar
+	}
+
+	var lock sync.Mutex
+	var extracted []string
+	err := iterate(filename, func(member *JarMember) error {
+		if !isNestedJar(member.Name) {
+			return nil
+		}
+		if !filepath.IsLocal(member.Name) {
+			return fmt.Errorf("%w: %s", ErrUnsafeMemberName, member.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(member.Name))
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		if err := copyMember(member, target); err != nil {
+			return err
+		}
+
+		lock.Lock()
+		extracted = append(extracted, member.Name)
+		lock.Unlock()
+		if remove {
+			member.Delete()
+		}
+		return nil
+	})
+	slices.Sort(extracted)
+	return extracted, err
+}
+
+func copyMember(member *JarMember, target string) error {
+	r, err := member.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// JarJarMetadataName is the file listing the jars Forge's JarJar loads from a mod.
+const JarJarMetadataName = "META-INF/jarjar/metadata.json"
+
+// EmbedJars stores jars in dir inside a jar, replacing nested jars of the same name. When the jar has a
+// fabric.mod.json the embedded jars are added to its jars so Fabric loads them, and when it has JarJar metadata, or
+// the jars are embedded in META-INF/jarjar, they are listed in the metadata so Forge loads them.
+func EmbedJars(filename string, dir string, jars ...string) error {
+	if !fss.Exists(filename) {
+		return fmt.Errorf("%s does not exist", filename)
+	}
+	embedded := map[string]bool{}
+	var names []string
+	var members []JarMember
+	for _, jar := range jars {
+		member, err := JarMemberFromFile(jar)
+		if err != nil {
+			return err
+		}
+		member.Name = path.Join(dir, filepath.Base(jar))
+		member.stored = true
+		embedded[member.Name] = true
+		names = append(names, member.Name)
+		members = append(members, member)
+	}
+
+	output := filename + "-modified.zip"
+	jar := CreateJar(output)
+	jar.Task(func(jar *Jar) error {
+		var jarJar atomic.Bool
+		err := ForJarMemberWithOptions(jar.Context(), filename, jar.Options(), func(member *JarMember) error {
+			if embedded[member.Name] {
+				return nil
+			}
+			switch member.Name {
+			case "fabric.mod.json":
+				if err := addFabricJars(member, names); err != nil {
+					return err
+				}
+			case JarJarMetadataName:
+				jarJar.Store(true)
+				if err := addJarJarJars(member, members); err != nil {
+					return err
+				}
+			}
+			return jar.Add(*member)
+		})
+		if err != nil {
+			return err
+		}
+		if !jarJar.Load() && strings.HasPrefix(path.Clean(dir)+"/", path.Dir(JarJarMetadataName)+"/") {
+			metadata := JarMemberFromString(JarJarMetadataName, `{"jars": []}`)
+			if err := addJarJarJars(&metadata, members); err != nil {
+				return err
+			}
+			if err := jar.Add(metadata); err != nil {
+				return err
+			}
+		}
+		for _, member := range members {
+			if err := jar.Add(member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err := jar.Wait(); err != nil {
+		os.Remove(output)
+		return err
+	}
+	return os.Rename(output, filename)
+}
+
+// addFabricJars adds nested jars missing from the jars of a fabric.mod.json, editing the file in place so
+// its formatting is kept.
+func addFabricJars(member *JarMember, jars []string) error {
+	if err := member.Load(); err != nil {
+		return err
+	}
+	data := *member.Buffer.Data
+	var mod struct{ Jars []struct{ File string } }
+	if err := json.Unmarshal(data, &mod); err != nil {
+		return fmt.Errorf("%s: %w", member.Name, err)
+	}
+	var entries []string
+	for _, jar := range jars {
+		if !slices.ContainsFunc(mod.Jars, func(existing struct{ File string }) bool { return existing.File == jar }) {
+			file, _ := json.Marshal(jar)
+			entries = append(entries, fmt.Sprintf(`{"file": %s}`, file))
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	start, end, err := topLevelValue(data, "jars")
+	if err != nil {
+		return fmt.Errorf("%s: %w", member.Name, err)
+	}
+	var edited []byte
+	if start < 0 {
+		// Without a jars array one is added as the first field, indented like the field it precedes
+		start = stdbytes.IndexByte(data, '{') + 1
+		rest := stdbytes.TrimLeft(data[start:], " \t\r\n")
+		indent := data[start : len(data)-len(rest)]
+		separator := ","
+		if rest[0] == '}' {
+			separator = ""
+		}
+		edited = slices.Concat(data[:start], indent, []byte(fmt.Sprintf(`"jars": [%s]%s`, strings.Join(entries, ", "), separator)), data[start:])
+	} else {
+		separator := ", "
+		if len(mod.Jars) == 0 {
+			separator = ""
+		}
+		bracket := start + stdbytes.LastIndexByte(data[start:end], ']')
+		edited = slices.Concat(data[:bracket], []byte(separator+strings.Join(entries, ", ")), data[bracket:])
+	}
+	member.Buffer = &bytes.Buffer{Data: &edited, Index: 0}
+	return nil
+}
+
+// jarJarEntry is a jar listed in JarJar metadata, which Forge loads when no other mod has a newer version of it.
+type jarJarEntry struct {
+	Identifier struct {
+		Group    string `json:"group"`
+		Artifact string `json:"artifact"`
+	} `json:"identifier"`
+	Version struct {
+		Range           string `json:"range"`
+		ArtifactVersion string `json:"artifactVersion"`
+	} `json:"version"`
+	Path         string `json:"path"`
+	IsObfuscated bool   `json:"isObfuscated"`
+}
+
+// addJarJarJars adds nested jars missing from JarJar metadata. Their coordinates are read from the Maven metadata
+// of the jars, or guessed from their file names, and any version of them from theirs on is accepted.
+func addJarJarJars(member *JarMember, jars []JarMember) error {
+	if err := member.Load(); err != nil {
+		return err
+	}
+	var metadata map[string]any
+	if err := json.Unmarshal(*member.Buffer.Data, &metadata); err != nil {
+		return fmt.Errorf("%s: %w", member.Name, err)
+	}
+	entries, _ := metadata["jars"].([]any)
+	listed := map[string]bool{}
+	for _, entry := range entries {
+		if entry, ok := entry.(map[string]any); ok {
+			listed[fmt.Sprint(entry["path"])] = true
+		}
+	}
+
+	changed := false
+	for _, jar := range jars {
+		if listed[jar.Name] {
+			continue
+		}
+		var entry jarJarEntry
+		entry.Path = jar.Name
+		entry.Identifier.Group, entry.Identifier.Artifact, entry.Version.ArtifactVersion = mavenCoordinates(&jar)
+		entry.Version.Range = "[" + entry.Version.ArtifactVersion + ",)"
+		entries = append(entries, entry)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	metadata["jars"] = entries
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	member.Buffer = &bytes.Buffer{Data: &data, Index: 0}
+	return nil
+}
+
+// mavenCoordinates returns the group, artifact and version of a jar from its pom.properties. Without one they are
+// taken from a file name such as "artifact-1.0.jar", with the artifact as the group.
+func mavenCoordinates(jar *JarMember) (string, string, string) {
+	data := *jar.Buffer.Data
+	if reader, err := zip.NewReader(stdbytes.NewReader(data), int64(len(data))); err == nil {
+		for _, file := range reader.File {
+			if !strings.HasPrefix(file.Name, "META-INF/maven/") || path.Base(file.Name) != "pom.properties" {
+				continue
+			}
+			member := JarMember{Name: file.Name, file: file}
+			properties, err := readMember(&member)
+			if err != nil {
+				break
+			}
+			values := map[string]string{}
+			for _, line := range strings.Split(string(properties), "\n") {
+				if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok && !strings.HasPrefix(key, "#") {
+					values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+				}
+			}
+			if values["groupId"] != "" && values["artifactId"] != "" && values["version"] != "" {
+				return values["groupId"], values["artifactId"], values["version"]
+			}
+		}
+	}
+
+	artifact, version := strings.TrimSuffix(path.Base(jar.Name), ".jar"), "0"
+	for i := 1; i < len(artifact)-1; i++ {
+		if artifact[i] == '-' && artifact[i+1] >= '0' && artifact[i+1] <= '9' {
+			artifact, version = artifact[:i], artifact[i+1:]
+			break
+		}
+	}
+	return artifact, artifact, version
+}
+
+// topLevelValue returns the bounds of the value of a field of a JSON object, or -1 if it has no such field.
+func topLevelValue(data []byte, field string) (int, int, error) {
+	decoder := json.NewDecoder(stdbytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return 0, 0, err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return 0, 0, err
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return 0, 0, err
+		}
+		if key == field {
+			end := int(decoder.InputOffset())
+			return end - len(value), end, nil
+		}
+	}
+	return -1, -1, nil
+}
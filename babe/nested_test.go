@@ -0,0 +1,307 @@
+package babe
+
+import (
+	"archive/zip"
+	stdbytes "bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testZipData returns a zip of the entries, compressed unless stored is set.
+func testZipData(t *testing.T, stored bool, entries []zipEntry) string {
+	t.Helper()
+	var buffer stdbytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	method := zip.Deflate
+	if stored {
+		method = zip.Store
+	}
+	for _, entry := range entries {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: entry.name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry.data))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.String()
+}
+
+// readZipData returns the entries of a zip by name, along with their compression methods.
+func readZipData(t *testing.T, data string) (map[string]string, map[string]uint16) {
+	t.Helper()
+	reader, err := zip.NewReader(stdbytes.NewReader([]byte(data)), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, methods := map[string]string{}, map[string]uint16{}
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[file.Name], methods[file.Name] = string(content), file.Method
+	}
+	return entries, methods
+}
+
+func readTestFile(t *testing.T, filename string) string {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestNestedJars(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored bool
+	}{
+		{"BOOT-INF/lib/inner.jar", true},
+		{"WEB-INF/lib/inner.jar", true},
+		{"META-INF/jars/inner.jar", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deep := testZipData(t, false, []zipEntry{testClassEntry(t, NewClassBuilder("a/Deep"))})
+			inner := testZipData(t, false, []zipEntry{
+				testClassEntry(t, NewClassBuilder("a/Inner").Field(ACC_PUBLIC, "deep", "La/Deep;", nil)),
+				{"META-INF/jars/deep.jar", deep},
+			})
+			filename := filepath.Join(t.TempDir(), "test.jar")
+			writeTestZip(t, filename, []zipEntry{testClassEntry(t, NewClassBuilder("a/Outer")), {test.name, inner}})
+
+			pipeline := NewPipeline(&Relocator{Relocations: [][]string{{"a", "shaded/a"}}})
+			pipeline.Options.Nested = true
+			if err := pipeline.Run(filename); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, methods := readZipData(t, readTestFile(t, filename))
+			if _, ok := entries["shaded/a/Outer.class"]; !ok {
+				t.Errorf("outer class not relocated: %v", sortedKeys(entries))
+			}
+			if stored := methods[test.name] == zip.Store; stored != test.stored {
+				t.Errorf("%s stored = %t, want %t", test.name, stored, test.stored)
+			}
+			innerEntries, innerMethods := readZipData(t, entries[test.name])
+			class := &Class{}
+			if err := class.Read([]byte(innerEntries["shaded/a/Inner.class"])); err != nil {
+				t.Fatalf("nested class not relocated: %v", err)
+			}
+			if class.FindField("deep", "Lshaded/a/Deep;") == nil {
+				t.Error("field of the nested class not relocated")
+			}
+			// Only jars in Spring Boot's library directories have to be stored
+			if innerMethods["META-INF/jars/deep.jar"] != zip.Deflate {
+				t.Error("jar nested twice was stored")
+			}
+			deepEntries, _ := readZipData(t, innerEntries["META-INF/jars/deep.jar"])
+			if _, ok := deepEntries["shaded/a/Deep.class"]; !ok {
+				t.Errorf("class nested twice not relocated: %v", sortedKeys(deepEntries))
+			}
+		})
+	}
+}
+
+func TestExtractNestedJars(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"lib/inner.jar", nil},
+		{"inner.jar", nil},
+		{"../escape.jar", ErrUnsafeMemberName},
+		{"lib/../../escape.jar", ErrUnsafeMemberName},
+		{"/absolute.jar", ErrUnsafeMemberName},
+	}
+	for _, test := range tests {
+		for _, remove := range []bool{false, true} {
+			t.Run(test.name, func(t *testing.T) {
+				root := t.TempDir()
+				filename := filepath.Join(root, "test.jar")
+				writeTestZip(t, filename, []zipEntry{{"a/Resource.txt", "text"}, {test.name, "nested"}})
+				dir := filepath.Join(root, "out", "extracted")
+
+				extracted, err := ExtractNestedJars(filename, dir, remove)
+				if !errors.Is(err, test.err) {
+					t.Fatalf("ExtractNestedJars error = %v, want %v", err, test.err)
+				}
+				if test.err != nil {
+					if _, err := os.Stat(filepath.Join(root, "out", "escape.jar")); err == nil {
+						t.Error("jar written outside the directory")
+					}
+					return
+				}
+				if !slices.Equal(extracted, []string{test.name}) {
+					t.Errorf("extracted = %v", extracted)
+				}
+				if data := readTestFile(t, filepath.Join(dir, filepath.FromSlash(test.name))); data != "nested" {
+					t.Errorf("extracted jar holds %q", data)
+				}
+				var names []string
+				for _, entry := range readTestZip(t, filename) {
+					names = append(names, entry.name)
+				}
+				want := []string{"a/Resource.txt", test.name}
+				if remove {
+					want = want[:1]
+				}
+				if slices.Sort(names); !slices.Equal(names, want) {
+					t.Errorf("jar entries = %v, want %v", names, want)
+				}
+			})
+		}
+	}
+}
+
+func TestEmbedJarsFabric(t *testing.T) {
+	const embedded = `{"file": "META-INF/jars/lib-1.0.jar"}`
+	tests := []struct {
+		name      string
+		mod, want string
+	}{
+		{"without jars", "{\n  \"id\": \"mod\"\n}", "{\n  \"jars\": [" + embedded + "],\n  \"id\": \"mod\"\n}"},
+		{"empty object", "{}", `{"jars": [` + embedded + `]}`},
+		{"empty jars", `{"id": "mod", "jars": []}`, `{"id": "mod", "jars": [` + embedded + `]}`},
+		{"other jars", `{"jars": [{"file": "META-INF/jars/other.jar"}], "id": "mod"}`, `{"jars": [{"file": "META-INF/jars/other.jar"}, ` + embedded + `], "id": "mod"}`},
+		{"already listed", `{"jars": [` + embedded + `]}`, `{"jars": [` + embedded + `]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			lib := filepath.Join(root, "lib-1.0.jar")
+			writeTestZip(t, lib, []zipEntry{{"lib/Lib.class", "lib"}})
+			filename := filepath.Join(root, "test.jar")
+			writeTestZip(t, filename, []zipEntry{{"fabric.mod.json", test.mod}, {"META-INF/jars/lib-1.0.jar", "old"}})
+
+			if err := EmbedJars(filename, "META-INF/jars", lib); err != nil {
+				t.Fatal(err)
+			}
+			entries, methods := readZipData(t, readTestFile(t, filename))
+			if entries["fabric.mod.json"] != test.want {
+				t.Errorf("fabric.mod.json =\n%s\nwant\n%s", entries["fabric.mod.json"], test.want)
+			}
+			if entries["META-INF/jars/lib-1.0.jar"] != readTestFile(t, lib) || methods["META-INF/jars/lib-1.0.jar"] != zip.Store {
+				t.Error("embedded jar not stored in place of the old one")
+			}
+			if _, ok := entries[JarJarMetadataName]; ok {
+				t.Error("JarJar metadata added to a Fabric mod")
+			}
+		})
+	}
+}
+
+func TestEmbedJarsJarJar(t *testing.T) {
+	tests := []struct {
+		name string
+		// metadata is the JarJar metadata of the jar, empty for none
+		metadata string
+		dir      string
+		want     []string
+	}{
+		{"new metadata", "", "META-INF/jarjar", []string{"META-INF/jarjar/lib-1.0.jar", "META-INF/jarjar/plain.jar"}},
+		{"existing metadata", `{"jars": [{"path": "META-INF/jarjar/other.jar"}]}`, "META-INF/jarjar",
+			[]string{"META-INF/jarjar/other.jar", "META-INF/jarjar/lib-1.0.jar", "META-INF/jarjar/plain.jar"}},
+		{"already listed", `{"jars": [{"path": "META-INF/jarjar/plain.jar"}]}`, "META-INF/jarjar",
+			[]string{"META-INF/jarjar/plain.jar", "META-INF/jarjar/lib-1.0.jar"}},
+		{"existing metadata outside jarjar", `{"jars": []}`, "libs", []string{"libs/lib-1.0.jar", "libs/plain.jar"}},
+		{"no metadata outside jarjar", "", "libs", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			lib := filepath.Join(root, "lib-1.0.jar")
+			writeTestZip(t, lib, []zipEntry{{"META-INF/maven/com.example/lib/pom.properties", "groupId=com.example\nartifactId=lib\nversion=1.0.2\n"}})
+			plain := filepath.Join(root, "plain.jar")
+			writeTestZip(t, plain, []zipEntry{{"plain/Plain.class", "plain"}})
+			filename := filepath.Join(root, "test.jar")
+			entries := []zipEntry{{"a/Resource.txt", "text"}}
+			if test.metadata != "" {
+				entries = append(entries, zipEntry{JarJarMetadataName, test.metadata})
+			}
+			writeTestZip(t, filename, entries)
+
+			if err := EmbedJars(filename, test.dir, lib, plain); err != nil {
+				t.Fatal(err)
+			}
+			written, _ := readZipData(t, readTestFile(t, filename))
+			data, ok := written[JarJarMetadataName]
+			if test.want == nil {
+				if ok {
+					t.Errorf("JarJar metadata added: %s", data)
+				}
+				return
+			}
+			var metadata struct{ Jars []jarJarEntry }
+			if err := json.Unmarshal([]byte(data), &metadata); err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, jar := range metadata.Jars {
+				paths = append(paths, jar.Path)
+				// Listed jars are kept as they are
+				if strings.Contains(test.metadata, jar.Path) {
+					continue
+				}
+				switch filepath.Base(jar.Path) {
+				case "lib-1.0.jar":
+					if jar.Identifier.Group != "com.example" || jar.Identifier.Artifact != "lib" || jar.Version.ArtifactVersion != "1.0.2" || jar.Version.Range != "[1.0.2,)" {
+						t.Errorf("entry of lib-1.0.jar = %+v", jar)
+					}
+				case "plain.jar":
+					if jar.Identifier.Group != "plain" || jar.Identifier.Artifact != "plain" || jar.Version.ArtifactVersion != "0" || jar.Version.Range != "[0,)" {
+						t.Errorf("entry of plain.jar = %+v", jar)
+					}
+				}
+			}
+			if !slices.Equal(paths, test.want) {
+				t.Errorf("listed jars = %v, want %v", paths, test.want)
+			}
+		})
+	}
+}
+
+func TestMavenCoordinates(t *testing.T) {
+	tests := []struct {
+		name string
+		// pom is the pom.properties of the jar, empty for none
+		pom                      string
+		group, artifact, version string
+	}{
+		{"libs/lib-1.0.jar", "", "lib", "lib", "1.0"},
+		{"lib-core-2.3.1-SNAPSHOT.jar", "", "lib-core", "lib-core", "2.3.1-SNAPSHOT"},
+		{"plain.jar", "", "plain", "plain", "0"},
+		{"lib-v2.jar", "", "lib-v2", "lib-v2", "0"},
+		{"renamed.jar", "#Generated\ngroupId = com.example\nartifactId=lib\r\nversion=1.2\n", "com.example", "lib", "1.2"},
+		{"lib-3.0.jar", "groupId=com.example\nartifactId=lib\n", "lib", "lib", "3.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := []zipEntry{{"lib/Lib.class", "lib"}}
+			if test.pom != "" {
+				entries = append(entries, zipEntry{"META-INF/maven/com.example/lib/pom.properties", test.pom})
+			}
+			jar := JarMemberFromString(test.name, testZipData(t, false, entries))
+			group, artifact, version := mavenCoordinates(&jar)
+			if group != test.group || artifact != test.artifact || version != test.version {
+				t.Errorf("mavenCoordinates = %s:%s:%s, want %s:%s:%s", group, artifact, version, test.group, test.artifact, test.version)
+			}
+		})
+	}
+}
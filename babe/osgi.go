@@ -0,0 +1,87 @@
+package babe
+
+import (
+	"strconv"
+	"strings"
+)
+
+// OSGiPackageHeaders are the manifest headers of OSGi bundles listing packages, which are relocated along with them.
+var OSGiPackageHeaders = []string{"Export-Package", "Import-Package", "DynamicImport-Package", "Private-Package"}
+
+// splitOSGi splits an OSGi header at the separators found outside of quoted strings.
+func splitOSGi(value string, separator byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			i++
+		case separator:
+			if !quoted {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// mapOSGiPackage maps a package of an OSGi header, which may end in a wildcard standing for its subpackages.
+func mapOSGiPackage(name string, mapPackage func(string) string) string {
+	if base, ok := strings.CutSuffix(name, ".*"); ok {
+		return mapOSGiPackage(base, mapPackage) + ".*"
+	}
+	return strings.ReplaceAll(mapPackage(strings.ReplaceAll(name, ".", "/")), "/", ".")
+}
+
+// mapOSGiHeader maps the packages of an OSGi package header: the packages of each clause and those of its uses:
+// directive. Other attributes and directives, such as versions, are kept as they are.
+func mapOSGiHeader(value string, mapPackage func(string) string) string {
+	clauses := splitOSGi(value, ',')
+	for i, clause := range clauses {
+		parts := splitOSGi(clause, ';')
+		for j, part := range parts {
+			name, parameter, ok := strings.Cut(part, "=")
+			if !ok {
+				if trimmed := strings.TrimSpace(part); trimmed != "" {
+					parts[j] = strings.Replace(part, trimmed, mapOSGiPackage(trimmed, mapPackage), 1)
+				}
+				continue
+			}
+			if strings.TrimSpace(name) != "uses:" {
+				continue
+			}
+			uses, err := strconv.Unquote(strings.TrimSpace(parameter))
+			if err != nil {
+				uses = strings.TrimSpace(parameter)
+			}
+			packages, changed := strings.Split(uses, ","), false
+			for k, use := range packages {
+				if mapped := mapOSGiPackage(strings.TrimSpace(use), mapPackage); mapped != strings.TrimSpace(use) {
+					packages[k], changed = mapped, true
+				}
+			}
+			if changed {
+				parts[j] = name + "=" + strconv.Quote(strings.Join(packages, ","))
+			}
+		}
+		clauses[i] = strings.Join(parts, ";")
+	}
+	return strings.Join(clauses, ",")
+}
+
+// mapOSGiHeaders maps the packages named by the OSGi headers of a manifest.
+func mapOSGiHeaders(manifest *Manifest, mapPackage func(string) string) bool {
+	changed := false
+	for _, name := range OSGiPackageHeaders {
+		if value := manifest.Main.Get(name); value != "" {
+			if mapped := mapOSGiHeader(value, mapPackage); mapped != value {
+				manifest.Main.Set(name, mapped)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,85 @@
+package babe
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitOSGi(t *testing.T) {
+	tests := []struct {
+		value     string
+		separator byte
+		parts     []string
+	}{
+		{"a,b", ',', []string{"a", "b"}},
+		{"a", ',', []string{"a"}},
+		{`a;version="[1.0,2.0)",b`, ',', []string{`a;version="[1.0,2.0)"`, "b"}},
+		{`a;uses:="b,c";version=1`, ';', []string{"a", `uses:="b,c"`, "version=1"}},
+		{`a;x="quoted \" ,",b`, ',', []string{`a;x="quoted \" ,"`, "b"}},
+		{"", ',', []string{""}},
+	}
+	for _, test := range tests {
+		if parts := splitOSGi(test.value, test.separator); !slices.Equal(parts, test.parts) {
+			t.Errorf("splitOSGi(%q) = %q, want %q", test.value, parts, test.parts)
+		}
+	}
+}
+
+func TestMapOSGiHeader(t *testing.T) {
+	relocator := &Relocator{Relocations: ParseRelocation("com.a:shaded.com.a")}
+	tests := []struct {
+		name, value, mapped string
+	}{
+		{"package", "com.a", "shaded.com.a"},
+		{"subpackage", "com.a.b", "shaded.com.a.b"},
+		{"shared prefix", "com.abc;version=1,com.a.b", "com.abc;version=1,shaded.com.a.b"},
+		{"outside the package", "org.com.a,com.a.com.a", "org.com.a,shaded.com.a.com.a"},
+		{"wildcard", "com.a.*,com.*", "shaded.com.a.*,com.*"},
+		{"version range", `com.a;version="[1.0,2.0)",org.b`, `shaded.com.a;version="[1.0,2.0)",org.b`},
+		{"spaces", " com.a ; version=1 , org.b", " shaded.com.a ; version=1 , org.b"},
+		{"uses", `org.b;uses:="com.a,com.abc,com.a.c";version=1`, `org.b;uses:="shaded.com.a,com.abc,shaded.com.a.c";version=1`},
+		{"unquoted uses", "org.b;uses:=com.a", `org.b;uses:="shaded.com.a"`},
+		{"uses of unrelocated packages", `org.b;uses:="org.c,com.abc"`, `org.b;uses:="org.c,com.abc"`},
+		{"resolution directive", "com.a;resolution:=optional", "shaded.com.a;resolution:=optional"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if mapped := mapOSGiHeader(test.value, relocator.relocate); mapped != test.mapped {
+				t.Errorf("mapOSGiHeader(%q) = %q, want %q", test.value, mapped, test.mapped)
+			}
+		})
+	}
+}
+
+func TestMapOSGiHeaders(t *testing.T) {
+	relocator := &Relocator{Relocations: ParseRelocation("com.a:shaded.com.a")}
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		mapped  string
+		changed bool
+	}{
+		{"exports", "Export-Package", "com.a;version=1,com.abc", "shaded.com.a;version=1,com.abc", true},
+		{"imports", "Import-Package", "com.abc,org.b", "com.abc,org.b", false},
+		{"dynamic imports", "DynamicImport-Package", "com.a.*", "shaded.com.a.*", true},
+		{"private packages", "Private-Package", "com.a.internal", "shaded.com.a.internal", true},
+		{"activator", "Bundle-Activator", "com.a.Activator", "shaded.com.a.Activator", true},
+		{"activator sharing a prefix", "Bundle-Activator", "com.abc.Activator", "com.abc.Activator", false},
+		{"other header", "Bundle-SymbolicName", "com.a", "com.a", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest := NewManifest()
+			manifest.Main.Set(test.header, test.value)
+			changed := mapManifestClasses(manifest, relocator.relocate)
+			changed = mapOSGiHeaders(manifest, relocator.relocate) || changed
+			if changed != test.changed {
+				t.Errorf("changed = %v, want %v", changed, test.changed)
+			}
+			if mapped := manifest.Main.Get(test.header); mapped != test.mapped {
+				t.Errorf("%s = %q, want %q", test.header, mapped, test.mapped)
+			}
+		})
+	}
+}
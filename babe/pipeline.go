@@ -0,0 +1,360 @@
+package babe
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	fss "github.com/mrnavastar/assist/fs"
+	"golang.org/x/sync/errgroup"
+)
+
+var ErrInvalidStage = errors.New("jarhax: pipeline stage implements no transformer or analyzer")
+
+// Analyzer sees every member of the jar, and of its nested jars when JarOptions.Nested is set, before any
+// transformer runs.
+type Analyzer interface {
+	Analyze(members []*JarMember) error
+}
+
+// NameAnalyzer is given the names of every member before any transformer runs, with those of nested jars prefixed
+// as in "inner.jar!/a/B.class". Unlike an Analyzer it doesn't need the members loaded, so the jar is still streamed
+// through.
+type NameAnalyzer interface {
+	AnalyzeNames(names []string) error
+}
+
+// ResourceAnalyzer reads the few resources naming others, such as the metadata of the jar, before any transformer
+// runs. It is given the resources AnalyzesResource accepts, loaded, so the rest of the jar can still be streamed
+// through.
+type ResourceAnalyzer interface {
+	AnalyzesResource(name string) bool
+	AnalyzeResources(members []*JarMember) error
+}
+
+// ClassTransformer is applied to every class member and reports whether it modified the class.
+type ClassTransformer interface {
+	TransformClass(member *JarMember, class *Class) (bool, error)
+}
+
+// ResourceTransformer is applied to every member that is not a class.
+type ResourceTransformer interface {
+	TransformResource(member *JarMember) error
+}
+
+// Generator adds members to the jar once every member has been transformed. Generated members are not transformed.
+type Generator interface {
+	Generate() ([]JarMember, error)
+}
+
+type AnalyzerFunc func(members []*JarMember) error
+
+func (f AnalyzerFunc) Analyze(members []*JarMember) error {
+	return f(members)
+}
+
+type ClassTransformerFunc func(member *JarMember, class *Class) (bool, error)
+
+func (f ClassTransformerFunc) TransformClass(member *JarMember, class *Class) (bool, error) {
+	return f(member, class)
+}
+
+type ResourceTransformerFunc func(member *JarMember) error
+
+func (f ResourceTransformerFunc) TransformResource(member *JarMember) error {
+	return f(member)
+}
+
+// Stage is any value implementing at least one of Analyzer, NameAnalyzer, ResourceAnalyzer, ClassTransformer,
+// ResourceTransformer or Generator.
+type Stage any
+
+type Pipeline struct {
+	Options JarOptions
+	stages  []Stage
+}
+
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{Options: DefaultJarOptions, stages: stages}
+}
+
+func (pipeline *Pipeline) Add(stages ...Stage) *Pipeline {
+	pipeline.stages = append(pipeline.stages, stages...)
+	return pipeline
+}
+
+func (pipeline *Pipeline) hasAnalyzers() bool {
+	for _, stage := range pipeline.stages {
+		if _, ok := stage.(Analyzer); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (pipeline *Pipeline) validate() error {
+	for _, stage := range pipeline.stages {
+		_, analyzer := stage.(Analyzer)
+		_, names := stage.(NameAnalyzer)
+		_, resources := stage.(ResourceAnalyzer)
+		_, class := stage.(ClassTransformer)
+		_, resource := stage.(ResourceTransformer)
+		_, generator := stage.(Generator)
+		if !analyzer && !names && !resources && !class && !resource && !generator {
+			return fmt.Errorf("%w: %T", ErrInvalidStage, stage)
+		}
+	}
+	return nil
+}
+
+func (pipeline *Pipeline) analyzeNames(names []string) error {
+	for _, stage := range pipeline.stages {
+		if analyzer, ok := stage.(NameAnalyzer); ok {
+			if err := analyzer.AnalyzeNames(names); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// analyzeResources gives every ResourceAnalyzer the resources it accepts, loading them.
+func (pipeline *Pipeline) analyzeResources(members []*JarMember) error {
+	for _, stage := range pipeline.stages {
+		analyzer, ok := stage.(ResourceAnalyzer)
+		if !ok {
+			continue
+		}
+		var accepted []*JarMember
+		for _, member := range members {
+			if strings.HasSuffix(member.Name, ".class") || !analyzer.AnalyzesResource(member.Name) {
+				continue
+			}
+			if err := member.Load(); err != nil {
+				return err
+			}
+			accepted = append(accepted, member)
+		}
+		if err := analyzer.AnalyzeResources(accepted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transform runs every transformer stage over a single member, in registration order.
+func (pipeline *Pipeline) Transform(member *JarMember) error {
+	modified := false
+	var class *Class
+
+	for _, stage := range pipeline.stages {
+		if member.delete {
+			return nil
+		}
+
+		if transformer, ok := stage.(ClassTransformer); ok && strings.HasSuffix(member.Name, ".class") {
+			if class == nil {
+				var err error
+				if class, err = member.GetAsClass(); err != nil {
+					if errors.Is(err, ErrNotClass) {
+						continue
+					}
+					return err
+				}
+			}
+
+			changed, err := transformer.TransformClass(member, class)
+			if err != nil {
+				return fmt.Errorf("%s: %w", member.Name, err)
+			}
+			modified = modified || changed
+			continue
+		}
+
+		if transformer, ok := stage.(ResourceTransformer); ok && !strings.HasSuffix(member.Name, ".class") {
+			if err := transformer.TransformResource(member); err != nil {
+				return fmt.Errorf("%s: %w", member.Name, err)
+			}
+		}
+	}
+
+	if modified {
+		member.SetClass(class)
+	}
+	return nil
+}
+
+// Run transforms filename in place.
+func (pipeline *Pipeline) Run(filename string) error {
+	return pipeline.RunContext(context.Background(), filename, filename)
+}
+
+// RunContext reads input once, runs every stage and writes the result to output, which may be the same file.
+func (pipeline *Pipeline) RunContext(ctx context.Context, input string, output string) error {
+	if err := pipeline.validate(); err != nil {
+		return err
+	}
+	if !fss.Exists(input) {
+		return fmt.Errorf("%s does not exist", input)
+	}
+
+	reader, err := zip.OpenReader(input)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	temp := output + "-modified.zip"
+	jar := CreateJarWithOptions(ctx, temp, pipeline.Options)
+	jar.Task(func(jar *Jar) error {
+		return pipeline.run(jar, &reader.Reader)
+	})
+
+	if err := jar.Wait(); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, output)
+}
+
+func (pipeline *Pipeline) run(jar *Jar, reader *zip.Reader) error {
+	if !pipeline.hasAnalyzers() && !jar.Options().Nested {
+		names := make([]string, len(reader.File))
+		// The members given to resource analyzers are loaded apart from those streamed to the transformers
+		var resources []*JarMember
+		for i, file := range reader.File {
+			names[i] = file.Name
+			if !file.FileInfo().IsDir() {
+				resources = append(resources, &JarMember{Name: file.Name, file: file})
+			}
+		}
+		if err := pipeline.analyzeNames(names); err != nil {
+			return err
+		}
+		if err := pipeline.analyzeResources(resources); err != nil {
+			return err
+		}
+		err := forZipMember(jar.Context(), reader, jar.Options(), func(member *JarMember) error {
+			if err := pipeline.Transform(member); err != nil {
+				return err
+			}
+			if !member.delete {
+				return jar.Add(*member)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return pipeline.generate(jar)
+	}
+
+	members, err := readMembers(jar.Context(), reader, jar.Options())
+	if err != nil {
+		return err
+	}
+	all, nested := members, []*nestedJar(nil)
+	if jar.Options().Nested {
+		if all, nested, err = expandNestedJars(jar.Context(), members, jar.Options()); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, len(all))
+	for i, member := range all {
+		names[i] = member.scopedName()
+	}
+	if err := pipeline.analyzeNames(names); err != nil {
+		return err
+	}
+	if err := pipeline.analyzeResources(all); err != nil {
+		return err
+	}
+	for _, stage := range pipeline.stages {
+		if analyzer, ok := stage.(Analyzer); ok {
+			if err := analyzer.Analyze(all); err != nil {
+				return err
+			}
+		}
+	}
+
+	errs, ctx := errgroup.WithContext(jar.Context())
+	errs.SetLimit(jar.Options().workers())
+	for _, member := range all {
+		if ctx.Err() != nil {
+			break
+		}
+		errs.Go(func() error {
+			return pipeline.Transform(member)
+		})
+	}
+	if err := errs.Wait(); err != nil {
+		return err
+	}
+	for _, jar := range nested {
+		if err := jar.write(); err != nil {
+			return err
+		}
+	}
+
+	for _, member := range members {
+		if member.delete {
+			continue
+		}
+		if err := jar.Add(*member); err != nil {
+			return err
+		}
+	}
+	return pipeline.generate(jar)
+}
+
+func (pipeline *Pipeline) generate(jar *Jar) error {
+	for _, stage := range pipeline.stages {
+		generator, ok := stage.(Generator)
+		if !ok {
+			continue
+		}
+		members, err := generator.Generate()
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if err := jar.Add(member); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readMembers loads every member of the jar, keeping the order of the zip directory.
+func readMembers(ctx context.Context, reader *zip.Reader, options JarOptions) ([]*JarMember, error) {
+	index := make(map[string]int, len(reader.File))
+	for i, file := range reader.File {
+		index[file.Name] = i
+	}
+
+	var lock sync.Mutex
+	members := make([]*JarMember, len(reader.File))
+	err := forZipMember(ctx, reader, options, func(member *JarMember) error {
+		lock.Lock()
+		members[index[member.Name]] = member
+		lock.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := members[:0]
+	for _, member := range members {
+		if member != nil {
+			loaded = append(loaded, member)
+		}
+	}
+	return loaded, nil
+}
@@ -1,7 +1,16 @@
 package babe
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrUnsupportedVersion = errors.New("jarhax: unsupported class file version")
+
+// Polyfill lowers the class file version of a class newer than version, replacing the constants that version lacks.
 func Polyfill(class *Class, version int) {
-	if class.Supports(version) {
+	if int(class.MajorVersion) <= version {
 		return
 	}
 	class.MajorVersion = uint16(version)
@@ -36,3 +45,122 @@ func Polyfill(class *Class, version int) {
 		}
 	}
 }
+
+type Polyfiller struct {
+	Version int
+}
+
+func (polyfiller *Polyfiller) TransformClass(member *JarMember, class *Class) (bool, error) {
+	version := class.MajorVersion
+	Polyfill(class, polyfiller.Version)
+	return class.MajorVersion != version, nil
+}
+
+func PolyfillJar(filename string, version int) error {
+	return NewPipeline(&Polyfiller{version}).Run(filename)
+}
+
+// MultiReleasePolyfiller polyfills the classes of a jar while keeping the originals for the JVMs able to load them.
+// The JVM loads the versioned entry of the highest version up to its own, or the base entry if there is none, so the
+// polyfilled classes replace the base entries and each original moves to the entries of its own Java version. Versioned
+// entries below Java 9 are ignored, so older originals are kept for Java 9 on. The jar is marked multi-release.
+type MultiReleasePolyfiller struct {
+	Version int
+	// base entries to polyfill
+	polyfill  map[*JarMember]bool
+	originals []JarMember
+	manifest  bool
+}
+
+func (polyfiller *MultiReleasePolyfiller) Analyze(members []*JarMember) error {
+	polyfiller.polyfill = map[*JarMember]bool{}
+	// Originals can only be added to the jar itself, so nested jars are left alone
+	var own []*JarMember
+	for _, member := range members {
+		if member.NestedIn() == "" {
+			own = append(own, member)
+			polyfiller.manifest = polyfiller.manifest || member.Name == ManifestName
+		}
+	}
+
+	classes := MultiReleaseClasses(own)
+	for _, name := range sortedVariantNames(classes) {
+		variants := classes[name]
+		if variants.Base == nil {
+			continue
+		}
+		class, err := variants.Base.GetAsClass()
+		if err != nil {
+			return fmt.Errorf("%s: %w", variants.Base.Name, err)
+		}
+		if int(class.MajorVersion) <= polyfiller.Version {
+			continue
+		}
+		polyfiller.polyfill[variants.Base] = true
+
+		// JVMs loading a versioned entry up to that version never loaded the original
+		release := max(javaVersion(int(class.MajorVersion)), 9)
+		if variants.Variant(release) != variants.Base {
+			continue
+		}
+		if err := variants.Base.Load(); err != nil {
+			return err
+		}
+		_, base := SplitVersionedName(variants.Base.Name)
+		original := JarMemberFromString(VersionedName(release, base), string(*variants.Base.Buffer.Data))
+		polyfiller.originals = append(polyfiller.originals, original)
+	}
+	return nil
+}
+
+func (polyfiller *MultiReleasePolyfiller) TransformClass(member *JarMember, class *Class) (bool, error) {
+	if !polyfiller.polyfill[member] {
+		return false, nil
+	}
+	Polyfill(class, polyfiller.Version)
+	return true, nil
+}
+
+func sortedVariantNames(classes map[string]*ClassVariants) []string {
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (polyfiller *MultiReleasePolyfiller) TransformResource(member *JarMember) error {
+	if member.Name != ManifestName || len(polyfiller.originals) == 0 {
+		return nil
+	}
+	if err := member.Load(); err != nil {
+		return err
+	}
+	manifest, err := ReadManifest(*member.Buffer.Data)
+	if err != nil {
+		return err
+	}
+	if !IsMultiRelease(manifest) {
+		manifest.Main.Set("Multi-Release", "true")
+		*member.Buffer.Data = manifest.Bytes()
+	}
+	return nil
+}
+
+// Generate returns the original classes as versioned entries, along with a manifest if the jar has none.
+func (polyfiller *MultiReleasePolyfiller) Generate() ([]JarMember, error) {
+	members := polyfiller.originals
+	if len(members) > 0 && !polyfiller.manifest {
+		manifest := NewManifest()
+		manifest.Main.Set("Multi-Release", "true")
+		members = append([]JarMember{JarMemberFromString(ManifestName, string(manifest.Bytes()))}, members...)
+	}
+	return members, nil
+}
+
+// PolyfillJarMultiRelease polyfills the classes of a jar to version, keeping the originals as versioned entries for the
+// Java versions that can load them.
+func PolyfillJarMultiRelease(filename string, version int) error {
+	return NewPipeline(&MultiReleasePolyfiller{Version: version}).Run(filename)
+}
@@ -1,16 +1,19 @@
 package babe
 
 import (
-	"errors"
-	"github.com/mrnavastar/assist/bytes"
-	"slices"
 	"strings"
+	"sync"
 )
 
+// ParseRelocations parses relocations written as from:to, with packages separated by dots or slashes.
 func ParseRelocations(relocations []string) [][]string {
 	var parsedRelocations [][]string
 	for _, relocation := range relocations {
-		parsedRelocations = append(parsedRelocations, strings.Split(strings.ReplaceAll(relocation, ".", "/"), ":"))
+		parsed := strings.Split(strings.ReplaceAll(relocation, ".", "/"), ":")
+		for i := range parsed {
+			parsed[i] = strings.TrimSuffix(parsed[i], "/")
+		}
+		parsedRelocations = append(parsedRelocations, parsed)
 	}
 	return parsedRelocations
 }
@@ -19,60 +22,120 @@ func ParseRelocation(relocation string) [][]string {
 	return ParseRelocations([]string{relocation})
 }
 
-// TODO: Dont modify regular strings - actually test that this works
-// TODO: Make this function less hacky and gross
+// RelocateClass moves the classes a class names, itself included, out of the relocated packages. Names are mapped
+// where the class uses them as names, descriptors or generic signatures, so string literals, and strings in
+// annotations, are left alone.
 func RelocateClass(class *Class, relocations [][]string) bool {
-	modified := false
-	var skip []uint16
+	return RemapClass(class, relocationRemapper(relocations))
+}
 
-	for _, constant := range class.ConstantPool {
-		switch info := constant.(type) {
-		case *StringInfo:
-			skip = append(skip, info.StringIndex-1)
-		}
-	}
+// relocationRemapper moves the classes of the relocated packages, keeping the names of members.
+type relocationRemapper [][]string
+
+func (relocations relocationRemapper) MapClass(name string) string {
+	return relocateName(relocations, name)
+}
+
+func (relocations relocationRemapper) MapField(owner string, name string, descriptor string) string {
+	return name
+}
+
+func (relocations relocationRemapper) MapMethod(owner string, name string, descriptor string) string {
+	return name
+}
 
-	for i, constant := range class.ConstantPool {
-		switch info := constant.(type) {
-		case *Utf8Info:
-			if slices.Contains(skip, uint16(i)) {
-				continue
-			}
-
-			for _, relocation := range relocations {
-				s := info.String()
-				if strings.Contains(s, relocation[0]) {
-					info.Set(strings.ReplaceAll(s, relocation[0], relocation[1]))
-					modified = true
-					break
-				}
-			}
+// Relocator moves packages, rewriting the Mixin configs and refmaps of the jar along with its classes, the packages
+// and classes named by its module descriptor, its META-INF/services files, the OSGi headers of its manifest and the
+// Kotlin metadata of its classes and .kotlin_module files.
+type Relocator struct {
+	Relocations [][]string
+	// ModuleName renames the module of the jar, so it no longer collides with the original library
+	ModuleName string
+	// packages of every jar once relocated, by the nested jar holding them
+	packages map[string]map[string]bool
+	// resourceRemapper is created once Relocations are set
+	once             sync.Once
+	resourceRemapper *resourceRemapper
+}
+
+func (relocator *Relocator) relocate(s string) string {
+	return relocateName(relocator.Relocations, s)
+}
+
+// relocateName applies the first relocation matching a name, so class files, classes and the names in resources
+// all move alike. A relocation matches the package or class it names and the names within it, never a name merely
+// sharing its prefix, and only that prefix is replaced.
+func relocateName(relocations [][]string, s string) string {
+	for _, relocation := range relocations {
+		if from := relocation[0]; s == from || strings.HasPrefix(s, from+"/") {
+			return relocation[1] + s[len(from):]
 		}
 	}
-	return modified
+	return s
 }
 
-func RelocateJar(filename string, relocations [][]string) error {
-	return ModifyJar(filename, func(member *JarMember) error {
-		for _, relocation := range relocations {
-			if strings.Contains(member.Name, relocation[0]) {
-				member.Name = strings.ReplaceAll(member.Name, relocation[0], relocation[1])
-				break
-			}
-		}
+func (relocator *Relocator) AnalyzeNames(names []string) error {
+	relocator.packages = scopedPackages(names, func(name string) string {
+		return mapVersionedName(name, relocator.relocate)
+	})
+	return nil
+}
 
-		class, err := member.GetAsClass()
-		if err != nil {
-			if errors.Is(err, ErrNotClass) {
-				return nil
-			}
-			return err
-		}
+func (relocator *Relocator) AnalyzesResource(name string) bool {
+	return isMixinMetadata(name)
+}
+
+func (relocator *Relocator) AnalyzeResources(members []*JarMember) error {
+	return relocator.resources().AnalyzeResources(members)
+}
+
+// resources returns the remapper of the resources and metadata naming relocated classes.
+func (relocator *Relocator) resources() *resourceRemapper {
+	relocator.once.Do(func() {
+		relocator.resourceRemapper = &resourceRemapper{remapper: relocationRemapper(relocator.Relocations)}
+	})
+	return relocator.resourceRemapper
+}
 
-		if RelocateClass(&class, relocations) {
-			member.Buffer = bytes.NewBuffer()
-			class.Write(member.Buffer.Data)
+func (relocator *Relocator) TransformResource(member *JarMember) error {
+	if err := relocator.resources().TransformResource(member); err != nil {
+		return err
+	}
+	err := editManifestMember(member, func(manifest *Manifest) bool {
+		if relocator.ModuleName != "" && manifest.Main.Get("Automatic-Module-Name") != relocator.ModuleName {
+			manifest.Main.Set("Automatic-Module-Name", relocator.ModuleName)
+			return true
 		}
-		return nil
+		return false
 	})
+	if err != nil {
+		return err
+	}
+	// Relocating kotlin itself would otherwise rename the module files
+	if !IsKotlinModule(member.Name) {
+		member.Name = mapVersionedName(member.Name, relocator.relocate)
+	}
+	return nil
+}
+
+func (relocator *Relocator) TransformClass(member *JarMember, class *Class) (bool, error) {
+	changed, err := relocator.resources().TransformClass(member, class)
+	if err != nil || !class.IsModuleInfo() {
+		return changed, err
+	}
+	if module := class.GetModule(); relocator.ModuleName != "" && module != nil && module.Name != relocator.ModuleName {
+		module.Name = relocator.ModuleName
+		class.SetModule(module)
+		changed = true
+	}
+	return syncModulePackages(class, relocator.packages[member.NestedIn()]) || changed, nil
+}
+
+func RelocateJar(filename string, relocations [][]string) error {
+	return NewPipeline(&Relocator{Relocations: relocations}).Run(filename)
+}
+
+// RelocateModule relocates a jar and renames its module, setting its Automatic-Module-Name.
+func RelocateModule(filename string, relocations [][]string, name string) error {
+	return NewPipeline(&Relocator{Relocations: relocations, ModuleName: name}).Run(filename)
 }
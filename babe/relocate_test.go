@@ -0,0 +1,92 @@
+package babe
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRelocateClass(t *testing.T) {
+	class, err := NewClassBuilder("com/a/Main").Signature("Ljava/lang/Object;Ljava/lang/Comparable<Lcom/a/Main;>;").
+		Field(ACC_STATIC, "comValue", "Lcom/a/Value;", nil).
+		Method(ACC_PUBLIC|ACC_STATIC, "compute", "(Lcom/a/Value;)Ljava/lang/String;", func(code *CodeBuilder) {
+			code.GetStatic("com/a/Main", "comValue", "Lcom/a/Value;")
+			code.VisitInsn(POP)
+			code.Push("com/a/Value")
+			code.VisitInsn(ARETURN)
+		}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !RelocateClass(class, ParseRelocation("com.a:shaded.com.a")) {
+		t.Fatal("RelocateClass changed nothing")
+	}
+	if name := class.GetClassName(); name != "shaded/com/a/Main" {
+		t.Errorf("class name = %q", name)
+	}
+	signature := class.FindAttribute(class.Attributes, "Signature")
+	if s := class.GetUtf8(uint16(u16(signature.Data, 0))); s != "Ljava/lang/Object;Ljava/lang/Comparable<Lshaded/com/a/Main;>;" {
+		t.Errorf("signature = %q", s)
+	}
+	if name, descriptor := class.Fields[0].GetName(), class.Fields[0].GetDescriptor(); name != "comValue" || descriptor != "Lshaded/com/a/Value;" {
+		t.Errorf("field = %s %s", name, descriptor)
+	}
+	if descriptor := class.Methods[0].GetDescriptor(); descriptor != "(Lshaded/com/a/Value;)Ljava/lang/String;" {
+		t.Errorf("method descriptor = %q", descriptor)
+	}
+	for i, constant := range class.ConstantPool {
+		switch info := constant.(type) {
+		case *StringInfo:
+			if s := class.GetUtf8(info.StringIndex); s != "com/a/Value" {
+				t.Errorf("string literal = %q", s)
+			}
+		case *FieldRefInfo:
+			if owner, name, _ := class.GetRef(uint16(i + 1)); owner != "shaded/com/a/Main" || name != "comValue" {
+				t.Errorf("field reference = %s.%s", owner, name)
+			}
+		case *ClassInfo:
+			if name := class.GetUtf8(info.NameIndex); strings.HasPrefix(name, "com/") {
+				t.Errorf("unrelocated class %q", name)
+			}
+		}
+	}
+}
+
+func TestRelocateName(t *testing.T) {
+	relocations := ParseRelocations([]string{"com.a:shaded.com.a", "org/b/:x/b/"})
+	tests := map[string]string{
+		"com/a":           "shaded/com/a",
+		"com/a/X":         "shaded/com/a/X",
+		"com/a/b/X.class": "shaded/com/a/b/X.class",
+		"com/abc/X":       "com/abc/X",
+		"org/com/a/X":     "org/com/a/X",
+		"com/a/com/a/X":   "shaded/com/a/com/a/X",
+		"org/b/Y":         "x/b/Y",
+		"org/bc/Y":        "org/bc/Y",
+	}
+	for name, want := range tests {
+		if relocated := relocateName(relocations, name); relocated != want {
+			t.Errorf("relocateName(%q) = %q, want %q", name, relocated, want)
+		}
+	}
+}
+
+func TestRelocateClassPackageBoundary(t *testing.T) {
+	class, err := NewClassBuilder("com/a/com/a/Main").
+		Field(ACC_STATIC, "other", "Lcom/abc/X;", nil).
+		Field(ACC_STATIC, "nested", "Lorg/com/a/X;", nil).
+		Field(ACC_STATIC, "relocated", "Lcom/a/X;", nil).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	RelocateClass(class, ParseRelocation("com.a:shaded.com.a"))
+	if name := class.GetClassName(); name != "shaded/com/a/com/a/Main" {
+		t.Errorf("class name = %q", name)
+	}
+	want := []string{"Lcom/abc/X;", "Lorg/com/a/X;", "Lshaded/com/a/X;"}
+	for i, field := range class.Fields {
+		if descriptor := field.GetDescriptor(); descriptor != want[i] {
+			t.Errorf("field %s = %q, want %q", field.GetName(), descriptor, want[i])
+		}
+	}
+}
@@ -0,0 +1,675 @@
+package babe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Remapper maps the names of classes, fields and methods. Names are internal names, and every method
+// returns the name it was given when there is no mapping for it.
+type Remapper interface {
+	MapClass(name string) string
+	MapField(owner string, name string, descriptor string) string
+	MapMethod(owner string, name string, descriptor string) string
+}
+
+// StringRemapper is implemented by remappers that also rewrite String constants.
+type StringRemapper interface {
+	MapString(value string) string
+}
+
+// LocalRemapper is implemented by remappers that also rename parameters and local variables. index is the
+// local variable slot in the method, which is mapped with the original owner, name and descriptor.
+type LocalRemapper interface {
+	MapLocal(owner string, method string, descriptor string, index int, name string) string
+}
+
+// SimpleRemapper maps names from fixed tables. Fields are keyed by "owner.name:descriptor", or by "owner.name" to
+// map the field whatever its descriptor, and methods by "owner.name" followed by the descriptor.
+type SimpleRemapper struct {
+	Classes map[string]string
+	Fields  map[string]string
+	Methods map[string]string
+}
+
+func (remapper *SimpleRemapper) MapClass(name string) string {
+	if mapped, ok := remapper.Classes[name]; ok {
+		return mapped
+	}
+	return name
+}
+
+func (remapper *SimpleRemapper) MapField(owner string, name string, descriptor string) string {
+	if mapped, ok := remapper.Fields[owner+"."+name+":"+descriptor]; ok {
+		return mapped
+	}
+	if mapped, ok := remapper.Fields[owner+"."+name]; ok {
+		return mapped
+	}
+	return name
+}
+
+func (remapper *SimpleRemapper) MapMethod(owner string, name string, descriptor string) string {
+	if mapped, ok := remapper.Methods[owner+"."+name+descriptor]; ok {
+		return mapped
+	}
+	return name
+}
+
+// MapType maps the name of a CONSTANT_Class, which is either an internal name or an array descriptor.
+func MapType(remapper Remapper, name string) string {
+	if strings.HasPrefix(name, "[") {
+		return MapDescriptor(remapper, name)
+	}
+	return remapper.MapClass(name)
+}
+
+// MapDescriptor maps the classes in a field or method descriptor.
+func MapDescriptor(remapper Remapper, descriptor string) string {
+	return MapSignature(remapper, descriptor)
+}
+
+// MapSignature maps the classes in a generic class, field or method signature. Malformed signatures are left as they are.
+func MapSignature(remapper Remapper, signature string) string {
+	if !strings.Contains(signature, "L") {
+		return signature
+	}
+	mapped, _ := VisitSignature(signature, func(class *ClassTypeSignature) {
+		name := class.Name
+		class.Name = remapper.MapClass(name)
+		outer := class.Name
+		for _, inner := range class.Inner {
+			name += "$" + inner.Name
+			mapped := remapper.MapClass(name)
+			inner.Name = innerName(mapped, outer, inner.Name)
+			outer = mapped
+		}
+	})
+	return mapped
+}
+
+// innerName returns the simple name of a mapped inner class, given the mapped name of its outer class.
+// The numbering javac prefixes to local class names is dropped.
+func innerName(mapped string, outer string, original string) string {
+	if strings.HasPrefix(mapped, outer+"$") {
+		return trimLocalIndex(mapped[len(outer)+1:])
+	}
+	if i := strings.LastIndexByte(mapped, '$'); i >= 0 {
+		return trimLocalIndex(mapped[i+1:])
+	}
+	if strings.Contains(mapped, "/") {
+		return mapped[strings.LastIndexByte(mapped, '/')+1:]
+	}
+	return original
+}
+
+func trimLocalIndex(name string) string {
+	if trimmed := strings.TrimLeft(name, "0123456789"); trimmed != "" {
+		return trimmed
+	}
+	return name
+}
+
+// JarRemapper is a pipeline stage remapping every class of a jar, moving class files to their new names
+// and updating the providers in META-INF/services and the classes named by the manifest.
+type JarRemapper struct {
+	Remapper Remapper
+}
+
+func (remapper *JarRemapper) TransformClass(member *JarMember, class *Class) (bool, error) {
+	member.Name = mapVersionedName(member.Name, func(name string) string {
+		if name, ok := strings.CutSuffix(name, ".class"); ok {
+			return remapper.Remapper.MapClass(name) + ".class"
+		}
+		return name
+	})
+	return RemapClass(class, remapper.Remapper), nil
+}
+
+func (remapper *JarRemapper) TransformResource(member *JarMember) error {
+	if err := remapManifestClasses(member, remapper.Remapper.MapClass); err != nil {
+		return err
+	}
+	return remapServices(member, remapper.Remapper)
+}
+
+// RemapJar remaps a jar through the class hierarchy of its classes and the given library jars, which must use the
+// same names as the jar.
+func RemapJar(filename string, remapper Remapper, libraries ...string) error {
+	hierarchy := NewClassHierarchy()
+	for _, library := range libraries {
+		if err := hierarchy.AddJar(library); err != nil {
+			return err
+		}
+	}
+	return NewPipeline(hierarchy, &JarRemapper{NewHierarchyRemapper(remapper, hierarchy)}).Run(filename)
+}
+
+// mapBinaryName maps a class name written with dots, as in service files and Class.forName.
+func mapBinaryName(remapper Remapper, name string) string {
+	return strings.ReplaceAll(remapper.MapClass(strings.ReplaceAll(name, ".", "/")), "/", ".")
+}
+
+// remapServices renames a META-INF/services file and the providers listed in it.
+func remapServices(member *JarMember, remapper Remapper) error {
+	service, ok := strings.CutPrefix(member.Name, "META-INF/services/")
+	if !ok || service == "" || strings.Contains(service, "/") {
+		return nil
+	}
+	member.Name = "META-INF/services/" + mapBinaryName(remapper, service)
+
+	if member.IsStreamed() {
+		if err := member.Load(); err != nil {
+			return err
+		}
+	}
+	lines := strings.Split(string(*member.Buffer.Data), "\n")
+	for i, line := range lines {
+		provider, _, _ := strings.Cut(line, "#")
+		provider = strings.TrimSpace(provider)
+		if provider != "" {
+			lines[i] = strings.Replace(line, provider, mapBinaryName(remapper, provider), 1)
+		}
+	}
+	*member.Buffer.Data = []byte(strings.Join(lines, "\n"))
+	return nil
+}
+
+// resourceRemapper maps the classes a jar names outside of the references of its class files: in the manifest and its
+// OSGi headers, META-INF/services files, Mixin configs and refmaps, .kotlin_module files, the Kotlin metadata of
+// classes and module descriptors. Packages are mapped as classes are, by their internal name. It is shared by the
+// stages moving classes across a jar, which have it analyze the jar's resources so Mixin configs are recognised.
+type resourceRemapper struct {
+	remapper Remapper
+	// Mixin configs and refmaps of every jar, by the nested jar holding them
+	mixins map[string]*mixinResources
+}
+
+func (r *resourceRemapper) AnalyzesResource(name string) bool {
+	return isMixinMetadata(name)
+}
+
+func (r *resourceRemapper) AnalyzeResources(members []*JarMember) error {
+	var err error
+	r.mixins, err = readMixinResources(members)
+	return err
+}
+
+func (r *resourceRemapper) TransformResource(member *JarMember) error {
+	if mixins := r.mixins[member.NestedIn()]; mixins.mayBeMixin(member.Name) {
+		if err := member.Load(); err != nil {
+			return err
+		}
+		var data []byte
+		var err error
+		switch mixins.kind(member.Name, *member.Buffer.Data) {
+		case mixinConfig:
+			data, err = relocateMixinConfig(*member.Buffer.Data, r.remapper.MapClass)
+		case mixinRefmap:
+			data, err = relocateRefmap(*member.Buffer.Data, r.remapper)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, member.Name)
+		}
+		if data != nil {
+			*member.Buffer.Data = data
+		}
+	}
+
+	if IsKotlinModule(member.Name) {
+		if err := member.Load(); err != nil {
+			return err
+		}
+		data, _, err := mapKotlinModule(*member.Buffer.Data, func(name string) string {
+			return mapOSGiPackage(name, r.remapper.MapClass)
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, member.Name)
+		}
+		*member.Buffer.Data = data
+	}
+
+	err := editManifestMember(member, func(manifest *Manifest) bool {
+		changed := mapManifestClasses(manifest, r.remapper.MapClass)
+		return mapOSGiHeaders(manifest, r.remapper.MapClass) || changed
+	})
+	if err != nil {
+		return err
+	}
+	return remapServices(member, r.remapper)
+}
+
+// TransformClass moves the class file and maps the class, along with its Kotlin metadata. Module descriptors only
+// name classes and packages in their Module attribute.
+func (r *resourceRemapper) TransformClass(member *JarMember, class *Class) (bool, error) {
+	member.Name = mapVersionedName(member.Name, func(name string) string {
+		if name, ok := strings.CutSuffix(name, ".class"); ok {
+			return r.remapper.MapClass(name) + ".class"
+		}
+		return name
+	})
+	if class.IsModuleInfo() {
+		return mapModule(class, r.remapper.MapClass, r.remapper.MapClass), nil
+	}
+	// The metadata is read before RemapClass repoints the constants holding it
+	var annotations []*Annotation
+	if class.HasAnnotation(KotlinMetadataDescriptor) {
+		annotations = class.GetAnnotations()
+	}
+	changed := RemapClass(class, r.remapper)
+	if annotations == nil {
+		return changed, nil
+	}
+	kotlinChanged, err := mapKotlinClassMetadata(class, annotations, r.remapper)
+	return changed || kotlinChanged, err
+}
+
+type classRemapper struct {
+	class            *Class
+	remapper         Remapper
+	owner            string
+	bootstrapMethods []BootstrapMethod
+	changed          bool
+
+	// The method whose attributes are being remapped
+	methodName       string
+	methodDescriptor string
+	static           bool
+}
+
+// RemapClass renames the class, its members and everything it references through the remapper, and
+// reports whether anything changed. Constants and attributes are repointed at new constants rather
+// than edited, so strings that happen to look like names are left alone unless the remapper
+// implements StringRemapper.
+func RemapClass(class *Class, remapper Remapper) bool {
+	r := &classRemapper{class: class, remapper: remapper, owner: class.GetClassName(), bootstrapMethods: class.GetBootstrapMethods()}
+
+	// Everything is computed from the pool as it was before any constant is repointed
+	var patches []func()
+	for _, constant := range class.ConstantPool {
+		if patch := r.constant(constant); patch != nil {
+			patches = append(patches, patch)
+		}
+	}
+
+	if patch := r.objectMethods(); patch != nil {
+		patches = append(patches, patch)
+	}
+
+	for i := range class.Fields {
+		field := &class.Fields[i]
+		descriptor := field.GetDescriptor()
+		r.utf8(&field.NameIndex, func(name string) string { return remapper.MapField(r.owner, name, descriptor) })
+		r.utf8(&field.DescriptorIndex, r.descriptor)
+		r.attributes(field.Attributes)
+	}
+	for i := range class.Methods {
+		method := &class.Methods[i]
+		descriptor := method.GetDescriptor()
+		r.methodName, r.methodDescriptor, r.static = method.GetName(), descriptor, method.HasModifier(ACC_STATIC)
+		r.utf8(&method.NameIndex, func(name string) string { return r.method(r.owner, name, descriptor) })
+		r.utf8(&method.DescriptorIndex, r.descriptor)
+		r.attributes(method.Attributes)
+	}
+	r.attributes(class.Attributes)
+
+	for _, patch := range patches {
+		patch()
+	}
+	if len(patches) > 0 {
+		class.pool = nil
+		r.changed = true
+	}
+	return r.changed
+}
+
+func (r *classRemapper) descriptor(descriptor string) string {
+	return MapDescriptor(r.remapper, descriptor)
+}
+
+func (r *classRemapper) signature(signature string) string {
+	return MapSignature(r.remapper, signature)
+}
+
+// method maps a method name, leaving constructors and static initializers alone.
+func (r *classRemapper) method(owner string, name string, descriptor string) string {
+	if name == "<init>" || name == "<clinit>" {
+		return name
+	}
+	return r.remapper.MapMethod(owner, name, descriptor)
+}
+
+// constant returns a function repointing the constant at its mapped content, or nil if it is unchanged.
+func (r *classRemapper) constant(constant Info) func() {
+	class := r.class
+	switch info := constant.(type) {
+	case *ClassInfo:
+		name := class.GetUtf8(info.NameIndex)
+		if mapped := MapType(r.remapper, name); mapped != name {
+			return func() { info.NameIndex = class.AddUtf8(mapped) }
+		}
+	case *FieldRefInfo:
+		return r.ref(info, false)
+	case *MethodRefInfo:
+		return r.ref(&info.FieldRefInfo, true)
+	case *InterfaceMethodRefInfo:
+		return r.ref(&info.FieldRefInfo, true)
+	case *MethodTypeInfo:
+		descriptor := class.GetUtf8(info.DescriptorIndex)
+		if mapped := r.descriptor(descriptor); mapped != descriptor {
+			return func() { info.DescriptorIndex = class.AddUtf8(mapped) }
+		}
+	case *InvokeDynamicInfo:
+		return r.nameAndType(&info.NameAndTypeIndex, func(name string, descriptor string) string {
+			return r.lambda(info.BootstrapMethodAttrIndex, name, descriptor)
+		})
+	case *DynamicInfo:
+		return r.nameAndType(&info.NameAndTypeIndex, func(name string, descriptor string) string { return name })
+	case *StringInfo:
+		if remapper, ok := r.remapper.(StringRemapper); ok {
+			value := class.GetUtf8(info.StringIndex)
+			if mapped := remapper.MapString(value); mapped != value {
+				return func() { info.StringIndex = class.AddUtf8(mapped) }
+			}
+		}
+	}
+	return nil
+}
+
+// lambda maps the name of an invokedynamic call site. For lambdas and method references the name is that
+// of the method implemented from the functional interface the call site returns.
+func (r *classRemapper) lambda(bootstrap uint16, name string, descriptor string) string {
+	if int(bootstrap) >= len(r.bootstrapMethods) {
+		return name
+	}
+	method := r.bootstrapMethods[bootstrap]
+	if len(method.Arguments) == 0 || r.class.bootstrapOwner(method) != "java/lang/invoke/LambdaMetafactory" {
+		return name
+	}
+	samType, ok := r.class.GetConstant(method.Arguments[0]).(*MethodTypeInfo)
+	returned := descriptor[strings.IndexByte(descriptor, ')')+1:]
+	if !ok || !strings.HasPrefix(returned, "L") {
+		return name
+	}
+	return r.remapper.MapMethod(returned[1:len(returned)-1], name, r.class.GetUtf8(samType.DescriptorIndex))
+}
+
+// objectMethods maps the field names ObjectMethods bootstrap methods receive joined by ; in a string, which records
+// use to implement equals, hashCode and toString. The getter handles following the string name the same fields.
+func (r *classRemapper) objectMethods() func() {
+	class := r.class
+	mapped := map[int]string{}
+	for i, method := range r.bootstrapMethods {
+		if len(method.Arguments) < 2 || class.bootstrapOwner(method) != "java/lang/runtime/ObjectMethods" {
+			continue
+		}
+		names, ok := class.GetConstant(method.Arguments[1]).(*StringInfo)
+		if !ok || class.GetUtf8(names.StringIndex) == "" {
+			continue
+		}
+		value := class.GetUtf8(names.StringIndex)
+		fields := strings.Split(value, ";")
+		if len(method.Arguments) != 2+len(fields) {
+			continue
+		}
+		for j, field := range fields {
+			if handle, ok := class.GetConstant(method.Arguments[2+j]).(*MethodHandleInfo); ok {
+				if owner, name, descriptor := class.GetRef(handle.ReferenceIndex); name == field {
+					fields[j] = r.remapper.MapField(owner, name, descriptor)
+				}
+			}
+		}
+		if joined := strings.Join(fields, ";"); joined != value {
+			mapped[i] = joined
+		}
+	}
+	if len(mapped) == 0 {
+		return nil
+	}
+	return func() {
+		methods := r.bootstrapMethods
+		for i, names := range mapped {
+			methods[i].Arguments = slices.Clone(methods[i].Arguments)
+			methods[i].Arguments[1] = class.AddString(names)
+		}
+		class.SetBootstrapMethods(methods)
+	}
+}
+
+func (r *classRemapper) ref(ref *FieldRefInfo, method bool) func() {
+	owner := r.class.GetClassInfoName(ref.ClassIndex)
+	return r.nameAndType(&ref.NameAndTypeIndex, func(name string, descriptor string) string {
+		if method {
+			return r.method(owner, name, descriptor)
+		}
+		return r.remapper.MapField(owner, name, descriptor)
+	})
+}
+
+// nameAndType maps the name and descriptor of a NameAndType, returning a function that repoints index at the result.
+func (r *classRemapper) nameAndType(index *uint16, mapName func(name string, descriptor string) string) func() {
+	name, descriptor := r.class.GetNameAndType(*index)
+	mappedName, mappedDescriptor := mapName(name, descriptor), r.descriptor(descriptor)
+	if mappedName == name && mappedDescriptor == descriptor {
+		return nil
+	}
+	r.changed = true
+	return func() { *index = r.class.AddNameAndType(mappedName, mappedDescriptor) }
+}
+
+// utf8 repoints the Utf8 index at its mapped content.
+func (r *classRemapper) utf8(index *uint16, mapper func(string) string) {
+	if *index == 0 {
+		return
+	}
+	value := r.class.GetUtf8(*index)
+	if mapped := mapper(value); mapped != value {
+		*index = r.class.AddUtf8(mapped)
+		r.changed = true
+	}
+}
+
+// patch repoints the Utf8 index stored at data[i:] at its mapped content.
+func (r *classRemapper) patch(data []byte, i int, mapper func(string) string) {
+	index := binary.BigEndian.Uint16(data[i:])
+	r.utf8(&index, mapper)
+	binary.BigEndian.PutUint16(data[i:], index)
+}
+
+func (r *classRemapper) attributes(attributes []AttributeInfo) {
+	for i := range attributes {
+		attribute := &attributes[i]
+		switch r.class.GetAttributeName(attribute) {
+		case "Signature", "EnclosingMethod", "MethodParameters", "InnerClasses", "Record", "Code", "LocalVariableTable", "LocalVariableTypeTable",
+			"RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations", "RuntimeVisibleParameterAnnotations",
+			"RuntimeInvisibleParameterAnnotations", "RuntimeVisibleTypeAnnotations", "RuntimeInvisibleTypeAnnotations", "AnnotationDefault":
+			// The data may still alias the bytes the class was read from
+			attribute.Data = slices.Clone(attribute.Data)
+			r.attribute(r.class.GetAttributeName(attribute), attribute.Data)
+		}
+	}
+}
+
+func u16(data []byte, i int) int {
+	return int(binary.BigEndian.Uint16(data[i:]))
+}
+
+// attribute patches the constant pool indexes in the data of an attribute in place.
+func (r *classRemapper) attribute(name string, data []byte) {
+	class := r.class
+	switch name {
+	case "Signature":
+		r.patch(data, 0, r.signature)
+	case "EnclosingMethod":
+		if index := uint16(u16(data, 2)); index != 0 {
+			owner := class.GetClassInfoName(uint16(u16(data, 0)))
+			if patch := r.nameAndType(&index, func(name string, descriptor string) string { return r.method(owner, name, descriptor) }); patch != nil {
+				patch()
+				binary.BigEndian.PutUint16(data[2:], index)
+			}
+		}
+	case "InnerClasses":
+		for i, count := 2, u16(data, 0); count > 0; i, count = i+8, count-1 {
+			if u16(data, i+4) == 0 {
+				continue
+			}
+			inner := class.GetClassInfoName(uint16(u16(data, i)))
+			mapped := MapType(r.remapper, inner)
+			if mapped == inner {
+				continue
+			}
+			outer := inner
+			if index := u16(data, i+2); index != 0 {
+				outer = MapType(r.remapper, class.GetClassInfoName(uint16(index)))
+			}
+			r.patch(data, i+4, func(simple string) string { return innerName(mapped, outer, simple) })
+		}
+	case "Record":
+		for i, count := 2, u16(data, 0); count > 0; count-- {
+			descriptor := class.GetUtf8(uint16(u16(data, i+2)))
+			r.patch(data, i, func(name string) string { return r.remapper.MapField(r.owner, name, descriptor) })
+			r.patch(data, i+2, r.descriptor)
+			i = r.nestedAttributes(data, i+4)
+		}
+	case "Code":
+		i := 8 + int(binary.BigEndian.Uint32(data[4:]))
+		i += 2 + 8*u16(data, i)
+		r.nestedAttributes(data, i)
+	case "LocalVariableTable":
+		for i, count := 2, u16(data, 0); count > 0; i, count = i+10, count-1 {
+			r.local(data, i+4, u16(data, i+8))
+			r.patch(data, i+6, r.descriptor)
+		}
+	case "LocalVariableTypeTable":
+		for i, count := 2, u16(data, 0); count > 0; i, count = i+10, count-1 {
+			r.local(data, i+4, u16(data, i+8))
+			r.patch(data, i+6, r.signature)
+		}
+	case "MethodParameters":
+		slot := 0
+		if !r.static {
+			slot = 1
+		}
+		arguments := methodArguments(r.methodDescriptor)
+		for i, parameter := 1, 0; parameter < int(data[0]) && parameter < len(arguments); i, parameter = i+4, parameter+1 {
+			r.local(data, i, slot)
+			slot++
+			if arguments[parameter] == "J" || arguments[parameter] == "D" {
+				slot++
+			}
+		}
+	case "RuntimeVisibleAnnotations", "RuntimeInvisibleAnnotations":
+		for i, count := 2, u16(data, 0); count > 0; count-- {
+			i = r.annotation(data, i)
+		}
+	case "RuntimeVisibleParameterAnnotations", "RuntimeInvisibleParameterAnnotations":
+		i := 1
+		for parameters := int(data[0]); parameters > 0; parameters-- {
+			count := u16(data, i)
+			for i += 2; count > 0; count-- {
+				i = r.annotation(data, i)
+			}
+		}
+	case "RuntimeVisibleTypeAnnotations", "RuntimeInvisibleTypeAnnotations":
+		for i, count := 2, u16(data, 0); count > 0; count-- {
+			i = r.annotation(data, typeAnnotationTarget(data, i))
+		}
+	case "AnnotationDefault":
+		r.elementValue(data, 0)
+	}
+}
+
+// local patches the name of the local variable at slot index, if the remapper renames locals.
+func (r *classRemapper) local(data []byte, i int, index int) {
+	if remapper, ok := r.remapper.(LocalRemapper); ok {
+		r.patch(data, i, func(name string) string {
+			return remapper.MapLocal(r.owner, r.methodName, r.methodDescriptor, index, name)
+		})
+	}
+}
+
+// nestedAttributes patches the attribute count and attributes starting at data[i:], returning the offset after them.
+func (r *classRemapper) nestedAttributes(data []byte, i int) int {
+	count := u16(data, i)
+	for i += 2; count > 0; count-- {
+		length := int(binary.BigEndian.Uint32(data[i+2:]))
+		r.attribute(r.class.GetUtf8(uint16(u16(data, i))), data[i+6:i+6+length])
+		i += 6 + length
+	}
+	return i
+}
+
+// typeAnnotationTarget skips the target_info and type_path of a type_annotation starting at data[i:].
+func typeAnnotationTarget(data []byte, i int) int {
+	i = typeAnnotationPath(data, i)
+	return i + 1 + 2*int(data[i])
+}
+
+// annotation maps an annotation and its element values. Elements are the methods of the annotation type, so their
+// names are mapped as methods returning the type of their value.
+func (r *classRemapper) annotation(data []byte, i int) int {
+	owner := r.class.GetUtf8(uint16(u16(data, i)))
+	if strings.HasPrefix(owner, "L") {
+		owner = owner[1 : len(owner)-1]
+	}
+	r.patch(data, i, r.descriptor)
+	count := u16(data, i+2)
+	for i += 4; count > 0; count-- {
+		if descriptor := r.elementType(data, i+2); descriptor != "" {
+			r.patch(data, i, func(name string) string { return r.remapper.MapMethod(owner, name, "()"+descriptor) })
+		}
+		i = r.elementValue(data, i+2)
+	}
+	return i
+}
+
+// elementType returns the descriptor of the type of an element value, or an empty string for an empty array, whose
+// component type isn't recorded.
+func (r *classRemapper) elementType(data []byte, i int) string {
+	switch tag := data[i]; tag {
+	case 'e', '@':
+		return r.class.GetUtf8(uint16(u16(data, i+1)))
+	case 's':
+		return "Ljava/lang/String;"
+	case 'c':
+		return "Ljava/lang/Class;"
+	case '[':
+		if u16(data, i+1) == 0 {
+			return ""
+		}
+		if component := r.elementType(data, i+3); component != "" {
+			return "[" + component
+		}
+		return ""
+	default:
+		return string(tag)
+	}
+}
+
+func (r *classRemapper) elementValue(data []byte, i int) int {
+	switch data[i] {
+	case 'e':
+		descriptor := r.class.GetUtf8(uint16(u16(data, i+1)))
+		owner := descriptor
+		if strings.HasPrefix(owner, "L") {
+			owner = owner[1 : len(owner)-1]
+		}
+		r.patch(data, i+1, r.descriptor)
+		r.patch(data, i+3, func(name string) string { return r.remapper.MapField(owner, name, descriptor) })
+		return i + 5
+	case 'c':
+		r.patch(data, i+1, r.descriptor)
+		return i + 3
+	case '@':
+		return r.annotation(data, i+1)
+	case '[':
+		count := u16(data, i+1)
+		for i += 3; count > 0; count-- {
+			i = r.elementValue(data, i)
+		}
+		return i
+	}
+	return i + 3
+}
@@ -0,0 +1,77 @@
+package babe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemapAnnotationElements(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		// descriptor is the return type of the element, empty when it can't be told from the value
+		descriptor string
+		mapped     any
+	}{
+		{"byte", int8(1), "B", int8(1)},
+		{"char", uint16('c'), "C", uint16('c')},
+		{"double", 1.5, "D", 1.5},
+		{"float", float32(1.5), "F", float32(1.5)},
+		{"int", int32(1), "I", int32(1)},
+		{"long", int64(1), "J", int64(1)},
+		{"short", int16(1), "S", int16(1)},
+		{"boolean", true, "Z", true},
+		{"string", "a/Foo", "Ljava/lang/String;", "a/Foo"},
+		{"enum", EnumValue{"La/Kind;", "ONE"}, "La/Kind;", EnumValue{"Lb/Kind;", "FIRST"}},
+		{"class", ClassConstant{"La/Foo;"}, "Ljava/lang/Class;", ClassConstant{"Lb/Foo;"}},
+		{"annotation", &Annotation{Descriptor: "La/Inner;", Elements: []AnnotationElement{{"value", "text"}}},
+			"La/Inner;", &Annotation{Descriptor: "Lb/Inner;", Elements: []AnnotationElement{{"text", "text"}}}},
+		{"array", []any{ClassConstant{"La/Foo;"}, ClassConstant{"I"}}, "[Ljava/lang/Class;", []any{ClassConstant{"Lb/Foo;"}, ClassConstant{"I"}}},
+		{"array of annotations", []any{&Annotation{Descriptor: "La/Inner;", Elements: []AnnotationElement{{"value", "text"}}}},
+			"[La/Inner;", []any{&Annotation{Descriptor: "Lb/Inner;", Elements: []AnnotationElement{{"text", "text"}}}}},
+		{"empty array", []any{}, "", []any{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			remapper := &SimpleRemapper{
+				Classes: map[string]string{"a/Ann": "b/Ann", "a/Inner": "b/Inner", "a/Kind": "b/Kind", "a/Foo": "b/Foo"},
+				Fields:  map[string]string{"a/Kind.ONE": "FIRST"},
+				Methods: map[string]string{
+					"a/Ann.value()" + test.descriptor:   "renamed",
+					"a/Inner.value()Ljava/lang/String;": "text",
+					// Elements of other types are different methods
+					"a/Ann.value()V": "wrong",
+				},
+			}
+			class := buildTestClass(t, NewClassBuilder("a/User").
+				Field(ACC_PUBLIC, "field", "I", nil).
+				Method(ACC_PUBLIC, "run", "(I)V", emptyBody))
+			annotations := []*Annotation{
+				{Descriptor: "La/Ann;", Visible: true, Elements: []AnnotationElement{{"value", test.value}}},
+				// Elements of the same name in other annotations are different methods
+				{Descriptor: "La/Other;", Elements: []AnnotationElement{{"value", test.value}}},
+			}
+			class.SetAnnotations(annotations)
+			class.Fields[0].SetTypeAnnotations([]*TypeAnnotation{{TargetType: 0x13, Target: []byte{}, Annotation: *annotations[0]}})
+			class.Methods[0].SetParameterAnnotations([][]*Annotation{annotations[:1]})
+			RemapClass(class, remapper)
+
+			name := "renamed"
+			if test.descriptor == "" {
+				name = "value"
+			}
+			mapped := &Annotation{Descriptor: "Lb/Ann;", Visible: true, Elements: []AnnotationElement{{name, test.mapped}}}
+			other := &Annotation{Descriptor: "La/Other;", Elements: []AnnotationElement{{"value", test.mapped}}}
+			read := rereadClass(t, class)
+			if got := read.GetAnnotations(); !reflect.DeepEqual(got, []*Annotation{mapped, other}) {
+				t.Errorf("class annotations = %#v, want %#v", got, []*Annotation{mapped, other})
+			}
+			if got := read.Fields[0].GetTypeAnnotations(); len(got) != 1 || !reflect.DeepEqual(&got[0].Annotation, mapped) {
+				t.Errorf("type annotations = %#v", got)
+			}
+			if got := read.Methods[0].GetParameterAnnotations(); !reflect.DeepEqual(got, [][]*Annotation{{mapped}}) {
+				t.Errorf("parameter annotations = %#v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package babe
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrClassNotFound = errors.New("jarhax: class not found")
+var ErrClassExists = errors.New("jarhax: class already exists")
+
+// ClassRenamer renames classes across a jar. Classes maps internal names to their new names; nested
+// classes are renamed along with their outer class. Every reference to a renamed class is updated in classes and in
+// the resources relocation rewrites: the manifest and its OSGi headers, META-INF/services files, Mixin configs and
+// refmaps, Kotlin metadata and module descriptors. It is an analyzer, so the whole jar is checked for missing classes
+// and name conflicts before anything is changed.
+type ClassRenamer struct {
+	Classes map[string]string
+	// Strings also renames String constants holding exactly the name of a renamed class, as passed to Class.forName.
+	// Unrelated strings that happen to equal a class name are renamed too.
+	Strings   bool
+	resources resourceRemapper
+	// packages of every jar once renamed, by the nested jar holding them
+	packages map[string]map[string]bool
+}
+
+type classRenameRemapper struct {
+	SimpleRemapper
+}
+
+// MapString maps strings holding exactly the internal or binary name of a renamed class.
+func (remapper *classRenameRemapper) MapString(value string) string {
+	if mapped, ok := remapper.Classes[value]; ok {
+		return mapped
+	}
+	slashed := strings.ReplaceAll(value, ".", "/")
+	if mapped, ok := remapper.Classes[slashed]; ok && strings.Contains(value, ".") {
+		return strings.ReplaceAll(mapped, "/", ".")
+	}
+	return value
+}
+
+func (renamer *ClassRenamer) Analyze(members []*JarMember) error {
+	classes := map[string]bool{}
+	for _, member := range members {
+		// Versioned variants of multi-release jars are the same class as their base
+		_, base := SplitVersionedName(member.Name)
+		if name, ok := strings.CutSuffix(base, ".class"); ok {
+			classes[name] = true
+		}
+	}
+
+	mapping := map[string]string{}
+	var errs []error
+	for from, to := range renamer.Classes {
+		if !classes[from] {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrClassNotFound, from))
+			continue
+		}
+		mapping[from] = to
+		for name := range classes {
+			if strings.HasPrefix(name, from+"$") {
+				mapping[name] = to + name[len(from):]
+			}
+		}
+	}
+
+	targets := map[string]string{}
+	for _, from := range sortedKeys(mapping) {
+		to := mapping[from]
+		if _, renamed := mapping[to]; classes[to] && !renamed {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrClassExists, to))
+		} else if other, ok := targets[to]; ok {
+			errs = append(errs, fmt.Errorf("%w: %s and %s would both be renamed to %s", ErrClassExists, other, from, to))
+		}
+		targets[to] = from
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	renamer.resources.remapper = &SimpleRemapper{Classes: mapping}
+	if renamer.Strings {
+		renamer.resources.remapper = &classRenameRemapper{SimpleRemapper{Classes: mapping}}
+	}
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = member.scopedName()
+	}
+	renamer.packages = scopedPackages(names, func(name string) string {
+		return mapVersionedName(name, func(name string) string {
+			if class, ok := strings.CutSuffix(name, ".class"); ok {
+				return renamer.resources.remapper.MapClass(class) + ".class"
+			}
+			return name
+		})
+	})
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (renamer *ClassRenamer) AnalyzesResource(name string) bool {
+	return renamer.resources.AnalyzesResource(name)
+}
+
+func (renamer *ClassRenamer) AnalyzeResources(members []*JarMember) error {
+	return renamer.resources.AnalyzeResources(members)
+}
+
+func (renamer *ClassRenamer) TransformClass(member *JarMember, class *Class) (bool, error) {
+	changed, err := renamer.resources.TransformClass(member, class)
+	if err == nil && class.IsModuleInfo() {
+		changed = syncModulePackages(class, renamer.packages[member.NestedIn()]) || changed
+	}
+	return changed, err
+}
+
+func (renamer *ClassRenamer) TransformResource(member *JarMember) error {
+	return renamer.resources.TransformResource(member)
+}
+
+// RenameClassInJar renames a class and its nested classes, updating every reference to them in the jar.
+// Names may use dots or slashes.
+func RenameClassInJar(filename string, from string, to string) error {
+	from, to = strings.ReplaceAll(from, ".", "/"), strings.ReplaceAll(to, ".", "/")
+	return NewPipeline(&ClassRenamer{Classes: map[string]string{from: to}}).Run(filename)
+}
@@ -0,0 +1,207 @@
+package babe
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// innerClasses returns the inner class, outer class and simple name of each entry of the InnerClasses attribute.
+func innerClasses(class *Class) [][3]string {
+	attribute := class.FindAttribute(class.Attributes, "InnerClasses")
+	if attribute == nil {
+		return nil
+	}
+	var entries [][3]string
+	data := attribute.Data
+	for i, count := 2, u16(data, 0); count > 0; i, count = i+8, count-1 {
+		entries = append(entries, [3]string{
+			class.GetClassInfoName(uint16(u16(data, i))),
+			class.GetClassInfoName(uint16(u16(data, i+2))),
+			class.GetUtf8(uint16(u16(data, i+4))),
+		})
+	}
+	return entries
+}
+
+// classNames returns the names of the classes a class references.
+func classNames(class *Class) []string {
+	var names []string
+	for _, constant := range class.ConstantPool {
+		if info, ok := constant.(*ClassInfo); ok {
+			names = append(names, class.GetUtf8(info.NameIndex))
+		}
+	}
+	return names
+}
+
+func testClassEntry(t *testing.T, builder *ClassBuilder) zipEntry {
+	t.Helper()
+	class, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zipEntry{class.GetClassName() + ".class", string(classBytes(class))}
+}
+
+func renameTestJar(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), "test.jar")
+	writeTestZip(t, filename, []zipEntry{
+		{ManifestName, "Manifest-Version: 1.0\r\nMain-Class: a.Foo\r\nMixinConfigs: x.json\r\n\r\n"},
+		{"META-INF/services/a.Foo", "a.Foo$Inner\n"},
+		{"x.json", `{"package": "a.mixin", "refmap": "x-refmap.json", "mixins": ["FooMixin"]}`},
+		{"x-refmap.json", `{"mappings": {"a/mixin/FooMixin": {"run": "La/Foo;run()V"}}}`},
+		testClassEntry(t, NewClassBuilder("a/Foo").
+			InnerClass("a/Foo$Inner", "a/Foo", "Inner", ACC_PUBLIC|ACC_STATIC).
+			Field(ACC_PRIVATE, "inner", "La/Foo$Inner;", nil).
+			Method(ACC_PUBLIC, "run", "()V", emptyBody)),
+		testClassEntry(t, NewClassBuilder("a/Foo$Inner").
+			InnerClass("a/Foo$Inner", "a/Foo", "Inner", ACC_PUBLIC|ACC_STATIC).
+			Method(ACC_PUBLIC, "get", "()La/Foo;", func(code *CodeBuilder) {
+				code.Push(nil)
+				code.VisitInsn(ARETURN)
+			})),
+		testClassEntry(t, NewClassBuilder("a/FooBar").Field(ACC_PUBLIC, "value", "I", nil)),
+		testClassEntry(t, NewClassBuilder("a/User").
+			Field(ACC_PUBLIC, "foo", "La/Foo;", nil).
+			Method(ACC_PUBLIC|ACC_STATIC, "use", "(La/Foo;)La/Foo$Inner;", func(code *CodeBuilder) {
+				code.VisitVarInsn(ALOAD, 0)
+				code.InvokeVirtual("a/Foo", "run", "()V")
+				code.Push("a.Foo")
+				code.VisitInsn(POP)
+				code.Push(nil)
+				code.VisitInsn(ARETURN)
+			})),
+		testClassEntry(t, NewClassBuilder("a/mixin/FooMixin")),
+	})
+	return filename
+}
+
+func TestRenameClasses(t *testing.T) {
+	filename := renameTestJar(t)
+	renamer := &ClassRenamer{Classes: map[string]string{"a/Foo": "c/Bar", "a/mixin/FooMixin": "a/mixin/BarMixin"}}
+	if err := NewPipeline(renamer).Run(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := map[string]string{}
+	var names []string
+	for _, entry := range readTestZip(t, filename) {
+		entries[entry.name] = entry.data
+		names = append(names, entry.name)
+	}
+	slices.Sort(names)
+	want := []string{"META-INF/MANIFEST.MF", "META-INF/services/c.Bar", "a/FooBar.class", "a/User.class", "a/mixin/BarMixin.class", "c/Bar$Inner.class", "c/Bar.class", "x-refmap.json", "x.json"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("entries = %v, want %v", names, want)
+	}
+
+	classes := map[string]*Class{}
+	for name, data := range entries {
+		if class, ok := strings.CutSuffix(name, ".class"); ok {
+			classes[class] = &Class{}
+			if err := classes[class].Read([]byte(data)); err != nil {
+				t.Fatal(err)
+			}
+			if read := classes[class].GetClassName(); read != class {
+				t.Errorf("%s holds class %s", name, read)
+			}
+		}
+	}
+	for name, class := range classes {
+		for _, referenced := range classNames(class) {
+			if strings.HasPrefix(referenced, "a/Foo") && referenced != "a/FooBar" {
+				t.Errorf("%s still references %s", name, referenced)
+			}
+		}
+	}
+	inner := [3]string{"c/Bar$Inner", "c/Bar", "Inner"}
+	for _, name := range []string{"c/Bar", "c/Bar$Inner"} {
+		if entries := innerClasses(classes[name]); len(entries) != 1 || entries[0] != inner {
+			t.Errorf("inner classes of %s = %v, want %v", name, entries, inner)
+		}
+	}
+	if field := classes["c/Bar"].FindField("inner", "Lc/Bar$Inner;"); field == nil {
+		t.Error("field of the renamed inner class type not found")
+	}
+	if method := classes["c/Bar$Inner"].FindMethod("get", "()Lc/Bar;"); method == nil {
+		t.Error("method returning the renamed class not found")
+	}
+
+	user := classes["a/User"]
+	if user.FindField("foo", "Lc/Bar;") == nil || user.FindMethod("use", "(Lc/Bar;)Lc/Bar$Inner;") == nil {
+		t.Error("members of a/User not renamed")
+	}
+	for i, constant := range user.ConstantPool {
+		switch info := constant.(type) {
+		case *MethodRefInfo:
+			if owner, name, _ := user.GetRef(uint16(i + 1)); name == "run" && owner != "c/Bar" {
+				t.Errorf("a/User calls %s.run", owner)
+			}
+		case *StringInfo:
+			if s := user.GetUtf8(info.StringIndex); s != "a.Foo" {
+				t.Errorf("string constant renamed to %q", s)
+			}
+		}
+	}
+
+	resources := map[string]string{
+		ManifestName:              "Manifest-Version: 1.0\r\nMain-Class: c.Bar\r\nMixinConfigs: x.json\r\n\r\n",
+		"META-INF/services/c.Bar": "c.Bar$Inner\n",
+		"x.json":                  `{"package": "a.mixin", "refmap": "x-refmap.json", "mixins": ["BarMixin"]}`,
+		"x-refmap.json":           `{"mappings": {"a/mixin/BarMixin": {"run": "Lc/Bar;run()V"}}}`,
+	}
+	for name, data := range resources {
+		if entries[name] != data {
+			t.Errorf("%s = %q, want %q", name, entries[name], data)
+		}
+	}
+}
+
+func TestRenameClassesConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		classes map[string]string
+		err     error
+	}{
+		{"missing class", map[string]string{"a/Missing": "a/Other"}, ErrClassNotFound},
+		{"inner class alone", map[string]string{"a/Foo$Missing": "a/Other"}, ErrClassNotFound},
+		{"existing class", map[string]string{"a/Foo": "a/FooBar"}, ErrClassExists},
+		{"existing inner class", map[string]string{"a/FooBar": "a/Foo$Inner"}, ErrClassExists},
+		{"same name", map[string]string{"a/User": "c/Bar", "a/FooBar": "c/Bar"}, ErrClassExists},
+		{"inner class of another rename", map[string]string{"a/Foo": "c/Bar", "a/User": "c/Bar$Inner"}, ErrClassExists},
+		{"swapped", map[string]string{"a/User": "a/FooBar", "a/FooBar": "a/User"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := renameTestJar(t)
+			before := readTestZip(t, filename)
+			err := NewPipeline(&ClassRenamer{Classes: test.classes}).Run(filename)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			if err != nil && !slices.Equal(readTestZip(t, filename), before) {
+				t.Error("a failed rename changed the jar")
+			}
+		})
+	}
+}
+
+func TestRenameClassInJar(t *testing.T) {
+	filename := renameTestJar(t)
+	if err := RenameClassInJar(filename, "a.FooBar", "c.Baz"); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, entry := range readTestZip(t, filename) {
+		found = found || entry.name == "c/Baz.class"
+		if entry.name == "a/FooBar.class" {
+			t.Error("a/FooBar.class is still there")
+		}
+	}
+	if !found {
+		t.Error("c/Baz.class not found")
+	}
+}
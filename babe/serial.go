@@ -0,0 +1,198 @@
+package babe
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// jdkSerializable lists JDK classes and interfaces commonly extended by serializable classes, as the hierarchy of a
+// jar doesn't include the JDK.
+var jdkSerializable = map[string]bool{
+	"java/io/Serializable": true, "java/io/Externalizable": true,
+	"java/lang/Throwable": true, "java/lang/Exception": true, "java/lang/RuntimeException": true, "java/lang/Error": true,
+	"java/lang/IllegalArgumentException": true, "java/lang/IllegalStateException": true,
+	"java/lang/UnsupportedOperationException": true, "java/lang/IndexOutOfBoundsException": true,
+	"java/lang/NullPointerException": true, "java/lang/ClassCastException": true, "java/lang/ArithmeticException": true,
+	"java/lang/NumberFormatException": true, "java/lang/SecurityException": true, "java/lang/InterruptedException": true,
+	"java/lang/ReflectiveOperationException": true, "java/lang/AssertionError": true, "java/lang/LinkageError": true,
+	"java/lang/Number": true, "java/io/IOException": true, "java/io/UncheckedIOException": true,
+	"java/io/FileNotFoundException": true, "java/util/NoSuchElementException": true,
+	"java/util/ConcurrentModificationException": true, "java/util/concurrent/ExecutionException": true,
+	"java/util/concurrent/CancellationException": true, "java/util/concurrent/CompletionException": true,
+	"java/util/concurrent/TimeoutException": true, "java/security/GeneralSecurityException": true,
+	"java/util/ArrayList": true, "java/util/LinkedList": true, "java/util/ArrayDeque": true, "java/util/PriorityQueue": true,
+	"java/util/HashMap": true, "java/util/LinkedHashMap": true, "java/util/TreeMap": true, "java/util/EnumMap": true,
+	"java/util/HashSet": true, "java/util/LinkedHashSet": true, "java/util/TreeSet": true,
+	"java/util/AbstractMap$SimpleEntry": true, "java/util/AbstractMap$SimpleImmutableEntry": true,
+	"java/util/concurrent/ConcurrentHashMap": true, "java/util/concurrent/ConcurrentLinkedQueue": true,
+	"java/util/concurrent/CopyOnWriteArrayList": true, "java/util/concurrent/atomic/AtomicBoolean": true,
+	"java/util/concurrent/atomic/AtomicInteger": true, "java/util/concurrent/atomic/AtomicLong": true,
+	"java/util/concurrent/atomic/AtomicReference": true, "java/util/Date": true, "java/util/EventObject": true,
+	"java/util/Random": true, "java/text/Format": true, "java/security/Permission": true,
+	"java/security/BasicPermission": true, "java/math/BigInteger": true, "java/math/BigDecimal": true,
+}
+
+// modifiers returns the access flags reflection reports for the class, which are those of its InnerClasses entry
+// for nested classes.
+func (class *Class) modifiers() int {
+	if attribute := class.FindAttribute(class.Attributes, "InnerClasses"); attribute != nil {
+		data := attribute.Data
+		for i, count := 2, u16(data, 0); count > 0; i, count = i+8, count-1 {
+			if class.GetClassInfoName(uint16(u16(data, i))) == class.GetClassName() {
+				return u16(data, i+6)
+			}
+		}
+	}
+	return int(class.AccessFlags)
+}
+
+// SerialVersionUID computes the serialVersionUID the JVM gives serializable classes that don't declare one, following
+// section 4.6 of the Java Object Serialization Specification. It changes with the names, modifiers and descriptors of
+// the class and its members, synthetic ones included.
+func (class *Class) SerialVersionUID() int64 {
+	hash := sha1.New()
+	writeUTF := func(s string) {
+		hash.Write(binary.BigEndian.AppendUint16(nil, uint16(len(s))))
+		hash.Write([]byte(s))
+	}
+	writeInt := func(value int) {
+		hash.Write(binary.BigEndian.AppendUint32(nil, uint32(value)))
+	}
+	dotted := func(s string) string {
+		return strings.ReplaceAll(s, "/", ".")
+	}
+
+	type member struct {
+		name       string
+		access     int
+		descriptor string
+	}
+	var constructors, methods []member
+	initializer := false
+	for i := range class.Methods {
+		method := &class.Methods[i]
+		entry := member{method.GetName(), int(method.AccessFlags), method.GetDescriptor()}
+		switch entry.name {
+		case "<clinit>":
+			initializer = true
+		case "<init>":
+			constructors = append(constructors, entry)
+		default:
+			methods = append(methods, entry)
+		}
+	}
+
+	writeUTF(dotted(class.GetClassName()))
+	access := class.modifiers() & (ACC_PUBLIC | ACC_FINAL | ACC_INTERFACE | ACC_ABSTRACT)
+	if access&ACC_INTERFACE != 0 {
+		if len(methods) > 0 {
+			access |= ACC_ABSTRACT
+		} else {
+			access &^= ACC_ABSTRACT
+		}
+	}
+	writeInt(access)
+
+	interfaces := class.GetInterfaceNames()
+	sort.Strings(interfaces)
+	for _, name := range interfaces {
+		writeUTF(dotted(name))
+	}
+
+	var fields []member
+	for _, field := range class.Fields {
+		fields = append(fields, member{field.GetName(), int(field.AccessFlags), field.GetDescriptor()})
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+	for _, field := range fields {
+		access := field.access & (ACC_PUBLIC | ACC_PRIVATE | ACC_PROTECTED | ACC_STATIC | ACC_FINAL | ACC_VOLATILE | ACC_TRANSIENT)
+		if access&ACC_PRIVATE == 0 || access&(ACC_STATIC|ACC_TRANSIENT) == 0 {
+			writeUTF(field.name)
+			writeInt(access)
+			writeUTF(field.descriptor)
+		}
+	}
+
+	if initializer {
+		writeUTF("<clinit>")
+		writeInt(ACC_STATIC)
+		writeUTF("()V")
+	}
+
+	sort.SliceStable(constructors, func(i, j int) bool { return constructors[i].descriptor < constructors[j].descriptor })
+	sort.SliceStable(methods, func(i, j int) bool {
+		if methods[i].name != methods[j].name {
+			return methods[i].name < methods[j].name
+		}
+		return methods[i].descriptor < methods[j].descriptor
+	})
+	for _, method := range append(constructors, methods...) {
+		access := method.access & (ACC_PUBLIC | ACC_PRIVATE | ACC_PROTECTED | ACC_STATIC | ACC_FINAL | ACC_SYNCHRONIZED |
+			ACC_NATIVE | ACC_ABSTRACT | ACC_STRICT)
+		if access&ACC_PRIVATE == 0 {
+			writeUTF(method.name)
+			writeInt(access)
+			writeUTF(dotted(method.descriptor))
+		}
+	}
+
+	return int64(binary.LittleEndian.Uint64(hash.Sum(nil)))
+}
+
+// HasSerialVersionUID reports whether the class declares its serialVersionUID.
+func (class *Class) HasSerialVersionUID() bool {
+	field := class.FindField("serialVersionUID", "J")
+	return field != nil && field.HasModifier(ACC_STATIC) && field.HasModifier(ACC_FINAL)
+}
+
+// SetSerialVersionUID declares the serialVersionUID of the class, replacing the value of a declared one.
+func (class *Class) SetSerialVersionUID(uid int64) {
+	field := class.FindField("serialVersionUID", "J")
+	if field == nil {
+		field = class.AddField(ACC_PRIVATE|ACC_STATIC|ACC_FINAL, "serialVersionUID", "J")
+	}
+	field.Attributes = class.SetAttribute(field.Attributes, "ConstantValue", binary.BigEndian.AppendUint16(nil, class.AddLong(uid)))
+	field.AttributesCount = uint16(len(field.Attributes))
+}
+
+// SerialVersionUIDAdder declares the serialVersionUID serializable classes lacking one get by default, so it stays the
+// same once later stages of the pipeline rename or change them. It must come before those stages. Enums and records
+// are left alone, as serialization ignores their serialVersionUID.
+type SerialVersionUIDAdder struct {
+	// Libraries are jars holding supertypes of the jar's classes, other than those of the JDK
+	Libraries []string
+	hierarchy *ClassHierarchy
+}
+
+func (adder *SerialVersionUIDAdder) Analyze(members []*JarMember) error {
+	adder.hierarchy = NewClassHierarchy()
+	for _, library := range adder.Libraries {
+		if err := adder.hierarchy.AddJar(library); err != nil {
+			return err
+		}
+	}
+	return adder.hierarchy.Analyze(members)
+}
+
+// serializable reports whether the class implements Serializable and takes a serialVersionUID.
+func (adder *SerialVersionUIDAdder) serializable(class *Class) bool {
+	if class.AccessFlags&(ACC_INTERFACE|ACC_ENUM|ACC_MODULE) != 0 || class.GetSuperClassName() == "java/lang/Record" {
+		return false
+	}
+	for _, ancestor := range adder.hierarchy.Ancestors(class.GetClassName()) {
+		if jdkSerializable[ancestor] {
+			return true
+		}
+	}
+	return false
+}
+
+func (adder *SerialVersionUIDAdder) TransformClass(member *JarMember, class *Class) (bool, error) {
+	if !adder.serializable(class) || class.HasSerialVersionUID() {
+		return false, nil
+	}
+	class.SetSerialVersionUID(class.SerialVersionUID())
+	return true, nil
+}
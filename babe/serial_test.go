@@ -0,0 +1,120 @@
+package babe
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"testing"
+)
+
+// serialStream is the stream section 4.6 of the Java Object Serialization Specification hashes, written out by hand.
+type serialStream []byte
+
+func (stream serialStream) utf(s string) serialStream {
+	return append(binary.BigEndian.AppendUint16(stream, uint16(len(s))), s...)
+}
+
+func (stream serialStream) int(value int) serialStream {
+	return binary.BigEndian.AppendUint32(stream, uint32(value))
+}
+
+func (stream serialStream) uid() int64 {
+	hash := sha1.Sum(stream)
+	return int64(binary.LittleEndian.Uint64(hash[:8]))
+}
+
+func emptyBody(code *CodeBuilder) {
+	code.Return()
+}
+
+func TestSerialVersionUID(t *testing.T) {
+	tests := []struct {
+		name   string
+		class  *ClassBuilder
+		stream serialStream
+	}{
+		{
+			"class",
+			NewClassBuilder("a/Data").Implements("java/io/Serializable", "a/Base").
+				Field(ACC_PUBLIC, "count", "I", nil).
+				Field(ACC_PRIVATE|ACC_STATIC, "cache", "La/Data;", nil).
+				Field(ACC_PRIVATE|ACC_TRANSIENT, "hash", "I", nil).
+				Field(ACC_PRIVATE, "name", "Ljava/lang/String;", nil).
+				Method(ACC_PUBLIC, "get", "(La/Data;)La/Data;", func(code *CodeBuilder) {
+					code.VisitVarInsn(ALOAD, 1)
+					code.VisitInsn(ARETURN)
+				}).
+				Method(ACC_PRIVATE, "helper", "()V", emptyBody).
+				Method(ACC_STATIC, "<clinit>", "()V", emptyBody).
+				Method(ACC_PUBLIC, "<init>", "(I)V", emptyBody).
+				Method(ACC_PROTECTED, "<init>", "()V", emptyBody).
+				Method(ACC_PUBLIC|ACC_STATIC|ACC_SYNTHETIC, "access$000", "()V", emptyBody),
+			serialStream{}.utf("a.Data").int(ACC_PUBLIC).
+				utf("a.Base").utf("java.io.Serializable").
+				utf("count").int(ACC_PUBLIC).utf("I").
+				utf("name").int(ACC_PRIVATE).utf("Ljava/lang/String;").
+				utf("<clinit>").int(ACC_STATIC).utf("()V").
+				utf("<init>").int(ACC_PROTECTED).utf("()V").
+				utf("<init>").int(ACC_PUBLIC).utf("(I)V").
+				utf("access$000").int(ACC_PUBLIC | ACC_STATIC).utf("()V").
+				utf("get").int(ACC_PUBLIC).utf("(La.Data;)La.Data;"),
+		},
+		{
+			"final class without members",
+			NewClassBuilder("Empty").Access(ACC_FINAL | ACC_SUPER).Implements("java/io/Serializable"),
+			serialStream{}.utf("Empty").int(ACC_FINAL).utf("java.io.Serializable"),
+		},
+		{
+			"interface without methods",
+			NewClassBuilder("a/Marker").Access(ACC_PUBLIC|ACC_INTERFACE|ACC_ABSTRACT).Implements("java/io/Serializable").
+				Field(ACC_PUBLIC|ACC_STATIC|ACC_FINAL, "VALUE", "I", 1),
+			serialStream{}.utf("a.Marker").int(ACC_PUBLIC | ACC_INTERFACE).utf("java.io.Serializable").
+				utf("VALUE").int(ACC_PUBLIC | ACC_STATIC | ACC_FINAL).utf("I"),
+		},
+		{
+			"interface with methods",
+			NewClassBuilder("a/Service").Access(ACC_PUBLIC|ACC_INTERFACE|ACC_ABSTRACT).Implements("java/io/Serializable").
+				Method(ACC_PUBLIC|ACC_ABSTRACT, "run", "()V", nil),
+			serialStream{}.utf("a.Service").int(ACC_PUBLIC | ACC_INTERFACE | ACC_ABSTRACT).utf("java.io.Serializable").
+				utf("run").int(ACC_PUBLIC | ACC_ABSTRACT).utf("()V"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class, err := test.class.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uid, want := class.SerialVersionUID(), test.stream.uid(); uid != want {
+				t.Errorf("SerialVersionUID = %d, want %d", uid, want)
+			}
+		})
+	}
+}
+
+func TestSetSerialVersionUID(t *testing.T) {
+	class, err := NewClassBuilder("a/Data").Implements("java/io/Serializable").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid := class.SerialVersionUID()
+	if class.HasSerialVersionUID() {
+		t.Fatal("HasSerialVersionUID before declaring it")
+	}
+	class.SetSerialVersionUID(uid)
+	if !class.HasSerialVersionUID() {
+		t.Fatal("HasSerialVersionUID after declaring it")
+	}
+	// The declared field is private and static, so it doesn't change the default
+	if declared := class.SerialVersionUID(); declared != uid {
+		t.Errorf("SerialVersionUID with the field declared = %d, want %d", declared, uid)
+	}
+	class.SetSerialVersionUID(-1)
+	if len(class.Fields) != 1 {
+		t.Errorf("SetSerialVersionUID added a second field")
+	}
+	field := class.FindField("serialVersionUID", "J")
+	value, ok := class.GetConstant(uint16(u16(class.FindAttribute(field.Attributes, "ConstantValue").Data, 0))).(*LongInfo)
+	if !ok || int64(value.HighBytes)<<32|int64(value.LowBytes) != -1 {
+		t.Errorf("ConstantValue = %+v, want -1", value)
+	}
+}
@@ -0,0 +1,704 @@
+package babe
+
+import (
+	"archive/zip"
+	stdbytes "bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var ErrUnsupportedKey = errors.New("jarhax: unsupported signing key")
+var ErrInvalidSignature = errors.New("jarhax: invalid jar signature")
+
+// isSignatureFile reports whether a member is part of a jar signature.
+func isSignatureFile(name string) bool {
+	dir, file := path.Split(strings.ToUpper(name))
+	if dir != "META-INF/" {
+		return false
+	}
+	switch path.Ext(file) {
+	case ".SF", ".RSA", ".DSA", ".EC":
+		return true
+	}
+	return strings.HasPrefix(file, "SIG-")
+}
+
+// IsSignedJar reports whether a jar has a signature.
+func IsSignedJar(filename string) (bool, error) {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if isSignatureFile(file.Name) && strings.HasSuffix(strings.ToUpper(file.Name), ".SF") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stripDigests removes the entry digests from a manifest, along with the sections left empty.
+func stripDigests(manifest *Manifest) bool {
+	changed := false
+	sections := manifest.Sections[:0]
+	for _, section := range manifest.Sections {
+		attributes := section.Attributes[:0]
+		for _, attribute := range section.Attributes {
+			if strings.HasSuffix(strings.ToUpper(attribute.Name), "-DIGEST") {
+				changed = true
+			} else {
+				attributes = append(attributes, attribute)
+			}
+		}
+		section.Attributes = attributes
+		if len(attributes) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	manifest.Sections = sections
+	return changed
+}
+
+// stripSignature removes a signature file, or the digests of the manifest, reporting whether the member is dropped.
+func stripSignature(member *JarMember) (bool, error) {
+	if isSignatureFile(member.Name) {
+		return true, nil
+	}
+	if member.Name != ManifestName {
+		return false, nil
+	}
+	if err := member.Load(); err != nil {
+		return false, err
+	}
+	manifest, err := ReadManifest(*member.Buffer.Data)
+	if err != nil {
+		return false, err
+	}
+	if stripDigests(manifest) {
+		*member.Buffer.Data = manifest.Bytes()
+	}
+	return false, nil
+}
+
+// StripJarSignature removes the signature files and entry digests of a jar.
+func StripJarSignature(filename string) error {
+	options := DefaultJarOptions
+	options.StripSignatures, options.Signer = true, nil
+	return ModifyJarWithOptions(context.Background(), filename, options, func(member *JarMember) error {
+		return nil
+	})
+}
+
+// JarSigner signs jars the way jarsigner does, with SHA-256 digests and a PKCS#7 signature block without signed
+// attributes. Certificates holds the certificate of the key first, followed by the rest of its chain.
+type JarSigner struct {
+	// Name of the signature files in META-INF, SIGNER if empty
+	Name         string
+	Key          crypto.Signer
+	Certificates []*x509.Certificate
+}
+
+// LoadSignerPEM reads a private key in PKCS#8, PKCS#1 or SEC 1 form and its certificate chain from PEM files.
+func LoadSignerPEM(keyFile string, certificateFile string) (*JarSigner, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer := &JarSigner{}
+	for block, rest := pem.Decode(data); block != nil && signer.Key == nil; block, rest = pem.Decode(rest) {
+		var key any
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyFile, err)
+		}
+		if signer.Key, err = signingKey(key); err != nil {
+			return nil, err
+		}
+	}
+	if signer.Key == nil {
+		return nil, fmt.Errorf("%w: %s has no private key", ErrUnsupportedKey, keyFile)
+	}
+
+	if data, err = os.ReadFile(certificateFile); err != nil {
+		return nil, err
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", certificateFile, err)
+			}
+			signer.Certificates = append(signer.Certificates, certificate)
+		}
+	}
+	if len(signer.Certificates) == 0 {
+		return nil, fmt.Errorf("%w: %s has no certificate", ErrUnsupportedKey, certificateFile)
+	}
+	return signer, nil
+}
+
+// LoadSignerPKCS12 reads the key and certificate chain of a PKCS#12 keystore.
+func LoadSignerPKCS12(file string, password string) (*JarSigner, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, certificate, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	signer := &JarSigner{Certificates: append([]*x509.Certificate{certificate}, chain...)}
+	if signer.Key, err = signingKey(key); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+func signingKey(key any) (crypto.Signer, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+}
+
+// SignJar signs a jar, replacing any signature it has.
+func SignJar(filename string, signer *JarSigner) error {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	manifest := NewManifest()
+	var files []*zip.File
+	for _, file := range reader.File {
+		switch {
+		case file.Name == ManifestName:
+			data, err := readZipFile(file)
+			if err != nil {
+				return err
+			}
+			if manifest, err = ReadManifest(data); err != nil {
+				return err
+			}
+		case !isSignatureFile(file.Name) && !file.FileInfo().IsDir():
+			files = append(files, file)
+		}
+	}
+
+	stripDigests(manifest)
+	for _, file := range files {
+		digest, err := zipFileDigest(file, sha256.New())
+		if err != nil {
+			return err
+		}
+		manifest.AddSection(file.Name).Attributes.Set("SHA-256-Digest", digest)
+	}
+
+	manifestBytes := manifest.Bytes()
+	signatureFile, err := signatureFileFor(manifest, manifestBytes)
+	if err != nil {
+		return err
+	}
+	block, extension, err := signer.sign(signatureFile)
+	if err != nil {
+		return err
+	}
+
+	name := signer.Name
+	if name == "" {
+		name = "SIGNER"
+	}
+	options := DefaultJarOptions
+	options.StripSignatures, options.Signer = false, nil
+	output := filename + "-signed.zip"
+	jar := CreateJarWithOptions(context.Background(), output, options)
+	jar.Task(func(jar *Jar) error {
+		// The signature files follow the manifest, where JarInputStream looks for them
+		signed := []JarMember{
+			JarMemberFromString(ManifestName, string(manifestBytes)),
+			JarMemberFromString("META-INF/"+name+".SF", string(signatureFile)),
+			JarMemberFromString("META-INF/"+name+extension, string(block)),
+		}
+		for _, member := range signed {
+			if err := jar.Add(member); err != nil {
+				return err
+			}
+		}
+		for _, file := range files {
+			if err := jar.Add(JarMember{Name: file.Name, file: file}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err := jar.Wait(); err != nil {
+		os.Remove(output)
+		return err
+	}
+	reader.Close()
+	return os.Rename(output, filename)
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func zipFileDigest(file *zip.File, digest hash.Hash) (string, error) {
+	r, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	if _, err := io.Copy(digest, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(digest.Sum(nil)), nil
+}
+
+func digestOf(data []byte, digest hash.Hash) string {
+	digest.Write(data)
+	return base64.StdEncoding.EncodeToString(digest.Sum(nil))
+}
+
+// signatureFileFor creates the .SF file of a manifest, holding the digests of the whole manifest, its main
+// attributes and each of its sections.
+func signatureFileFor(manifest *Manifest, manifestBytes []byte) ([]byte, error) {
+	main, sections, err := manifestSections(manifestBytes)
+	if err != nil {
+		return nil, err
+	}
+	signatureFile := &Manifest{Main: ManifestAttributes{
+		{"Signature-Version", "1.0"},
+		{"Created-By", "babe"},
+		{"SHA-256-Digest-Manifest", digestOf(manifestBytes, sha256.New())},
+		{"SHA-256-Digest-Manifest-Main-Attributes", digestOf(main, sha256.New())},
+	}}
+	for _, section := range manifest.Sections {
+		signatureFile.AddSection(section.Name).Attributes.Set("SHA-256-Digest", digestOf(sections[section.Name], sha256.New()))
+	}
+	return signatureFile.Bytes(), nil
+}
+
+// manifestSections splits a manifest into the raw bytes of its main section and of each named section, including
+// the blank lines ending them, as signature digests are computed over them.
+func manifestSections(data []byte) ([]byte, map[string][]byte, error) {
+	var main []byte
+	sections := map[string][]byte{}
+	for start, first := 0, true; start < len(data); first = false {
+		end := start
+		for end < len(data) {
+			lineEnd := end
+			for lineEnd < len(data) && data[lineEnd] != '\n' && data[lineEnd] != '\r' {
+				lineEnd++
+			}
+			blank := lineEnd == end
+			if lineEnd < len(data) && data[lineEnd] == '\r' {
+				lineEnd++
+			}
+			if lineEnd < len(data) && data[lineEnd] == '\n' {
+				lineEnd++
+			}
+			end = lineEnd
+			if blank {
+				break
+			}
+		}
+
+		section := data[start:end]
+		if first {
+			main = section
+		} else if parsed, err := ReadManifest(append([]byte("\r\n"), section...)); err != nil {
+			return nil, nil, err
+		} else if len(parsed.Sections) > 0 {
+			sections[parsed.Sections[0].Name] = section
+		}
+		start = end
+	}
+	return main, sections, nil
+}
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSASHA256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber asn1.RawValue
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// sign creates the PKCS#7 signature block of a signature file, returning it along with its file extension.
+func (signer *JarSigner) sign(signatureFile []byte) ([]byte, string, error) {
+	if signer.Key == nil || len(signer.Certificates) == 0 {
+		return nil, "", fmt.Errorf("%w: a key and its certificate are needed", ErrUnsupportedKey)
+	}
+	digest := sha256.Sum256(signatureFile)
+	signature, err := signer.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, "", err
+	}
+
+	encryption, extension := pkix.AlgorithmIdentifier{Algorithm: oidRSA, Parameters: asn1.NullRawValue}, ".RSA"
+	if _, ok := signer.Key.Public().(*ecdsa.PublicKey); ok {
+		encryption, extension = pkix.AlgorithmIdentifier{Algorithm: oidECDSASHA256}, ".EC"
+	}
+	var certificates []byte
+	for _, certificate := range signer.Certificates {
+		certificates = append(certificates, certificate.Raw...)
+	}
+	certificate := signer.Certificates[0]
+
+	data, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo:      contentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: certificate.RawIssuer},
+				SerialNumber: mustMarshal(certificate.SerialNumber),
+			},
+			DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			DigestEncryptionAlgorithm: encryption,
+			EncryptedDigest:           signature,
+		}},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	block, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data},
+	})
+	return block, extension, err
+}
+
+func mustMarshal(value any) asn1.RawValue {
+	data, err := asn1.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return asn1.RawValue{FullBytes: data}
+}
+
+// JarSignature is a signature found by VerifyJarSignature.
+type JarSignature struct {
+	// Name of the signature file, without its extension
+	Name         string
+	Certificates []*x509.Certificate
+}
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"SHA1": sha1.New, "SHA-1": sha1.New, "SHA-256": sha256.New, "SHA-384": sha512.New384, "SHA-512": sha512.New,
+}
+
+// VerifyJarSignature checks the entry digests of a signed jar against its manifest, the digests of every signature file
+// against the manifest, and the signature of every signature file. Certificates are returned but not checked against
+// any trust store. Every problem found is reported, each wrapping ErrInvalidSignature.
+func VerifyJarSignature(filename string) ([]JarSignature, error) {
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	files := map[string]*zip.File{}
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidSignature, fmt.Sprintf(format, args...)))
+	}
+
+	file := files[ManifestName]
+	if file == nil {
+		return nil, ErrNoManifest
+	}
+	manifestBytes, err := readZipFile(file)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := ReadManifest(manifestBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, section := range manifest.Sections {
+		for _, attribute := range section.Attributes {
+			algorithm, ok := strings.CutSuffix(strings.ToUpper(attribute.Name), "-DIGEST")
+			if !ok || digestAlgorithms[algorithm] == nil {
+				continue
+			}
+			entry := files[section.Name]
+			if entry == nil {
+				invalid("%s is signed but missing", section.Name)
+				continue
+			}
+			if digest, err := zipFileDigest(entry, digestAlgorithms[algorithm]()); err != nil {
+				return nil, err
+			} else if digest != attribute.Value {
+				invalid("%s does not match its %s digest", section.Name, algorithm)
+			}
+		}
+	}
+	for _, file := range reader.File {
+		if !file.FileInfo().IsDir() && file.Name != ManifestName && !isSignatureFile(file.Name) && manifest.Section(file.Name) == nil {
+			invalid("%s is not signed", file.Name)
+		}
+	}
+
+	main, sections, err := manifestSections(manifestBytes)
+	if err != nil {
+		return nil, err
+	}
+	var signatures []JarSignature
+	for _, file := range reader.File {
+		base, ok := strings.CutSuffix(file.Name, ".SF")
+		if !ok || !isSignatureFile(file.Name) {
+			continue
+		}
+		signatureFile, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifySignatureFile(signatureFile, manifestBytes, main, sections); err != nil {
+			invalid("%s: %s", file.Name, err)
+		}
+
+		var block *zip.File
+		for _, extension := range []string{".RSA", ".DSA", ".EC"} {
+			if block = files[base+extension]; block != nil {
+				break
+			}
+		}
+		if block == nil {
+			invalid("%s has no signature block", file.Name)
+			continue
+		}
+		data, err := readZipFile(block)
+		if err != nil {
+			return nil, err
+		}
+		certificates, err := verifySignatureBlock(data, signatureFile)
+		if err != nil {
+			invalid("%s: %s", block.Name, err)
+		}
+		signatures = append(signatures, JarSignature{base, certificates})
+	}
+	if len(signatures) == 0 {
+		invalid("jar is not signed")
+	}
+	return signatures, errors.Join(errs...)
+}
+
+// verifySignatureFile checks the digest of the whole manifest, or failing that, of its main attributes and every section.
+// At least one digest must match.
+func verifySignatureFile(signatureFile []byte, manifestBytes []byte, main []byte, sections map[string][]byte) error {
+	parsed, err := ReadManifest(signatureFile)
+	if err != nil {
+		return err
+	}
+	for algorithm, digest := range digestAlgorithms {
+		if value := parsed.Main.Get(algorithm + "-Digest-Manifest"); value != "" && value == digestOf(manifestBytes, digest()) {
+			return nil
+		}
+	}
+	matched := false
+	for algorithm, digest := range digestAlgorithms {
+		if value := parsed.Main.Get(algorithm + "-Digest-Manifest-Main-Attributes"); value != "" {
+			if value != digestOf(main, digest()) {
+				return fmt.Errorf("main attributes do not match their %s digest", algorithm)
+			}
+			matched = true
+		}
+	}
+	for _, section := range parsed.Sections {
+		for _, attribute := range section.Attributes {
+			algorithm, ok := strings.CutSuffix(strings.ToUpper(attribute.Name), "-DIGEST")
+			if !ok || digestAlgorithms[algorithm] == nil {
+				continue
+			}
+			if raw, ok := sections[section.Name]; !ok || attribute.Value != digestOf(raw, digestAlgorithms[algorithm]()) {
+				return fmt.Errorf("manifest section of %s does not match its %s digest", section.Name, algorithm)
+			}
+			matched = true
+		}
+	}
+	if !matched {
+		return errors.New("no digest of a supported algorithm matches the manifest")
+	}
+	return nil
+}
+
+var signatureDigests = map[string]crypto.Hash{
+	oidSHA1.String(): crypto.SHA1, oidSHA256.String(): crypto.SHA256, oidSHA384.String(): crypto.SHA384, oidSHA512.String(): crypto.SHA512,
+}
+
+// verifySignatureBlock checks the PKCS#7 signature of a signature file, returning the certificates of the block.
+func verifySignatureBlock(block []byte, signatureFile []byte) ([]*x509.Certificate, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(block, &info); err != nil {
+		return nil, err
+	}
+	var data signedData
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("not a PKCS#7 signed data block")
+	}
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &data); err != nil {
+		return nil, err
+	}
+	certificates, err := x509.ParseCertificates(data.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.SignerInfos) == 0 {
+		return certificates, fmt.Errorf("no signer")
+	}
+
+	for _, signer := range data.SignerInfos {
+		var certificate *x509.Certificate
+		for _, candidate := range certificates {
+			if stdbytes.Equal(candidate.RawIssuer, signer.IssuerAndSerialNumber.Issuer.FullBytes) &&
+				stdbytes.Equal(mustMarshal(candidate.SerialNumber).FullBytes, signer.IssuerAndSerialNumber.SerialNumber.FullBytes) {
+				certificate = candidate
+			}
+		}
+		if certificate == nil {
+			return certificates, fmt.Errorf("no certificate for signer")
+		}
+
+		digest, ok := signatureDigests[signer.DigestAlgorithm.Algorithm.String()]
+		if !ok {
+			return certificates, fmt.Errorf("unsupported digest algorithm %s", signer.DigestAlgorithm.Algorithm)
+		}
+
+		// With signed attributes the signature covers them, and they hold the digest of the signature file
+		signed := signatureFile
+		if len(signer.AuthenticatedAttributes.Bytes) > 0 {
+			var attributes []pkcs7Attribute
+			if _, err := asn1.UnmarshalWithParams(signer.AuthenticatedAttributes.FullBytes, &attributes, "set,tag:0"); err != nil {
+				return certificates, err
+			}
+			hash := digest.New()
+			hash.Write(signatureFile)
+			found := false
+			for _, attribute := range attributes {
+				var value []byte
+				if attribute.Type.Equal(oidMessageDigest) {
+					if _, err := asn1.Unmarshal(attribute.Values.Bytes, &value); err == nil && stdbytes.Equal(value, hash.Sum(nil)) {
+						found = true
+					}
+				}
+			}
+			if !found {
+				return certificates, fmt.Errorf("signed attributes do not match the signature file")
+			}
+			signed = retag(signer.AuthenticatedAttributes.FullBytes, 0x31)
+		}
+
+		algorithm, err := signatureAlgorithm(certificate, digest)
+		if err != nil {
+			return certificates, err
+		}
+		if err := certificate.CheckSignature(algorithm, signed, signer.EncryptedDigest); err != nil {
+			return certificates, err
+		}
+	}
+	return certificates, nil
+}
+
+// retag copies DER data, replacing its tag, as signed attributes are signed as a SET rather than [0].
+func retag(data []byte, tag byte) []byte {
+	copied := stdbytes.Clone(data)
+	copied[0] = tag
+	return copied
+}
+
+func signatureAlgorithm(certificate *x509.Certificate, digest crypto.Hash) (x509.SignatureAlgorithm, error) {
+	algorithms := map[x509.PublicKeyAlgorithm]map[crypto.Hash]x509.SignatureAlgorithm{
+		x509.RSA:   {crypto.SHA1: x509.SHA1WithRSA, crypto.SHA256: x509.SHA256WithRSA, crypto.SHA384: x509.SHA384WithRSA, crypto.SHA512: x509.SHA512WithRSA},
+		x509.ECDSA: {crypto.SHA1: x509.ECDSAWithSHA1, crypto.SHA256: x509.ECDSAWithSHA256, crypto.SHA384: x509.ECDSAWithSHA384, crypto.SHA512: x509.ECDSAWithSHA512},
+	}
+	if algorithm, ok := algorithms[certificate.PublicKeyAlgorithm][digest]; ok {
+		return algorithm, nil
+	}
+	return 0, fmt.Errorf("unsupported signature algorithm %s with %s", certificate.PublicKeyAlgorithm, digest)
+}
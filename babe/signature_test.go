@@ -0,0 +1,228 @@
+package babe
+
+import (
+	"archive/zip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type zipEntry struct {
+	name string
+	data string
+}
+
+func writeTestZip(t *testing.T, filename string, entries []zipEntry) {
+	t.Helper()
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	for _, entry := range entries {
+		w, err := writer.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry.data))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestZip(t *testing.T, filename string) []zipEntry {
+	t.Helper()
+	reader, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var entries []zipEntry
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, zipEntry{file.Name, string(data)})
+	}
+	return entries
+}
+
+func testSigner(t *testing.T, key crypto.Signer) *JarSigner {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "babe test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	data, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &JarSigner{Key: key, Certificates: []*x509.Certificate{certificate}}
+}
+
+var testJarEntries = []zipEntry{
+	{ManifestName, "Manifest-Version: 1.0\r\nMain-Class: a.Main\r\n\r\n"},
+	{"a/", ""},
+	{"a/Main.class", "not really a class"},
+	{"a/" + strings.Repeat("long-name-", 10) + ".txt", "wrapped in the manifest"},
+}
+
+func TestSignJar(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	tests := []struct {
+		name      string
+		key       crypto.Signer
+		extension string
+	}{
+		{"rsa", rsaKey, ".RSA"},
+		{"ecdsa p-256", p256, ".EC"},
+		{"ecdsa p-384", p384, ".EC"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.jar")
+			writeTestZip(t, filename, testJarEntries)
+			signer := testSigner(t, test.key)
+			signer.Name = "TEST"
+			if err := SignJar(filename, signer); err != nil {
+				t.Fatal(err)
+			}
+
+			signatures, err := VerifyJarSignature(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(signatures) != 1 || signatures[0].Name != "META-INF/TEST" || !signatures[0].Certificates[0].Equal(signer.Certificates[0]) {
+				t.Errorf("VerifyJarSignature = %+v", signatures)
+			}
+			names := map[string]bool{}
+			for _, entry := range readTestZip(t, filename) {
+				names[entry.name] = true
+			}
+			if !names["META-INF/TEST.SF"] || !names["META-INF/TEST"+test.extension] {
+				t.Errorf("signature files missing from %v", names)
+			}
+			manifest, err := ReadJarManifest(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if manifest.Main.Get("Main-Class") != "a.Main" {
+				t.Errorf("signing lost the main attributes: %v", manifest.Main)
+			}
+		})
+	}
+}
+
+func TestVerifyJarSignatureTampered(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests := []struct {
+		name   string
+		tamper func(entries []zipEntry) []zipEntry
+	}{
+		{"changed entry", func(entries []zipEntry) []zipEntry {
+			for i := range entries {
+				if entries[i].name == "a/Main.class" {
+					entries[i].data = "changed"
+				}
+			}
+			return entries
+		}},
+		{"added entry", func(entries []zipEntry) []zipEntry {
+			return append(entries, zipEntry{"a/Added.class", "unsigned"})
+		}},
+		{"removed entry", func(entries []zipEntry) []zipEntry {
+			var kept []zipEntry
+			for _, entry := range entries {
+				if entry.name != "a/Main.class" {
+					kept = append(kept, entry)
+				}
+			}
+			return kept
+		}},
+		{"changed manifest", func(entries []zipEntry) []zipEntry {
+			entries[0].data = strings.Replace(entries[0].data, "a.Main", "b.Main", 1)
+			return entries
+		}},
+		{"signature file without digests", func(entries []zipEntry) []zipEntry {
+			for i := range entries {
+				if strings.HasSuffix(entries[i].name, ".SF") {
+					entries[i].data = "Signature-Version: 1.0\r\nCreated-By: test\r\n\r\n"
+				}
+			}
+			return entries
+		}},
+		{"unsigned", func(entries []zipEntry) []zipEntry {
+			var kept []zipEntry
+			for _, entry := range entries {
+				if !isSignatureFile(entry.name) {
+					kept = append(kept, entry)
+				}
+			}
+			return kept
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.jar")
+			writeTestZip(t, filename, testJarEntries)
+			if err := SignJar(filename, testSigner(t, key)); err != nil {
+				t.Fatal(err)
+			}
+			writeTestZip(t, filename, test.tamper(readTestZip(t, filename)))
+			if _, err := VerifyJarSignature(filename); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifyJarSignature error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestSignJarIncompleteSigner(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests := map[string]*JarSigner{
+		"no certificates": {Key: key},
+		"no key":          {Certificates: testSigner(t, key).Certificates},
+	}
+	for name, signer := range tests {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.jar")
+			writeTestZip(t, filename, testJarEntries)
+			if err := SignJar(filename, signer); !errors.Is(err, ErrUnsupportedKey) {
+				t.Errorf("SignJar error = %v, want ErrUnsupportedKey", err)
+			}
+			if entries := readTestZip(t, filename); len(entries) != len(testJarEntries) {
+				t.Errorf("SignJar changed the jar: %v", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package babe
+
+// Metadata removed by DebugStripper
+const (
+	StripLineNumbers      = 1 << iota // LineNumberTable
+	StripLocalVariables               // LocalVariableTable and LocalVariableTypeTable
+	StripSourceFile                   // SourceFile and SourceDebugExtension
+	StripMethodParameters             // MethodParameters
+	// Signature, the generic types only seen through reflection and by compilers
+	StripGenericSignatures
+	// InnerClasses and EnclosingMethod, which reflection needs to find the declaring and simple names of nested classes
+	StripInnerClasses
+
+	StripDebug = StripLineNumbers | StripLocalVariables | StripSourceFile | StripMethodParameters
+)
+
+// DebugStripper removes the attributes selected by Flags from every class, then compacts its constant pool.
+type DebugStripper struct {
+	Flags int
+}
+
+func (stripper *DebugStripper) attributeNames() []string {
+	var names []string
+	for flag, attributes := range map[int][]string{
+		StripLineNumbers:       {"LineNumberTable"},
+		StripLocalVariables:    {"LocalVariableTable", "LocalVariableTypeTable"},
+		StripSourceFile:        {"SourceFile", "SourceDebugExtension"},
+		StripMethodParameters:  {"MethodParameters"},
+		StripGenericSignatures: {"Signature"},
+		StripInnerClasses:      {"InnerClasses", "EnclosingMethod"},
+	} {
+		if stripper.Flags&flag != 0 {
+			names = append(names, attributes...)
+		}
+	}
+	return names
+}
+
+func (stripper *DebugStripper) TransformClass(member *JarMember, class *Class) (bool, error) {
+	names := stripper.attributeNames()
+	changed := false
+	strip := func(attributes []AttributeInfo) []AttributeInfo {
+		for _, name := range names {
+			count := len(attributes)
+			if attributes = class.RemoveAttribute(attributes, name); len(attributes) != count {
+				changed = true
+			}
+		}
+		return attributes
+	}
+
+	class.Attributes = strip(class.Attributes)
+	class.AttributesCount = uint16(len(class.Attributes))
+	for i := range class.Fields {
+		field := &class.Fields[i]
+		field.Attributes = strip(field.Attributes)
+		field.AttributesCount = uint16(len(field.Attributes))
+	}
+	for i := range class.Methods {
+		method := &class.Methods[i]
+		method.Attributes = strip(method.Attributes)
+		method.AttributesCount = uint16(len(method.Attributes))
+		if code := method.GetCode(); code != nil {
+			count := len(code.Attributes)
+			if code.Attributes = strip(code.Attributes); len(code.Attributes) != count {
+				method.SetCode(code)
+			}
+		}
+	}
+	if components := class.GetRecordComponents(); components != nil {
+		stripped := changed
+		changed = false
+		for _, component := range components {
+			component.Attributes = strip(component.Attributes)
+		}
+		if changed {
+			class.SetRecordComponents(components)
+		}
+		changed = changed || stripped
+	}
+	return class.CompactConstantPool() || changed, nil
+}
+
+// StripJar removes the metadata selected by flags from the classes of a jar, see DebugStripper.
+func StripJar(filename string, flags int) error {
+	return NewPipeline(&DebugStripper{Flags: flags}).Run(filename)
+}
@@ -0,0 +1,238 @@
+package babe
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// AnnotationStripper removes the annotations matching Patterns wherever they appear: on classes, fields, methods,
+// parameters and record components, and as type annotations, those in code included. Annotations nested in the values
+// of other annotations are kept as they are. Annotation classes of the jar matching Patterns are dropped once nothing
+// else references them.
+type AnnotationStripper struct {
+	// Patterns are class names in which * matches within a package and ** across packages, such as
+	// "org.jetbrains.annotations.*" or "lombok.**".
+	Patterns []string
+	patterns []*regexp.Regexp
+	drop     map[string]bool
+}
+
+func compileClassPattern(pattern string) *regexp.Regexp {
+	expression := regexp.QuoteMeta(strings.ReplaceAll(pattern, ".", "/"))
+	expression = strings.ReplaceAll(expression, `\*\*`, ".*")
+	expression = strings.ReplaceAll(expression, `\*`, "[^/]*")
+	return regexp.MustCompile("^" + expression + "$")
+}
+
+// strips reports whether an annotation descriptor matches the patterns.
+func (stripper *AnnotationStripper) strips(descriptor string) bool {
+	name := strings.TrimSuffix(strings.TrimPrefix(descriptor, "L"), ";")
+	for _, pattern := range stripper.patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (stripper *AnnotationStripper) strip(annotations []*Annotation) ([]*Annotation, bool) {
+	kept := annotations[:0]
+	for _, annotation := range annotations {
+		if !stripper.strips(annotation.Descriptor) {
+			kept = append(kept, annotation)
+		}
+	}
+	return kept, len(kept) != len(annotations)
+}
+
+// editTypeAnnotations applies edit to the annotations of a list of type annotations, keeping those edit keeps.
+func editTypeAnnotations(annotations []*TypeAnnotation, edit func([]*Annotation) ([]*Annotation, bool)) ([]*TypeAnnotation, bool) {
+	list := make([]*Annotation, len(annotations))
+	for i, annotation := range annotations {
+		list[i] = &annotation.Annotation
+	}
+	list, changed := edit(list)
+	if !changed {
+		return annotations, false
+	}
+	kept := map[*Annotation]bool{}
+	for _, annotation := range list {
+		kept[annotation] = true
+	}
+	edited := annotations[:0]
+	for _, annotation := range annotations {
+		if kept[&annotation.Annotation] {
+			edited = append(edited, annotation)
+		}
+	}
+	return edited, true
+}
+
+// editAnnotations applies edit to every list of annotations of a class, writing back those it changes.
+func editAnnotations(class *Class, edit func([]*Annotation) ([]*Annotation, bool)) bool {
+	changed := false
+	type annotated interface {
+		GetAnnotations() []*Annotation
+		SetAnnotations([]*Annotation)
+		GetTypeAnnotations() []*TypeAnnotation
+		SetTypeAnnotations([]*TypeAnnotation)
+	}
+	apply := func(holder annotated) bool {
+		holderChanged := false
+		if annotations, ok := edit(holder.GetAnnotations()); ok {
+			holder.SetAnnotations(annotations)
+			holderChanged = true
+		}
+		if annotations, ok := editTypeAnnotations(holder.GetTypeAnnotations(), edit); ok {
+			holder.SetTypeAnnotations(annotations)
+			holderChanged = true
+		}
+		return holderChanged
+	}
+
+	changed = apply(class) || changed
+	for i := range class.Fields {
+		changed = apply(&class.Fields[i]) || changed
+	}
+	for i := range class.Methods {
+		method := &class.Methods[i]
+		changed = apply(method) || changed
+
+		parameters, parametersChanged := method.GetParameterAnnotations(), false
+		for j := range parameters {
+			if annotations, ok := edit(parameters[j]); ok {
+				parameters[j], parametersChanged = annotations, true
+			}
+		}
+		if parametersChanged {
+			method.SetParameterAnnotations(parameters)
+			changed = true
+		}
+
+		if code := method.GetCode(); code != nil {
+			if annotations, ok := editTypeAnnotations(class.readTypeAnnotations(code.Attributes), edit); ok {
+				code.Attributes = class.writeTypeAnnotations(code.Attributes, annotations)
+				method.SetCode(code)
+				changed = true
+			}
+		}
+	}
+
+	components, componentsChanged := class.GetRecordComponents(), false
+	for _, component := range components {
+		componentsChanged = apply(component) || componentsChanged
+	}
+	if componentsChanged {
+		class.SetRecordComponents(components)
+		changed = true
+	}
+	return changed
+}
+
+// annotationValueTypes returns the classes named by the element values of an annotation.
+func annotationValueTypes(value any) []string {
+	switch v := value.(type) {
+	case EnumValue:
+		return descriptorClassNames(v.Descriptor)
+	case ClassConstant:
+		return descriptorClassNames(v.Descriptor)
+	case *Annotation:
+		names := descriptorClassNames(v.Descriptor)
+		for _, element := range v.Elements {
+			names = append(names, annotationValueTypes(element.Value)...)
+		}
+		return names
+	case []any:
+		var names []string
+		for _, value := range v {
+			names = append(names, annotationValueTypes(value)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// references returns the classes a class refers to once its annotations are stripped.
+func (stripper *AnnotationStripper) references(class *Class) []string {
+	references := typeReferences(class)
+	signatures := [][]AttributeInfo{class.Attributes}
+	for i := range class.Fields {
+		signatures = append(signatures, class.Fields[i].Attributes)
+	}
+	for i := range class.Methods {
+		signatures = append(signatures, class.Methods[i].Attributes)
+	}
+	for _, attributes := range signatures {
+		if signature := class.FindAttribute(attributes, "Signature"); signature != nil && len(signature.Data) >= 2 {
+			references = append(references, descriptorClassNames(class.GetUtf8(uint16(u16(signature.Data, 0))))...)
+		}
+	}
+	editAnnotations(class, func(annotations []*Annotation) ([]*Annotation, bool) {
+		for _, annotation := range annotations {
+			if stripper.strips(annotation.Descriptor) {
+				continue
+			}
+			references = append(references, annotationValueTypes(annotation)...)
+		}
+		return annotations, false
+	})
+	return references
+}
+
+func (stripper *AnnotationStripper) Analyze(members []*JarMember) error {
+	stripper.patterns = nil
+	for _, pattern := range stripper.Patterns {
+		stripper.patterns = append(stripper.patterns, compileClassPattern(pattern))
+	}
+
+	candidates := map[string][]string{}
+	var roots []string
+	for _, member := range members {
+		class, err := member.GetAsClass()
+		if err != nil {
+			if errors.Is(err, ErrNotClass) {
+				continue
+			}
+			return err
+		}
+		name := class.GetClassName()
+		references := stripper.references(class)
+		if class.HasModifier(ACC_ANNOTATION) && stripper.strips("L"+name+";") {
+			candidates[name] = append(candidates[name], references...)
+		} else {
+			roots = append(roots, references...)
+		}
+	}
+
+	// Annotation classes only referenced by other dropped ones are dropped along with them
+	referenced := map[string]bool{}
+	for len(roots) > 0 {
+		name := roots[len(roots)-1]
+		roots = roots[:len(roots)-1]
+		if references, ok := candidates[name]; ok && !referenced[name] {
+			referenced[name] = true
+			roots = append(roots, references...)
+		}
+	}
+	stripper.drop = map[string]bool{}
+	for name := range candidates {
+		if !referenced[name] {
+			stripper.drop[name] = true
+		}
+	}
+	return nil
+}
+
+func (stripper *AnnotationStripper) TransformClass(member *JarMember, class *Class) (bool, error) {
+	if stripper.drop[class.GetClassName()] {
+		member.Delete()
+		return false, nil
+	}
+	return editAnnotations(class, stripper.strip), nil
+}
+
+// StripAnnotations removes the annotations matching the patterns from a jar, see AnnotationStripper.
+func StripAnnotations(filename string, patterns ...string) error {
+	return NewPipeline(&AnnotationStripper{Patterns: patterns}).Run(filename)
+}
@@ -0,0 +1,425 @@
+package babe
+
+import "strings"
+
+// ClassConstant is a class literal. Descriptor is a field descriptor such as "Ljava/lang/String;", "[I" or "I".
+type ClassConstant struct {
+	Descriptor string
+}
+
+// ClassConstantOf returns the class literal for an internal name or array descriptor.
+func ClassConstantOf(name string) ClassConstant {
+	if strings.HasPrefix(name, "[") {
+		return ClassConstant{name}
+	}
+	return ClassConstant{"L" + name + ";"}
+}
+
+// InternalName returns the name used by CONSTANT_Class for the literal.
+func (constant ClassConstant) InternalName() string {
+	if strings.HasPrefix(constant.Descriptor, "L") {
+		return constant.Descriptor[1 : len(constant.Descriptor)-1]
+	}
+	return constant.Descriptor
+}
+
+type MethodTypeConstant struct {
+	Descriptor string
+}
+
+type Handle struct {
+	Kind        int
+	Owner       string
+	Name        string
+	Descriptor  string
+	IsInterface bool
+}
+
+type ConstantDynamic struct {
+	Name       string
+	Descriptor string
+	Bootstrap  Handle
+	Arguments  []any
+}
+
+// Attribute is an attribute the visitors don't model. Data still refers to the constant pool
+// of the class it was read from, so it is only meaningful to a ClassWriter created from that reader.
+type Attribute struct {
+	Name string
+	Data []byte
+}
+
+// Label marks a position in the code of a method.
+type Label struct {
+	offset int
+}
+
+// AnnotationVisitor visits the elements of an annotation. Values passed to Visit are bool, int8, uint16,
+// int16, int32, int64, float32, float64, string or ClassConstant, matching the element_value tag.
+type AnnotationVisitor interface {
+	Visit(name string, value any)
+	VisitEnum(name string, descriptor string, value string)
+	VisitAnnotation(name string, descriptor string) AnnotationVisitor
+	VisitArray(name string) AnnotationVisitor
+	VisitEnd()
+}
+
+type FieldVisitor interface {
+	VisitAnnotation(descriptor string, visible bool) AnnotationVisitor
+	VisitAttribute(attribute Attribute)
+	VisitEnd()
+}
+
+// MethodVisitor visits a method. Frames are always expanded: every VisitFrame call carries the complete
+// locals and stack, where each element is an ITEM_* constant, an internal name or the *Label of a NEW.
+// Attributes visited after VisitCode are attributes of the Code attribute, such as type annotations on
+// instructions. They are passed through as they are, so those holding code offsets only stay valid while the
+// code keeps its layout.
+type MethodVisitor interface {
+	VisitParameter(name string, access int)
+	VisitAnnotationDefault() AnnotationVisitor
+	VisitAnnotation(descriptor string, visible bool) AnnotationVisitor
+	VisitParameterAnnotation(parameter int, descriptor string, visible bool) AnnotationVisitor
+	VisitAttribute(attribute Attribute)
+	VisitCode()
+	VisitFrame(locals []any, stack []any)
+	VisitInsn(opcode int)
+	VisitIntInsn(opcode int, operand int)
+	VisitVarInsn(opcode int, index int)
+	VisitTypeInsn(opcode int, typ string)
+	VisitFieldInsn(opcode int, owner string, name string, descriptor string)
+	VisitMethodInsn(opcode int, owner string, name string, descriptor string, isInterface bool)
+	VisitInvokeDynamicInsn(name string, descriptor string, bootstrap Handle, arguments ...any)
+	VisitJumpInsn(opcode int, label *Label)
+	VisitLabel(label *Label)
+	VisitLdcInsn(value any)
+	VisitIincInsn(index int, increment int)
+	VisitTableSwitchInsn(min int, max int, dflt *Label, labels ...*Label)
+	VisitLookupSwitchInsn(dflt *Label, keys []int, labels []*Label)
+	VisitMultiANewArrayInsn(descriptor string, dimensions int)
+	VisitTryCatchBlock(start *Label, end *Label, handler *Label, typ string)
+	VisitLocalVariable(name string, descriptor string, signature string, start *Label, end *Label, index int)
+	VisitLineNumber(line int, start *Label)
+	VisitMaxs(maxStack int, maxLocals int)
+	VisitEnd()
+}
+
+type ClassVisitor interface {
+	Visit(version int, access int, name string, signature string, superName string, interfaces []string)
+	VisitSource(source string, debug string)
+	VisitNestHost(nestHost string)
+	VisitOuterClass(owner string, name string, descriptor string)
+	VisitAnnotation(descriptor string, visible bool) AnnotationVisitor
+	VisitAttribute(attribute Attribute)
+	VisitNestMember(nestMember string)
+	VisitPermittedSubclass(permittedSubclass string)
+	VisitInnerClass(name string, outerName string, innerName string, access int)
+	VisitField(access int, name string, descriptor string, signature string, value any) FieldVisitor
+	VisitMethod(access int, name string, descriptor string, signature string, exceptions []string) MethodVisitor
+	VisitEnd()
+}
+
+// ClassVisitorAdapter forwards every call to Next. Embed it to override only the calls a transform cares about.
+type ClassVisitorAdapter struct {
+	Next ClassVisitor
+}
+
+func (adapter *ClassVisitorAdapter) Visit(version int, access int, name string, signature string, superName string, interfaces []string) {
+	if adapter.Next != nil {
+		adapter.Next.Visit(version, access, name, signature, superName, interfaces)
+	}
+}
+
+func (adapter *ClassVisitorAdapter) VisitSource(source string, debug string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitSource(source, debug)
+	}
+}
+
+func (adapter *ClassVisitorAdapter) VisitNestHost(nestHost string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitNestHost(nestHost)
+	}
+}
+
+func (adapter *ClassVisitorAdapter) VisitOuterClass(owner string, name string, descriptor string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitOuterClass(owner, name, descriptor)
+	}
+}
+
+func (adapter *ClassVisitorAdapter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitAnnotation(descriptor, visible)
+	}
+	return nil
+}
+
+func (adapter *ClassVisitorAdapter) VisitAttribute(attribute Attribute) {
+	if adapter.Next != nil {
+		adapter.Next.VisitAttribute(attribute)
+	}
+}
+
+func (adapter *ClassVisitorAdapter) VisitNestMember(nestMember string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitNestMember(nestMember)
+	}
+}
+
+func (adapter *ClassVisitorAdapter) VisitPermittedSubclass(permittedSubclass string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitPermittedSubclass(permittedSubclass)
+	}
+}
+
+func (adapter *ClassVisitorAdapter) VisitInnerClass(name string, outerName string, innerName string, access int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitInnerClass(name, outerName, innerName, access)
+	}
+}
+
+func (adapter *ClassVisitorAdapter) VisitField(access int, name string, descriptor string, signature string, value any) FieldVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitField(access, name, descriptor, signature, value)
+	}
+	return nil
+}
+
+func (adapter *ClassVisitorAdapter) VisitMethod(access int, name string, descriptor string, signature string, exceptions []string) MethodVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitMethod(access, name, descriptor, signature, exceptions)
+	}
+	return nil
+}
+
+func (adapter *ClassVisitorAdapter) VisitEnd() {
+	if adapter.Next != nil {
+		adapter.Next.VisitEnd()
+	}
+}
+
+// FieldVisitorAdapter forwards every call to Next.
+type FieldVisitorAdapter struct {
+	Next FieldVisitor
+}
+
+func (adapter *FieldVisitorAdapter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitAnnotation(descriptor, visible)
+	}
+	return nil
+}
+
+func (adapter *FieldVisitorAdapter) VisitAttribute(attribute Attribute) {
+	if adapter.Next != nil {
+		adapter.Next.VisitAttribute(attribute)
+	}
+}
+
+func (adapter *FieldVisitorAdapter) VisitEnd() {
+	if adapter.Next != nil {
+		adapter.Next.VisitEnd()
+	}
+}
+
+// AnnotationVisitorAdapter forwards every call to Next.
+type AnnotationVisitorAdapter struct {
+	Next AnnotationVisitor
+}
+
+func (adapter *AnnotationVisitorAdapter) Visit(name string, value any) {
+	if adapter.Next != nil {
+		adapter.Next.Visit(name, value)
+	}
+}
+
+func (adapter *AnnotationVisitorAdapter) VisitEnum(name string, descriptor string, value string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitEnum(name, descriptor, value)
+	}
+}
+
+func (adapter *AnnotationVisitorAdapter) VisitAnnotation(name string, descriptor string) AnnotationVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitAnnotation(name, descriptor)
+	}
+	return nil
+}
+
+func (adapter *AnnotationVisitorAdapter) VisitArray(name string) AnnotationVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitArray(name)
+	}
+	return nil
+}
+
+func (adapter *AnnotationVisitorAdapter) VisitEnd() {
+	if adapter.Next != nil {
+		adapter.Next.VisitEnd()
+	}
+}
+
+// MethodVisitorAdapter forwards every call to Next.
+type MethodVisitorAdapter struct {
+	Next MethodVisitor
+}
+
+func (adapter *MethodVisitorAdapter) VisitParameter(name string, access int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitParameter(name, access)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitAnnotationDefault() AnnotationVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitAnnotationDefault()
+	}
+	return nil
+}
+
+func (adapter *MethodVisitorAdapter) VisitAnnotation(descriptor string, visible bool) AnnotationVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitAnnotation(descriptor, visible)
+	}
+	return nil
+}
+
+func (adapter *MethodVisitorAdapter) VisitParameterAnnotation(parameter int, descriptor string, visible bool) AnnotationVisitor {
+	if adapter.Next != nil {
+		return adapter.Next.VisitParameterAnnotation(parameter, descriptor, visible)
+	}
+	return nil
+}
+
+func (adapter *MethodVisitorAdapter) VisitAttribute(attribute Attribute) {
+	if adapter.Next != nil {
+		adapter.Next.VisitAttribute(attribute)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitCode() {
+	if adapter.Next != nil {
+		adapter.Next.VisitCode()
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitFrame(locals []any, stack []any) {
+	if adapter.Next != nil {
+		adapter.Next.VisitFrame(locals, stack)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitInsn(opcode int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitInsn(opcode)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitIntInsn(opcode int, operand int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitIntInsn(opcode, operand)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitVarInsn(opcode int, index int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitVarInsn(opcode, index)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitTypeInsn(opcode int, typ string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitTypeInsn(opcode, typ)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitFieldInsn(opcode int, owner string, name string, descriptor string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitFieldInsn(opcode, owner, name, descriptor)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitMethodInsn(opcode int, owner string, name string, descriptor string, isInterface bool) {
+	if adapter.Next != nil {
+		adapter.Next.VisitMethodInsn(opcode, owner, name, descriptor, isInterface)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitInvokeDynamicInsn(name string, descriptor string, bootstrap Handle, arguments ...any) {
+	if adapter.Next != nil {
+		adapter.Next.VisitInvokeDynamicInsn(name, descriptor, bootstrap, arguments...)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitJumpInsn(opcode int, label *Label) {
+	if adapter.Next != nil {
+		adapter.Next.VisitJumpInsn(opcode, label)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitLabel(label *Label) {
+	if adapter.Next != nil {
+		adapter.Next.VisitLabel(label)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitLdcInsn(value any) {
+	if adapter.Next != nil {
+		adapter.Next.VisitLdcInsn(value)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitIincInsn(index int, increment int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitIincInsn(index, increment)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitTableSwitchInsn(min int, max int, dflt *Label, labels ...*Label) {
+	if adapter.Next != nil {
+		adapter.Next.VisitTableSwitchInsn(min, max, dflt, labels...)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitLookupSwitchInsn(dflt *Label, keys []int, labels []*Label) {
+	if adapter.Next != nil {
+		adapter.Next.VisitLookupSwitchInsn(dflt, keys, labels)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitMultiANewArrayInsn(descriptor string, dimensions int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitMultiANewArrayInsn(descriptor, dimensions)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitTryCatchBlock(start *Label, end *Label, handler *Label, typ string) {
+	if adapter.Next != nil {
+		adapter.Next.VisitTryCatchBlock(start, end, handler, typ)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitLocalVariable(name string, descriptor string, signature string, start *Label, end *Label, index int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitLocalVariable(name, descriptor, signature, start, end, index)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitLineNumber(line int, start *Label) {
+	if adapter.Next != nil {
+		adapter.Next.VisitLineNumber(line, start)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitMaxs(maxStack int, maxLocals int) {
+	if adapter.Next != nil {
+		adapter.Next.VisitMaxs(maxStack, maxLocals)
+	}
+}
+
+func (adapter *MethodVisitorAdapter) VisitEnd() {
+	if adapter.Next != nil {
+		adapter.Next.VisitEnd()
+	}
+}
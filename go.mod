@@ -2,12 +2,16 @@ module github.com/mrnavastar/babe
 
 go 1.22
 
-require github.com/mrnavastar/assist v0.0.0-20240622221548-0d5c64e8331b
+require (
+	github.com/mrnavastar/assist v0.0.0-20240622221548-0d5c64e8331b
+	github.com/urfave/cli/v2 v2.27.2
+	golang.org/x/sync v0.7.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
+)
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.4 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
-	github.com/urfave/cli/v2 v2.27.2 // indirect
 	github.com/xrash/smetrics v0.0.0-20240312152122-5f08fbb34913 // indirect
-	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/crypto v0.11.0 // indirect
 )